@@ -3,11 +3,12 @@ set -e
 
 cd "$( dirname "${BASH_SOURCE[0]}" )"
 mkdir -p ./bin
+version="$(git describe --tags --always --dirty 2>/dev/null || echo dev)"
 
 for arch in "amd64" "386"; do
     for os in "linux"; do
         export GOARCH="$arch"
         export GOOS="$os"
-        go build -o bin/l2bridge-driver.$os.$arch
+        go build -ldflags "-X github.com/nategraf/l2bridge-driver/l2bridge.Version=$version" -o bin/l2bridge-driver.$os.$arch
     done
 done
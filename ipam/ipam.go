@@ -0,0 +1,343 @@
+// Package ipam implements an IPAM driver handing out addresses of physical subnets that l2bridge networks are bridged
+// onto. The real gateway of a subnet is reserved rather than given to the bridge, and an address is only handed out
+// once no host already on the wire answers for it.
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	plugin "github.com/docker/go-plugins-helpers/ipam"
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	localAddressSpace  = "l2bridge-local"
+	globalAddressSpace = "l2bridge-global"
+	stateFileName      = "ipam.json"
+
+	// Keys libnetwork uses in address requests and pool data.
+	requestAddressType = "RequestAddressType"
+	gatewayAddressType = "com.docker.network.gateway"
+)
+
+// pool is a subnet handed out from, as persisted across restarts.
+type pool struct {
+	ID           string          `json:"id"`
+	AddressSpace string          `json:"address_space"`
+	Subnet       *net.IPNet      `json:"subnet"`
+	Range        *net.IPNet      `json:"range,omitempty"`
+	Gateway      net.IP          `json:"gateway"`
+	ProbeIface   string          `json:"probe_iface,omitempty"`
+	Allocated    map[string]bool `json:"allocated"` // key: address
+}
+
+// Driver is the IPAM driver. Its pools are persisted under the driver's data root, next to the state of the network
+// driver, so that both are restored together.
+type Driver struct {
+	mu        sync.Mutex
+	pools     map[string]*pool // key: pool id
+	statePath string
+	probe     func(iface string, ip net.IP) (bool, error)
+}
+
+// NewDriver constructs an IPAM driver persisting its pools under dataRoot, restoring those persisted before. An empty
+// dataRoot disables persistence.
+func NewDriver(dataRoot string) *Driver {
+	d := &Driver{pools: map[string]*pool{}, probe: probeAddress}
+	if dataRoot != "" {
+		d.statePath = filepath.Join(dataRoot, stateFileName)
+	}
+	if err := d.restore(); err != nil {
+		logrus.WithError(err).Warn("Failed to restore IPAM state")
+	}
+	return d
+}
+
+// Serve handles IPAM plugin requests on the given unix socket until an error occurs.
+func (d *Driver) Serve(socketAddress string) error {
+	return plugin.NewHandler(d).ServeUnix(socketAddress, 0)
+}
+
+func (d *Driver) GetCapabilities() (*plugin.CapabilitiesResponse, error) {
+	return &plugin.CapabilitiesResponse{RequiresMACAddress: false}, nil
+}
+
+func (d *Driver) GetDefaultAddressSpaces() (*plugin.AddressSpacesResponse, error) {
+	return &plugin.AddressSpacesResponse{
+		LocalDefaultAddressSpace:  localAddressSpace,
+		GlobalDefaultAddressSpace: globalAddressSpace,
+	}, nil
+}
+
+// RequestPool registers the physical subnet given with --subnet, optionally restricted to the range given with
+// --ip-range. The subnet's gateway is its first address unless given with the l2bridge.ipam.gateway option.
+func (d *Driver) RequestPool(req *plugin.RequestPoolRequest) (*plugin.RequestPoolResponse, error) {
+	if req.Pool == "" {
+		return nil, types.BadRequestErrorf("the l2bridge IPAM driver has no default pools, give the physical subnet with --subnet")
+	}
+	_, subnet, err := net.ParseCIDR(req.Pool)
+	if err != nil {
+		return nil, types.BadRequestErrorf("invalid pool %s: %v", req.Pool, err)
+	}
+	p := &pool{
+		ID:           req.AddressSpace + "/" + subnet.String(),
+		AddressSpace: req.AddressSpace,
+		Subnet:       subnet,
+		ProbeIface:   req.Options[label.IPAMProbeIface],
+		Allocated:    map[string]bool{},
+	}
+	if req.SubPool != "" {
+		if _, p.Range, err = net.ParseCIDR(req.SubPool); err != nil {
+			return nil, types.BadRequestErrorf("invalid range %s: %v", req.SubPool, err)
+		}
+		if !subnet.Contains(p.Range.IP) {
+			return nil, types.BadRequestErrorf("range %s is outside of pool %s", p.Range, subnet)
+		}
+	}
+	if gw, ok := req.Options[label.IPAMGateway]; ok {
+		if p.Gateway = net.ParseIP(gw); p.Gateway == nil || !subnet.Contains(p.Gateway) {
+			return nil, types.BadRequestErrorf("invalid %s %s: not an address of pool %s", label.IPAMGateway, gw, subnet)
+		}
+	} else {
+		first, _ := netutils.NetworkRange(subnet)
+		p.Gateway = nextIP(first)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, other := range d.pools {
+		if other.AddressSpace == p.AddressSpace && netutils.NetworkOverlaps(other.Subnet, subnet) {
+			return nil, types.ForbiddenErrorf("pool %s overlaps pool %s already in use", subnet, other.Subnet)
+		}
+	}
+	d.pools[p.ID] = p
+	d.storeSync("pool request")
+
+	logrus.Infof("Registered IPAM pool %s with gateway %s", p.ID, p.Gateway)
+	return &plugin.RequestPoolResponse{
+		PoolID: p.ID,
+		Pool:   subnet.String(),
+		Data:   map[string]string{gatewayAddressType: withMask(p.Gateway, subnet)},
+	}, nil
+}
+
+func (d *Driver) ReleasePool(req *plugin.ReleasePoolRequest) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.pools[req.PoolID]; !ok {
+		return types.NotFoundErrorf("pool %s does not exist", req.PoolID)
+	}
+	delete(d.pools, req.PoolID)
+	d.storeSync("pool release")
+	logrus.Infof("Released IPAM pool %s", req.PoolID)
+	return nil
+}
+
+// RequestAddress hands out the requested address if free, or else the first free address of the pool that no host
+// on the wire answers for. A request for the gateway is answered with the reserved gateway.
+func (d *Driver) RequestAddress(req *plugin.RequestAddressRequest) (*plugin.RequestAddressResponse, error) {
+	d.mu.Lock()
+	p, ok := d.pools[req.PoolID]
+	d.mu.Unlock()
+	if !ok {
+		return nil, types.NotFoundErrorf("pool %s does not exist", req.PoolID)
+	}
+
+	if req.Options[requestAddressType] == gatewayAddressType {
+		return &plugin.RequestAddressResponse{Address: withMask(p.Gateway, p.Subnet)}, nil
+	}
+
+	if req.Address != "" {
+		ip := net.ParseIP(req.Address)
+		if ip == nil || !p.Subnet.Contains(ip) {
+			return nil, types.BadRequestErrorf("requested address %s is outside of pool %s", req.Address, p.Subnet)
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if p.reserved(ip) {
+			return nil, types.ForbiddenErrorf("requested address %s is reserved", ip)
+		}
+		if p.Allocated[ip.String()] {
+			return nil, types.ForbiddenErrorf("requested address %s is already allocated", ip)
+		}
+		p.Allocated[ip.String()] = true
+		d.storeSync("address request")
+		return &plugin.RequestAddressResponse{Address: withMask(ip, p.Subnet)}, nil
+	}
+
+	from := p.Subnet
+	if p.Range != nil {
+		from = p.Range
+	}
+	first, _ := netutils.NetworkRange(from)
+	for ip := first; from.Contains(ip); ip = nextIP(ip) {
+		d.mu.Lock()
+		taken := p.reserved(ip) || p.Allocated[ip.String()]
+		d.mu.Unlock()
+		if taken || d.inUse(p, ip) {
+			continue
+		}
+
+		d.mu.Lock()
+		// The address may have been handed out while probing.
+		if p.Allocated[ip.String()] {
+			d.mu.Unlock()
+			continue
+		}
+		p.Allocated[ip.String()] = true
+		d.storeSync("address request")
+		d.mu.Unlock()
+		return &plugin.RequestAddressResponse{Address: withMask(ip, p.Subnet)}, nil
+	}
+	return nil, types.NoServiceErrorf("no free address left in pool %s", from)
+}
+
+func (d *Driver) ReleaseAddress(req *plugin.ReleaseAddressRequest) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.pools[req.PoolID]
+	if !ok {
+		return types.NotFoundErrorf("pool %s does not exist", req.PoolID)
+	}
+	ip := net.ParseIP(req.Address)
+	if ip == nil {
+		return types.BadRequestErrorf("invalid address %s", req.Address)
+	}
+	delete(p.Allocated, ip.String())
+	d.storeSync("address release")
+	return nil
+}
+
+// PoolGateway returns the gateway reserved for the pool with the given subnet, or nil if the driver has no such pool.
+func (d *Driver) PoolGateway(subnet *net.IPNet) net.IP {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, p := range d.pools {
+		if p.Subnet.String() == subnet.String() {
+			return p.Gateway
+		}
+	}
+	return nil
+}
+
+// reserved reports whether ip is never handed out: the gateway, the network address, which is the subnet-router
+// anycast address of an IPv6 subnet, and the broadcast address of an IPv4 subnet.
+func (p *pool) reserved(ip net.IP) bool {
+	first, last := netutils.NetworkRange(p.Subnet)
+	if ip.Equal(p.Gateway) || ip.Equal(first) {
+		return true
+	}
+	return ip.To4() != nil && ip.Equal(last)
+}
+
+// inUse reports whether a host on the wire already answers for ip. Only IPv4 addresses are probed, and only if the
+// pool names the interface to probe through; a failed probe is logged and the address considered free.
+func (d *Driver) inUse(p *pool, ip net.IP) bool {
+	if p.ProbeIface == "" || ip.To4() == nil {
+		return false
+	}
+	used, err := d.probe(p.ProbeIface, ip)
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to probe for address %s on %s", ip, p.ProbeIface)
+		return false
+	}
+	if used {
+		logrus.Infof("Skipping address %s of pool %s, already in use on the wire", ip, p.ID)
+	}
+	return used
+}
+
+// probeAddress runs ARP duplicate address detection for ip through iface, reporting whether a host answered.
+func probeAddress(iface string, ip net.IP) (bool, error) {
+	err := exec.Command("arping", "-D", "-q", "-c", "2", "-w", "2", "-I", iface, ip.String()).Run()
+	if err == nil {
+		return false, nil
+	}
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func withMask(ip net.IP, subnet *net.IPNet) string {
+	return (&net.IPNet{IP: ip, Mask: subnet.Mask}).String()
+}
+
+// storeSync persists the pools after a change, logging rather than failing the request if it cannot. The caller
+// must hold the lock.
+func (d *Driver) storeSync(change string) {
+	if err := d.store(); err != nil {
+		logrus.WithError(err).Warnf("Failed to save IPAM state after %s", change)
+	}
+}
+
+func (d *Driver) store() error {
+	if d.statePath == "" {
+		return nil
+	}
+	pools := make([]*pool, 0, len(d.pools))
+	for _, p := range d.pools {
+		pools = append(pools, p)
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].ID < pools[j].ID })
+	data, err := json.Marshal(pools)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.statePath), 0700); err != nil {
+		return err
+	}
+	tmp := d.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.statePath)
+}
+
+func (d *Driver) restore() error {
+	if d.statePath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(d.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var pools []*pool
+	if err := json.Unmarshal(data, &pools); err != nil {
+		return fmt.Errorf("invalid IPAM state %s: %v", d.statePath, err)
+	}
+	for _, p := range pools {
+		if p.Allocated == nil {
+			p.Allocated = map[string]bool{}
+		}
+		d.pools[p.ID] = p
+	}
+	logrus.Infof("Restored %d IPAM pools", len(pools))
+	return nil
+}
@@ -0,0 +1,75 @@
+package l2bridge
+
+import (
+	"github.com/docker/libnetwork/types"
+)
+
+// AdoptMigratedEndpoint recreates on this host an endpoint that lived on another, keeping the address and MAC it
+// was given there rather than asking for a fresh allocation. The endpoint then awaits its sandbox, which may join it
+// directly, or claim it with a CreateEndpoint request carrying the same addresses.
+func (d *bridgeDriver) AdoptMigratedEndpoint(nid, eid string, ei EndpointInterface) error {
+	if ei.Address == nil || ei.MacAddress == nil {
+		return types.BadRequestErrorf("adopting endpoint %s requires both its address and MAC address", eid)
+	}
+	defer d.lockNetwork(nid)()
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	n.config.fillEndpointPrefix(&ei)
+	if err := n.config.validateEndpointAddress(&ei); err != nil {
+		return err
+	}
+
+	n.Lock()
+	for _, other := range n.endpoints {
+		for _, ip := range other.addresses() {
+			if ip.Equal(ei.Address.IP) || (ei.AddressIPv6 != nil && ip.Equal(ei.AddressIPv6.IP)) {
+				n.Unlock()
+				return types.ForbiddenErrorf("address %s is already allocated to endpoint %s", ip, other.id)
+			}
+		}
+	}
+	n.Unlock()
+
+	if _, err := d.createEndpoint(nid, eid, &ei, nil); err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	n.Lock()
+	ep.adopted = true
+	n.Unlock()
+	d.storeSync("endpoint adoption")
+	return nil
+}
+
+// claimAdopted hands an adopted endpoint over to the CreateEndpoint request arriving with the migrated sandbox,
+// provided the request agrees with the adopted addresses.
+func (n *bridgeNetwork) claimAdopted(ep *bridgeEndpoint, ei *EndpointInterface) (*EndpointInterface, error) {
+	n.Lock()
+	defer n.Unlock()
+
+	if (ei.Address != nil && !ei.Address.IP.Equal(ep.addr.IP)) ||
+		(ei.AddressIPv6 != nil && (ep.addrv6 == nil || !ei.AddressIPv6.IP.Equal(ep.addrv6.IP))) ||
+		(ei.MacAddress != nil && ei.MacAddress.String() != ep.macAddress.String()) {
+		return nil, types.ForbiddenErrorf("endpoint %s was adopted with different addresses", ep.id)
+	}
+	ep.adopted = false
+
+	out := &EndpointInterface{}
+	if ei.Address == nil {
+		out.Address = ep.addr
+	}
+	if ei.AddressIPv6 == nil {
+		out.AddressIPv6 = ep.addrv6
+	}
+	if ei.MacAddress == nil {
+		out.MacAddress = ep.macAddress
+	}
+	return out, nil
+}
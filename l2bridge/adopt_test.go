@@ -0,0 +1,114 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestAdoptMigratedEndpoint(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:0a:01:00:05")
+	other, _ := net.ParseMAC("02:42:0a:01:00:06")
+	tests := []struct {
+		name       string
+		ei         EndpointInterface
+		badRequest bool
+		forbidden  bool
+	}{
+		{name: "address and MAC", ei: EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16"), MacAddress: mac}},
+		{name: "prefix filled in", ei: EndpointInterface{Address: &net.IPNet{IP: net.ParseIP("10.1.0.5").To4()}, MacAddress: mac}},
+		{name: "no MAC", ei: EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16")}, badRequest: true},
+		{name: "no address", ei: EndpointInterface{MacAddress: mac}, badRequest: true},
+		{name: "outside the pool", ei: EndpointInterface{Address: mustCIDR(t, "10.2.0.5/16"), MacAddress: mac}, badRequest: true},
+		{name: "address taken", ei: EndpointInterface{Address: mustCIDR(t, "10.1.0.2/16"), MacAddress: other}, forbidden: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), &EndpointInterface{Address: mustCIDR(t, "10.1.0.2/16")}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			err := d.AdoptMigratedEndpoint(testID(1), testID(3), tt.ei)
+			switch {
+			case tt.badRequest:
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+			case tt.forbidden:
+				if _, ok := err.(types.ForbiddenError); !ok {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				info, err := d.EndpointInfo(testID(1), testID(3))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info[label.IPv4Address] != "10.1.0.5/16" || info[label.MACAddress] != mac.String() {
+					t.Errorf("expected the endpoint adopted with 10.1.0.5/16 and %s, got %v", mac, info)
+				}
+			}
+		})
+	}
+}
+
+func TestAdoptThenCreateAndJoin(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:0a:01:00:05")
+	tests := []struct {
+		name      string
+		ei        EndpointInterface
+		forbidden bool
+	}{
+		{name: "empty request"},
+		{name: "matching request", ei: EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16"), MacAddress: mac}},
+		{name: "different address", ei: EndpointInterface{Address: mustCIDR(t, "10.1.0.6/16")}, forbidden: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.AdoptMigratedEndpoint(testID(1), testID(2), EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16"), MacAddress: mac}); err != nil {
+				t.Fatal(err)
+			}
+
+			ei := tt.ei
+			res, err := d.CreateEndpoint(ctx, testID(1), testID(2), &ei, nil)
+			if tt.forbidden {
+				if _, ok := err.(types.ForbiddenError); !ok {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.ei.Address == nil && (res.Address == nil || res.Address.String() != "10.1.0.5/16") {
+				t.Errorf("expected the adopted address returned, got %+v", res)
+			}
+			if tt.ei.MacAddress == nil && res.MacAddress.String() != mac.String() {
+				t.Errorf("expected the adopted MAC returned, got %+v", res)
+			}
+			if _, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/test", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// Once claimed, the endpoint is no longer handed over.
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), &EndpointInterface{}, nil); err == nil {
+				t.Error("expected creating the claimed endpoint again to fail")
+			}
+		})
+	}
+}
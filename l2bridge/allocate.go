@@ -0,0 +1,71 @@
+package l2bridge
+
+import (
+	"fmt"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+// AllocateNetwork validates and reserves the configuration of a swarm scoped network on a manager. Swarm managers only
+// call it on a driver configured with GlobalScope. Nothing is created on the host, since each node creates the bridge
+// itself when CreateNetwork is called there. The returned options are passed on to the CreateNetwork call of every
+// node.
+func (d *bridgeDriver) AllocateNetwork(id string, options map[string]string, ipV4Data, ipV6Data []*IPAMData) (map[string]string, error) {
+	if len(id) < 12 {
+		return nil, types.BadRequestErrorf("invalid network id: %s", id)
+	}
+
+	labels := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		labels[k] = v
+	}
+	config, err := parseNetworkGenericOptions(labels)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.BridgeName == "" {
+		config.BridgeName = "br-" + id[:12]
+	}
+	config.ID = id
+
+	if err = config.processIPAM(id, ipV4Data, ipV6Data); err != nil {
+		return nil, err
+	}
+
+	d.Lock()
+	if _, ok := d.allocated[id]; ok {
+		d.Unlock()
+		return nil, types.ForbiddenErrorf("network %s is already allocated", id)
+	}
+	d.allocated[id] = config
+	d.Unlock()
+
+	// The allocation must outlive a restart of the driver, so that it is neither allocated twice nor lost.
+	if err = d.storeUpdate(); err != nil {
+		d.Lock()
+		delete(d.allocated, id)
+		d.Unlock()
+		return nil, fmt.Errorf("failed to save allocation of network %s to store: %w", id, err)
+	}
+
+	// Nodes must agree on the bridge name. It is passed apart from l2bridge.name, so that a node tells it from a name
+	// given by the user.
+	return map[string]string{label.AllocatedBridgeName: config.BridgeName}, nil
+}
+
+// FreeNetwork releases the configuration reserved by AllocateNetwork.
+func (d *bridgeDriver) FreeNetwork(id string) error {
+	d.Lock()
+	if _, ok := d.allocated[id]; !ok {
+		d.Unlock()
+		return types.InternalMaskableErrorf("network %s is not allocated", id)
+	}
+	delete(d.allocated, id)
+	d.Unlock()
+	d.storeSync("network free")
+	return nil
+}
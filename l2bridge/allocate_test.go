@@ -0,0 +1,168 @@
+package l2bridge
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestAllocateNetwork(t *testing.T) {
+	d := newDryRunDriver()
+	ipv4 := testIPAMData(t, "10.1.0.0/16")
+	steps := []struct {
+		name  string
+		do    func() (map[string]string, error)
+		want  map[string]string
+		check func(error) bool
+	}{
+		{
+			name: "allocate",
+			do:   func() (map[string]string, error) { return d.AllocateNetwork(testID(1), nil, ipv4, nil) },
+			want: map[string]string{label.AllocatedBridgeName: "br-" + testID(1)[:12]},
+		},
+		{
+			name: "allocate with a bridge name",
+			do: func() (map[string]string, error) {
+				return d.AllocateNetwork(testID(2), map[string]string{label.BridgeName: "l2b-swarm"}, ipv4, nil)
+			},
+			want: map[string]string{label.AllocatedBridgeName: "l2b-swarm"},
+		},
+		{
+			name:  "double allocate",
+			do:    func() (map[string]string, error) { return d.AllocateNetwork(testID(1), nil, ipv4, nil) },
+			check: func(err error) bool { _, ok := err.(types.ForbiddenError); return ok },
+		},
+		{
+			name: "invalid option",
+			do: func() (map[string]string, error) {
+				return d.AllocateNetwork(testID(3), map[string]string{label.BridgeName: "a-name-too-long-for-linux"}, ipv4, nil)
+			},
+			check: func(err error) bool { _, ok := err.(types.BadRequestError); return ok },
+		},
+		{
+			name: "free",
+			do:   func() (map[string]string, error) { return nil, d.FreeNetwork(testID(1)) },
+		},
+		{
+			name:  "free twice",
+			do:    func() (map[string]string, error) { return nil, d.FreeNetwork(testID(1)) },
+			check: func(err error) bool { _, ok := err.(types.MaskableError); return ok },
+		},
+		{
+			name:  "free unknown",
+			do:    func() (map[string]string, error) { return nil, d.FreeNetwork(testID(9)) },
+			check: func(err error) bool { _, ok := err.(types.MaskableError); return ok },
+		},
+		{
+			name: "allocate again after free",
+			do:   func() (map[string]string, error) { return d.AllocateNetwork(testID(1), nil, ipv4, nil) },
+			want: map[string]string{label.AllocatedBridgeName: "br-" + testID(1)[:12]},
+		},
+	}
+	for _, step := range steps {
+		got, err := step.do()
+		if step.check != nil {
+			if !step.check(err) {
+				t.Errorf("%s: unexpected error %v", step.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", step.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: expected options %v, got %v", step.name, step.want, got)
+		}
+	}
+
+	// Allocation leaves the host alone.
+	if links, _ := d.nlh.LinkList(); len(links) != 0 {
+		t.Errorf("expected no links created, got %d", len(links))
+	}
+	if len(d.getNetworks()) != 0 {
+		t.Errorf("expected no networks created, got %d", len(d.getNetworks()))
+	}
+}
+
+// TestAllocateNetworkRestored checks allocations are persisted, so that a restarted manager still refuses to allocate
+// a network twice and frees it.
+func TestAllocateNetworkRestored(t *testing.T) {
+	dataRoot := t.TempDir()
+	newDriver := func() *bridgeDriver {
+		d := newDryRunDriver()
+		d.config.DryRun, d.config.DataRoot = false, dataRoot
+		if err := d.restoreState(); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	d := newDriver()
+	if _, err := d.AllocateNetwork(testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	d = newDriver()
+	if _, err := d.AllocateNetwork(testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err == nil {
+		t.Error("expected the restored allocation to refuse a double allocate")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Errorf("expected a ForbiddenError, got %v", err)
+	}
+	if err := d.FreeNetwork(testID(1)); err != nil {
+		t.Errorf("expected the restored allocation freed, got %v", err)
+	}
+
+	d = newDriver()
+	if err := d.FreeNetwork(testID(1)); err == nil {
+		t.Error("expected the free persisted")
+	}
+}
+
+func TestCreateNetworkAllocatedName(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]interface{}
+		want   string
+	}{
+		{name: "derived", labels: map[string]interface{}{}, want: "br-" + testID(1)[:12]},
+		{name: "allocated", labels: map[string]interface{}{label.AllocatedBridgeName: "l2b-swarm"}, want: "l2b-swarm"},
+		{name: "given", labels: map[string]interface{}{label.AllocatedBridgeName: "l2b-swarm", label.BridgeName: "l2b-mine"},
+			want: "l2b-mine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			opts := map[string]interface{}{netlabel.GenericData: tt.labels}
+			if err := d.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			n, _ := d.getNetwork(testID(1))
+			if n.config.BridgeName != tt.want {
+				t.Errorf("expected bridge %s, got %s", tt.want, n.config.BridgeName)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesScope(t *testing.T) {
+	for _, global := range []bool{false, true} {
+		d := NewDriver(&Configuration{DryRun: true, GlobalScope: global})
+		res, err := d.GetCapabilities()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := network.LocalScope
+		if global {
+			want = network.GlobalScope
+		}
+		if res.Scope != want || res.ConnectivityScope != network.LocalScope {
+			t.Errorf("global scope %v: expected scope %s with local connectivity, got %+v", global, want, res)
+		}
+	}
+}
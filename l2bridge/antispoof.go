@@ -0,0 +1,94 @@
+package l2bridge
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ebtables runs the ethernet bridge frame table utility with the given arguments.
+func ebtables(args ...string) error {
+	if out, err := runCommand("ebtables", args...); err != nil {
+		return fmt.Errorf("ebtables %s failed: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// antispoofChain is the name of the ebtables chain filtering frames sent by the endpoint.
+func (ep *bridgeEndpoint) antispoofChain() string {
+	return "L2B-" + ep.hostIfName
+}
+
+// antispoofRules returns the rules of the endpoint's chain. Frames from another source MAC, and IPv4, ARP or IPv6
+// packets from addresses other than the endpoint's, are dropped. IPv6 link-local and unspecified sources remain
+// allowed so that neighbor discovery keeps working.
+func (ep *bridgeEndpoint) antispoofRules() [][]string {
+	rules := [][]string{
+		{"-s", "!", ep.macAddress.String(), "-j", "DROP"},
+	}
+	if ep.addr != nil {
+		rules = append(rules,
+			[]string{"-p", "IPv4", "--ip-src", ep.addr.IP.String(), "-j", "RETURN"},
+			[]string{"-p", "IPv4", "-j", "DROP"},
+			[]string{"-p", "ARP", "--arp-ip-src", ep.addr.IP.String(), "-j", "RETURN"},
+			[]string{"-p", "ARP", "--arp-ip-src", "0.0.0.0", "-j", "RETURN"},
+			[]string{"-p", "ARP", "-j", "DROP"},
+		)
+	}
+	if ep.addrv6 != nil {
+		rules = append(rules,
+			[]string{"-p", "IPv6", "--ip6-src", ep.addrv6.IP.String(), "-j", "RETURN"},
+			[]string{"-p", "IPv6", "--ip6-src", "fe80::/10", "-j", "RETURN"},
+			[]string{"-p", "IPv6", "--ip6-src", "::", "-j", "RETURN"},
+			[]string{"-p", "IPv6", "-j", "DROP"},
+		)
+	}
+	return rules
+}
+
+// validateAntispoof checks that the endpoint has the addresses its anti-spoofing rules are built from.
+func (ep *bridgeEndpoint) validateAntispoof() error {
+	if ep.macAddress == nil {
+		return fmt.Errorf("endpoint has no MAC address")
+	}
+	if ep.addr == nil && ep.addrv6 == nil {
+		return fmt.Errorf("endpoint has no IP address")
+	}
+	return nil
+}
+
+// setupAntispoof installs the endpoint's chain and sends every frame received from its host interface through it.
+func (ep *bridgeEndpoint) setupAntispoof() error {
+	chain := ep.antispoofChain()
+	if err := ebtables("-N", chain, "-P", "RETURN"); err != nil {
+		return err
+	}
+	for _, rule := range ep.antispoofRules() {
+		if err := ebtables(append([]string{"-A", chain}, rule...)...); err != nil {
+			return err
+		}
+	}
+	for _, hook := range []string{"FORWARD", "INPUT"} {
+		if err := ebtables("-I", hook, "-i", ep.hostIfName, "-j", chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeAntispoof removes everything installed by setupAntispoof, continuing past failures.
+func (ep *bridgeEndpoint) removeAntispoof() error {
+	chain := ep.antispoofChain()
+	var errs []string
+	for _, hook := range []string{"FORWARD", "INPUT"} {
+		if err := ebtables("-D", hook, "-i", ep.hostIfName, "-j", chain); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := ebtables("-X", chain); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package l2bridge
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// antispoofFrame is a frame sent by a container, with the source addresses the anti-spoofing rules match on.
+type antispoofFrame struct {
+	mac   string
+	proto string // IPv4, ARP or IPv6
+	src   string
+}
+
+// antispoofVerdict runs the frame through the rules as ebtables would, returning the target of the first matching
+// rule, or RETURN, the chain policy, if none matches.
+func antispoofVerdict(t *testing.T, rules [][]string, f antispoofFrame) string {
+	for _, rule := range rules {
+		match := true
+		for j := 0; j < len(rule)-2; j++ {
+			switch rule[j] {
+			case "-s":
+				if rule[j+1] == "!" {
+					j++
+					match = match && !strings.EqualFold(rule[j+1], f.mac)
+				} else {
+					match = match && strings.EqualFold(rule[j+1], f.mac)
+				}
+				j++
+			case "-p":
+				match = match && rule[j+1] == f.proto
+				j++
+			case "--ip-src", "--arp-ip-src", "--ip6-src":
+				match = match && srcMatches(t, rule[j+1], f.src)
+				j++
+			default:
+				t.Fatalf("unexpected match %s in rule %v", rule[j], rule)
+			}
+		}
+		if rule[len(rule)-2] != "-j" {
+			t.Fatalf("rule %v has no target", rule)
+		}
+		if match {
+			return rule[len(rule)-1]
+		}
+	}
+	return "RETURN"
+}
+
+func srcMatches(t *testing.T, want, src string) bool {
+	ip := net.ParseIP(src)
+	if strings.Contains(want, "/") {
+		_, subnet, err := net.ParseCIDR(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return subnet.Contains(ip)
+	}
+	return net.ParseIP(want).Equal(ip)
+}
+
+func TestAntispoofRules(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:0a:01:00:02")
+	ep := &bridgeEndpoint{
+		hostIfName: "veth1",
+		macAddress: mac,
+		addr:       &net.IPNet{IP: net.ParseIP("10.1.0.2").To4(), Mask: net.CIDRMask(16, 32)},
+		addrv6:     &net.IPNet{IP: net.ParseIP("2001:db8:1::2"), Mask: net.CIDRMask(64, 128)},
+	}
+	const own = "02:42:0a:01:00:02"
+	tests := []struct {
+		name  string
+		frame antispoofFrame
+		drop  bool
+	}{
+		{name: "own IPv4", frame: antispoofFrame{own, "IPv4", "10.1.0.2"}},
+		{name: "own IPv6", frame: antispoofFrame{own, "IPv6", "2001:db8:1::2"}},
+		{name: "own ARP", frame: antispoofFrame{own, "ARP", "10.1.0.2"}},
+		{name: "ARP probe", frame: antispoofFrame{own, "ARP", "0.0.0.0"}},
+		{name: "link-local IPv6", frame: antispoofFrame{own, "IPv6", "fe80::42:aff:fe01:2"}},
+		{name: "unspecified IPv6", frame: antispoofFrame{own, "IPv6", "::"}},
+		{name: "spoofed MAC", frame: antispoofFrame{"02:42:0a:01:00:03", "IPv4", "10.1.0.2"}, drop: true},
+		{name: "spoofed IPv4", frame: antispoofFrame{own, "IPv4", "10.1.0.3"}, drop: true},
+		{name: "spoofed ARP", frame: antispoofFrame{own, "ARP", "10.1.0.1"}, drop: true},
+		{name: "spoofed IPv6", frame: antispoofFrame{own, "IPv6", "2001:db8:1::3"}, drop: true},
+	}
+	rules := ep.antispoofRules()
+	for _, tt := range tests {
+		if got := antispoofVerdict(t, rules, tt.frame); (got == "DROP") != tt.drop {
+			t.Errorf("%s: expected drop %v, got %s", tt.name, tt.drop, got)
+		}
+	}
+
+	// Without an IPv6 address, every IPv6 source passes as the endpoint may autoconfigure addresses.
+	ep.addrv6 = nil
+	if got := antispoofVerdict(t, ep.antispoofRules(), antispoofFrame{own, "IPv6", "2001:db8:1::3"}); got == "DROP" {
+		t.Errorf("expected IPv6 not filtered without an IPv6 address, got %s", got)
+	}
+}
+
+func TestValidateAntispoof(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:0a:01:00:02")
+	addr := &net.IPNet{IP: net.ParseIP("10.1.0.2").To4(), Mask: net.CIDRMask(16, 32)}
+	addrv6 := &net.IPNet{IP: net.ParseIP("2001:db8:1::2"), Mask: net.CIDRMask(64, 128)}
+	tests := []struct {
+		name string
+		ep   *bridgeEndpoint
+		err  bool
+	}{
+		{name: "IPv4", ep: &bridgeEndpoint{macAddress: mac, addr: addr}},
+		{name: "IPv6", ep: &bridgeEndpoint{macAddress: mac, addrv6: addrv6}},
+		{name: "no MAC", ep: &bridgeEndpoint{addr: addr}, err: true},
+		{name: "no address", ep: &bridgeEndpoint{macAddress: mac}, err: true},
+	}
+	for _, tt := range tests {
+		if err := tt.ep.validateAntispoof(); (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestAntispoofSetupAndRemove(t *testing.T) {
+	cmds := recordCommands(t)
+	mac, _ := net.ParseMAC("02:42:0a:01:00:02")
+	ep := &bridgeEndpoint{hostIfName: "veth1", macAddress: mac, addr: &net.IPNet{IP: net.ParseIP("10.1.0.2").To4(), Mask: net.CIDRMask(16, 32)}}
+	if err := ep.setupAntispoof(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ebtables -N L2B-veth1 -P RETURN"}
+	for _, rule := range ep.antispoofRules() {
+		want = append(want, "ebtables -A L2B-veth1 "+strings.Join(rule, " "))
+	}
+	want = append(want, "ebtables -I FORWARD -i veth1 -j L2B-veth1", "ebtables -I INPUT -i veth1 -j L2B-veth1")
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(*cmds, "\n"))
+	}
+
+	*cmds = nil
+	if err := ep.removeAntispoof(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"ebtables -D FORWARD -i veth1 -j L2B-veth1", "ebtables -D INPUT -i veth1 -j L2B-veth1", "ebtables -X L2B-veth1"}
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands %v, got %v", want, *cmds)
+	}
+}
@@ -0,0 +1,48 @@
+package l2bridge
+
+import (
+	"strconv"
+)
+
+const (
+	// bandwidthFilterPrio places the bandwidth policer after the BUM policer on the port.
+	bandwidthFilterPrio = "2"
+	// bandwidthLatency bounds how long the shaper holds frames sent to the endpoint before dropping them.
+	bandwidthLatency = "50ms"
+)
+
+// bandwidthBurst returns the burst, in bytes, allowed at the given rate: a tenth of a second of traffic, and never
+// less than a full frame.
+func bandwidthBurst(rate uint64) string {
+	burst := rate / 8 / 10
+	if burst < minBUMBurst {
+		burst = minBUMBurst
+	}
+	return strconv.FormatUint(burst, 10)
+}
+
+// setupBandwidth caps the traffic of the endpoint at rate, in bits per second, in both directions. Traffic sent to
+// the endpoint is shaped by a token bucket on its host interface, and traffic received from it is policed.
+func (ep *bridgeEndpoint) setupBandwidth(rate uint64) error {
+	r := strconv.FormatUint(rate, 10) + "bit"
+	burst := bandwidthBurst(rate)
+	if err := tc("qdisc", "replace", "dev", ep.hostIfName, "root", "handle", "1:", "tbf",
+		"rate", r, "burst", burst, "latency", bandwidthLatency); err != nil {
+		return err
+	}
+	if err := setupIngressQdisc(ep.hostIfName); err != nil {
+		return err
+	}
+	return tc("filter", "replace", "dev", ep.hostIfName, "parent", "ffff:", "prio", bandwidthFilterPrio,
+		"protocol", "all", "u32", "match", "u32", "0", "0",
+		"police", "rate", r, "burst", burst, "drop")
+}
+
+// removeBandwidth removes the shaper and policer installed by setupBandwidth, continuing past failures.
+func (ep *bridgeEndpoint) removeBandwidth() error {
+	err := tc("qdisc", "del", "dev", ep.hostIfName, "root", "handle", "1:")
+	if ferr := tc("filter", "del", "dev", ep.hostIfName, "parent", "ffff:", "prio", bandwidthFilterPrio); err == nil {
+		err = ferr
+	}
+	return err
+}
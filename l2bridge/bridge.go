@@ -1,6 +1,7 @@
 package l2bridge
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/docker/libnetwork/netlabel"
 	"github.com/docker/libnetwork/netutils"
@@ -30,6 +32,10 @@ const (
 	vethLen                    = 7
 	defaultContainerVethPrefix = "eth"
 	maxAllocatePortAttempts    = 10
+	maxEndpointMetaSize        = 4096
+	maxReservedRetries         = 16
+	minMTU                     = 68
+	maxMTU                     = 65535
 )
 
 const (
@@ -46,6 +52,70 @@ type iptablesCleanFuncs []iptableCleanFunc
 type Configuration struct {
 	EnableIPForwarding bool
 	EnableIPTables     bool
+	// DebugAddress is the TCP address serving debug endpoints. Empty disables them.
+	DebugAddress string
+	// MetricsAddress is the TCP address serving only the metrics, on /metrics. Empty disables it.
+	MetricsAddress string
+	// IPAMURL is an HTTP service asked for an endpoint address when libnetwork provides none. Empty disables it.
+	IPAMURL string
+	// IPAMTimeout bounds the wait for the IPAM service to assign an address.
+	IPAMTimeout time.Duration
+	// TeardownTimeout bounds the wait for the bridge of a deleted network to disappear before it is recreated.
+	TeardownTimeout time.Duration
+	// VerifyTeardown checks that endpoint objects are really gone after teardown, counting leftovers as leaks.
+	VerifyTeardown bool
+	// AutoLoadModules allows the driver to load missing kernel modules it needs with modprobe.
+	AutoLoadModules bool
+	// StateDumpPath is the file the driver state is written to on SIGUSR2. Empty writes it to the log.
+	StateDumpPath string
+	// ReapGracePeriod is how long an endpoint's host interface and sandbox must both be gone before the endpoint is
+	// deleted and its addresses freed. Zero disables reclaiming vanished endpoints.
+	ReapGracePeriod time.Duration
+	// DataRoot is the directory networks and endpoints are persisted under, restored when the driver restarts.
+	// Empty disables persistence.
+	DataRoot string
+	// OperationTimeout bounds each network and endpoint request, failing it with a timeout error and reverting it
+	// once complete. Zero leaves requests unbounded.
+	OperationTimeout time.Duration
+	// WarmRestart checks restored networks against the host and reinstalls whatever their endpoints are missing, as
+	// when the driver restarted while containers kept running.
+	WarmRestart bool
+	// ShutdownMode is what Shutdown does with the driver's networks, leaving them in place by default.
+	ShutdownMode ShutdownMode
+	// LogFormat is the format of the driver's logs, LogFormatText or LogFormatJSON.
+	LogFormat string
+	// DryRun validates requests and answers them as if served, without changing the host or persisting any state.
+	DryRun bool
+	// TransientErrnos are the host errors failing a request with a RetryError rather than an InternalError.
+	TransientErrnos []syscall.Errno
+	// NoCleanup makes Reconcile, including the pass on startup, only log the orphaned links and FDB entries it finds.
+	NoCleanup bool
+	// FlowLogPath is the file records of the ended flows of masqueraded endpoints and endpoints with published ports
+	// are appended to, as lines of JSON, or - for the standard output. Empty disables flow logs.
+	FlowLogPath string
+	// FlowLogSampleRate records one in every FlowLogSampleRate ended flows. Zero records all of them.
+	FlowLogSampleRate uint
+	// GlobalScope advertises the driver as global scoped, for swarm managers to allocate the networks created with
+	// --scope swarm through AllocateNetwork and FreeNetwork, which they only call on global scoped drivers. Docker then
+	// creates the driver's networks through swarm only. Each node still creates its own bridge.
+	GlobalScope bool
+}
+
+// DefaultConfiguration returns the configuration used when none is given.
+func DefaultConfiguration() *Configuration {
+	return &Configuration{
+		EnableIPForwarding: true,
+		EnableIPTables:     true,
+		IPAMTimeout:        defaultIPAMTimeout,
+		TeardownTimeout:    defaultTeardownTimeout,
+		VerifyTeardown:     true,
+		DataRoot:           defaultDataRoot,
+		WarmRestart:        true,
+		ShutdownMode:       ShutdownLeave,
+		LogFormat:          LogFormatText,
+		OperationTimeout:   defaultOperationTimeout,
+		TransientErrnos:    DefaultTransientErrnos,
+	}
 }
 
 // networkConfiguration for network specific configuration
@@ -55,11 +125,57 @@ type networkConfiguration struct {
 	EnableIPv6           bool
 	Mtu                  int
 	ContainerIfacePrefix string
+	ProxyNDP             bool
+	DSCPMap              map[uint8]uint32
+	AllowRejoin          bool
+	AllowOverlap         bool
+	StableGatewayMAC     bool
+	IsolateHost          bool
+	IsolateHostAllow     []string
+	DeriveULA            bool
+	FlushConntrack       bool
+	VLANStats            bool
+	GatewayService       bool
+	PortGroups           map[string]portGroup
+	IPv6GatewayRouted    bool
+	Reserved             []addrRange
+	NoIPv6GatewayAnycast bool
+	StaticFDB            []staticFDBEntry
+	BUMRateLimit         uint64
+	UniqueUplinkMAC      bool
+	IgnoreIPv6Disabled   bool
+	MSSClamp             bool
+	UplinkMSSClamp       bool
+	Uplink               string
+	StealUplink          bool
+	VLAN                 int
+	QuietRequests        bool
+	IPv6Forward          bool
+	FDBMax               uint32
+	Masquerade           bool
+	STP                  bool
+	LazyBridge           bool
+	Promisc              bool
+	Internal             bool
+	DHCP                 bool
+	// Learning is nil when unset, leaving the kernel default of learning on the ports.
+	Learning *bool
+	// AssignGatewayToBridge is nil when unset, in which case assignsGateway picks the default.
+	AssignGatewayToBridge *bool
 	// Internal fields set after ipam data parsing
 	PoolIPv4           *net.IPNet
 	PoolIPv6           *net.IPNet
 	DefaultGatewayIPv4 net.IP
 	DefaultGatewayIPv6 net.IP
+	BridgeIPv4         *net.IPNet
+	BridgeIPv6         *net.IPNet
+	// Subnets beyond the first of each family, and the addresses the bridge holds in them
+	SecondaryIPv4      []secondarySubnet
+	SecondaryIPv6      []secondarySubnet
+	SecondaryBridgeIPs []*net.IPNet
+	IPv6Ignored        bool   // IPv6 was requested but dropped as the kernel has it disabled
+	ULADerived         bool   // The IPv6 pool is a unique local prefix derived from the network id
+	allocatedName      string // Bridge name allocated by a swarm manager, used unless BridgeName is given
 	dbIndex            uint64
 	dbExists           bool
 }
@@ -76,12 +192,44 @@ const (
 // endpointConfiguration represents the user specified configuration for the sandbox endpoint
 type endpointConfiguration struct {
 	MacAddress net.HardwareAddr
+	IPFamily   string
+	PortGroup  string
+	Antispoof  bool
+	Sysctls    map[string]string
+	TempAddr   string
+	VerifyGW   bool
+	MaxConns   uint32
+	Bandwidth  uint64
+	Peers      []string
+	FDB        []staticFDBEntry
+	MTU        int
+	Learning   *bool
+	Meta       map[string]string
+}
+
+// Address families an endpoint may be restricted to with the ip_family label.
+const (
+	ipFamilyV4   = "v4"
+	ipFamilyV6   = "v6"
+	ipFamilyDual = "dual"
+)
+
+// wantsIPv4 reports whether the endpoint should be given IPv4 connectivity.
+func (ec *endpointConfiguration) wantsIPv4() bool {
+	return ec.IPFamily != ipFamilyV6
+}
+
+// wantsIPv6 reports whether the endpoint should be given IPv6 connectivity.
+func (ec *endpointConfiguration) wantsIPv6() bool {
+	return ec.IPFamily != ipFamilyV4
 }
 
 type bridgeEndpoint struct {
 	id           string
 	nid          string
 	srcName      string
+	hostIfName   string
+	sandboxKey   string
 	addr         *net.IPNet
 	addrv6       *net.IPNet
 	gatewayv4    net.IP
@@ -89,17 +237,65 @@ type bridgeEndpoint struct {
 	macAddress   net.HardwareAddr
 	config       *endpointConfiguration // User specified parameters
 	exposedPorts []types.TransportPort
-	dbIndex      uint64
-	dbExists     bool
+	meta         map[string]string
+	lastErr      *lastError
+	adopted      bool // Migrated from another host, awaiting its sandbox
+	gwReachable  string
+	mtu          int // Effective MTU of the endpoint's interfaces
+	vlan         *endpointVLAN
+	peerPolicy   bool // Traffic with endpoints other than its peers is dropped
+	dhcp         *dhcpLease
+	fdbInstalled bool // The static FDB entries of the endpoint are installed
+	// Ports published on the host for the endpoint, with the host port each was given
+	portMapping []types.PortBinding
+	// Class of the endpoint under its port group, 0 unless it joined one
+	portGroupClass int
+	// Sysctls of the sandbox the join replaced, with the values they had before, restored on leave
+	replacedSysctls map[string]string
+	// Stops the gateway check of the endpoint's join, nil unless one runs
+	gwCheckStop chan struct{}
+	// Address the masquerading rules match, that of the endpoint when they were programmed
+	masqueradeAddr net.IP
+	// Interface the endpoint is masqueraded out of, empty unless external connectivity is programmed
+	masqueradeIface string
+	dbIndex         uint64
+	dbExists        bool
+}
+
+// addresses returns the IPv4 and IPv6 addresses assigned to the endpoint.
+func (ep *bridgeEndpoint) addresses() []net.IP {
+	var ips []net.IP
+	if ep.addr != nil {
+		ips = append(ips, ep.addr.IP)
+	}
+	if ep.addrv6 != nil {
+		ips = append(ips, ep.addrv6.IP)
+	}
+	return ips
 }
 
 type bridgeNetwork struct {
-	id            string
-	bridge        *bridgeInterface // The bridge's L3 interface
-	config        *networkConfiguration
-	endpoints     map[string]*bridgeEndpoint // key: endpoint id
-	driver        *bridgeDriver              // The network's driver
-	iptCleanFuncs iptablesCleanFuncs
+	id             string
+	bridge         *bridgeInterface // The bridge's L3 interface
+	config         *networkConfiguration
+	endpoints      map[string]*bridgeEndpoint // key: endpoint id
+	driver         *bridgeDriver              // The network's driver
+	iptCleanFuncs  iptablesCleanFuncs
+	lastErr        *lastError
+	draining       bool   // Reject new endpoints and joins while existing ones are torn down
+	mssClampMTU    int    // MTU the installed MSS clamp fits, 0 if none
+	uplinkPort     string // Interface attached for the uplink, a VLAN sub-interface of it if tagged
+	uplinkWasUp    bool   // Whether the uplink was up before it was attached
+	vlanCreated    bool   // Whether the uplink port is a VLAN sub-interface created by the driver
+	uplinkPromisc  bool   // Whether the uplink was put in promiscuous mode by the driver
+	quiet          bool   // Successful requests on the network are not logged
+	pendingRebuild bool   // Without its bridge, restored without it or lazy, which is created when the network is next used
+	requested      string // Configuration requested at creation, to recognize retries of the request
+	foreignBridge  bool   // The bridge existed before the network and was not created by the driver
+	// Addresses the driver added to a foreign bridge, removed again when the network is deleted
+	bridgeAddrs []*net.IPNet
+	// Serializes the requests changing the network's bridge and endpoints, see lockNetwork
+	opMu sync.Mutex
 	sync.Mutex
 }
 
@@ -108,29 +304,80 @@ type bridgeDriver struct {
 	config        *Configuration
 	network       *bridgeNetwork
 	networks      map[string]*bridgeNetwork
-	nlh           *netlink.Handle
+	allocated     map[string]*networkConfiguration // key: id of a swarm network allocated on this manager
+	nlh           NetlinkHandle
 	configNetwork sync.Mutex
+	probeKernel   func() map[string]bool
+	moduleLoaded  func(name string) bool
+	featuresOnce  sync.Once
+	features      map[string]bool
+	tearingDown   map[string]bool // key: name of a deleted bridge
+	metrics       *metricsRegistry
+	probeGateway  func(sandboxKey string, mac net.HardwareAddr, gw net.IP) (bool, error)
+	renumber      func(sandboxKey string, mac net.HardwareAddr, oldAddr, newAddr *net.IPNet) error
+	ipv6Disabled  func() bool
+	vlanCounters  func(ifName string) ([]vlanStats, error)
+	ipamGateways  GatewayLookup
+	storeMu       sync.Mutex // Serializes writes of the persisted state
+	stateLoaded   bool
+	restoreErr    string
+	lastReconcile *reconcileResult
+	orphanedFDB   []orphanedFDB
+	// Requests given up on which still run, by the id of their network or endpoint
+	abandoned map[string]*abandonedOp
 	sync.Mutex
 }
 
 // NewBridgeDriver constructs a new bridge driver
 func NewBridgeDriver(config *Configuration) *bridgeDriver {
 	if config == nil {
-		config = &Configuration{
-			EnableIPForwarding: true,
-			EnableIPTables:     true,
-		}
-	}
-	return &bridgeDriver{networks: map[string]*bridgeNetwork{}, config: config}
+		config = DefaultConfiguration()
+	}
+	metrics := newMetricsRegistry()
+	registerTeardownMetrics(metrics)
+	registerNetlinkMetrics(metrics)
+	registerGatewayMetrics(metrics)
+	registerRequestMetrics(metrics)
+	registerReaperMetrics(metrics)
+	registerFDBMetrics(metrics)
+	registerFlowLogMetrics(metrics)
+	registerVLANStatsMetrics(metrics)
+	d := &bridgeDriver{
+		networks:     map[string]*bridgeNetwork{},
+		allocated:    map[string]*networkConfiguration{},
+		config:       config,
+		probeKernel:  probeKernelFeatures,
+		moduleLoaded: moduleLoaded,
+		tearingDown:  map[string]bool{},
+		abandoned:    map[string]*abandonedOp{},
+		metrics:      metrics,
+		probeGateway: probeSandboxGateway,
+		renumber:     renumberSandboxInterface,
+		ipv6Disabled: kernelIPv6Disabled,
+		vlanCounters: readVLANStats,
+	}
+	if config.DryRun {
+		dryRunLogOnce.Do(func() { logrus.AddHook(dryRunLogHook{}) })
+		d.nlh = newDryRunHandle()
+		d.probeKernel = func() map[string]bool { return map[string]bool{} }
+	}
+	return d
 }
 
 // Validate performs a static validation on the network configuration parameters.
 // Whatever can be assessed a priori before attempting any programming.
 func (c *networkConfiguration) Validate() error {
-	if c.Mtu < 0 {
+	if c.Mtu != 0 && (c.Mtu < minMTU || c.Mtu > maxMTU) {
 		return ErrInvalidMtu(c.Mtu)
 	}
 
+	if c.VLAN != 0 && c.Uplink == "" {
+		return types.BadRequestErrorf("%s requires %s to be set", label.VLAN, label.Uplink)
+	}
+	if c.UplinkMSSClamp && c.Uplink == "" {
+		return types.BadRequestErrorf("%s requires %s to be set", label.UplinkMSSClamp, label.Uplink)
+	}
+
 	// If bridge v4 subnet is specified
 	if c.PoolIPv4 != nil {
 		// If default gw is specified, it must be part of bridge subnet
@@ -147,6 +394,133 @@ func (c *networkConfiguration) Validate() error {
 			return &ErrInvalidGateway{}
 		}
 	}
+
+	// Proxying neighbor discovery is meaningless without IPv6 on the network.
+	if c.ProxyNDP && !c.EnableIPv6 {
+		return types.BadRequestErrorf("%s requires an IPv6 enabled network", label.ProxyNDP)
+	}
+	if c.DeriveULA && !c.EnableIPv6 {
+		return types.BadRequestErrorf("%s requires an IPv6 enabled network", label.DeriveULA)
+	}
+	if c.IPv6Forward && !c.EnableIPv6 {
+		return types.BadRequestErrorf("%s requires an IPv6 enabled network", label.IPv6Forward)
+	}
+	if c.IsolateHost && c.AssignGatewayToBridge != nil && *c.AssignGatewayToBridge {
+		return types.BadRequestErrorf("%s would make the gateway held by the bridge unreachable, set %s=false",
+			label.IsolateHost, label.AssignGatewayToBridge)
+	}
+	return nil
+}
+
+// dropIPv6 turns off IPv6 and the options depending on it, leaving an IPv4 only network.
+func (c *networkConfiguration) dropIPv6() {
+	c.EnableIPv6 = false
+	c.ProxyNDP = false
+	c.DeriveULA = false
+	c.IPv6GatewayRouted = false
+	c.IPv6Forward = false
+	c.IPv6Ignored = true
+}
+
+// assignsGateway reports whether the bridge should hold the network's gateway addresses.
+func (c *networkConfiguration) assignsGateway() bool {
+	if c.AssignGatewayToBridge != nil {
+		return *c.AssignGatewayToBridge
+	}
+	// An isolated host cannot serve as the gateway.
+	return !c.IsolateHost
+}
+
+// validateIPFamily checks that the network has a pool for the address family requested for an endpoint.
+func (c *networkConfiguration) validateIPFamily(family string) error {
+	switch family {
+	case ipFamilyV4:
+		if c.PoolIPv4 == nil {
+			return types.BadRequestErrorf("%s=%s requires a network with an IPv4 pool", label.IPFamily, family)
+		}
+	case ipFamilyV6:
+		if c.PoolIPv6 == nil {
+			return types.BadRequestErrorf("%s=%s requires a network with an IPv6 pool", label.IPFamily, family)
+		}
+	}
+	return nil
+}
+
+// fillEndpointPrefix gives addresses requested without a prefix length the prefix length of the network's pool of
+// their family, or a host prefix if the network has no such pool.
+func (c *networkConfiguration) fillEndpointPrefix(ei *EndpointInterface) {
+	if addr := ei.Address; addr != nil && addr.Mask == nil {
+		addr.Mask = net.CIDRMask(32, 32)
+		if pool := poolOf(c.poolsIPv4(), addr.IP); pool != nil {
+			addr.Mask = pool.Mask
+		}
+	}
+	if addr := ei.AddressIPv6; addr != nil && addr.Mask == nil {
+		addr.Mask = net.CIDRMask(128, 128)
+		if pool := poolOf(c.poolsIPv6(), addr.IP); pool != nil {
+			addr.Mask = pool.Mask
+		}
+	}
+}
+
+// validateEndpointMAC checks that a MAC address requested for an endpoint may be given to an Ethernet interface.
+func validateEndpointMAC(mac net.HardwareAddr) error {
+	if len(mac) != 6 {
+		return types.BadRequestErrorf("MAC address %s is not an Ethernet address", mac)
+	}
+	// The low bit of the first octet marks group addresses, the broadcast address among them.
+	if mac[0]&0x01 != 0 {
+		return types.BadRequestErrorf("MAC address %s is a multicast or broadcast address", mac)
+	}
+	if bytes.Equal(mac, make(net.HardwareAddr, 6)) {
+		return types.BadRequestErrorf("MAC address %s is the zero address", mac)
+	}
+	return nil
+}
+
+// endpointConflict describes the first of the MAC and addresses in ei already used by another endpoint of the
+// network, or returns the empty string if none is. The caller must hold the network lock.
+func (n *bridgeNetwork) endpointConflict(eid string, ei *EndpointInterface) string {
+	for _, other := range n.endpoints {
+		if other.id == eid {
+			continue
+		}
+		if ei.MacAddress != nil && bytes.Equal(other.macAddress, ei.MacAddress) {
+			return fmt.Sprintf("mac address %s is already used by endpoint %s", ei.MacAddress, other.id)
+		}
+		for _, ip := range other.addresses() {
+			for _, addr := range []*net.IPNet{ei.Address, ei.AddressIPv6} {
+				if addr != nil && addr.IP.Equal(ip) {
+					return fmt.Sprintf("address %s is already used by endpoint %s", ip, other.id)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// validateEndpointAddress checks that the addresses requested for an endpoint fall within the network's pools.
+func (c *networkConfiguration) validateEndpointAddress(ei *EndpointInterface) error {
+	if pools := c.poolsIPv4(); ei.Address != nil && pools != nil && !poolsContain(pools, ei.Address.IP) {
+		return types.BadRequestErrorf("requested address %s is outside of the network's IPv4 pools %s", ei.Address.IP, formatPools(pools))
+	}
+	if ei.AddressIPv6 != nil {
+		pools := c.poolsIPv6()
+		if pools == nil {
+			return types.BadRequestErrorf("requested IPv6 address %s but the network has no IPv6 pool", ei.AddressIPv6.IP)
+		}
+		if !poolsContain(pools, ei.AddressIPv6.IP) {
+			return types.BadRequestErrorf("requested IPv6 address %s is outside of the network's IPv6 pools %s", ei.AddressIPv6.IP, formatPools(pools))
+		}
+	}
+	for _, addr := range []*net.IPNet{ei.Address, ei.AddressIPv6} {
+		if addr == nil {
+			continue
+		}
+		if r, ok := c.reservedRange(addr.IP); ok {
+			return types.ForbiddenErrorf("requested address %s is in the reserved range %s", addr.IP, r)
+		}
+	}
 	return nil
 }
 
@@ -157,10 +531,23 @@ func (c *networkConfiguration) fromLabels(labels map[string]interface{}) error {
 		case label.DockerBridgeName, label.BridgeName:
 			switch name := value.(type) {
 			case string:
+				if err = validateBridgeName(name); err != nil {
+					return parseErr(key, name, err.Error())
+				}
 				c.BridgeName = name
 			default:
 				return fmt.Errorf("unrecognized type for %s: %T", key, name)
 			}
+		case label.AllocatedBridgeName:
+			switch name := value.(type) {
+			case string:
+				if err = validateBridgeName(name); err != nil {
+					return parseErr(key, name, err.Error())
+				}
+				c.allocatedName = name
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, name)
+			}
 		case label.GatewayIPv4:
 			logrus.Infof("GOT %s = %v", key, value)
 			switch gateway := value.(type) {
@@ -186,7 +573,7 @@ func (c *networkConfiguration) fromLabels(labels map[string]interface{}) error {
 			default:
 				return fmt.Errorf("unrecognized type for %s: %T", key, gateway)
 			}
-		case netlabel.DriverMTU:
+		case netlabel.DriverMTU, label.MTU:
 			switch mtu := value.(type) {
 			case int:
 				c.Mtu = mtu
@@ -215,6 +602,201 @@ func (c *networkConfiguration) fromLabels(labels map[string]interface{}) error {
 			default:
 				return fmt.Errorf("unrecognized type for %s: %T", key, prefix)
 			}
+		case label.ProxyNDP:
+			if c.ProxyNDP, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.AllowRejoin:
+			if c.AllowRejoin, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.AllowOverlap:
+			if c.AllowOverlap, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.StableGatewayMAC:
+			if c.StableGatewayMAC, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.DeriveULA:
+			if c.DeriveULA, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.FlushConntrack:
+			if c.FlushConntrack, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.DisableGatewayService:
+			var disable bool
+			if disable, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+			c.GatewayService = !disable
+		case label.IPv6GatewayOnLink:
+			var onLink bool
+			if onLink, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+			c.IPv6GatewayRouted = !onLink
+		case label.IPv6GatewayAnycast:
+			var anycast bool
+			if anycast, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+			c.NoIPv6GatewayAnycast = !anycast
+		case label.AssignGatewayToBridge:
+			var assign bool
+			if assign, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+			c.AssignGatewayToBridge = &assign
+		case label.Uplink, label.Parent:
+			switch uplink := value.(type) {
+			case string:
+				c.Uplink = uplink
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, uplink)
+			}
+		case label.LogRequests:
+			var log bool
+			if log, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+			c.QuietRequests = !log
+		case label.VLAN:
+			switch vlan := value.(type) {
+			case string:
+				if c.VLAN, err = strconv.Atoi(vlan); err != nil || c.VLAN < minVLAN || c.VLAN > maxVLAN {
+					return parseErr(key, vlan, fmt.Sprintf("must be a vlan id between %d and %d", minVLAN, maxVLAN))
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, vlan)
+			}
+		case label.FDBMax:
+			switch max := value.(type) {
+			case string:
+				limit, err := strconv.ParseUint(max, 10, 32)
+				if err != nil || limit == 0 || limit > maxFDBLimit {
+					return parseErr(key, max, fmt.Sprintf("must be a number of entries between 1 and %d", uint64(maxFDBLimit)))
+				}
+				c.FDBMax = uint32(limit)
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, max)
+			}
+		case label.Masquerade:
+			if c.Masquerade, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.DHCP:
+			if c.DHCP, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.Promisc:
+			if c.Promisc, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.Learning:
+			var learning bool
+			if learning, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+			c.Learning = &learning
+		case label.LazyBridge:
+			if c.LazyBridge, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.STP:
+			if c.STP, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.StealUplink:
+			if c.StealUplink, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.UplinkMSSClamp:
+			if c.UplinkMSSClamp, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.MSSClamp:
+			if c.MSSClamp, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.IPv6Forward:
+			if c.IPv6Forward, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.IgnoreIPv6Disabled:
+			if c.IgnoreIPv6Disabled, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.UniqueUplinkMAC:
+			if c.UniqueUplinkMAC, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.VLANStats:
+			if c.VLANStats, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.IsolateHost:
+			if c.IsolateHost, err = parseBoolLabel(key, value); err != nil {
+				return err
+			}
+		case label.IsolateHostAllow:
+			switch allow := value.(type) {
+			case string:
+				if c.IsolateHostAllow, err = parseHostIsolationAllow(allow); err != nil {
+					return parseErr(key, allow, err.Error())
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, allow)
+			}
+		case label.DSCPMap:
+			switch dscpMap := value.(type) {
+			case string:
+				if c.DSCPMap, err = parseDSCPMap(dscpMap); err != nil {
+					return parseErr(key, dscpMap, err.Error())
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, dscpMap)
+			}
+		case label.BUMRateLimit:
+			switch rate := value.(type) {
+			case string:
+				if c.BUMRateLimit, err = parseRate(rate); err != nil {
+					return parseErr(key, rate, err.Error())
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, rate)
+			}
+		case label.Reserved:
+			switch reserved := value.(type) {
+			case string:
+				if c.Reserved, err = parseReservedRanges(reserved); err != nil {
+					return parseErr(key, reserved, err.Error())
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, reserved)
+			}
+		case label.StaticFDB:
+			switch fdb := value.(type) {
+			case string:
+				if c.StaticFDB, err = parseStaticFDB(fdb); err != nil {
+					return parseErr(key, fdb, err.Error())
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, fdb)
+			}
+		case label.PortGroups:
+			switch groups := value.(type) {
+			case string:
+				if c.PortGroups, err = parsePortGroups(groups); err != nil {
+					return parseErr(key, groups, err.Error())
+				}
+			default:
+				return fmt.Errorf("unrecognized type for %s: %T", key, groups)
+			}
+		case label.BondXmitHashPolicy:
+			return types.BadRequestErrorf("%s is not supported, set the xmit_hash_policy of the uplink's bond on the host", key)
 		default:
 			logrus.Warnf("Ignoring unrecognized configuration option %s: %v", key, value)
 		}
@@ -227,6 +809,22 @@ func parseErr(key, value, errString string) error {
 	return types.BadRequestErrorf("failed to parse %s value: %v (%s)", key, value, errString)
 }
 
+// parseBoolLabel interprets a label value given either as a bool or as a string.
+func parseBoolLabel(key string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, parseErr(key, v, err.Error())
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("unrecognized type for %s: %T", key, v)
+	}
+}
+
 func (n *bridgeNetwork) registerIptCleanFunc(clean iptableCleanFunc) {
 	n.iptCleanFuncs = append(n.iptCleanFuncs, clean)
 }
@@ -283,7 +881,7 @@ func (d *bridgeDriver) configure(option map[string]interface{}) error {
 
 	if config.EnableIPForwarding {
 		if err := setupIPForwarding(config.EnableIPTables); err != nil {
-			logrus.WithError(err).Warnf("Failed to setup IP forwarding: ", err)
+			logrus.WithError(err).Warn("Failed to setup IP forwarding")
 			return err
 		}
 	}
@@ -292,14 +890,24 @@ func (d *bridgeDriver) configure(option map[string]interface{}) error {
 	d.config = config
 	d.Unlock()
 
-	// TODO(nategraf) Implement storage.
-	//if err := d.initStore(option); err != nil {
-	//	return err
-	//}
-
 	return nil
 }
 
+// lockNetwork serializes the requests changing a network's bridge and endpoints, so that concurrent requests for one
+// network run one at a time while those for different networks run in parallel. It returns the function releasing
+// the lock, which does nothing if the network is unknown, leaving the request to fail as it would. The network lock
+// is taken before configNetwork by those requests needing both.
+func (d *bridgeDriver) lockNetwork(nid string) func() {
+	d.Lock()
+	n, ok := d.networks[nid]
+	d.Unlock()
+	if !ok || n == nil {
+		return func() {}
+	}
+	n.opMu.Lock()
+	return n.opMu.Unlock
+}
+
 func (d *bridgeDriver) getNetwork(id string) (*bridgeNetwork, error) {
 	if id == "" {
 		return nil, types.BadRequestErrorf("invalid network id: %s", id)
@@ -351,10 +959,6 @@ func parseNetworkGenericOptions(data interface{}) (*networkConfiguration, error)
 }
 
 func (c *networkConfiguration) processIPAM(id string, ipamV4Data, ipamV6Data []*IPAMData) error {
-	if len(ipamV4Data) > 1 || len(ipamV6Data) > 1 {
-		return types.ForbiddenErrorf("l2bridge driver doesn't support multiple subnets")
-	}
-
 	if len(ipamV4Data) == 0 || ipamV4Data[0].Pool == nil {
 		return types.BadRequestErrorf("l2bridge network %s requires ipv4 configuration", id)
 	}
@@ -371,6 +975,53 @@ func (c *networkConfiguration) processIPAM(id string, ipamV4Data, ipamV6Data []*
 		}
 	}
 
+	// Subnets beyond the first of each family share the bridge, which holds an address in each of them as well.
+	var err error
+	if c.SecondaryIPv4, err = parseSecondarySubnets(id, ipamV4Data, DefaultGatewayV4AuxKey); err != nil {
+		return err
+	}
+	if c.SecondaryIPv6, err = parseSecondarySubnets(id, ipamV6Data, DefaultGatewayV6AuxKey); err != nil {
+		return err
+	}
+
+	if gw := c.DefaultGatewayIPv4; gw != nil {
+		if err := checkGatewayAddress(gw, c.PoolIPv4); err != nil {
+			return err
+		}
+	}
+	if gw := c.DefaultGatewayIPv6; gw != nil && c.NoIPv6GatewayAnycast && gw.Equal(c.PoolIPv6.IP.Mask(c.PoolIPv6.Mask)) {
+		return types.BadRequestErrorf("IPv6 gateway %s is the subnet-router anycast address of %s", gw, c.PoolIPv6)
+	}
+
+	for _, r := range c.Reserved {
+		if !r.withinAny(c.poolsIPv4()) && !r.withinAny(c.poolsIPv6()) {
+			return types.BadRequestErrorf("reserved range %s is outside of the network's pools", r)
+		}
+	}
+
+	if c.IPv6GatewayRouted {
+		if c.DefaultGatewayIPv6 == nil {
+			return types.BadRequestErrorf("routing to the IPv6 gateway requires an IPv6 gateway to be configured")
+		}
+		if !c.PoolIPv6.Contains(c.DefaultGatewayIPv6) {
+			return types.BadRequestErrorf("IPv6 gateway %s is outside of the network's IPv6 pool %s", c.DefaultGatewayIPv6, c.PoolIPv6)
+		}
+	}
+
+	if c.assignsGateway() {
+		if c.DefaultGatewayIPv4 != nil {
+			c.BridgeIPv4 = &net.IPNet{IP: c.DefaultGatewayIPv4, Mask: c.PoolIPv4.Mask}
+		}
+		if c.DefaultGatewayIPv6 != nil && c.EnableIPv6 {
+			c.BridgeIPv6 = &net.IPNet{IP: c.DefaultGatewayIPv6, Mask: c.PoolIPv6.Mask}
+		}
+		c.assignSecondaryGateways()
+	}
+
+	if c.StableGatewayMAC && c.DefaultGatewayIPv4 == nil && c.DefaultGatewayIPv6 == nil {
+		return types.BadRequestErrorf("%s requires a default gateway to be configured", label.StableGatewayMAC)
+	}
+
 	return nil
 }
 
@@ -391,6 +1042,11 @@ func parseNetworkOptions(id string, option options.Generic) (*networkConfigurati
 	if val, ok := option[netlabel.EnableIPv6]; ok {
 		config.EnableIPv6 = val.(bool)
 	}
+	if val, ok := option[netlabel.Internal]; ok {
+		if config.Internal, err = parseBoolLabel(netlabel.Internal, val); err != nil {
+			return nil, err
+		}
+	}
 
 	// Finally validate the configuration
 	if err = config.Validate(); err != nil {
@@ -398,15 +1054,10 @@ func parseNetworkOptions(id string, option options.Generic) (*networkConfigurati
 	}
 
 	if config.BridgeName == "" {
-		config.BridgeName = "br-" + id[:12]
+		config.BridgeName = config.allocatedName
 	}
-
-	exists, err := bridgeInterfaceExists(config.BridgeName)
-	if err != nil {
-		return nil, err
-	}
-	if exists {
-		return nil, types.ForbiddenErrorf("interface with name %s exists", config.BridgeName)
+	if config.BridgeName == "" {
+		config.BridgeName = "br-" + id[:12]
 	}
 
 	config.ID = id
@@ -426,62 +1077,202 @@ func (d *bridgeDriver) getNetworks() []*bridgeNetwork {
 }
 
 // Create a new L2 Bridge network, including creating and performing inital setup on the bridge interface.
-func (d *bridgeDriver) CreateNetwork(id string, option map[string]interface{}, ipV4Data, ipV6Data []*IPAMData) error {
+func (d *bridgeDriver) createNetworkWithOptions(id string, option map[string]interface{}, ipV4Data, ipV6Data []*IPAMData) error {
 	if len(ipV4Data) == 0 || ipV4Data[0].Pool.String() == "0.0.0.0/0" {
 		return types.BadRequestErrorf("ipv4 pool is empty")
 	}
-	// Sanity checks
-	d.Lock()
-	if _, ok := d.networks[id]; ok {
-		d.Unlock()
-		return types.ForbiddenErrorf("network %s exists", id)
-	}
-	d.Unlock()
-
 	// Parse and validate the config. It should not be conflict with existing networks' config
 	config, err := parseNetworkOptions(id, option)
 	if err != nil {
 		return err
 	}
 
+	if (config.EnableIPv6 || len(ipV6Data) != 0) && d.ipv6Disabled() {
+		if !config.IgnoreIPv6Disabled {
+			return types.BadRequestErrorf("IPv6 requested but disabled in kernel, set %s to create network %s without it",
+				label.IgnoreIPv6Disabled, id)
+		}
+		logrus.Warnf("IPv6 is disabled in the kernel, creating network %s with IPv4 only", id)
+		config.dropIPv6()
+		ipV6Data = nil
+	}
+
+	ipV4Data = d.applyIPAMGateways(config, ipV4Data, DefaultGatewayV4AuxKey)
+	ipV6Data = d.applyIPAMGateways(config, ipV6Data, DefaultGatewayV6AuxKey)
 	if err = config.processIPAM(id, ipV4Data, ipV6Data); err != nil {
 		return err
 	}
 
+	fingerprint, err := requestFingerprint(config)
+	if err != nil {
+		return internalErrorf("failed to record the configuration of network %s: %v", id, err)
+	}
+
 	// start the critical section, from this point onward we are dealing with the list of networks
 	// so to be consistent we cannot allow that the list changes
 	d.configNetwork.Lock()
 	defer d.configNetwork.Unlock()
-	if err = d.createNetwork(config); err != nil {
+
+	// A create racing with another create or a delete of the same id is only settled once inside the critical section.
+	// Docker retries a create after transient errors, which must then succeed if the network was created after all.
+	d.Lock()
+	existing, ok := d.networks[id]
+	d.Unlock()
+	if ok {
+		return existing.checkRetry(fingerprint)
+	}
+	if err = d.checkBridgeName(config); err != nil {
+		return err
+	}
+
+	// The host of a dry run need not be the one networks are created on, so its kernel is not held against them.
+	if !d.dryRun() {
+		if err = d.requireKernelFeatures(config); err != nil {
+			return err
+		}
+	}
+
+	if config.DeriveULA && config.PoolIPv6 == nil {
+		if err = d.assignULA(config); err != nil {
+			return err
+		}
+	}
+
+	if err = d.checkPoolOverlap(config); err != nil {
+		return err
+	}
+	if err = d.checkBridgeGateway(config); err != nil {
+		return err
+	}
+
+	if d.dryRun() {
+		d.declareDryRunNetwork(config)
+	} else if err = d.createNetwork(config); err != nil {
 		return err
 	}
 
-	return nil //d.storeUpdate(config)
+	d.Lock()
+	n := d.networks[id]
+	d.Unlock()
+	n.Lock()
+	n.requested = fingerprint
+	n.Unlock()
+
+	d.storeSync("network create")
+	return nil
+}
+
+// checkPoolOverlap rejects a network with a pool overlapping, as equal to, within or around, a pool of another network,
+// unless either network allows it. The caller must hold configNetwork.
+func (d *bridgeDriver) checkPoolOverlap(config *networkConfiguration) error {
+	if config.AllowOverlap {
+		return nil
+	}
+
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		other := n.config
+		n.Unlock()
+		if n.id == config.ID || other.AllowOverlap {
+			continue
+		}
+		for _, pools := range [][2][]*net.IPNet{
+			{config.poolsIPv4(), other.poolsIPv4()},
+			{config.poolsIPv6(), other.poolsIPv6()},
+		} {
+			for _, pool := range pools[0] {
+				for _, otherPool := range pools[1] {
+					if netutils.NetworkOverlaps(pool, otherPool) {
+						return types.BadRequestErrorf("pool %s overlaps pool %s of network %s, set %s=true to allow it",
+							pool, otherPool, n.id, label.AllowOverlap)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkBridgeGateway rejects a network whose bridge would hold a gateway inside the pool of another network whose
+// bridge does the same, as the host could not tell which bridge to route through. The caller must hold configNetwork.
+func (d *bridgeDriver) checkBridgeGateway(config *networkConfiguration) error {
+	if config.BridgeIPv4 == nil && config.BridgeIPv6 == nil {
+		return nil
+	}
+
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		other := n.config
+		n.Unlock()
+		if config.BridgeIPv4 != nil && other.BridgeIPv4 != nil && netutils.NetworkOverlaps(config.BridgeIPv4, other.BridgeIPv4) {
+			return types.ForbiddenErrorf("gateway %s overlaps the gateway held by network %s, set %s=false on one of them",
+				config.BridgeIPv4, n.id, label.AssignGatewayToBridge)
+		}
+		if config.BridgeIPv6 != nil && other.BridgeIPv6 != nil && netutils.NetworkOverlaps(config.BridgeIPv6, other.BridgeIPv6) {
+			return types.ForbiddenErrorf("gateway %s overlaps the gateway held by network %s, set %s=false on one of them",
+				config.BridgeIPv6, n.id, label.AssignGatewayToBridge)
+		}
+	}
+
+	if !d.config.EnableIPForwarding {
+		logrus.Warnf("Bridge of network %s holds the gateway but IP forwarding is disabled, traffic will not be routed beyond the host", config.ID)
+	}
+	return nil
 }
 
 func (d *bridgeDriver) createNetwork(config *networkConfiguration) (err error) {
 	defer osl.InitOSContext()()
 
+	// Fail with a clear message, rather than an obscure errno, when the kernel lacks what the network needs.
+	if err = d.requireModule("bridge"); err != nil {
+		return err
+	}
+	if config.FlushConntrack {
+		if err = d.requireModule("nf_conntrack_netlink"); err != nil {
+			return err
+		}
+	}
+
 	// Initialize handle when needed
 	d.Lock()
 	if d.nlh == nil {
-		d.nlh = ns.NlHandle()
+		d.nlh = newMeteredHandle(ns.NlHandle(), d.metrics)
 	}
 	d.Unlock()
 
+	if err = d.waitTeardown(config.BridgeName); err != nil {
+		return err
+	}
+	if err = d.checkStaticFDBPorts(config); err != nil {
+		return err
+	}
+
 	// Create or retrieve the bridge L3 interface
 	bridgeIface, err := newInterface(d.nlh, config)
 	if err != nil {
 		return err
 	}
 
+	var ports []string
+	var uplink uplinkPort
+	if config.Uplink != "" {
+		if uplink, err = d.setupUplink(config); err != nil {
+			return err
+		}
+		ports = []string{uplink.name}
+	}
+
 	// Create and set network handler in driver
 	network := &bridgeNetwork{
-		id:        config.ID,
-		endpoints: make(map[string]*bridgeEndpoint),
-		config:    config,
-		bridge:    bridgeIface,
-		driver:    d,
+		id:          config.ID,
+		endpoints:   make(map[string]*bridgeEndpoint),
+		config:      config,
+		bridge:      bridgeIface,
+		driver:      d,
+		uplinkPort:  uplink.name,
+		uplinkWasUp: uplink.wasUp,
+		vlanCreated: uplink.created,
+		quiet:       config.QuietRequests,
 	}
 
 	d.Lock()
@@ -494,10 +1285,35 @@ func (d *bridgeDriver) createNetwork(config *networkConfiguration) (err error) {
 			d.Lock()
 			delete(d.networks, config.ID)
 			d.Unlock()
+			network.releaseUplink()
 		}
 	}()
 
-	// Prepare the bridge setup configuration
+	// A lazy network is only declared, its bridge is created along with its first endpoint.
+	if config.LazyBridge && !bridgeIface.exists() {
+		network.pendingRebuild = true
+		return nil
+	}
+	return d.setupNetworkBridge(network, ports)
+}
+
+// setupNetworkBridge creates or configures the bridge of the network, attaching the given ports to it as soon as it
+// exists.
+func (d *bridgeDriver) setupNetworkBridge(network *bridgeNetwork, ports []string) error {
+	config, bridgeIface := network.config, network.bridge
+
+	// A bridge the host made is used as is, and only loses the addresses given to it when the network is deleted.
+	network.foreignBridge, network.bridgeAddrs = bridgeIface.isForeign(), nil
+	if network.foreignBridge {
+		logrus.Infof("Network %s uses the existing bridge %s, which is kept when the network is deleted", config.ID, config.BridgeName)
+		addrs, err := foreignBridgeAddrs(config, bridgeIface)
+		if err != nil {
+			return fmt.Errorf("failed to list addresses of bridge %s: %w", config.BridgeName, err)
+		}
+		network.bridgeAddrs = addrs
+	}
+
+	// Prepare the bridge setup configuration
 	bridgeSetup := newBridgeSetup(config, bridgeIface)
 
 	// If the bridge interface doesn't exist, create a new device.
@@ -505,13 +1321,99 @@ func (d *bridgeDriver) createNetwork(config *networkConfiguration) (err error) {
 		bridgeSetup.queueStep(setupDevice)
 	}
 
-	// Prevent the bridge from obtaining an IPv6 address.
-	bridgeSetup.queueStep(setupDisableIPv6)
+	// An existing bridge may itself be nested in a device with a smaller MTU.
+	if bridgeIface.exists() {
+		bridgeSetup.queueStep(setupNestedMTU)
+	}
+
+	if len(ports) != 0 {
+		bridgeSetup.queueStep(func(config *networkConfiguration, i *bridgeInterface) error {
+			for _, port := range ports {
+				if err := addToBridge(i.nlh, port, config.BridgeName); err != nil {
+					return fmt.Errorf("adding interface %s to bridge %s failed: %w", port, config.BridgeName, err)
+				}
+			}
+			return nil
+		})
+	}
+	if network.uplinkPort != "" {
+		bridgeSetup.queueStep(network.setupUplinkUp)
+	}
+	bridgeSetup.queueStep(network.setupMTU)
+	if config.UplinkMSSClamp {
+		bridgeSetup.queueStep(network.setupUplinkMSSClamp)
+	}
+
+	// Answering neighbor solicitations or holding a gateway address requires IPv6 to be active on the bridge.
+	if config.ProxyNDP {
+		bridgeSetup.queueStep(setupProxyNDP)
+	}
+	if config.BridgeIPv4 != nil {
+		bridgeSetup.queueStep(setupBridgeIPv4)
+	}
+	if config.BridgeIPv6 != nil {
+		bridgeSetup.queueStep(setupBridgeIPv6)
+	}
+	if len(config.SecondaryBridgeIPs) != 0 {
+		bridgeSetup.queueStep(setupSecondaryBridgeIPs)
+	}
+	if network.foreignBridge {
+		// The IPv6 settings of a bridge the host made are its own, unless the network asks to forward IPv6.
+		if config.IPv6Forward {
+			bridgeSetup.queueStep(setupIPv6Forwarding)
+		}
+	} else if !config.ProxyNDP && config.BridgeIPv6 == nil && !config.holdsSecondaryIPv6() {
+		// Prevent the bridge from obtaining an IPv6 address.
+		bridgeSetup.queueStep(setupDisableIPv6)
+	} else {
+		bridgeSetup.queueStep(setupIPv6Forwarding)
+	}
+
+	if config.STP {
+		bridgeSetup.queueStep(setupSTP)
+	}
+
+	if config.Promisc {
+		bridgeSetup.queueStep(network.setupPromisc)
+	}
+
+	if config.VLANStats {
+		bridgeSetup.queueStep(setupVLANStats)
+	}
+
+	if config.FDBMax != 0 {
+		bridgeSetup.queueStep(setupFDBLimit)
+	}
+
+	if len(config.StaticFDB) != 0 {
+		bridgeSetup.queueStep(setupStaticFDB)
+	}
+
+	if len(config.PortGroups) != 0 {
+		bridgeSetup.queueStep(network.setupPortGroups)
+	}
+
+	if config.IsolateHost && !d.config.EnableIPTables {
+		return types.ForbiddenErrorf("%s requires iptables to be enabled", label.IsolateHost)
+	}
+	if config.Masquerade && !d.config.EnableIPTables {
+		return types.ForbiddenErrorf("%s requires iptables to be enabled", label.Masquerade)
+	}
+	if config.Internal && !d.config.EnableIPTables {
+		return types.ForbiddenErrorf("internal networks require iptables to be enabled")
+	}
 
 	if d.config.EnableIPTables {
 		// Setup IPTables.
 		bridgeSetup.queueStep(network.setupIPTables)
 
+		if config.IsolateHost {
+			bridgeSetup.queueStep(network.setupHostIsolation)
+		}
+		if config.Internal {
+			bridgeSetup.queueStep(network.setupInternal)
+		}
+
 		//We want to track firewalld configuration so that
 		//if it is started/reloaded, the rules can be applied correctly
 		bridgeSetup.queueStep(network.setupFirewalld)
@@ -522,14 +1424,6 @@ func (d *bridgeDriver) createNetwork(config *networkConfiguration) (err error) {
 	return bridgeSetup.apply()
 }
 
-func (d *bridgeDriver) DeleteNetwork(nid string) error {
-
-	d.configNetwork.Lock()
-	defer d.configNetwork.Unlock()
-
-	return d.deleteNetwork(nid)
-}
-
 func (d *bridgeDriver) deleteNetwork(nid string) error {
 	var err error
 
@@ -547,24 +1441,27 @@ func (d *bridgeDriver) deleteNetwork(nid string) error {
 	config := n.config
 	n.Unlock()
 
+	plan := d.planDelete(n)
+	n.revokeAllExternalConnectivity()
+
 	// delete endpoints belong to this network
-	for _, ep := range n.endpoints {
-		if link, err := d.nlh.LinkByName(ep.srcName); err == nil {
+	for _, ep := range plan.Endpoints {
+		if link, err := d.nlh.LinkByName(ep.Veth); err == nil {
 			if err := d.nlh.LinkDel(link); err != nil {
-				logrus.WithError(err).Errorf("Failed to delete interface (%s)'s link on endpoint (%s) delete", ep.srcName, ep.id)
+				logrus.WithError(err).Errorf("Failed to delete interface (%s)'s link on endpoint (%s) delete", ep.Veth, ep.ID)
 			}
 		}
-
-		// TODO(nategraf) Implement storage.
-		//if err := d.storeDelete(ep); err != nil {
-		//	logrus.Warnf("Failed to remove bridge endpoint %.7s from store: %v", ep.id, err)
-		//}
 	}
 
 	d.Lock()
 	delete(d.networks, nid)
 	d.Unlock()
 
+	if d.dryRun() {
+		logrus.Infof("Dry run: deleted network %s", nid)
+		return nil
+	}
+
 	// On failure set network handler back in driver, but
 	// only if is not already taken over by some other thread
 	defer func() {
@@ -577,8 +1474,30 @@ func (d *bridgeDriver) deleteNetwork(nid string) error {
 		}
 	}()
 
-	if err := d.nlh.LinkDel(n.bridge.Link); err != nil {
-		logrus.WithError(err).Warnf("Failed to remove bridge interface %s on network %s delete: %v", config.BridgeName, nid, err)
+	n.removeStaticFDB()
+	n.removeMSSClamp()
+	if config.UplinkMSSClamp {
+		n.removeUplinkMSSClamp()
+	}
+	if len(config.PortGroups) != 0 {
+		n.removePortGroups()
+	}
+
+	for _, uplink := range plan.Uplinks {
+		logrus.Infof("Releasing uplink %s from bridge %s on network %s delete", uplink, config.BridgeName, nid)
+	}
+	n.releaseUplink()
+	// A bridge the driver did not create is left in place, only the addresses the driver added are removed.
+	if n.foreignBridge {
+		logrus.Infof("Keeping bridge %s of network %s, which the driver did not create", config.BridgeName, nid)
+		n.releaseForeignBridge()
+	} else if n.bridge.exists() {
+		// exists is false for a declared network, whose bridge was never created and so is not deleted.
+		if err := d.nlh.LinkDel(n.bridge.Link); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove bridge interface %s on network %s delete: %v", config.BridgeName, nid, err)
+		} else {
+			d.markTearingDown(config.BridgeName)
+		}
 	}
 
 	for _, cleanFunc := range n.iptCleanFuncs {
@@ -587,14 +1506,14 @@ func (d *bridgeDriver) deleteNetwork(nid string) error {
 		}
 	}
 
-	// TODO(nategraf) Implement storage.
-	return nil // d.storeDelete(config)
+	d.storeSync("network delete")
+	return nil
 }
 
-func addToBridge(nlh *netlink.Handle, ifaceName, bridgeName string) error {
+func addToBridge(nlh NetlinkHandle, ifaceName, bridgeName string) error {
 	link, err := nlh.LinkByName(ifaceName)
 	if err != nil {
-		return fmt.Errorf("could not find interface %s: %v", ifaceName, err)
+		return fmt.Errorf("could not find interface %s: %w", ifaceName, err)
 	}
 	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: bridgeName}}
 	if err = nlh.LinkSetMaster(link, bridge); err != nil {
@@ -603,7 +1522,7 @@ func addToBridge(nlh *netlink.Handle, ifaceName, bridgeName string) error {
 	return nil
 }
 
-func setHairpinMode(nlh *netlink.Handle, link netlink.Link, enable bool) error {
+func setHairpinMode(nlh NetlinkHandle, link netlink.Link, enable bool) error {
 	err := nlh.LinkSetHairpin(link, enable)
 	if err != nil && err != syscall.EINVAL {
 		// If error is not EINVAL something else went wrong, bail out right away
@@ -628,15 +1547,17 @@ func setHairpinMode(nlh *netlink.Handle, link netlink.Link, enable bool) error {
 	}
 
 	if err := ioutil.WriteFile(path, val, 0644); err != nil {
-		return fmt.Errorf("unable to set hairpin mode on %s via sysfs: %v", link.Attrs().Name, err)
+		return fmt.Errorf("unable to set hairpin mode on %s via sysfs: %w", link.Attrs().Name, err)
 	}
 
 	return nil
 }
 
-// CreateEndpoint makes a new link to be added to a container.
+// createEndpoint makes a new link to be added to a container.
 // Any fields set in the returned EndpointInterface will be understood as change requests by the Docker daemon.
-func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, epOptions map[string]interface{}) (*EndpointInterface, error) {
+// A provided MAC or address always wins, and is rejected if another endpoint of the network uses it. The driver
+// fills in the gaps: a random MAC, and an IPv6 address derived from the MAC, each unique within the network.
+func (d *bridgeDriver) createEndpoint(nid, eid string, ei *EndpointInterface, epOptions map[string]interface{}) (*EndpointInterface, error) {
 	defer osl.InitOSContext()()
 
 	if ei == nil {
@@ -655,18 +1576,95 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 	}
 	// Endpoint with that id exists either on desired or other sandbox
 	if ep != nil {
+		if ep.adopted {
+			return n.claimAdopted(ep, ei)
+		}
 		return nil, ErrEndpointExists(eid)
 	}
 
+	if n.isDraining() {
+		return nil, types.ForbiddenErrorf("network %s is draining and accepts no new endpoints", nid)
+	}
+
+	if err = d.ensureBridge(n); err != nil {
+		return nil, err
+	}
+
 	// Try to convert the options to endpoint configuration
 	epConfig, err := parseEndpointOptions(epOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create and add the endpoint
+	// Libnetwork still allocates IPv6 addresses on a network created without the IPv6 it asked for.
+	if n.config.IPv6Ignored {
+		ei.AddressIPv6 = nil
+	}
+	// Libnetwork allocates addresses of both families on a dual-stack network, whatever family the endpoint asked for.
+	switch epConfig.IPFamily {
+	case ipFamilyV4:
+		ei.AddressIPv6 = nil
+	case ipFamilyV6:
+		ei.Address = nil
+	}
+
+	// Reject addresses the network cannot hold before touching the host.
+	n.config.fillEndpointPrefix(ei)
+	if err = n.config.validateEndpointAddress(ei); err != nil {
+		return nil, err
+	}
+	if err = n.config.validateIPFamily(epConfig.IPFamily); err != nil {
+		return nil, err
+	}
+	if _, ok := n.config.PortGroups[epConfig.PortGroup]; epConfig.PortGroup != "" && !ok {
+		return nil, types.BadRequestErrorf("network %s has no port group %s", nid, epConfig.PortGroup)
+	}
+	if ei.MacAddress != nil {
+		if err = validateEndpointMAC(ei.MacAddress); err != nil {
+			return nil, err
+		}
+	}
+	if ei.MacAddress != nil && n.config.UniqueUplinkMAC {
+		if err = d.checkUplinkMAC(n, ei.MacAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	// Ask the external IPAM service for an address when libnetwork did not provide one.
+	d.Lock()
+	ipamURL, ipamTimeout := d.config.IPAMURL, d.config.IPAMTimeout
+	d.Unlock()
+
+	// A dry run allocates nothing, as it would never release the address. A derived pool assigns its own addresses.
+	var allocated, allocatedv6 *net.IPNet
+	if ei.Address == nil && ipamURL != "" && epConfig.wantsIPv4() && !d.dryRun() {
+		if allocated, err = requestExternalAddress(ipamURL, ipamTimeout, nid, eid, ipFamilyV4, n.config.PoolIPv4); err != nil {
+			return nil, err
+		}
+		ei.Address = allocated
+		if err = n.config.validateEndpointAddress(ei); err != nil {
+			return nil, err
+		}
+	}
+	if ei.AddressIPv6 == nil && ipamURL != "" && epConfig.wantsIPv6() && n.config.PoolIPv6 != nil && !n.config.ULADerived && !d.dryRun() {
+		if allocatedv6, err = requestExternalAddress(ipamURL, ipamTimeout, nid, eid, ipFamilyV6, n.config.PoolIPv6); err != nil {
+			return nil, err
+		}
+		ei.AddressIPv6 = allocatedv6
+		if err = n.config.validateEndpointAddress(ei); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create and add the endpoint, unless what was provided is already used. Checking and adding under one lock
+	// keeps concurrent requests from both claiming the same MAC or address.
 	n.Lock()
-	endpoint := &bridgeEndpoint{id: eid, nid: nid, config: epConfig}
+	if conflict := n.endpointConflict(eid, ei); conflict != "" {
+		n.Unlock()
+		return nil, types.BadRequestErrorf("%s", conflict)
+	}
+	endpoint := &bridgeEndpoint{id: eid, nid: nid, config: epConfig, meta: epConfig.Meta, macAddress: ei.MacAddress,
+		addr: ei.Address, addrv6: ei.AddressIPv6}
 	n.endpoints[eid] = endpoint
 	n.Unlock()
 
@@ -680,13 +1678,13 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 	}()
 
 	// Generate a name for what will be the host side pipe interface
-	hostIfName, err := netutils.GenerateIfaceName(d.nlh, vethPrefix, vethLen)
+	hostIfName, err := generateIfaceName(d.nlh, vethPrefix, vethLen)
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate a name for what will be the sandbox side pipe interface
-	containerIfName, err := netutils.GenerateIfaceName(d.nlh, vethPrefix, vethLen)
+	containerIfName, err := generateIfaceName(d.nlh, vethPrefix, vethLen)
 	if err != nil {
 		return nil, err
 	}
@@ -696,13 +1694,13 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 		LinkAttrs: netlink.LinkAttrs{Name: hostIfName, TxQLen: 0},
 		PeerName:  containerIfName}
 	if err = d.nlh.LinkAdd(veth); err != nil {
-		return nil, types.InternalErrorf("failed to add the host (%s) <=> sandbox (%s) pair interfaces: %v", hostIfName, containerIfName, err)
+		return nil, internalErrorf("failed to add the host (%s) <=> sandbox (%s) pair interfaces: %v", hostIfName, containerIfName, err)
 	}
 
 	// Get the host side pipe interface handler
 	host, err := d.nlh.LinkByName(hostIfName)
 	if err != nil {
-		return nil, types.InternalErrorf("failed to find host side interface %s: %v", hostIfName, err)
+		return nil, internalErrorf("failed to find host side interface %s: %v", hostIfName, err)
 	}
 	defer func() {
 		if err != nil {
@@ -715,7 +1713,7 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 	// Get the sandbox side pipe interface handler
 	sbox, err := d.nlh.LinkByName(containerIfName)
 	if err != nil {
-		return nil, types.InternalErrorf("failed to find sandbox side interface %s: %v", containerIfName, err)
+		return nil, internalErrorf("failed to find sandbox side interface %s: %v", containerIfName, err)
 	}
 	defer func() {
 		if err != nil {
@@ -729,21 +1727,27 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 	config := n.config
 	n.Unlock()
 
-	// Add bridge inherited attributes to pipe interfaces
-	if config.Mtu != 0 {
-		err = d.nlh.LinkSetMTU(host, config.Mtu)
+	// Add bridge inherited attributes to pipe interfaces, unless the endpoint asked for its own MTU.
+	mtu := config.Mtu
+	if epConfig.MTU != 0 {
+		mtu = epConfig.MTU
+	}
+	if mtu != 0 {
+		err = d.nlh.LinkSetMTU(host, mtu)
 		if err != nil {
-			return nil, types.InternalErrorf("failed to set MTU on host interface %s: %v", hostIfName, err)
+			return nil, internalErrorf("failed to set MTU on host interface %s: %v", hostIfName, err)
 		}
-		err = d.nlh.LinkSetMTU(sbox, config.Mtu)
+		err = d.nlh.LinkSetMTU(sbox, mtu)
 		if err != nil {
-			return nil, types.InternalErrorf("failed to set MTU on sandbox interface %s: %v", containerIfName, err)
+			return nil, internalErrorf("failed to set MTU on sandbox interface %s: %v", containerIfName, err)
 		}
+	} else {
+		mtu = defaultMTU
 	}
 
 	// Attach host side pipe interface into the bridge
 	if err = addToBridge(d.nlh, hostIfName, config.BridgeName); err != nil {
-		return nil, fmt.Errorf("adding interface %s to bridge %s failed: %v", hostIfName, config.BridgeName, err)
+		return nil, fmt.Errorf("adding interface %s to bridge %s failed: %w", hostIfName, config.BridgeName, err)
 	}
 
 	// Allow packets to enter and leave the same (bridge) interface.
@@ -752,33 +1756,98 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 		return nil, err
 	}
 
+	if learning := n.portLearning(endpoint); learning != nil {
+		if err = d.nlh.LinkSetLearning(host, *learning); err != nil {
+			return nil, internalErrorf("failed to set MAC learning on host interface %s: %v", hostIfName, err)
+		}
+	}
+
+	// Give traffic from the container an internal priority according to its DSCP mark.
+	if len(config.DSCPMap) != 0 && !d.dryRun() {
+		if err = setupDSCPMap(hostIfName, config.DSCPMap); err != nil {
+			return nil, internalErrorf("failed to install DSCP map on host interface %s: %v", hostIfName, err)
+		}
+	}
+
+	// Protect the bridge from broadcast storms sent by the container.
+	if config.BUMRateLimit != 0 && !d.dryRun() {
+		if err = setupBUMPolicer(hostIfName, config.BUMRateLimit); err != nil {
+			return nil, internalErrorf("failed to install BUM policer on host interface %s: %v", hostIfName, err)
+		}
+	}
+
 	// Store the sandbox side pipe interface parameters
+	n.Lock()
 	endpoint.srcName = containerIfName
-	endpoint.macAddress = ei.MacAddress
-	endpoint.addr = ei.Address
-	endpoint.addrv6 = ei.AddressIPv6
+	endpoint.hostIfName = hostIfName
+	n.Unlock()
+
+	// Mark the pipe as made by the driver, now that the endpoint holds it, so that Reconcile may delete it once
+	// orphaned.
+	for _, link := range []netlink.Link{host, sbox} {
+		if err := d.nlh.LinkSetAlias(link, ownedLinkAlias); err != nil {
+			logrus.WithError(err).Warnf("Failed to set alias of interface %s", link.Attrs().Name)
+		}
+	}
+
+	// Libnetwork knows nothing of a derived pool, so the endpoint is given an address from it here.
+	if endpoint.addrv6 == nil && config.ULADerived && epConfig.wantsIPv6() {
+		if err = n.assignEndpointULA(endpoint); err != nil {
+			return nil, err
+		}
+	}
 
-	// Set default gateway info if this endpoint is not the networks gatway.
-	if gw := n.config.DefaultGatewayIPv4; gw != nil && !gw.Equal(endpoint.addr.IP) {
+	// Set default gateway info, for the families the endpoint asked for, if this endpoint is not the networks gatway.
+	// An endpoint in a secondary subnet is given that subnet's gateway.
+	if gw := n.config.gatewayIPv4For(endpoint.addr); gw != nil && epConfig.wantsIPv4() && endpoint.addr != nil && !gw.Equal(endpoint.addr.IP) {
 		endpoint.gatewayv4 = gw
 	}
-	if gw := n.config.DefaultGatewayIPv6; gw != nil && !gw.Equal(endpoint.addr.IP) {
+	if gw := n.config.gatewayIPv6For(endpoint.addrv6); gw != nil && epConfig.wantsIPv6() && (endpoint.addrv6 == nil || !gw.Equal(endpoint.addrv6.IP)) {
 		endpoint.gatewayv6 = gw
 	}
 
-	// Set the sbox's MAC if not provided. If specified, use the one configured by user, otherwise generate one based on IP.
-	eiOut := &EndpointInterface{}
+	// Set the sbox's MAC if not provided. If specified, use the one configured by user, otherwise generate one not
+	// used by another endpoint of the network.
+	eiOut := &EndpointInterface{Address: allocated, AddressIPv6: allocatedv6}
 	if endpoint.macAddress == nil {
-		endpoint.macAddress = netutils.GenerateRandomMAC()
+		for attempt := 0; ; attempt++ {
+			mac := netutils.GenerateRandomMAC()
+			n.Lock()
+			conflict := n.endpointConflict(eid, &EndpointInterface{MacAddress: mac})
+			if conflict == "" {
+				endpoint.macAddress = mac
+			}
+			n.Unlock()
+			if conflict == "" {
+				break
+			}
+			if attempt >= maxReservedRetries {
+				err = types.InternalErrorf("failed to generate a MAC address for endpoint %s: %s", eid, conflict)
+				return nil, err
+			}
+		}
 		eiOut.MacAddress = endpoint.macAddress
 	}
+	if config.ULADerived && ei.AddressIPv6 == nil {
+		eiOut.AddressIPv6 = endpoint.addrv6
+	}
 
 	// Up the host interface after finishing all netlink configuration
 	if err = d.nlh.LinkSetUp(host); err != nil {
-		return nil, fmt.Errorf("could not set link up for host interface %s: %v", hostIfName, err)
+		return nil, fmt.Errorf("could not set link up for host interface %s: %w", hostIfName, err)
 	}
 
-	if endpoint.addrv6 == nil && config.EnableIPv6 {
+	// Keep TCP working between endpoints of differing MTUs.
+	n.Lock()
+	endpoint.mtu = mtu
+	n.Unlock()
+	if config.MSSClamp && !d.dryRun() {
+		if err = n.updateMSSClamp(); err != nil {
+			return nil, internalErrorf("failed to update MSS clamping on bridge %s: %v", config.BridgeName, err)
+		}
+	}
+
+	if endpoint.addrv6 == nil && config.EnableIPv6 && epConfig.wantsIPv6() {
 		var ip6 net.IP
 		network := n.config.PoolIPv6
 		if config.PoolIPv6 != nil {
@@ -791,25 +1860,85 @@ func (d *bridgeDriver) CreateEndpoint(nid, eid string, ei *EndpointInterface, ep
 			return nil, err
 		}
 
-		ip6 = make(net.IP, len(network.IP))
-		copy(ip6, network.IP)
-		for i, h := range endpoint.macAddress {
-			ip6[i+10] = h
+		// Derive the address from the MAC, picking another MAC if we chose it and the address is reserved or used.
+		for attempt := 0; ; attempt++ {
+			ip6 = make(net.IP, len(network.IP))
+			copy(ip6, network.IP)
+			for i, h := range endpoint.macAddress {
+				ip6[i+10] = h
+			}
+			r, reserved := n.config.reservedRange(ip6)
+			n.Lock()
+			conflict := n.endpointConflict(eid, &EndpointInterface{AddressIPv6: &net.IPNet{IP: ip6, Mask: network.Mask}})
+			if !reserved && conflict == "" {
+				endpoint.addrv6 = &net.IPNet{IP: ip6, Mask: network.Mask}
+			}
+			n.Unlock()
+			if !reserved && conflict == "" {
+				break
+			}
+			if eiOut.MacAddress == nil || attempt >= maxReservedRetries {
+				if reserved {
+					err = types.ForbiddenErrorf("self generated IPv6 address %s is in the reserved range %s", ip6, r)
+				} else {
+					err = types.ForbiddenErrorf("self generated IPv6 %s", conflict)
+				}
+				return nil, err
+			}
+			n.Lock()
+			endpoint.macAddress = netutils.GenerateRandomMAC()
+			n.Unlock()
+			eiOut.MacAddress = endpoint.macAddress
 		}
 
-		endpoint.addrv6 = &net.IPNet{IP: ip6, Mask: network.Mask}
 		eiOut.AddressIPv6 = endpoint.addrv6
 	}
 
-	// TODO(nategraf) Implement storage.
-	//if err = d.storeUpdate(endpoint); err != nil {
-	//	return nil, fmt.Errorf("failed to save bridge endpoint %.7s to store: %v", endpoint.id, err)
-	//}
+	// The container interface carries the MAC into the sandbox. A requested MAC is already known to libnetwork, which
+	// refuses to have it returned, so only a generated one is part of the response.
+	if err = d.nlh.LinkSetHardwareAddr(sbox, endpoint.macAddress); err != nil {
+		return nil, internalErrorf("failed to set MAC address %s on sandbox interface %s: %v", endpoint.macAddress, containerIfName, err)
+	}
+
+	// Lease an address from the segment's DHCP server when libnetwork provided none. The container interface is still
+	// in the host namespace, so the exchange runs there, and the veth is deleted if it fails or times out.
+	if config.DHCP && endpoint.addr == nil && epConfig.wantsIPv4() && !d.dryRun() {
+		var lease *dhcpLease
+		if lease, err = n.acquireDHCPLease(endpoint); err != nil {
+			return nil, err
+		}
+		n.Lock()
+		endpoint.dhcp = lease
+		conflict := n.endpointConflict(eid, &EndpointInterface{Address: lease.Addr})
+		if conflict == "" {
+			endpoint.addr = lease.Addr
+			if lease.Router != nil {
+				endpoint.gatewayv4 = lease.Router
+			}
+		}
+		n.Unlock()
+		defer func() {
+			if err != nil {
+				n.releaseDHCPLease(endpoint, "")
+			}
+		}()
+		if conflict != "" {
+			err = types.BadRequestErrorf("DHCP leased %s", conflict)
+			return nil, err
+		}
+		eiOut.Address = lease.Addr
+	}
+
+	if err = d.storeUpdate(); err != nil {
+		return nil, fmt.Errorf("failed to save bridge endpoint %.7s to store: %w", endpoint.id, err)
+	}
+
+	n.updatePeerPolicies()
 
 	return eiOut, nil
 }
 
-func (d *bridgeDriver) DeleteEndpoint(nid, eid string) error {
+func (d *bridgeDriver) deleteEndpoint(nid, eid string) error {
 	var err error
 
 	defer osl.InitOSContext()()
@@ -845,18 +1974,70 @@ func (d *bridgeDriver) DeleteEndpoint(nid, eid string) error {
 		}
 	}()
 
+	// An endpoint deleted without its external connectivity revoked, nor leaving, still publishes its ports and is
+	// masqueraded. Both are no-ops once revoked.
+	if err := n.revokePortMapping(ep); err != nil {
+		logrus.WithError(err).Warnf("Failed to remove port mapping rules on endpoint (%s) delete", ep.id)
+	}
+	if err := n.revokeMasquerade(ep); err != nil {
+		logrus.WithError(err).Warnf("Failed to remove masquerading rules on endpoint (%s) delete", ep.id)
+	}
+
+	if d.dryRun() {
+		if link, err := d.nlh.LinkByName(ep.hostIfName); err == nil {
+			d.nlh.LinkDel(link)
+		}
+		logrus.Infof("Dry run: deleted endpoint %s", eid)
+		return nil
+	}
+
+	if n.config.BUMRateLimit != 0 {
+		err := removeBUMPolicer(ep.hostIfName)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove BUM policer from interface (%s) on endpoint (%s) delete", ep.hostIfName, ep.id)
+		}
+		d.countRuleRemoval("tc", err)
+	}
+	if len(n.config.DSCPMap) != 0 {
+		err := removeDSCPMap(ep.hostIfName)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove DSCP map from interface (%s) on endpoint (%s) delete", ep.hostIfName, ep.id)
+		}
+		d.countRuleRemoval("tc", err)
+	}
+
+	// An endpoint deleted without leaving, or never joined, still holds its lease, and if joined its FDB entries.
+	n.releaseDHCPLease(ep, ep.sandboxKey)
+	n.removeEndpointFDB(ep)
+
 	// Try removal of link. Discard error: it is a best effort.
 	// Also make sure defer does not see this error either.
 	if link, err := d.nlh.LinkByName(ep.srcName); err == nil {
 		if err := d.nlh.LinkDel(link); err != nil {
 			logrus.WithError(err).Errorf("Failed to delete interface (%s)'s link on endpoint (%s) delete", ep.srcName, ep.id)
+		} else {
+			d.metrics.inc(metricVethsDeleted)
 		}
+	} else {
+		d.metrics.inc(metricTeardownMissing, "kind", "veth")
 	}
+	d.verifyLinkGone(ep.hostIfName)
 
-	// TODO(nategraf) Implement storage.
-	//if err := d.storeDelete(ep); err != nil {
-	//	logrus.Warnf("Failed to remove bridge endpoint %.7s from store: %v", ep.id, err)
-	//}
+	if n.config.MSSClamp {
+		if err := n.updateMSSClamp(); err != nil {
+			logrus.WithError(err).Warnf("Failed to update MSS clamping on endpoint (%s) delete", ep.id)
+		}
+	}
+
+	// Stale connection tracking state would misdirect traffic to the next holder of the addresses.
+	if n.config.FlushConntrack {
+		if err := flushConntrack(d.nlh, ep.addresses()...); err != nil {
+			logrus.WithError(err).Warnf("Failed to flush conntrack entries on endpoint (%s) delete", ep.id)
+		}
+	}
+
+	n.updatePeerPolicies()
+	d.storeSync("endpoint delete")
 
 	return nil
 }
@@ -888,6 +2069,14 @@ func (d *bridgeDriver) EndpointInfo(nid, eid string) (map[string]string, error)
 		m[netlabel.ExposedPorts] = strings.Join(strs, ",")
 	}
 
+	if ep.portMapping != nil {
+		strs := make([]string, 0, len(ep.portMapping))
+		for _, pb := range ep.portMapping {
+			strs = append(strs, pb.String())
+		}
+		m[netlabel.PortMap] = strings.Join(strs, ",")
+	}
+
 	if ep.macAddress != nil {
 		m[netlabel.MacAddress] = ep.macAddress.String()
 	}
@@ -898,11 +2087,205 @@ func (d *bridgeDriver) EndpointInfo(nid, eid string) (map[string]string, error)
 		m[netlabel.Gateway] = ep.gatewayv6.String()
 	}
 
+	if n.config.VLANStats && ep.hostIfName != "" {
+		stats, err := d.vlanCounters(ep.hostIfName)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to read VLAN stats of endpoint (%s)", eid)
+		}
+		for _, s := range stats {
+			s.report(m)
+		}
+	}
+
+	if ep.config != nil && ep.config.TempAddr != "" {
+		m[label.UseTempAddr] = ep.config.TempAddr
+	}
+	if ep.config != nil && ep.config.PortGroup != "" {
+		m[label.PortGroup] = ep.config.PortGroup
+	}
+	if ep.mtu != 0 {
+		m[label.MTU] = strconv.Itoa(ep.mtu)
+	}
+	m[label.BridgeName] = n.config.BridgeName
+	m[label.Bridge] = n.config.BridgeName
+	if stp, err := bridgeSTPState(n.config.BridgeName); err == nil {
+		m[label.STP] = strconv.FormatBool(stp)
+	}
+	n.reportLinkFlags(d.nlh, ep, m)
+	if n.config.VLAN != 0 {
+		m[label.VLAN] = strconv.Itoa(n.config.VLAN)
+	}
+	if ep.vlan != nil {
+		ep.vlan.report(m)
+	}
+	if ep.config != nil && ep.config.MaxConns != 0 {
+		m[label.MaxConns] = strconv.FormatUint(uint64(ep.config.MaxConns), 10)
+	}
+	if ep.config != nil && ep.config.Bandwidth != 0 {
+		m[label.Bandwidth] = strconv.FormatUint(ep.config.Bandwidth, 10) + "bit"
+	}
+	if ep.config != nil && len(ep.config.Peers) != 0 {
+		m[label.Peers] = strings.Join(ep.config.Peers, ",")
+	}
+	if ep.config != nil && len(ep.config.FDB) != 0 {
+		entries := make([]string, len(ep.config.FDB))
+		for i, e := range ep.config.FDB {
+			entries[i] = e.MAC.String() + "@" + e.Port
+		}
+		m[label.EndpointFDB] = strings.Join(entries, ",")
+	}
+
+	m[label.IPFamily] = ipFamilyDual
+	if ep.config != nil && ep.config.IPFamily != "" {
+		m[label.IPFamily] = ep.config.IPFamily
+	}
+
+	n.Lock()
+	ep.reportInterface(m)
+	if ep.dhcp != nil && !ep.dhcp.Released {
+		m[label.DHCPServer] = ep.dhcp.Server.String()
+		if len(ep.dhcp.DNS) != 0 {
+			m[label.DHCPDNS] = ep.dhcp.dnsServers()
+		}
+	}
+	for k, v := range ep.meta {
+		m[label.MetaPrefix+k] = v
+	}
+	if n.draining {
+		m[label.NetworkDraining] = "true"
+	}
+	if ep.gwReachable != "" {
+		m[label.GatewayReachable] = ep.gwReachable
+	}
+	ep.lastErr.report(m, label.LastErrorPrefix)
+	n.lastErr.report(m, label.NetworkLastErrorPrefix)
+	n.Unlock()
+
+	d.reportBridgeVLANs(nid, m)
 	return m, nil
 }
 
-// Join method is invoked when a Sandbox is attached to an endpoint.
-func (d *bridgeDriver) Join(nid, eid, sboxKey string, opts map[string]interface{}) (*JoinResponse, error) {
+// reportInterface adds the endpoint's interfaces, sandbox and addresses to the endpoint info. The caller must hold
+// the network lock.
+func (ep *bridgeEndpoint) reportInterface(m map[string]string) {
+	if ep.hostIfName != "" {
+		m[label.HostIface] = ep.hostIfName
+	}
+	if ep.sandboxKey != "" {
+		m[label.SandboxKey] = ep.sandboxKey
+	}
+	if ep.macAddress != nil {
+		m[label.MACAddress] = ep.macAddress.String()
+	}
+	if ep.addr != nil && (ep.config == nil || ep.config.wantsIPv4()) {
+		m[label.IPv4Address] = ep.addr.String()
+	}
+	if ep.addrv6 != nil && (ep.config == nil || ep.config.wantsIPv6()) {
+		m[label.IPv6Address] = ep.addrv6.String()
+	}
+}
+
+// SetNetworkDraining starts or stops draining a network. A draining network rejects new endpoints and joins, while
+// existing endpoints may still leave and be deleted.
+func (d *bridgeDriver) SetNetworkDraining(nid string, on bool) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	n.draining = on
+	n.Unlock()
+	logrus.Infof("Network %s draining: %t", nid, on)
+	d.storeSync("network drain")
+	return nil
+}
+
+// SetNetworkLogging enables or disables the logging of successful requests on a network. Failed requests are always
+// logged.
+func (d *bridgeDriver) SetNetworkLogging(nid string, on bool) error {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	n.quiet = !on
+	n.Unlock()
+	logrus.Infof("Network %s request logging: %t", nid, on)
+	d.storeSync("network logging change")
+	return nil
+}
+
+// isQuiet reports whether successful requests on the network are left out of the log.
+func (d *bridgeDriver) isQuiet(nid string) bool {
+	d.Lock()
+	n, ok := d.networks[nid]
+	d.Unlock()
+	if !ok {
+		return false
+	}
+	n.Lock()
+	defer n.Unlock()
+	return n.quiet
+}
+
+// isDraining reports whether the network rejects new endpoints and joins.
+func (n *bridgeNetwork) isDraining() bool {
+	n.Lock()
+	defer n.Unlock()
+	return n.draining
+}
+
+// SetEndpointMeta replaces the opaque metadata stored on an endpoint.
+func (d *bridgeDriver) SetEndpointMeta(nid, eid string, meta map[string]string) error {
+	defer d.lockNetwork(nid)()
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	if err := validateEndpointMeta(meta); err != nil {
+		return err
+	}
+
+	copied := make(map[string]string, len(meta))
+	for k, v := range meta {
+		copied[k] = v
+	}
+
+	n.Lock()
+	ep.meta = copied
+	n.Unlock()
+	d.storeSync("endpoint metadata change")
+	return nil
+}
+
+// validateEndpointMeta checks the endpoint metadata keys are set and their total size is within bounds.
+func validateEndpointMeta(meta map[string]string) error {
+	size := 0
+	for k, v := range meta {
+		if k == "" {
+			return types.BadRequestErrorf("endpoint metadata keys must not be empty")
+		}
+		size += len(k) + len(v)
+	}
+	if size > maxEndpointMetaSize {
+		return types.BadRequestErrorf("endpoint metadata is %d bytes, exceeding the limit of %d bytes", size, maxEndpointMetaSize)
+	}
+	return nil
+}
+
+// join is invoked when a Sandbox is attached to an endpoint.
+func (d *bridgeDriver) join(nid, eid, sboxKey string, opts map[string]interface{}) (res *JoinResponse, err error) {
 	defer osl.InitOSContext()()
 
 	network, err := d.getNetwork(nid)
@@ -917,10 +2300,50 @@ func (d *bridgeDriver) Join(nid, eid, sboxKey string, opts map[string]interface{
 		return nil, EndpointNotFoundError(eid)
 	}
 
+	if network.isDraining() {
+		return nil, types.ForbiddenErrorf("network %s is draining and accepts no new joins", nid)
+	}
+
+	joinOpts, err := parseJoinOptions(network.config, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.ensureBridge(network); err != nil {
+		return nil, err
+	}
+
+	// An endpoint may only be joined to one sandbox at a time.
+	if endpoint.sandboxKey != "" && endpoint.sandboxKey != sboxKey {
+		if !network.config.AllowRejoin {
+			return nil, types.ForbiddenErrorf("endpoint %s is already joined to sandbox %s", eid, endpoint.sandboxKey)
+		}
+		logrus.Warnf("Endpoint (%s) joining sandbox %s, leaving sandbox %s", eid, sboxKey, endpoint.sandboxKey)
+		network.Lock()
+		oldKey := endpoint.sandboxKey
+		network.Unlock()
+		if d.dryRun() {
+			network.Lock()
+			endpoint.sandboxKey = ""
+			network.Unlock()
+		} else {
+			// Leave the old sandbox as Leave would, then take the container interface back out of it, which
+			// libnetwork only does itself on Leave, so that it can be moved into the new sandbox.
+			network.leaveEndpoint(endpoint)
+			d.storeSync("endpoint leave")
+			if err := reclaimSandboxInterface(oldKey, endpoint.macAddress, endpoint.srcName); err != nil {
+				return nil, internalErrorf("failed to take the interface of endpoint %s out of sandbox %s: %v", eid, oldKey, err)
+			}
+		}
+	}
+
 	containerVethPrefix := defaultContainerVethPrefix
 	if network.config.ContainerIfacePrefix != "" {
 		containerVethPrefix = network.config.ContainerIfacePrefix
 	}
+	if joinOpts.ifPrefix != "" {
+		containerVethPrefix = joinOpts.ifPrefix
+	}
 
 	if value, ok := opts[netlabel.ExposedPorts]; ok {
 		ports, err := parseTransportPorts(value)
@@ -931,21 +2354,196 @@ func (d *bridgeDriver) Join(nid, eid, sboxKey string, opts map[string]interface{
 		}
 	}
 
-	return &JoinResponse{
+	if endpoint.config.Antispoof {
+		if err := endpoint.validateAntispoof(); err != nil {
+			return nil, types.ForbiddenErrorf("cannot enable %s on endpoint %s: %v", label.Antispoof, eid, err)
+		}
+	}
+
+	if d.dryRun() {
+		network.Lock()
+		endpoint.sandboxKey = sboxKey
+		network.Unlock()
+		logrus.Infof("Dry run: joined endpoint %s to sandbox %s", eid, sboxKey)
+		return network.joinResponse(endpoint, joinOpts, containerVethPrefix), nil
+	}
+
+	// libnetwork does not call Leave after a failed join, so a failing step removes what the steps before it
+	// installed, in reverse order.
+	var undo []func()
+	defer func() {
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				undo[i]()
+			}
+		}
+	}()
+
+	// Take the lease up again before anything relies on the address, as it was released if the endpoint left a
+	// sandbox before.
+	network.Lock()
+	leased := endpoint.dhcp != nil
+	network.Unlock()
+	if leased {
+		if err := network.renewDHCPLease(endpoint); err != nil {
+			return nil, err
+		}
+		undo = append(undo, func() { network.releaseDHCPLease(endpoint, "") })
+	}
+
+	// Answer neighbor solicitations for the endpoint's address on the bridge.
+	if network.config.ProxyNDP && endpoint.addrv6 != nil && endpoint.config.wantsIPv6() {
+		if err := network.bridge.addProxyNeighbor(endpoint.addrv6.IP); err != nil {
+			return nil, internalErrorf("failed to add proxy neighbor entry for %s: %v", endpoint.addrv6.IP, err)
+		}
+		undo = append(undo, func() { network.bridge.delProxyNeighbor(endpoint.addrv6.IP) })
+	}
+
+	// Shape the traffic sent to the endpoint according to its port group.
+	if _, ok := network.config.PortGroups[endpoint.config.PortGroup]; ok {
+		if err := network.setupPortGroup(endpoint, endpoint.config.PortGroup); err != nil {
+			network.removePortGroup(endpoint)
+			return nil, internalErrorf("failed to place endpoint %s in port group %s: %v", eid, endpoint.config.PortGroup, err)
+		}
+		undo = append(undo, func() { network.removePortGroup(endpoint) })
+	}
+
+	// Cap the endpoint's traffic in both directions.
+	if rate := endpoint.config.Bandwidth; rate != 0 {
+		if err := endpoint.setupBandwidth(rate); err != nil {
+			endpoint.removeBandwidth()
+			return nil, internalErrorf("failed to limit bandwidth of endpoint %s: %v", eid, err)
+		}
+		undo = append(undo, func() { endpoint.removeBandwidth() })
+	}
+
+	// Drop anything the endpoint sends from addresses other than its own.
+	if endpoint.config.Antispoof {
+		if err := endpoint.setupAntispoof(); err != nil {
+			endpoint.removeAntispoof()
+			return nil, internalErrorf("failed to install anti-spoofing rules for endpoint %s: %v", eid, err)
+		}
+		undo = append(undo, func() { endpoint.removeAntispoof() })
+	}
+
+	// Bound the connections the endpoint may have open.
+	if limit := endpoint.config.MaxConns; limit != 0 {
+		if available, probed := d.kernelFeatures()[featureNFTables]; probed && !available {
+			return nil, types.NotImplementedErrorf("%s requires kernel support for %s, which is unavailable on this host", label.MaxConns, featureNFTables)
+		}
+		if err := d.requireModule("nf_conntrack_bridge"); err != nil {
+			return nil, err
+		}
+		if err := endpoint.setupConnLimit(limit); err != nil {
+			endpoint.removeConnLimit()
+			return nil, internalErrorf("failed to install connection limit for endpoint %s: %v", eid, err)
+		}
+		undo = append(undo, func() { endpoint.removeConnLimit() })
+	}
+
+	// Keep the endpoint from the network's other endpoints, bar its peers.
+	if len(endpoint.config.Peers) != 0 {
+		if available, probed := d.kernelFeatures()[featureNFTables]; probed && !available {
+			return nil, types.NotImplementedErrorf("%s requires kernel support for %s, which is unavailable on this host", label.Peers, featureNFTables)
+		}
+		if err := endpoint.setupPeerPolicy(); err != nil {
+			endpoint.removePeerPolicy()
+			return nil, internalErrorf("failed to install peer policy for endpoint %s: %v", eid, err)
+		}
+		network.Lock()
+		endpoint.peerPolicy = true
+		network.Unlock()
+		network.updatePeerPolicies()
+		undo = append(undo, func() {
+			network.Lock()
+			endpoint.peerPolicy = false
+			network.Unlock()
+			endpoint.removePeerPolicy()
+		})
+	}
+
+	// Pin the MAC addresses the endpoint forwards to onto their ports.
+	if len(endpoint.config.FDB) != 0 {
+		if err := network.setupEndpointFDB(endpoint); err != nil {
+			network.removeEndpointFDB(endpoint)
+			return nil, err
+		}
+	}
+
+	res = network.joinResponse(endpoint, joinOpts, containerVethPrefix)
+	if sysctls := endpoint.sandboxSysctls(res); len(sysctls) != 0 {
+		replaced, err := applyContainerSysctls(sboxKey, sysctls)
+		if err != nil {
+			applyContainerSysctls(sboxKey, replaced)
+			return nil, internalErrorf("failed to set sysctls for endpoint %s: %v", eid, err)
+		}
+		network.Lock()
+		endpoint.replacedSysctls = replaced
+		network.Unlock()
+	}
+
+	network.Lock()
+	endpoint.sandboxKey = sboxKey
+	network.Unlock()
+	d.storeSync("endpoint join")
+
+	// The container interface only moves into the sandbox after Join returns, so the gateway is checked in the
+	// background.
+	if endpoint.config.VerifyGW {
+		d.verifyGateway(network, endpoint, sboxKey)
+	}
+	if leased {
+		network.keepDHCPLease(endpoint, sboxKey)
+	}
+	return res, nil
+}
+
+// joinResponse builds the response to a join of the endpoint, giving the container interface the given prefix.
+func (n *bridgeNetwork) joinResponse(endpoint *bridgeEndpoint, joinOpts *joinOptions, containerVethPrefix string) *JoinResponse {
+	// The gateways requested on join override those of the endpoint.
+	gatewayv4, gatewayv6 := endpoint.gatewayv4, endpoint.gatewayv6
+	if joinOpts.gateway != nil {
+		gatewayv4 = joinOpts.gateway
+	}
+	if joinOpts.gatewayv6 != nil {
+		gatewayv6 = joinOpts.gatewayv6
+	}
+	if joinOpts.noGateway {
+		gatewayv4, gatewayv6 = nil, nil
+	}
+
+	res := &JoinResponse{
 		InterfaceName: InterfaceName{
 			SrcName:   endpoint.srcName,
 			DstPrefix: containerVethPrefix,
 		},
-		Gateway:     endpoint.gatewayv4,
-		GatewayIPv6: endpoint.gatewayv6,
-		// Prevent Docker from creating a default gateway for us.
-		DisableGatewayService: true,
-	}, nil
+		Gateway:     gatewayv4,
+		GatewayIPv6: gatewayv6,
+		// Unless asked otherwise, prevent Docker from creating a default gateway for us.
+		DisableGatewayService: !n.config.GatewayService,
+	}
+
+	// Rather than relying on the gateway being on-link, route to it explicitly and through it by default.
+	if n.config.IPv6GatewayRouted && gatewayv6 != nil {
+		res.GatewayIPv6 = nil
+		res.StaticRoutes = append(res.StaticRoutes,
+			&StaticRoute{
+				Destination: &net.IPNet{IP: gatewayv6, Mask: net.CIDRMask(128, 128)},
+				RouteType:   types.CONNECTED,
+			},
+			&StaticRoute{
+				Destination: &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+				RouteType:   types.NEXTHOP,
+				NextHop:     gatewayv6,
+			},
+		)
+	}
+	return res
 }
 
-// Leave method is invoked when a Sandbox detaches from an endpoint.
-// Currently this is just a couple sanity checks to better report errors.
-func (d *bridgeDriver) Leave(nid, eid string) error {
+// leave is invoked when a Sandbox detaches from an endpoint.
+// Beyond a couple sanity checks to better report errors, it removes any state installed by Join.
+func (d *bridgeDriver) leave(nid, eid string) error {
 	defer osl.InitOSContext()()
 
 	network, err := d.getNetwork(nid)
@@ -961,15 +2559,105 @@ func (d *bridgeDriver) Leave(nid, eid string) error {
 		return EndpointNotFoundError(eid)
 	}
 
+	if d.dryRun() {
+		network.Lock()
+		endpoint.sandboxKey = ""
+		network.Unlock()
+		logrus.Infof("Dry run: endpoint %s left its sandbox", eid)
+		return nil
+	}
+
+	network.leaveEndpoint(endpoint)
+	d.releaseLazyBridge(network)
+	d.storeSync("endpoint leave")
 	return nil
 }
 
-func parseEndpointOptions(epOptions map[string]interface{}) (*endpointConfiguration, error) {
-	if epOptions == nil {
-		return nil, nil
+// leaveEndpoint removes the state installed when the endpoint joined its sandbox. It is best effort.
+func (n *bridgeNetwork) leaveEndpoint(ep *bridgeEndpoint) {
+	if n.config.ProxyNDP && ep.addrv6 != nil && ep.config.wantsIPv6() {
+		err := n.bridge.delProxyNeighbor(ep.addrv6.IP)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove proxy neighbor entry for %s on endpoint (%s) leave", ep.addrv6.IP, ep.id)
+		}
+		n.driver.countRuleRemoval("neighbor", err)
+	}
+
+	if _, ok := n.config.PortGroups[ep.config.PortGroup]; ok {
+		err := n.removePortGroup(ep)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove port group shaping on endpoint (%s) leave", ep.id)
+		}
+		n.driver.countRuleRemoval("tc", err)
+	}
+
+	if ep.config.Bandwidth != 0 {
+		err := ep.removeBandwidth()
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove bandwidth limit on endpoint (%s) leave", ep.id)
+		}
+		n.driver.countRuleRemoval("tc", err)
+	}
+
+	if ep.config.Antispoof {
+		err := ep.removeAntispoof()
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove anti-spoofing rules on endpoint (%s) leave", ep.id)
+		}
+		n.driver.countRuleRemoval("ebtables", err)
+		n.driver.verifyAntispoofGone(ep)
+	}
+
+	if ep.config.MaxConns != 0 {
+		err := ep.removeConnLimit()
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove connection limit on endpoint (%s) leave", ep.id)
+		}
+		n.driver.countRuleRemoval("nftables", err)
 	}
 
+	if err := n.revokePortMapping(ep); err != nil {
+		logrus.WithError(err).Warnf("Failed to remove port mapping rules on endpoint (%s) leave", ep.id)
+	}
+	if err := n.revokeMasquerade(ep); err != nil {
+		logrus.WithError(err).Warnf("Failed to remove masquerading rules on endpoint (%s) leave", ep.id)
+	}
+
+	n.Lock()
+	policy := ep.peerPolicy
+	ep.peerPolicy = false
+	n.Unlock()
+	if policy {
+		err := ep.removePeerPolicy()
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to remove peer policy on endpoint (%s) leave", ep.id)
+		}
+		n.driver.countRuleRemoval("nftables", err)
+	}
+
+	n.removeEndpointFDB(ep)
+
+	n.Lock()
+	sandboxKey := ep.sandboxKey
+	n.Unlock()
+	n.releaseDHCPLease(ep, sandboxKey)
+	n.restoreContainerSysctls(ep, sandboxKey)
+
+	n.Lock()
+	ep.sandboxKey = ""
+	ep.gwReachable = ""
+	if ep.gwCheckStop != nil {
+		close(ep.gwCheckStop)
+		ep.gwCheckStop = nil
+	}
+	n.Unlock()
+}
+
+func parseEndpointOptions(epOptions map[string]interface{}) (*endpointConfiguration, error) {
 	ec := &endpointConfiguration{}
+	if epOptions == nil {
+		return ec, nil
+	}
 
 	if opt, ok := epOptions[netlabel.MacAddress]; ok {
 		if mac, ok := opt.(net.HardwareAddr); ok {
@@ -979,6 +2667,142 @@ func parseEndpointOptions(epOptions map[string]interface{}) (*endpointConfigurat
 		}
 	}
 
+	if opt, ok := epOptions[label.PortGroup]; ok {
+		group, ok := opt.(string)
+		if !ok {
+			return nil, types.BadRequestErrorf("unrecognized type for %s: %T", label.PortGroup, opt)
+		}
+		ec.PortGroup = group
+	}
+
+	if opt, ok := epOptions[label.Antispoof]; ok {
+		antispoof, err := parseBoolLabel(label.Antispoof, opt)
+		if err != nil {
+			return nil, types.BadRequestErrorf("%v", err)
+		}
+		ec.Antispoof = antispoof
+	}
+
+	if opt, ok := epOptions[label.Learning]; ok {
+		learning, err := parseBoolLabel(label.Learning, opt)
+		if err != nil {
+			return nil, types.BadRequestErrorf("%v", err)
+		}
+		ec.Learning = &learning
+	}
+
+	if opt, ok := epOptions[label.MTU]; ok {
+		mtu, err := strconv.Atoi(fmt.Sprint(opt))
+		if err != nil || mtu < minMTU || mtu > maxMTU {
+			return nil, types.BadRequestErrorf("invalid %s %v: must be between %d and %d", label.MTU, opt, minMTU, maxMTU)
+		}
+		ec.MTU = mtu
+	}
+
+	if opt, ok := epOptions[label.MaxConns]; ok {
+		limit, err := parseConnLimit(fmt.Sprint(opt))
+		if err != nil {
+			return nil, types.BadRequestErrorf("invalid %s %v: %v", label.MaxConns, opt, err)
+		}
+		ec.MaxConns = limit
+	}
+
+	if opt, ok := epOptions[label.Bandwidth]; ok {
+		rate, err := parseRate(fmt.Sprint(opt))
+		if err != nil {
+			return nil, types.BadRequestErrorf("invalid %s %v: %v", label.Bandwidth, opt, err)
+		}
+		if ec.PortGroup != "" {
+			return nil, types.BadRequestErrorf("%s cannot be combined with %s", label.Bandwidth, label.PortGroup)
+		}
+		ec.Bandwidth = rate
+	}
+
+	if opt, ok := epOptions[label.Peers]; ok {
+		s, ok := opt.(string)
+		if !ok {
+			return nil, types.BadRequestErrorf("unrecognized type for %s: %T", label.Peers, opt)
+		}
+		peers, err := parsePeers(s)
+		if err != nil {
+			return nil, types.BadRequestErrorf("invalid %s %v: %v", label.Peers, opt, err)
+		}
+		ec.Peers = peers
+	}
+
+	if opt, ok := epOptions[label.EndpointFDB]; ok {
+		s, ok := opt.(string)
+		if !ok {
+			return nil, types.BadRequestErrorf("unrecognized type for %s: %T", label.EndpointFDB, opt)
+		}
+		fdb, err := parseEndpointFDB(s)
+		if err != nil {
+			return nil, types.BadRequestErrorf("invalid %s %v: %v", label.EndpointFDB, opt, err)
+		}
+		ec.FDB = fdb
+	}
+
+	if opt, ok := epOptions[label.VerifyGateway]; ok {
+		verify, err := parseBoolLabel(label.VerifyGateway, opt)
+		if err != nil {
+			return nil, types.BadRequestErrorf("%v", err)
+		}
+		ec.VerifyGW = verify
+	}
+
+	if opt, ok := epOptions[label.UseTempAddr]; ok {
+		switch v := fmt.Sprint(opt); v {
+		case "0", "1", "2":
+			ec.TempAddr = v
+		default:
+			return nil, types.BadRequestErrorf("invalid %s %v: must be 0, 1 or 2", label.UseTempAddr, opt)
+		}
+	}
+
+	if opt, ok := epOptions[label.IPFamily]; ok {
+		family, _ := opt.(string)
+		switch family {
+		case ipFamilyV4, ipFamilyV6, ipFamilyDual:
+			ec.IPFamily = family
+		default:
+			return nil, types.BadRequestErrorf("invalid %s %v: must be one of v4, v6 or dual", label.IPFamily, opt)
+		}
+	}
+
+	for key, value := range epOptions {
+		if !strings.HasPrefix(key, label.ContainerSysctlPrefix) {
+			continue
+		}
+		v, ok := value.(string)
+		if !ok {
+			return nil, types.BadRequestErrorf("unrecognized type for %s: %T", key, value)
+		}
+		if ec.Sysctls == nil {
+			ec.Sysctls = make(map[string]string)
+		}
+		ec.Sysctls[strings.TrimPrefix(key, label.ContainerSysctlPrefix)] = v
+	}
+	if err := validateContainerSysctls(ec.Sysctls); err != nil {
+		return nil, types.ForbiddenErrorf("%v", err)
+	}
+
+	for key, value := range epOptions {
+		if !strings.HasPrefix(key, label.MetaPrefix) {
+			continue
+		}
+		v, ok := value.(string)
+		if !ok {
+			return nil, types.BadRequestErrorf("unrecognized type for %s: %T", key, value)
+		}
+		if ec.Meta == nil {
+			ec.Meta = make(map[string]string)
+		}
+		ec.Meta[strings.TrimPrefix(key, label.MetaPrefix)] = v
+	}
+	if err := validateEndpointMeta(ec.Meta); err != nil {
+		return nil, err
+	}
+
 	return ec, nil
 }
 
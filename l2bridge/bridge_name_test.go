@@ -0,0 +1,75 @@
+package l2bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+)
+
+func TestCreateNetworkBridgeNameTaken(t *testing.T) {
+	tests := []struct {
+		name      string
+		link      netlink.Link
+		errType   string
+		errSubstr string
+	}{
+		{name: "free"},
+		{name: "dummy", link: &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "l2b-test"}}, errType: "badrequest", errSubstr: "non-bridge device of type dummy"},
+		{name: "foreign bridge", link: &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "l2b-test"}}, errType: "forbidden", errSubstr: "not created by this driver"},
+		{name: "owned bridge", link: &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "l2b-test", Alias: ownedLinkAlias}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			if tt.link != nil {
+				d.nlh.LinkAdd(tt.link)
+			}
+			opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.BridgeName: "l2b-test"}}
+			err := d.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil)
+			switch tt.errType {
+			case "badrequest":
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+			case "forbidden":
+				if _, ok := err.(types.ForbiddenError); !ok {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !strings.Contains(err.Error(), tt.errSubstr) {
+				t.Errorf("expected an error containing %q, got %v", tt.errSubstr, err)
+			}
+			if _, err := d.getNetwork(testID(1)); err == nil {
+				t.Error("expected the network not to be created")
+			}
+		})
+	}
+}
+
+func TestNewInterfaceNonBridge(t *testing.T) {
+	h := newDryRunHandle()
+	h.LinkAdd(&netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "l2b-test"}})
+	if _, err := newInterface(h, &networkConfiguration{BridgeName: "l2b-test"}); err == nil {
+		t.Fatal("expected a dummy device not to be taken for the bridge")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Errorf("expected a BadRequestError, got %v", err)
+	}
+
+	i, err := newInterface(h, &networkConfiguration{BridgeName: "l2b-other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.exists() {
+		t.Error("expected a missing bridge not to exist")
+	}
+}
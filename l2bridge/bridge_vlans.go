@@ -0,0 +1,105 @@
+package l2bridge
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// BridgeVLAN is a VLAN configured on a network's bridge, with the ports that are members of it.
+type BridgeVLAN struct {
+	VID   uint16     `json:"vid"`
+	Ports []VLANPort `json:"ports"`
+}
+
+// VLANPort is the membership of one port, or of the bridge itself, in a VLAN.
+type VLANPort struct {
+	Name     string `json:"name"`
+	PVID     bool   `json:"pvid,omitempty"`
+	Untagged bool   `json:"untagged,omitempty"`
+}
+
+// BridgeVLANs reports the VLANs configured on the network's bridge and their port memberships, as the kernel's
+// bridge VLAN dump has them.
+func (d *bridgeDriver) BridgeVLANs(nid string) ([]BridgeVLAN, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Lock()
+	exists := n.bridge.exists()
+	bridgeName := n.config.BridgeName
+	n.Unlock()
+	if !exists {
+		return nil, types.InternalErrorf("bridge %s of network %s does not exist", bridgeName, nid)
+	}
+
+	bridge, err := d.nlh.LinkByName(bridgeName)
+	if err != nil {
+		return nil, internalErrorf("failed to find bridge %s: %v", bridgeName, err)
+	}
+	links, err := d.nlh.LinkList()
+	if err != nil {
+		return nil, internalErrorf("failed to list the ports of bridge %s: %v", bridgeName, err)
+	}
+	dump, err := d.nlh.BridgeVlanList()
+	if err != nil {
+		return nil, internalErrorf("failed to list vlans of bridge %s: %v", bridgeName, err)
+	}
+	return bridgeVLANs(bridge, links, dump), nil
+}
+
+// bridgeVLANs groups the VLAN dump entries of the bridge and its ports by VLAN, sorted by VLAN id and port name.
+func bridgeVLANs(bridge netlink.Link, links []netlink.Link, dump map[int32][]*nl.BridgeVlanInfo) []BridgeVLAN {
+	index := bridge.Attrs().Index
+	names := map[int32]string{int32(index): bridge.Attrs().Name}
+	for _, l := range links {
+		if l.Attrs().MasterIndex == index {
+			names[int32(l.Attrs().Index)] = l.Attrs().Name
+		}
+	}
+
+	byVID := make(map[uint16][]VLANPort)
+	for ifindex, infos := range dump {
+		name, ok := names[ifindex]
+		if !ok {
+			continue
+		}
+		for _, info := range infos {
+			byVID[info.Vid] = append(byVID[info.Vid], VLANPort{
+				Name:     name,
+				PVID:     info.Flags&nl.BRIDGE_VLAN_INFO_PVID != 0,
+				Untagged: info.Flags&nl.BRIDGE_VLAN_INFO_UNTAGGED != 0,
+			})
+		}
+	}
+
+	vlans := make([]BridgeVLAN, 0, len(byVID))
+	for vid, ports := range byVID {
+		sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+		vlans = append(vlans, BridgeVLAN{VID: vid, Ports: ports})
+	}
+	sort.Slice(vlans, func(i, j int) bool { return vlans[i].VID < vlans[j].VID })
+	return vlans
+}
+
+// reportBridgeVLANs summarizes the VLANs of the network's bridge, by id, in an endpoint info map.
+func (d *bridgeDriver) reportBridgeVLANs(nid string, m map[string]string) {
+	vlans, err := d.BridgeVLANs(nid)
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to read VLANs of network %s", nid)
+		return
+	}
+	vids := make([]string, len(vlans))
+	for i, v := range vlans {
+		vids[i] = strconv.Itoa(int(v.VID))
+	}
+	m[label.NetworkVLANs] = strings.Join(vids, ",")
+}
@@ -0,0 +1,102 @@
+package l2bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// newBridgeVLANsDriver returns a driver whose network 1 has bridge index 1 with ports eth1 and veth1, reporting
+// the given bridge VLAN dump. eth2, index 4, is off the bridge.
+func newBridgeVLANsDriver(t *testing.T, dump map[int32][]*nl.BridgeVlanInfo) *Driver {
+	d := NewDriver(&Configuration{DryRun: true})
+	if err := d.bridge.CreateNetwork(context.Background(), testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.bridge.getNetwork(testID(1))
+	h := &vlanTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle), vlans: dump}
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: n.config.BridgeName, Index: 1}}
+	h.LinkAdd(bridge)
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 2, MasterIndex: 1}})
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "veth1", Index: 3, MasterIndex: 1}})
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 4}})
+	d.bridge.nlh = h
+	n.bridge = &bridgeInterface{Link: bridge, nlh: h}
+	return d
+}
+
+func TestBridgeVLANs(t *testing.T) {
+	dump := map[int32][]*nl.BridgeVlanInfo{
+		1: vlanInfos(1, nil),
+		2: vlanInfos(1, []uint16{20, 10}),
+		3: vlanInfos(10, nil),
+		4: vlanInfos(30, nil),
+	}
+	d := newBridgeVLANsDriver(t, dump)
+	n, _ := d.bridge.getNetwork(testID(1))
+	got, err := d.BridgeVLANs(testID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BridgeVLAN{
+		{VID: 1, Ports: []VLANPort{{Name: n.config.BridgeName, PVID: true, Untagged: true}, {Name: "eth1", PVID: true, Untagged: true}}},
+		{VID: 10, Ports: []VLANPort{{Name: "eth1"}, {Name: "veth1", PVID: true, Untagged: true}}},
+		{VID: 20, Ports: []VLANPort{{Name: "eth1"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected vlans\n%+v\ngot\n%+v", want, got)
+	}
+
+	d.bridge.nlh.(*vlanTestHandle).vlans = map[int32][]*nl.BridgeVlanInfo{}
+	if got, err := d.BridgeVLANs(testID(1)); err != nil || len(got) != 0 {
+		t.Errorf("expected no vlans on a bridge without any, got %+v, %v", got, err)
+	}
+	if _, err := d.BridgeVLANs(testID(2)); err == nil {
+		t.Error("expected an error for an unknown network")
+	}
+	n.bridge.Link = nil
+	if _, err := d.BridgeVLANs(testID(1)); err == nil {
+		t.Error("expected an error for a network without its bridge")
+	} else if _, ok := err.(types.InternalError); !ok {
+		t.Errorf("expected an InternalError, got %v", err)
+	}
+}
+
+func TestBridgeVLANsReported(t *testing.T) {
+	d := newBridgeVLANsDriver(t, map[int32][]*nl.BridgeVlanInfo{2: vlanInfos(1, []uint16{20, 10})})
+	ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16")}
+	if _, err := d.bridge.CreateEndpoint(context.Background(), testID(1), testID(2), ei, nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := d.bridge.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.NetworkVLANs] != "1,10,20" {
+		t.Errorf("expected %s 1,10,20 in endpoint info, got %q", label.NetworkVLANs, info[label.NetworkVLANs])
+	}
+
+	rec := httptest.NewRecorder()
+	d.handleVLANs(rec, httptest.NewRequest("GET", "/debug/vlans?network="+testID(1), nil))
+	var vlans []BridgeVLAN
+	if err := json.Unmarshal(rec.Body.Bytes(), &vlans); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(vlans) != 3 || vlans[0].VID != 1 || vlans[2].Ports[0].Name != "eth1" {
+		t.Errorf("expected vlans 1, 10 and 20 on eth1, got %+v", vlans)
+	}
+
+	rec = httptest.NewRecorder()
+	d.handleVLANs(rec, httptest.NewRequest("GET", "/debug/vlans?network="+testID(2), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected not found for an unknown network, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+// newDryRunDriver returns a driver which answers requests without touching the host.
+func newDryRunDriver() *bridgeDriver {
+	config := DefaultConfiguration()
+	config.DryRun = true
+	return NewBridgeDriver(config)
+}
+
+// testID returns the n-th network or endpoint id of a test.
+func testID(n int) string {
+	return fmt.Sprintf("%d%063d", n, 0)
+}
+
+// testIPAMData returns the IPAM data libnetwork passes for the pool, with its first address as the gateway.
+func testIPAMData(t *testing.T, pool string) []*IPAMData {
+	_, ipnet, err := net.ParseCIDR(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := &net.IPNet{IP: make(net.IP, len(ipnet.IP)), Mask: ipnet.Mask}
+	copy(gw.IP, ipnet.IP)
+	gw.IP[len(gw.IP)-1]++
+	key := DefaultGatewayV4AuxKey
+	if ipnet.IP.To4() == nil {
+		key = DefaultGatewayV6AuxKey
+	}
+	return []*IPAMData{{Pool: ipnet, Gateway: gw, AuxAddresses: map[string]*net.IPNet{key: gw}}}
+}
+
+// TestConcurrentEndpointRequests runs the requests changing endpoints of several networks concurrently, for the race
+// detector to catch unguarded state.
+func TestConcurrentEndpointRequests(t *testing.T) {
+	const networks, workers = 4, 20
+	d := newDryRunDriver()
+	ctx := context.Background()
+
+	for n := 1; n <= networks; n++ {
+		pool := fmt.Sprintf("10.%d.0.0/16", n)
+		if err := d.CreateNetwork(ctx, testID(n), nil, testIPAMData(t, pool), nil); err != nil {
+			t.Fatalf("creating network %d: %v", n, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, networks*workers)
+	for n := 1; n <= networks; n++ {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(n, w int) {
+				defer wg.Done()
+				nid, eid := testID(n), fmt.Sprintf("%d%02d%061d", n, w, 0)
+				addr := &net.IPNet{IP: net.IPv4(10, byte(n), 1, byte(w+2)), Mask: net.CIDRMask(16, 32)}
+				if _, err := d.CreateEndpoint(ctx, nid, eid, &EndpointInterface{Address: addr}, nil); err != nil {
+					errs <- fmt.Errorf("creating endpoint %s: %w", eid, err)
+					return
+				}
+				if _, err := d.Join(ctx, nid, eid, "/var/run/docker/netns/"+eid[:12], nil); err != nil {
+					errs <- fmt.Errorf("joining endpoint %s: %w", eid, err)
+				}
+				if err := d.SetEndpointMeta(nid, eid, map[string]string{"worker": fmt.Sprint(w)}); err != nil {
+					errs <- fmt.Errorf("setting metadata of endpoint %s: %w", eid, err)
+				}
+				d.EndpointInfo(nid, eid)
+				if err := d.Leave(ctx, nid, eid); err != nil {
+					errs <- fmt.Errorf("leaving endpoint %s: %w", eid, err)
+				}
+				if err := d.DeleteEndpoint(ctx, nid, eid); err != nil {
+					errs <- fmt.Errorf("deleting endpoint %s: %w", eid, err)
+				}
+			}(n, w)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for n := 1; n <= networks; n++ {
+		nw, err := d.getNetwork(testID(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nw.Lock()
+		left := len(nw.endpoints)
+		nw.Unlock()
+		if left != 0 {
+			t.Errorf("network %d has %d endpoints left", n, left)
+		}
+		if err := d.DeleteNetwork(ctx, testID(n)); err != nil {
+			t.Errorf("deleting network %d: %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package l2bridge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxConnLimit bounds the connection limit an endpoint may be given.
+const maxConnLimit = 1 << 20
+
+// nft runs the nftables utility with the given arguments.
+func nft(args ...string) error {
+	if out, err := runCommand("nft", args...); err != nil {
+		return fmt.Errorf("nft %s failed: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// parseConnLimit parses the number of tracked connections an endpoint may have open.
+func parseConnLimit(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a connection count", s)
+	}
+	if n == 0 || n > maxConnLimit {
+		return 0, fmt.Errorf("connection limit must be between 1 and %d", maxConnLimit)
+	}
+	return uint32(n), nil
+}
+
+// connLimitTable is the name of the nftables bridge table limiting the connections opened by the endpoint.
+func (ep *bridgeEndpoint) connLimitTable() string {
+	return "l2b-" + ep.hostIfName
+}
+
+// setupConnLimit drops new connections from the endpoint, whether forwarded or to the host, once it has the given
+// number of connections tracked. Bridged traffic is only tracked with the nf_conntrack_bridge module loaded.
+func (ep *bridgeEndpoint) setupConnLimit(limit uint32) error {
+	table := ep.connLimitTable()
+	if err := nft("add", "table", "bridge", table); err != nil {
+		return err
+	}
+	for _, hook := range []string{"forward", "input"} {
+		if err := nft("add", "chain", "bridge", table, hook,
+			"{", "type", "filter", "hook", hook, "priority", "0", ";", "}"); err != nil {
+			return err
+		}
+		if err := nft("add", "rule", "bridge", table, hook, "iifname", ep.hostIfName,
+			"ct", "state", "new", "ct", "count", "over", strconv.FormatUint(uint64(limit), 10), "drop"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeConnLimit removes the table installed by setupConnLimit.
+func (ep *bridgeEndpoint) removeConnLimit() error {
+	return nft("delete", "table", "bridge", ep.connLimitTable())
+}
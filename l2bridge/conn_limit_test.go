@@ -0,0 +1,174 @@
+package l2bridge
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestParseConnLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint32
+		err  bool
+	}{
+		{in: "1", want: 1},
+		{in: "1024", want: 1024},
+		{in: strconv.Itoa(maxConnLimit), want: maxConnLimit},
+		{in: "0", err: true},
+		{in: strconv.Itoa(maxConnLimit + 1), err: true},
+		{in: "-1", err: true},
+		{in: "many", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseConnLimit(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseConnLimit(%q): expected error %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseConnLimit(%q) = %d, expected %d", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := parseEndpointOptions(map[string]interface{}{label.MaxConns: "0"}); err == nil {
+		t.Error("expected a zero connection limit to be rejected")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Errorf("expected a BadRequestError, got %v", err)
+	}
+}
+
+func TestConnLimitRules(t *testing.T) {
+	cmds := recordCommands(t)
+	ep := &bridgeEndpoint{hostIfName: "veth1"}
+	if err := ep.setupConnLimit(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.removeConnLimit(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"nft add table bridge l2b-veth1",
+		"nft add chain bridge l2b-veth1 forward { type filter hook forward priority 0 ; }",
+		"nft add rule bridge l2b-veth1 forward iifname veth1 ct state new ct count over 100 drop",
+		"nft add chain bridge l2b-veth1 input { type filter hook input priority 0 ; }",
+		"nft add rule bridge l2b-veth1 input iifname veth1 ct state new ct count over 100 drop",
+		"nft delete table bridge l2b-veth1",
+	}
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands\n%v\ngot\n%v", want, *cmds)
+	}
+}
+
+func TestConnLimitEndpointInfo(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16")}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, map[string]interface{}{label.MaxConns: "100"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.MaxConns] != "100" {
+		t.Errorf("expected %s 100 in endpoint info, got %q", label.MaxConns, info[label.MaxConns])
+	}
+}
+
+// TestJoinUnwind checks a join failing part way removes what its earlier steps installed, in reverse order, as
+// libnetwork does not call Leave after a failed join.
+func TestJoinUnwind(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     map[string]interface{}
+		nftables bool
+		fail     string // Prefix of the command made to fail
+		check    func(error) bool
+		undone   []string // Prefixes of the teardown commands expected, in order
+	}{
+		{
+			name:     "connection limit without nftables",
+			opts:     map[string]interface{}{label.Bandwidth: "10mbit", label.Antispoof: "true", label.MaxConns: "100"},
+			nftables: false,
+			check:    func(err error) bool { _, ok := err.(types.NotImplementedError); return ok },
+			undone:   []string{"ebtables -D FORWARD", "ebtables -D INPUT", "ebtables -X", "tc qdisc del", "tc filter del"},
+		},
+		{
+			name:     "peers without nftables",
+			opts:     map[string]interface{}{label.Bandwidth: "10mbit", label.Peers: testID(3)},
+			nftables: false,
+			check:    func(err error) bool { _, ok := err.(types.NotImplementedError); return ok },
+			undone:   []string{"tc qdisc del", "tc filter del"},
+		},
+		{
+			name:     "peer policy failing",
+			opts:     map[string]interface{}{label.Bandwidth: "10mbit", label.MaxConns: "100", label.Peers: testID(3)},
+			nftables: true,
+			fail:     "nft add table bridge l2b-peers-",
+			check:    func(err error) bool { _, ok := err.(types.InternalError); return ok },
+			undone:   []string{"nft delete table bridge l2b-peers-", "nft delete table bridge l2b-", "tc qdisc del", "tc filter del"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16")}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			d.config.DryRun, d.config.EnableIPTables = false, false
+			d.probeKernel = func() map[string]bool { return map[string]bool{featureNFTables: tt.nftables} }
+			d.moduleLoaded = func(string) bool { return true }
+
+			var cmds []string
+			orig := runCommand
+			runCommand = func(name string, args ...string) ([]byte, error) {
+				cmd := name + " " + strings.Join(args, " ")
+				cmds = append(cmds, cmd)
+				if tt.fail != "" && strings.HasPrefix(cmd, tt.fail) {
+					return nil, errors.New("failed")
+				}
+				return nil, nil
+			}
+			t.Cleanup(func() { runCommand = orig })
+
+			_, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/2", nil)
+			if !tt.check(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			var teardown []string
+			for _, cmd := range cmds {
+				for _, removal := range []string{"tc qdisc del", "tc filter del", "ebtables -D", "ebtables -X", "nft delete"} {
+					if strings.HasPrefix(cmd, removal) {
+						teardown = append(teardown, cmd)
+					}
+				}
+			}
+			ok := len(teardown) == len(tt.undone)
+			for i := 0; ok && i < len(teardown); i++ {
+				ok = strings.HasPrefix(teardown[i], tt.undone[i])
+			}
+			if !ok {
+				t.Errorf("expected teardown %v, got\n%s", tt.undone, strings.Join(cmds, "\n"))
+			}
+
+			n, _ := d.getNetwork(testID(1))
+			if ep := n.endpoints[testID(2)]; ep.sandboxKey != "" || ep.peerPolicy {
+				t.Errorf("expected the endpoint left unjoined, got sandbox %q and peer policy %v", ep.sandboxKey, ep.peerPolicy)
+			}
+		})
+	}
+}
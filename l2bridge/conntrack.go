@@ -0,0 +1,30 @@
+package l2bridge
+
+import (
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// conntrackAddrFilter matches conntrack flows with the address as source or destination in either direction.
+type conntrackAddrFilter net.IP
+
+func (f conntrackAddrFilter) MatchConntrackFlow(flow *netlink.ConntrackFlow) bool {
+	ip := net.IP(f)
+	return flow.Forward.SrcIP.Equal(ip) || flow.Forward.DstIP.Equal(ip) ||
+		flow.Reverse.SrcIP.Equal(ip) || flow.Reverse.DstIP.Equal(ip)
+}
+
+// flushConntrack deletes all conntrack entries involving any of the given addresses.
+func flushConntrack(nlh NetlinkHandle, ips ...net.IP) error {
+	for _, ip := range ips {
+		family := netlink.InetFamily(netlink.FAMILY_V4)
+		if ip.To4() == nil {
+			family = netlink.InetFamily(netlink.FAMILY_V6)
+		}
+		if _, err := nlh.ConntrackDeleteFilter(netlink.ConntrackTable, family, conntrackAddrFilter(ip)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package l2bridge
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// conntrackTestHandle is a dry run handle recording the conntrack flushes requested.
+type conntrackTestHandle struct {
+	*dryRunHandle
+	families []netlink.InetFamily
+	filters  []netlink.CustomConntrackFilter
+}
+
+func (h *conntrackTestHandle) ConntrackDeleteFilter(table netlink.ConntrackTableType, family netlink.InetFamily, filter netlink.CustomConntrackFilter) (uint, error) {
+	if table != netlink.ConntrackTable {
+		return 0, nil
+	}
+	h.families = append(h.families, family)
+	h.filters = append(h.filters, filter)
+	return 1, nil
+}
+
+func TestFlushConntrack(t *testing.T) {
+	h := &conntrackTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+	v4, v6 := net.ParseIP("10.1.0.2").To4(), net.ParseIP("2001:db8:1::2")
+	if err := flushConntrack(h, v4, v6); err != nil {
+		t.Fatal(err)
+	}
+	wantFamilies := []netlink.InetFamily{netlink.FAMILY_V4, netlink.FAMILY_V6}
+	if len(h.families) != len(wantFamilies) {
+		t.Fatalf("expected flushes for families %v, got %v", wantFamilies, h.families)
+	}
+	for j, family := range wantFamilies {
+		if h.families[j] != family {
+			t.Errorf("expected flush %d for family %d, got %d", j, family, h.families[j])
+		}
+	}
+
+	flow := func(fwdSrc, fwdDst, revSrc, revDst string) *netlink.ConntrackFlow {
+		f := &netlink.ConntrackFlow{}
+		f.Forward.SrcIP, f.Forward.DstIP = net.ParseIP(fwdSrc), net.ParseIP(fwdDst)
+		f.Reverse.SrcIP, f.Reverse.DstIP = net.ParseIP(revSrc), net.ParseIP(revDst)
+		return f
+	}
+	tests := []struct {
+		name  string
+		flow  *netlink.ConntrackFlow
+		match bool
+	}{
+		{name: "from endpoint", flow: flow("10.1.0.2", "1.1.1.1", "1.1.1.1", "192.0.2.1"), match: true},
+		{name: "to endpoint", flow: flow("1.1.1.1", "192.0.2.1", "10.1.0.2", "1.1.1.1"), match: true},
+		{name: "reply to endpoint", flow: flow("1.1.1.1", "8.8.8.8", "8.8.8.8", "10.1.0.2"), match: true},
+		{name: "other endpoint", flow: flow("10.1.0.3", "1.1.1.1", "1.1.1.1", "10.1.0.3")},
+	}
+	for _, tt := range tests {
+		if got := h.filters[0].MatchConntrackFlow(tt.flow); got != tt.match {
+			t.Errorf("%s: expected the v4 filter to match %v, got %v", tt.name, tt.match, got)
+		}
+	}
+	if !h.filters[1].MatchConntrackFlow(flow("2001:db8:1::2", "2001:db8:9::1", "2001:db8:9::1", "2001:db8:1::2")) {
+		t.Error("expected the v6 filter to match flows of the endpoint's IPv6 address")
+	}
+}
@@ -0,0 +1,151 @@
+package l2bridge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netns"
+)
+
+// containerSysctlAllowlist holds the prefixes of the network sysctls a container may ask for. Interface specific
+// settings are excluded since the container interface is not yet in the sandbox when they are applied.
+var containerSysctlAllowlist = []string{
+	"net.core.somaxconn",
+	"net.ipv4.conf.all.",
+	"net.ipv4.conf.default.",
+	"net.ipv4.ip_local_port_range",
+	"net.ipv4.ip_unprivileged_port_start",
+	"net.ipv4.ping_group_range",
+	"net.ipv4.tcp_",
+	"net.ipv6.conf.all.",
+	"net.ipv6.conf.default.",
+}
+
+// sandboxSysctls returns the sysctls to set in the sandbox when the endpoint joins it with the given response. The
+// container interface only arrives in the sandbox after Join, so its settings are made through the namespace defaults,
+// which the interface takes on as it moves in. These are its IPv6 privacy extensions, and for an IPv6 endpoint, IPv6
+// itself, so that its address is assigned and neighbor discovery runs where the sandbox disables IPv6 by default. An
+// endpoint given its IPv6 gateway ignores router advertisements, which on a segment shared with the physical network
+// would autoconfigure addresses and routes besides its own. The sysctls the endpoint asked for take precedence.
+func (ep *bridgeEndpoint) sandboxSysctls(res *JoinResponse) map[string]string {
+	sysctls := make(map[string]string)
+	if ep.config.TempAddr != "" {
+		sysctls["net.ipv6.conf.default.use_tempaddr"] = ep.config.TempAddr
+	}
+	if ep.addrv6 != nil && ep.config.wantsIPv6() {
+		sysctls["net.ipv6.conf.default.disable_ipv6"] = "0"
+		if res.hasIPv6Gateway() {
+			sysctls["net.ipv6.conf.default.accept_ra"] = "0"
+		}
+	}
+	for k, v := range ep.config.Sysctls {
+		sysctls[k] = v
+	}
+	return sysctls
+}
+
+// validateContainerSysctls checks the requested sysctls against the allowlist.
+func validateContainerSysctls(sysctls map[string]string) error {
+	for key, value := range sysctls {
+		allowed := false
+		for _, prefix := range containerSysctlAllowlist {
+			if strings.HasPrefix(key, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed || strings.ContainsAny(key, "/\x00") {
+			return fmt.Errorf("sysctl %s is not allowed", key)
+		}
+		if strings.ContainsAny(value, "\n\x00") {
+			return fmt.Errorf("sysctl %s has an invalid value %q", key, value)
+		}
+	}
+	return nil
+}
+
+// applyContainerSysctls sets the given sysctls in the network namespace of the sandbox, returning the values they
+// replaced, including on failure those of the sysctls already set. The plugin protocol cannot carry sysctls in the
+// JoinResponse, so they are written directly from a thread moved into the sandbox.
+func applyContainerSysctls(sandboxKey string, sysctls map[string]string) (map[string]string, error) {
+	keys := make([]string, 0, len(sysctls))
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	replaced := make(map[string]string, len(keys))
+	err := inSandbox(sandboxKey, func() error {
+		for _, key := range keys {
+			path := filepath.Join("/proc/sys", strings.Replace(key, ".", "/", -1))
+			old, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", key, err)
+			}
+			if err := ioutil.WriteFile(path, []byte(sysctls[key]), 0644); err != nil {
+				return fmt.Errorf("failed to set %s: %w", key, err)
+			}
+			replaced[key] = strings.TrimSpace(string(old))
+		}
+		return nil
+	})
+	return replaced, err
+}
+
+// restoreContainerSysctls puts back the sysctls an endpoint's join replaced in the sandbox it leaves.
+func (n *bridgeNetwork) restoreContainerSysctls(ep *bridgeEndpoint, sandboxKey string) {
+	n.Lock()
+	replaced := ep.replacedSysctls
+	ep.replacedSysctls = nil
+	n.Unlock()
+	if len(replaced) == 0 || sandboxKey == "" {
+		return
+	}
+	if _, err := applyContainerSysctls(sandboxKey, replaced); err != nil {
+		logrus.WithError(err).Warnf("Failed to restore sysctls of sandbox %s on endpoint (%s) leave", sandboxKey, ep.id)
+	}
+}
+
+// inSandbox runs fn on a thread moved into the network namespace of the sandbox.
+func inSandbox(sandboxKey string, fn func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is left locked, and so discarded with the goroutine, if it cannot be returned to its namespace.
+		runtime.LockOSThread()
+
+		origin, err := netns.Get()
+		if err != nil {
+			errCh <- fmt.Errorf("failed to get current network namespace: %w", err)
+			return
+		}
+		defer origin.Close()
+
+		sbox, err := netns.GetFromPath(sandboxKey)
+		if err != nil {
+			errCh <- fmt.Errorf("failed to open sandbox %s: %w", sandboxKey, err)
+			return
+		}
+		defer sbox.Close()
+
+		if err := netns.Set(sbox); err != nil {
+			errCh <- fmt.Errorf("failed to enter sandbox %s: %w", sandboxKey, err)
+			return
+		}
+
+		ferr := fn()
+
+		if err := netns.Set(origin); err != nil {
+			logrus.WithError(err).Errorf("Failed to return to the original network namespace from sandbox %s", sandboxKey)
+			errCh <- ferr
+			return
+		}
+		runtime.UnlockOSThread()
+		errCh <- ferr
+	}()
+	return <-errCh
+}
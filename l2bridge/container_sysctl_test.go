@@ -0,0 +1,97 @@
+package l2bridge
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestValidateContainerSysctls(t *testing.T) {
+	tests := []struct {
+		name    string
+		sysctls map[string]string
+		ok      bool
+	}{
+		{name: "none", ok: true},
+		{name: "tcp", sysctls: map[string]string{"net.ipv4.tcp_syncookies": "1"}, ok: true},
+		{name: "somaxconn", sysctls: map[string]string{"net.core.somaxconn": "1024"}, ok: true},
+		{name: "ipv6 default", sysctls: map[string]string{"net.ipv6.conf.default.accept_ra": "0"}, ok: true},
+		{name: "port range", sysctls: map[string]string{"net.ipv4.ip_local_port_range": "1024 65000"}, ok: true},
+		{name: "kernel", sysctls: map[string]string{"kernel.shmmax": "1"}},
+		{name: "interface", sysctls: map[string]string{"net.ipv4.conf.eth0.rp_filter": "0"}},
+		{name: "path traversal", sysctls: map[string]string{"net.ipv4.tcp_/../../kernel/core_pattern": "x"}},
+		{name: "nul in key", sysctls: map[string]string{"net.ipv4.tcp_syncookies\x00": "1"}},
+		{name: "newline in value", sysctls: map[string]string{"net.ipv4.tcp_syncookies": "1\n0"}},
+		{name: "nul in value", sysctls: map[string]string{"net.ipv4.tcp_syncookies": "1\x00"}},
+	}
+	for _, tt := range tests {
+		if err := validateContainerSysctls(tt.sysctls); (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok %v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
+
+func TestParseEndpointSysctls(t *testing.T) {
+	ec, err := parseEndpointOptions(map[string]interface{}{label.ContainerSysctlPrefix + "net.ipv4.tcp_syncookies": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"net.ipv4.tcp_syncookies": "1"}; !reflect.DeepEqual(ec.Sysctls, want) {
+		t.Errorf("expected sysctls %v, got %v", want, ec.Sysctls)
+	}
+
+	_, err = parseEndpointOptions(map[string]interface{}{label.ContainerSysctlPrefix + "kernel.shmmax": "1"})
+	if _, ok := err.(types.ForbiddenError); !ok {
+		t.Errorf("expected a ForbiddenError for a sysctl off the allowlist, got %v", err)
+	}
+}
+
+func TestSandboxSysctls(t *testing.T) {
+	addrv6 := &net.IPNet{IP: net.ParseIP("2001:db8:1::2"), Mask: net.CIDRMask(64, 128)}
+	_, defaultv6, _ := net.ParseCIDR("::/0")
+	tests := []struct {
+		name   string
+		config endpointConfiguration
+		addrv6 *net.IPNet
+		res    JoinResponse
+		want   map[string]string
+	}{
+		{name: "v4 only", config: endpointConfiguration{IPFamily: ipFamilyV4}, addrv6: addrv6, want: map[string]string{}},
+		{name: "no v6 address", want: map[string]string{}},
+		{name: "tempaddr", config: endpointConfiguration{TempAddr: "2"}, want: map[string]string{
+			"net.ipv6.conf.default.use_tempaddr": "2",
+		}},
+		{name: "v6 without gateway", addrv6: addrv6, want: map[string]string{
+			"net.ipv6.conf.default.disable_ipv6": "0",
+		}},
+		{name: "v6 gateway", addrv6: addrv6, res: JoinResponse{GatewayIPv6: net.ParseIP("2001:db8:1::1")}, want: map[string]string{
+			"net.ipv6.conf.default.disable_ipv6": "0",
+			"net.ipv6.conf.default.accept_ra":    "0",
+		}},
+		{name: "v6 default route", addrv6: addrv6, res: JoinResponse{StaticRoutes: []*StaticRoute{
+			{Destination: defaultv6, NextHop: net.ParseIP("2001:db8:1::1")},
+		}}, want: map[string]string{
+			"net.ipv6.conf.default.disable_ipv6": "0",
+			"net.ipv6.conf.default.accept_ra":    "0",
+		}},
+		{name: "requested sysctls take precedence", addrv6: addrv6, res: JoinResponse{GatewayIPv6: net.ParseIP("2001:db8:1::1")},
+			config: endpointConfiguration{Sysctls: map[string]string{"net.ipv6.conf.default.accept_ra": "2", "net.ipv4.tcp_syncookies": "1"}},
+			want: map[string]string{
+				"net.ipv6.conf.default.disable_ipv6": "0",
+				"net.ipv6.conf.default.accept_ra":    "2",
+				"net.ipv4.tcp_syncookies":            "1",
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			ep := &bridgeEndpoint{config: &config, addrv6: tt.addrv6}
+			if got := ep.sandboxSysctls(&tt.res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package l2bridge
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/docker/go-plugins-helpers/network"
 	"github.com/docker/libnetwork/types"
@@ -25,6 +26,22 @@ func ParseIPv4(s string) (*net.IPNet, error) {
 	return ipnet, nil
 }
 
+// parseEndpointAddress parses an endpoint address in CIDR notation. Some clients send the address without a prefix
+// length, in which case it is returned with a nil mask, to be filled in from the network's pool.
+func parseEndpointAddress(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		return ParseIPv4(s)
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %s", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip}, nil
+}
+
 func ParseIPAMDataSlice(in []*network.IPAMData) ([]*IPAMData, error) {
 	var out []*IPAMData
 	for _, data := range in {
@@ -45,12 +62,12 @@ func ParseIPAMData(in *network.IPAMData) (*IPAMData, error) {
 	var err error
 	if in.Pool != "" {
 		if out.Pool, err = ParseIPv4(in.Pool); err != nil {
-			return out, fmt.Errorf("bad pool address: %v ", err)
+			return out, fmt.Errorf("bad pool address: %w ", err)
 		}
 	}
 	if in.Gateway != "" {
 		if out.Gateway, err = ParseIPv4(in.Gateway); err != nil {
-			return out, fmt.Errorf("bad gateway address: %v ", err)
+			return out, fmt.Errorf("bad gateway address: %w ", err)
 		}
 	}
 
@@ -63,7 +80,7 @@ func ParseIPAMData(in *network.IPAMData) (*IPAMData, error) {
 			out.AuxAddresses[key] = addr
 		case string:
 			if out.AuxAddresses[key], err = ParseIPv4(addr); err != nil {
-				return out, fmt.Errorf("bad aux address %s: %v", key, err)
+				return out, fmt.Errorf("bad aux address %s: %w", key, err)
 			}
 		default:
 			return out, fmt.Errorf("invalid aux address %s: %T is an unrecognized type", key, addr)
@@ -85,17 +102,17 @@ func ParseEndpointInterface(in *network.EndpointInterface) (*EndpointInterface,
 	var err error
 	if in.MacAddress != "" {
 		if out.MacAddress, err = net.ParseMAC(in.MacAddress); err != nil {
-			return nil, fmt.Errorf("bad MAC address: %v ", err)
+			return nil, fmt.Errorf("bad MAC address: %w ", err)
 		}
 	}
 	if in.Address != "" {
-		if out.Address, err = ParseIPv4(in.Address); err != nil {
-			return nil, fmt.Errorf("bad IPv4 address: %v ", err)
+		if out.Address, err = parseEndpointAddress(in.Address); err != nil {
+			return nil, fmt.Errorf("bad IPv4 address: %w ", err)
 		}
 	}
 	if in.AddressIPv6 != "" {
-		if out.AddressIPv6, err = ParseIPv4(in.AddressIPv6); err != nil {
-			return nil, fmt.Errorf("bad ipv6 address: %v ", err)
+		if out.AddressIPv6, err = parseEndpointAddress(in.AddressIPv6); err != nil {
+			return nil, fmt.Errorf("bad ipv6 address: %w ", err)
 		}
 	}
 	return out, nil
@@ -153,6 +170,19 @@ type JoinResponse struct {
 	DisableGatewayService bool
 }
 
+// hasIPv6Gateway reports whether the response gives the container an IPv6 gateway, directly or as a default route.
+func (j *JoinResponse) hasIPv6Gateway() bool {
+	if j.GatewayIPv6 != nil {
+		return true
+	}
+	for _, r := range j.StaticRoutes {
+		if ones, bits := r.Destination.Mask.Size(); r.NextHop != nil && ones == 0 && bits == 128 {
+			return true
+		}
+	}
+	return false
+}
+
 func (j *JoinResponse) Marshal() *network.JoinResponse {
 	if j == nil {
 		return nil
@@ -0,0 +1,205 @@
+package l2bridge
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultOperationTimeout bounds each network and endpoint request unless configured otherwise.
+const defaultOperationTimeout = 30 * time.Second
+
+// withDeadline runs op, giving up on it with a TimeoutError once ctx is done. Netlink requests and the tools the
+// driver runs cannot be interrupted, so an operation given up on runs to its end in the background. Failing, it
+// cleans up after itself as always; succeeding, undo, if given, reverts it, so that nothing is left behind of a
+// request its caller was told failed. abandon, if given, is called when giving up on op, and returns the function
+// called once op and undo are done.
+func withDeadline(ctx context.Context, name string, op func() error, undo func(), abandon func() func()) error {
+	if ctx.Done() == nil {
+		return op()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- op() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	finished := func() {}
+	if abandon != nil {
+		finished = abandon()
+	}
+	go func() {
+		defer finished()
+		err := <-done
+		if err != nil {
+			logrus.WithError(err).Warnf("Abandoned %s failed", name)
+			return
+		}
+		if undo != nil {
+			logrus.Warnf("Abandoned %s completed, reverting it", name)
+			undo()
+		}
+	}()
+	return types.TimeoutErrorf("%s did not complete in time: %v", name, ctx.Err())
+}
+
+// abandonedOp counts the requests given up on for a network or endpoint which still run.
+type abandonedOp struct {
+	running int
+	done    chan struct{}
+}
+
+// markAbandoned records a request for the network or endpoint id given up on, returning the function recording that
+// it is done.
+func (d *bridgeDriver) markAbandoned(id string) func() {
+	d.Lock()
+	defer d.Unlock()
+	op := d.abandoned[id]
+	if op == nil {
+		op = &abandonedOp{done: make(chan struct{})}
+		d.abandoned[id] = op
+	}
+	op.running++
+	return func() {
+		d.Lock()
+		defer d.Unlock()
+		if op.running--; op.running == 0 {
+			delete(d.abandoned, id)
+			close(op.done)
+		}
+	}
+}
+
+// waitAbandoned waits for the requests given up on for the network or endpoint id, so that a retry of one is not
+// undone once the abandoned request completes.
+func (d *bridgeDriver) waitAbandoned(ctx context.Context, name, id string) error {
+	for {
+		d.Lock()
+		op := d.abandoned[id]
+		d.Unlock()
+		if op == nil {
+			return nil
+		}
+		logrus.Infof("Waiting for an abandoned request for %s before %s", id, name)
+		select {
+		case <-op.done:
+		case <-ctx.Done():
+			return types.TimeoutErrorf("%s did not complete in time, waiting for an abandoned request for %s: %v", name, id, ctx.Err())
+		}
+	}
+}
+
+// withDeadline runs op as withDeadline does, classifying its error. It first waits for the requests given up on for
+// the network or endpoint id, and marks op as such if given up on in turn.
+func (d *bridgeDriver) withDeadline(ctx context.Context, name, id string, op func() error, undo func()) error {
+	if err := d.waitAbandoned(ctx, name, id); err != nil {
+		return err
+	}
+	return d.classifyError(withDeadline(ctx, name, op, undo, func() func() { return d.markAbandoned(id) }))
+}
+
+// CreateNetwork creates a network, giving up once ctx is done.
+func (d *bridgeDriver) CreateNetwork(ctx context.Context, id string, option map[string]interface{}, ipV4Data, ipV6Data []*IPAMData) error {
+	// A retried request for an existing network is not reverted, as the network is not its own.
+	var existed bool
+	return d.withDeadline(ctx, "creation of network "+id, id, func() error {
+		_, err := d.getNetwork(id)
+		existed = err == nil
+		return d.createNetworkWithOptions(id, option, ipV4Data, ipV6Data)
+	}, func() {
+		if !existed {
+			d.removeNetwork(id)
+		}
+	})
+}
+
+// DeleteNetwork deletes a network, giving up once ctx is done.
+func (d *bridgeDriver) DeleteNetwork(ctx context.Context, nid string) error {
+	return d.withDeadline(ctx, "deletion of network "+nid, nid, func() error {
+		return d.removeNetwork(nid)
+	}, nil)
+}
+
+// removeNetwork deletes a network under its network lock.
+func (d *bridgeDriver) removeNetwork(nid string) error {
+	defer d.lockNetwork(nid)()
+	d.configNetwork.Lock()
+	defer d.configNetwork.Unlock()
+	return d.deleteNetwork(nid)
+}
+
+// CreateEndpoint creates an endpoint, giving up once ctx is done.
+func (d *bridgeDriver) CreateEndpoint(ctx context.Context, nid, eid string, ei *EndpointInterface, epOptions map[string]interface{}) (*EndpointInterface, error) {
+	var res *EndpointInterface
+	err := d.withDeadline(ctx, "creation of endpoint "+eid, eid, func() error {
+		defer d.lockNetwork(nid)()
+		var err error
+		res, err = d.createEndpoint(nid, eid, ei, epOptions)
+		return err
+	}, func() {
+		d.removeEndpoint(nid, eid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteEndpoint deletes an endpoint, giving up once ctx is done.
+func (d *bridgeDriver) DeleteEndpoint(ctx context.Context, nid, eid string) error {
+	return d.withDeadline(ctx, "deletion of endpoint "+eid, eid, func() error {
+		return d.removeEndpoint(nid, eid)
+	}, nil)
+}
+
+// removeEndpoint deletes an endpoint under its network lock.
+func (d *bridgeDriver) removeEndpoint(nid, eid string) error {
+	defer d.lockNetwork(nid)()
+	return d.deleteEndpoint(nid, eid)
+}
+
+// Join joins an endpoint to a sandbox, giving up once ctx is done.
+func (d *bridgeDriver) Join(ctx context.Context, nid, eid, sboxKey string, opts map[string]interface{}) (*JoinResponse, error) {
+	// A retried join of the sandbox the endpoint is already in is not reverted.
+	var joined bool
+	var res *JoinResponse
+	err := d.withDeadline(ctx, "join of endpoint "+eid, eid, func() error {
+		defer d.lockNetwork(nid)()
+		if n, err := d.getNetwork(nid); err == nil {
+			if ep, err := n.getEndpoint(eid); err == nil && ep != nil {
+				n.Lock()
+				joined = ep.sandboxKey == sboxKey
+				n.Unlock()
+			}
+		}
+		var err error
+		res, err = d.join(nid, eid, sboxKey, opts)
+		return err
+	}, func() {
+		if !joined {
+			d.leaveSandbox(nid, eid)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Leave detaches an endpoint from its sandbox, giving up once ctx is done.
+func (d *bridgeDriver) Leave(ctx context.Context, nid, eid string) error {
+	return d.withDeadline(ctx, "leave of endpoint "+eid, eid, func() error {
+		return d.leaveSandbox(nid, eid)
+	}, nil)
+}
+
+// leaveSandbox detaches an endpoint from its sandbox under its network lock.
+func (d *bridgeDriver) leaveSandbox(nid, eid string) error {
+	defer d.lockNetwork(nid)()
+	return d.leave(nid, eid)
+}
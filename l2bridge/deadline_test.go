@@ -0,0 +1,92 @@
+package l2bridge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestWithDeadlineRetryWaitsForAbandonedUndo(t *testing.T) {
+	d := newDryRunDriver()
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := d.withDeadline(ctx, "creation of network n", "n", func() error {
+		<-release
+		record("op")
+		return nil
+	}, func() {
+		record("undo")
+	})
+	if _, ok := err.(types.TimeoutError); !ok {
+		t.Fatalf("expected a TimeoutError, got %v", err)
+	}
+
+	retried := make(chan error)
+	go func() {
+		retried <- d.withDeadline(context.Background(), "creation of network n", "n", func() error {
+			record("retry")
+			return nil
+		}, nil)
+	}()
+	select {
+	case err := <-retried:
+		t.Fatalf("retry completed before the abandoned request: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-retried; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"op", "undo", "retry"}; !equalStrings(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+	if len(d.abandoned) != 0 {
+		t.Errorf("abandoned requests left recorded: %v", d.abandoned)
+	}
+}
+
+func TestWithDeadlineRetryGivesUpWaiting(t *testing.T) {
+	d := newDryRunDriver()
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	d.withDeadline(ctx, "join of endpoint e", "e", func() error { <-release; return nil }, nil)
+
+	ran := false
+	err := d.withDeadline(ctx, "join of endpoint e", "e", func() error { ran = true; return nil }, nil)
+	if _, ok := err.(types.TimeoutError); !ok {
+		t.Fatalf("expected a TimeoutError, got %v", err)
+	}
+	if ran {
+		t.Error("retry ran while the abandoned request was running")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// serveDebug serves the debug endpoints on the given TCP address until an error occurs.
+func (d *Driver) serveDebug(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/latency", d.handleLatency)
+	mux.HandleFunc("/debug/kernel", d.handleKernel)
+	mux.HandleFunc("/debug/topology", d.handleTopology)
+	mux.HandleFunc("/debug/vlans", d.handleVLANs)
+	mux.HandleFunc("/debug/metrics-schema", d.handleMetricsSchema)
+	mux.HandleFunc("/metrics", d.handleMetrics)
+	mux.HandleFunc("/health", d.handleHealth)
+	return http.ListenAndServe(addr, mux)
+}
+
+// serveMetrics serves only the metrics and health check on the given TCP address until an error occurs, for scraping
+// and probing the driver without exposing the debug endpoints.
+func (d *Driver) serveMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", d.handleMetrics)
+	mux.HandleFunc("/health", d.handleHealth)
+	return http.ListenAndServe(addr, mux)
+}
+
+// handleLatency reports request latency percentiles per driver method.
+func (d *Driver) handleLatency(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.latency.summaries())
+}
+
+// handleKernel reports the optional kernel features available on the host.
+func (d *Driver) handleKernel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.KernelFeatures())
+}
+
+// handleTopology reports the graph of networks, bridges, uplinks and endpoints, as JSON or, with format=dot, as DOT.
+func (d *Driver) handleTopology(w http.ResponseWriter, r *http.Request) {
+	t := d.bridge.topology()
+	if r.URL.Query().Get("format") != "dot" {
+		writeJSON(w, t)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vnd.graphviz")
+	if err := t.writeDOT(w); err != nil {
+		logrus.WithError(err).Warn("Failed to write debug response")
+	}
+}
+
+// handleVLANs reports the VLANs configured on the bridge of the network given with network=<id>.
+func (d *Driver) handleVLANs(w http.ResponseWriter, r *http.Request) {
+	vlans, err := d.BridgeVLANs(r.URL.Query().Get("network"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, vlans)
+}
+
+// handleMetrics reports the driver metrics in the Prometheus text exposition format.
+func (d *Driver) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	d.bridge.updateFDBMetrics()
+	d.bridge.updateVLANStatsMetrics()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := d.bridge.metrics.writeText(w); err != nil {
+		logrus.WithError(err).Warn("Failed to write debug response")
+	}
+}
+
+// handleMetricsSchema describes every metric served on /metrics, for generating dashboards and alerting rules.
+func (d *Driver) handleMetricsSchema(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, d.bridge.metrics.schema())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Warn("Failed to write debug response")
+	}
+}
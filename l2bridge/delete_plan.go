@@ -0,0 +1,104 @@
+package l2bridge
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeletePlan describes what deleting a network tears down.
+type DeletePlan struct {
+	Network   string            `json:"network"`
+	Bridge    string            `json:"bridge"`
+	Endpoints []PlannedEndpoint `json:"endpoints"`
+	// Uplinks are the ports which are not endpoints, released from the bridge but left in place.
+	Uplinks []string `json:"uplinks"`
+	// Rules are the rules and entries outside of the deleted links that are removed.
+	Rules []string `json:"rules"`
+	// KeepBridge is set when the bridge was not created by the driver, and only loses the addresses given to it.
+	KeepBridge bool `json:"keep_bridge,omitempty"`
+}
+
+// PlannedEndpoint is an endpoint whose veth pair a DeletePlan deletes.
+type PlannedEndpoint struct {
+	ID         string `json:"id"`
+	Veth       string `json:"veth"`
+	HostIfName string `json:"host_ifname"`
+}
+
+// PlanDelete computes the teardown DeleteNetwork would perform on the network, without performing it.
+func (d *bridgeDriver) PlanDelete(nid string) (*DeletePlan, error) {
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return nil, err
+	}
+	return d.planDelete(n), nil
+}
+
+// planDelete enumerates what deleting the network tears down. It is shared with deleteNetwork, so that a plan
+// matches the teardown it previews.
+func (d *bridgeDriver) planDelete(n *bridgeNetwork) *DeletePlan {
+	var ports []string
+	if u, err := d.uplinkGraph(); err != nil {
+		logrus.WithError(err).Warnf("Failed to find the uplinks of network %s", n.id)
+	} else {
+		ports = u.ports[n.id]
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	p := &DeletePlan{
+		Network:    n.id,
+		Bridge:     n.config.BridgeName,
+		KeepBridge: n.foreignBridge,
+		Endpoints:  []PlannedEndpoint{},
+		Uplinks:    append([]string{}, ports...),
+		Rules:      []string{},
+	}
+	// The ports of a kept bridge stay attached, but for the uplink of the network.
+	if n.foreignBridge {
+		p.Uplinks = []string{}
+		if n.uplinkPort != "" {
+			p.Uplinks = append(p.Uplinks, n.uplinkPort)
+		}
+	}
+	sort.Strings(p.Uplinks)
+
+	for _, ep := range n.endpoints {
+		p.Endpoints = append(p.Endpoints, PlannedEndpoint{ID: ep.id, Veth: ep.srcName, HostIfName: ep.hostIfName})
+	}
+	sort.Slice(p.Endpoints, func(i, j int) bool { return p.Endpoints[i].ID < p.Endpoints[j].ID })
+	for _, pe := range p.Endpoints {
+		if iface := n.endpoints[pe.ID].masqueradeIface; iface != "" {
+			p.Rules = append(p.Rules, fmt.Sprintf("masquerading of endpoint %s out of %s", pe.ID, iface))
+		}
+		for _, pb := range n.endpoints[pe.ID].portMapping {
+			p.Rules = append(p.Rules, fmt.Sprintf("port mapping %s of endpoint %s", pb.String(), pe.ID))
+		}
+	}
+
+	for _, addr := range n.bridgeAddrs {
+		p.Rules = append(p.Rules, fmt.Sprintf("address %s of bridge %s", addr, n.config.BridgeName))
+	}
+	if n.vlanCreated {
+		p.Rules = append(p.Rules, "vlan interface "+n.uplinkPort)
+	}
+	for _, e := range n.config.StaticFDB {
+		p.Rules = append(p.Rules, fmt.Sprintf("static fdb entry %s on %s", e.MAC, e.Port))
+	}
+	if len(n.config.PortGroups) != 0 {
+		p.Rules = append(p.Rules, "port group shaping device "+portGroupDevice(n.id))
+	}
+	if n.mssClampMTU != 0 {
+		p.Rules = append(p.Rules, "nftables table bridge "+n.mssClampTable())
+	}
+	if n.config.UplinkMSSClamp {
+		p.Rules = append(p.Rules, "nftables table bridge "+n.uplinkMSSClampTable())
+	}
+	if len(n.iptCleanFuncs) != 0 {
+		p.Rules = append(p.Rules, fmt.Sprintf("iptables rules of %d setup steps", len(n.iptCleanFuncs)))
+	}
+	return p
+}
@@ -0,0 +1,156 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// newDeletePlanDriver returns a dry run driver with a network on bridge index 1 holding endpoints 3 and 2.
+func newDeletePlanDriver(t *testing.T) (*bridgeDriver, *bridgeNetwork) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: n.config.BridgeName, Index: 1}}
+	d.nlh.LinkAdd(bridge)
+	n.bridge.Link = bridge
+	for _, eid := range []int{3, 2} {
+		ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.1.0.%d/16", eid))}
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(eid), ei, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d, n
+}
+
+func TestPlanDelete(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+	tests := []struct {
+		name       string
+		setup      func(d *bridgeDriver, n *bridgeNetwork)
+		uplinks    []string
+		rules      []string
+		keepBridge bool
+	}{
+		{
+			name:    "endpoints only",
+			uplinks: []string{},
+			rules:   []string{},
+		},
+		{
+			name: "uplink ports",
+			setup: func(d *bridgeDriver, n *bridgeNetwork) {
+				d.nlh.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 3, MasterIndex: 1}})
+				d.nlh.LinkAdd(&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Name: "eth1.10", Index: 2, MasterIndex: 1}, VlanId: 10})
+				d.nlh.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth3", Index: 4}})
+				n.uplinkPort, n.vlanCreated = "eth1.10", true
+			},
+			uplinks: []string{"eth1.10", "eth2"},
+			rules:   []string{"vlan interface eth1.10"},
+		},
+		{
+			name: "foreign bridge",
+			setup: func(d *bridgeDriver, n *bridgeNetwork) {
+				d.nlh.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 2, MasterIndex: 1}})
+				d.nlh.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 3, MasterIndex: 1}})
+				n.foreignBridge, n.uplinkPort = true, "eth1"
+				n.bridgeAddrs = []*net.IPNet{{IP: net.ParseIP("10.1.0.1"), Mask: net.CIDRMask(16, 32)}}
+			},
+			uplinks:    []string{"eth1"},
+			rules:      []string{"address 10.1.0.1/16 of bridge %bridge%"},
+			keepBridge: true,
+		},
+		{
+			name: "rules",
+			setup: func(d *bridgeDriver, n *bridgeNetwork) {
+				ep := n.endpoints[testID(2)]
+				ep.masqueradeIface = "eth0"
+				ep.portMapping = []types.PortBinding{{Proto: types.TCP, IP: net.ParseIP("10.1.0.2"), Port: 80, HostPort: 8080}}
+				n.config.StaticFDB = []staticFDBEntry{{MAC: mac, Port: "eth1"}}
+				n.config.PortGroups = map[string]portGroup{"web": {}}
+				n.config.UplinkMSSClamp = true
+				n.mssClampMTU = 1500
+				n.iptCleanFuncs = iptablesCleanFuncs{func() error { return nil }, func() error { return nil }}
+			},
+			uplinks: []string{},
+			rules: []string{
+				"masquerading of endpoint " + testID(2) + " out of eth0",
+				"port mapping tcp/10.1.0.2:80/:8080 of endpoint " + testID(2),
+				"static fdb entry 02:42:ac:11:00:02 on eth1",
+				"port group shaping device " + portGroupDevice(testID(1)),
+				"nftables table bridge %mss%",
+				"nftables table bridge %umss%",
+				"iptables rules of 2 setup steps",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, n := newDeletePlanDriver(t)
+			if tt.setup != nil {
+				tt.setup(d, n)
+			}
+			p, err := d.PlanDelete(testID(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := &DeletePlan{Network: testID(1), Bridge: n.config.BridgeName, KeepBridge: tt.keepBridge, Uplinks: tt.uplinks}
+			for _, eid := range []string{testID(2), testID(3)} {
+				ep := n.endpoints[eid]
+				want.Endpoints = append(want.Endpoints, PlannedEndpoint{ID: eid, Veth: ep.srcName, HostIfName: ep.hostIfName})
+			}
+			for _, rule := range tt.rules {
+				want.Rules = append(want.Rules, strings.NewReplacer(
+					"%bridge%", n.config.BridgeName, "%mss%", n.mssClampTable(), "%umss%", n.uplinkMSSClampTable()).Replace(rule))
+			}
+			if want.Rules == nil {
+				want.Rules = []string{}
+			}
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("expected plan\n%+v\ngot\n%+v", want, p)
+			}
+		})
+	}
+
+	if _, err := newDryRunDriver().PlanDelete(testID(1)); err == nil {
+		t.Error("expected an error planning the delete of an unknown network")
+	}
+}
+
+func TestDeleteNetworkFollowsPlan(t *testing.T) {
+	d, n := newDeletePlanDriver(t)
+	d.nlh.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 2, MasterIndex: 1}})
+	p, err := d.PlanDelete(testID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range p.Endpoints {
+		if _, err := d.nlh.LinkByName(ep.Veth); err != nil {
+			t.Fatalf("expected planning to leave veth %s of endpoint %s in place, got %v", ep.Veth, ep.ID, err)
+		}
+	}
+	if err := d.DeleteNetwork(context.Background(), testID(1)); err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range p.Endpoints {
+		if _, err := d.nlh.LinkByName(ep.Veth); err == nil {
+			t.Errorf("expected veth %s of endpoint %s deleted", ep.Veth, ep.ID)
+		}
+	}
+	if _, err := d.nlh.LinkByName("eth1"); err != nil {
+		t.Errorf("expected uplink eth1 left in place, got %v", err)
+	}
+	if _, err := d.getNetwork(n.id); err == nil {
+		t.Error("expected the network deleted")
+	}
+}
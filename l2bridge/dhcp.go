@@ -0,0 +1,504 @@
+package l2bridge
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// dhcpTimeout bounds a DHCP exchange, leaving the rest of a request's deadline to the endpoint's setup.
+	dhcpTimeout = 15 * time.Second
+	// dhcpRetransmit is how long a DHCP message goes unanswered before it is sent again.
+	dhcpRetransmit = 3 * time.Second
+	// dhcpRenewRetry is how long a renewal waits after a failed attempt before the next.
+	dhcpRenewRetry = time.Minute
+	// dhcpMinRenew is the least time a lease is kept before it is renewed, so that a server granting zero or tiny
+	// lease times is not flooded with renewals back to back.
+	dhcpMinRenew = 10 * time.Second
+)
+
+// DHCP message types, option codes and ports, as of RFC 2131 and 2132.
+const (
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+	dhcpRequest  = 3
+	dhcpAck      = 5
+	dhcpNak      = 6
+	dhcpRelease  = 7
+
+	dhcpOptSubnetMask   = 1
+	dhcpOptRouter       = 3
+	dhcpOptDNS          = 6
+	dhcpOptRequestedIP  = 50
+	dhcpOptLeaseTime    = 51
+	dhcpOptMessageType  = 53
+	dhcpOptServerID     = 54
+	dhcpOptParamRequest = 55
+	dhcpOptClientID     = 61
+	dhcpOptPad          = 0
+	dhcpOptEnd          = 255
+
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+)
+
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// dhcpLease is an IPv4 address leased to an endpoint by a DHCP server on the network's segment.
+type dhcpLease struct {
+	Addr      *net.IPNet    `json:"addr"`
+	Router    net.IP        `json:"router,omitempty"`
+	DNS       []net.IP      `json:"dns,omitempty"`
+	Server    net.IP        `json:"server"`
+	LeaseTime time.Duration `json:"lease_time"`
+	Acquired  time.Time     `json:"acquired"`
+	// Released is set once the lease is given back on leave, until the endpoint joins again.
+	Released bool `json:"released,omitempty"`
+}
+
+// renewAt returns when the lease is due for renewal, half way through it but no sooner than dhcpMinRenew.
+func (l *dhcpLease) renewAt() time.Time {
+	if l.LeaseTime/2 < dhcpMinRenew {
+		return l.Acquired.Add(dhcpMinRenew)
+	}
+	return l.Acquired.Add(l.LeaseTime / 2)
+}
+
+// expiry returns when the lease runs out unless renewed.
+func (l *dhcpLease) expiry() time.Time {
+	return l.Acquired.Add(l.LeaseTime)
+}
+
+// dnsServers lists the DNS servers of the lease, comma separated.
+func (l *dhcpLease) dnsServers() string {
+	strs := make([]string, len(l.DNS))
+	for i, ip := range l.DNS {
+		strs[i] = ip.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// dhcpClient exchanges DHCP messages on one interface through a packet socket, which needs neither an address on the
+// interface nor a route to the server.
+type dhcpClient struct {
+	fd      int
+	ifName  string
+	ifIndex int
+	mac     net.HardwareAddr
+	xid     uint32
+}
+
+func newDHCPClient(link netlink.Link) (*dhcpClient, error) {
+	attrs := link.Attrs()
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(syscall.ETH_P_IP)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open packet socket: %w", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_IP), Ifindex: attrs.Index}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to bind packet socket to interface %s: %w", attrs.Name, err)
+	}
+	var xid [4]byte
+	if _, err := rand.Read(xid[:]); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to generate DHCP transaction id: %w", err)
+	}
+	return &dhcpClient{
+		fd:      fd,
+		ifName:  attrs.Name,
+		ifIndex: attrs.Index,
+		mac:     attrs.HardwareAddr,
+		xid:     binary.BigEndian.Uint32(xid[:]),
+	}, nil
+}
+
+func (c *dhcpClient) close() {
+	syscall.Close(c.fd)
+}
+
+// acquire leases an address with a discover, offer, request and acknowledgement exchange.
+func (c *dhcpClient) acquire() (*dhcpLease, error) {
+	deadline := time.Now().Add(dhcpTimeout)
+	offer, err := c.exchange(c.message(dhcpDiscover, nil), deadline, dhcpOffer)
+	if err != nil {
+		return nil, err
+	}
+	server, ok := offer.options[dhcpOptServerID]
+	if !ok || len(offer.yiaddr) != net.IPv4len {
+		return nil, types.InternalErrorf("malformed DHCP offer on interface %s", c.ifName)
+	}
+	return c.request(c.message(dhcpRequest, nil,
+		dhcpOption(dhcpOptRequestedIP, offer.yiaddr...),
+		dhcpOption(dhcpOptServerID, server...)), deadline)
+}
+
+// renew asks again for the leased address. It is broadcast with no client address, as on reboot, so that it works
+// whether or not the interface holds the address and whichever server granted it.
+func (c *dhcpClient) renew(l *dhcpLease) (*dhcpLease, error) {
+	deadline := time.Now().Add(dhcpTimeout)
+	lease, err := c.request(c.message(dhcpRequest, nil, dhcpOption(dhcpOptRequestedIP, l.Addr.IP.To4()...)), deadline)
+	if err != nil {
+		return nil, err
+	}
+	if !lease.Addr.IP.Equal(l.Addr.IP) {
+		return nil, types.InternalErrorf("DHCP server granted %s rather than %s on interface %s", lease.Addr.IP, l.Addr.IP, c.ifName)
+	}
+	return lease, nil
+}
+
+// release gives the lease back to its server. Servers do not answer a release, so it is sent once.
+func (c *dhcpClient) release(l *dhcpLease) error {
+	return c.send(c.message(dhcpRelease, l.Addr.IP, dhcpOption(dhcpOptServerID, l.Server.To4()...)), l.Addr.IP)
+}
+
+func (c *dhcpClient) request(msg []byte, deadline time.Time) (*dhcpLease, error) {
+	ack, err := c.exchange(msg, deadline, dhcpAck, dhcpNak)
+	if err != nil {
+		return nil, err
+	}
+	if ack.msgType == dhcpNak {
+		return nil, types.ForbiddenErrorf("DHCP server declined the address requested on interface %s", c.ifName)
+	}
+	return ack.lease(time.Now())
+}
+
+// exchange sends msg, again every dhcpRetransmit, until a reply of one of the wanted types arrives or the deadline
+// passes.
+func (c *dhcpClient) exchange(msg []byte, deadline time.Time, want ...byte) (*dhcpReply, error) {
+	buf := make([]byte, 1500)
+	for {
+		if err := c.send(msg, nil); err != nil {
+			return nil, err
+		}
+		resend := time.Now().Add(dhcpRetransmit)
+		if resend.After(deadline) {
+			resend = deadline
+		}
+		for {
+			wait := time.Until(resend)
+			if wait <= 0 {
+				break
+			}
+			tv := syscall.NsecToTimeval(wait.Nanoseconds())
+			if err := syscall.SetsockoptTimeval(c.fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+				return nil, fmt.Errorf("failed to set receive timeout on packet socket: %w", err)
+			}
+			n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to receive on interface %s: %w", c.ifName, err)
+			}
+			reply, ok := c.parse(buf[:n])
+			if !ok {
+				continue
+			}
+			for _, t := range want {
+				if reply.msgType == t {
+					return reply, nil
+				}
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil, types.TimeoutErrorf("no DHCP reply received on interface %s within %s", c.ifName, dhcpTimeout)
+		}
+	}
+}
+
+// message builds a DHCP message of the given type, asking for the options the lease is made of.
+func (c *dhcpClient) message(msgType byte, ciaddr net.IP, opts ...[]byte) []byte {
+	msg := make([]byte, 236, 300)
+	msg[0] = 1 // BOOTREQUEST
+	msg[1] = 1 // Ethernet
+	msg[2] = 6
+	binary.BigEndian.PutUint32(msg[4:8], c.xid)
+	// Ask for broadcast replies, as the interface may hold no address to receive unicast on.
+	binary.BigEndian.PutUint16(msg[10:12], 0x8000)
+	if ip := ciaddr.To4(); ip != nil {
+		copy(msg[12:16], ip)
+	}
+	copy(msg[28:44], c.mac)
+
+	msg = append(msg, dhcpMagicCookie...)
+	msg = append(msg, dhcpOption(dhcpOptMessageType, msgType)...)
+	msg = append(msg, dhcpOption(dhcpOptClientID, append([]byte{1}, c.mac...)...)...)
+	for _, opt := range opts {
+		msg = append(msg, opt...)
+	}
+	if msgType != dhcpRelease {
+		msg = append(msg, dhcpOption(dhcpOptParamRequest, dhcpOptSubnetMask, dhcpOptRouter, dhcpOptDNS, dhcpOptLeaseTime, dhcpOptServerID)...)
+	}
+	return append(msg, dhcpOptEnd)
+}
+
+func dhcpOption(code byte, data ...byte) []byte {
+	return append([]byte{code, byte(len(data))}, data...)
+}
+
+// send broadcasts a DHCP message to the servers on the segment from src, or from no address if nil.
+func (c *dhcpClient) send(msg []byte, src net.IP) error {
+	pkt := make([]byte, 28+len(msg))
+	// IPv4 header
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:4], uint16(len(pkt)))
+	pkt[8] = 64
+	pkt[9] = syscall.IPPROTO_UDP
+	if ip := src.To4(); ip != nil {
+		copy(pkt[12:16], ip)
+	}
+	copy(pkt[16:20], net.IPv4bcast.To4())
+	binary.BigEndian.PutUint16(pkt[10:12], ipChecksum(pkt[:20]))
+	// UDP header, without the optional checksum
+	binary.BigEndian.PutUint16(pkt[20:22], dhcpClientPort)
+	binary.BigEndian.PutUint16(pkt[22:24], dhcpServerPort)
+	binary.BigEndian.PutUint16(pkt[24:26], uint16(8+len(msg)))
+	copy(pkt[28:], msg)
+
+	to := &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_IP), Ifindex: c.ifIndex, Halen: 6}
+	copy(to.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err := syscall.Sendto(c.fd, pkt, 0, to); err != nil {
+		return fmt.Errorf("failed to send DHCP message on interface %s: %w", c.ifName, err)
+	}
+	return nil
+}
+
+// dhcpReply is a DHCP message from a server to the client.
+type dhcpReply struct {
+	msgType byte
+	yiaddr  net.IP
+	options map[byte][]byte
+}
+
+// parse decodes an IPv4 packet as a DHCP reply to this client, reporting whether it is one.
+func (c *dhcpClient) parse(pkt []byte) (*dhcpReply, bool) {
+	if len(pkt) < 20 || pkt[0]>>4 != 4 || pkt[9] != syscall.IPPROTO_UDP {
+		return nil, false
+	}
+	ihl := int(pkt[0]&0x0f) * 4
+	if len(pkt) < ihl+8 || binary.BigEndian.Uint16(pkt[ihl+2:ihl+4]) != dhcpClientPort {
+		return nil, false
+	}
+	msg := pkt[ihl+8:]
+	if len(msg) < 240 || msg[0] != 2 || binary.BigEndian.Uint32(msg[4:8]) != c.xid ||
+		!bytes.Equal(msg[28:34], c.mac) || !bytes.Equal(msg[236:240], dhcpMagicCookie) {
+		return nil, false
+	}
+
+	reply := &dhcpReply{yiaddr: net.IP(append([]byte(nil), msg[16:20]...)), options: map[byte][]byte{}}
+	opts := msg[240:]
+	for len(opts) > 0 && opts[0] != dhcpOptEnd {
+		if opts[0] == dhcpOptPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, false
+		}
+		reply.options[opts[0]] = opts[2 : 2+int(opts[1])]
+		opts = opts[2+int(opts[1]):]
+	}
+	if t := reply.options[dhcpOptMessageType]; len(t) == 1 {
+		reply.msgType = t[0]
+	}
+	return reply, reply.msgType != 0
+}
+
+// lease reads the lease granted by an acknowledgement.
+func (r *dhcpReply) lease(now time.Time) (*dhcpLease, error) {
+	server := r.options[dhcpOptServerID]
+	seconds := r.options[dhcpOptLeaseTime]
+	if len(r.yiaddr) != net.IPv4len || len(server) != net.IPv4len || len(seconds) != 4 {
+		return nil, types.InternalErrorf("malformed DHCP acknowledgement")
+	}
+	mask := r.yiaddr.DefaultMask()
+	if m := r.options[dhcpOptSubnetMask]; len(m) == net.IPv4len {
+		mask = net.IPMask(m)
+	}
+	l := &dhcpLease{
+		Addr:      &net.IPNet{IP: r.yiaddr, Mask: mask},
+		Server:    net.IP(server),
+		LeaseTime: time.Duration(binary.BigEndian.Uint32(seconds)) * time.Second,
+		Acquired:  now,
+	}
+	if router := r.options[dhcpOptRouter]; len(router) >= net.IPv4len {
+		l.Router = net.IP(router[:net.IPv4len])
+	}
+	for dns := r.options[dhcpOptDNS]; len(dns) >= net.IPv4len; dns = dns[net.IPv4len:] {
+		l.DNS = append(l.DNS, net.IP(dns[:net.IPv4len]))
+	}
+	return l, nil
+}
+
+func ipChecksum(hdr []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(hdr); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(hdr[i : i+2]))
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return binary.LittleEndian.Uint16(b[:])
+}
+
+// onContainerLink runs fn with a DHCP client on the endpoint's container interface, wherever it is: in the host
+// namespace before the endpoint joins and once it has left, in its sandbox while joined.
+func (n *bridgeNetwork) onContainerLink(ep *bridgeEndpoint, sandboxKey string, fn func(c *dhcpClient) error) error {
+	if link, err := n.driver.nlh.LinkByName(ep.srcName); err == nil && bytes.Equal(link.Attrs().HardwareAddr, ep.macAddress) {
+		if err := n.driver.nlh.LinkSetUp(link); err != nil {
+			return internalErrorf("failed to set sandbox interface %s up: %v", ep.srcName, err)
+		}
+		return runDHCPClient(link, fn)
+	}
+	if sandboxKey == "" {
+		return types.InternalErrorf("sandbox interface %s of endpoint %s not found", ep.srcName, ep.id)
+	}
+	return inSandbox(sandboxKey, func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if bytes.Equal(link.Attrs().HardwareAddr, ep.macAddress) {
+				return runDHCPClient(link, fn)
+			}
+		}
+		return fmt.Errorf("no interface with mac address %s in sandbox %s", ep.macAddress, sandboxKey)
+	})
+}
+
+func runDHCPClient(link netlink.Link, fn func(c *dhcpClient) error) error {
+	c, err := newDHCPClient(link)
+	if err != nil {
+		return internalErrorf("%v", err)
+	}
+	defer c.close()
+	return fn(c)
+}
+
+// acquireDHCPLease leases an address for the endpoint from the DHCP server on the network's segment.
+func (n *bridgeNetwork) acquireDHCPLease(ep *bridgeEndpoint) (*dhcpLease, error) {
+	var lease *dhcpLease
+	err := n.onContainerLink(ep, "", func(c *dhcpClient) (err error) {
+		lease, err = c.acquire()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Endpoint (%s) leased %s from DHCP server %s for %s", ep.id, lease.Addr, lease.Server, lease.LeaseTime)
+	return lease, nil
+}
+
+// renewDHCPLease renews the endpoint's lease before it joins a sandbox, taking up the address again if it was
+// released on leave.
+func (n *bridgeNetwork) renewDHCPLease(ep *bridgeEndpoint) error {
+	n.Lock()
+	lease := ep.dhcp
+	n.Unlock()
+
+	var renewed *dhcpLease
+	err := n.onContainerLink(ep, "", func(c *dhcpClient) (err error) {
+		renewed, err = c.renew(lease)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	ep.dhcp = renewed
+	if renewed.Router != nil {
+		ep.gatewayv4 = renewed.Router
+	}
+	n.Unlock()
+	return nil
+}
+
+// releaseDHCPLease gives the endpoint's lease back, if it holds one. It is best effort.
+func (n *bridgeNetwork) releaseDHCPLease(ep *bridgeEndpoint, sandboxKey string) {
+	n.Lock()
+	lease := ep.dhcp
+	if lease == nil || lease.Released {
+		n.Unlock()
+		return
+	}
+	released := *lease
+	released.Released = true
+	ep.dhcp = &released
+	n.Unlock()
+
+	err := n.onContainerLink(ep, sandboxKey, func(c *dhcpClient) error {
+		return c.release(lease)
+	})
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to release DHCP lease of %s for endpoint (%s)", lease.Addr, ep.id)
+	}
+}
+
+// keepDHCPLease renews the endpoint's lease from its sandbox while the endpoint stays joined to it. It stops once the
+// endpoint leaves or the lease is replaced, as by the next join.
+func (n *bridgeNetwork) keepDHCPLease(ep *bridgeEndpoint, sandboxKey string) {
+	n.Lock()
+	lease := ep.dhcp
+	n.Unlock()
+	if lease == nil {
+		return
+	}
+
+	go func() {
+		next := lease.renewAt()
+		for {
+			time.Sleep(time.Until(next))
+			n.Lock()
+			current := ep.dhcp == lease && ep.sandboxKey == sandboxKey
+			n.Unlock()
+			if !current {
+				return
+			}
+
+			var renewed *dhcpLease
+			err := n.onContainerLink(ep, sandboxKey, func(c *dhcpClient) (err error) {
+				renewed, err = c.renew(lease)
+				return err
+			})
+			if err != nil {
+				if time.Now().After(lease.expiry()) {
+					logrus.WithError(err).Errorf("DHCP lease of %s for endpoint (%s) expired", lease.Addr, ep.id)
+					return
+				}
+				logrus.WithError(err).Warnf("Failed to renew DHCP lease of %s for endpoint (%s)", lease.Addr, ep.id)
+				next = time.Now().Add(dhcpRenewRetry)
+				continue
+			}
+
+			n.Lock()
+			current = ep.dhcp == lease
+			if current {
+				ep.dhcp = renewed
+			}
+			n.Unlock()
+			if !current {
+				return
+			}
+			lease, next = renewed, renewed.renewAt()
+			n.driver.storeSync("dhcp renewal")
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package l2bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDHCPLeaseRenewAt(t *testing.T) {
+	acquired := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		leaseTime time.Duration
+		want      time.Duration
+	}{
+		{name: "half way", leaseTime: time.Hour, want: 30 * time.Minute},
+		{name: "zero length", leaseTime: 0, want: dhcpMinRenew},
+		{name: "under a second", leaseTime: 500 * time.Millisecond, want: dhcpMinRenew},
+		{name: "under the floor", leaseTime: dhcpMinRenew, want: dhcpMinRenew},
+	}
+	for _, tt := range tests {
+		l := &dhcpLease{LeaseTime: tt.leaseTime, Acquired: acquired}
+		if got := l.renewAt().Sub(acquired); got != tt.want {
+			t.Errorf("%s: expected renewal after %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestNetworkDraining(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := func(n int) *EndpointInterface {
+		return &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, byte(n)).To4(), Mask: net.CIDRMask(16, 32)}}
+	}
+	for _, eid := range []int{2, 3} {
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(eid), endpoint(eid), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/test2", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SetNetworkDraining(testID(1), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNetworkDraining(testID(9), true); err == nil {
+		t.Error("expected draining a missing network to fail")
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.NetworkDraining] != "true" {
+		t.Errorf("expected %s in endpoint info, got %v", label.NetworkDraining, info)
+	}
+
+	// New endpoints and joins are rejected.
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(4), endpoint(4), nil); err == nil {
+		t.Error("expected creating an endpoint on a draining network to fail")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Errorf("expected a ForbiddenError creating an endpoint, got %v", err)
+	}
+	if _, err := d.Join(ctx, testID(1), testID(3), "/var/run/docker/netns/test3", nil); err == nil {
+		t.Error("expected joining a draining network to fail")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Errorf("expected a ForbiddenError joining, got %v", err)
+	}
+
+	// Existing endpoints are still torn down.
+	if err := d.Leave(ctx, testID(1), testID(2)); err != nil {
+		t.Errorf("leaving a draining network: %v", err)
+	}
+	for _, eid := range []int{2, 3} {
+		if err := d.DeleteEndpoint(ctx, testID(1), testID(eid)); err != nil {
+			t.Errorf("deleting an endpoint of a draining network: %v", err)
+		}
+	}
+
+	// The network accepts endpoints again once drained.
+	if err := d.SetNetworkDraining(testID(1), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(4), endpoint(4), nil); err != nil {
+		t.Errorf("creating an endpoint once draining stopped: %v", err)
+	}
+	if topo := d.topology(); topo.Nodes[0].Draining {
+		t.Errorf("expected the network no longer draining in the topology, got %+v", topo.Nodes[0])
+	}
+}
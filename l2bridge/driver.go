@@ -1,26 +1,148 @@
 package l2bridge
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"reflect"
+	"time"
 
 	"github.com/docker/go-plugins-helpers/network"
 	"github.com/docker/libnetwork/types"
 	"github.com/sirupsen/logrus"
 )
 
+// Version of the driver, set at build time.
+var Version = "dev"
+
 type Driver struct {
-	bridge *bridgeDriver
+	requests      uint64 // Requests served, numbering them for the logs; first to be aligned for atomic access
+	bridge        *bridgeDriver
+	socketAddress string
+	latency       *latencyTracker
 }
 
-func NewDriver() *Driver {
+// NewDriver constructs a new driver with the given configuration, or the default configuration if nil.
+func NewDriver(config *Configuration) *Driver {
+	if config != nil {
+		setLogFormat(config.LogFormat)
+	}
 	return &Driver{
-		bridge: NewBridgeDriver(nil),
+		bridge:  NewBridgeDriver(config),
+		latency: newLatencyTracker(),
+	}
+}
+
+// requestContext returns the context bounding a request by the configured operation timeout, if any.
+func (d *Driver) requestContext() (context.Context, context.CancelFunc) {
+	d.bridge.Lock()
+	timeout := d.bridge.config.OperationTimeout
+	d.bridge.Unlock()
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
 	}
+	return context.WithTimeout(context.Background(), timeout)
 }
 
-var capabilities = &network.CapabilitiesResponse{
-	Scope:             network.LocalScope,
-	ConnectivityScope: network.LocalScope,
+// capabilities returns the scope advertised for the driver, global if configured so that swarm managers allocate its
+// networks. Connectivity is always local, as a bridge only connects the containers of its node.
+func (d *Driver) capabilities() *network.CapabilitiesResponse {
+	d.bridge.Lock()
+	global := d.bridge.config.GlobalScope
+	d.bridge.Unlock()
+	scope := network.LocalScope
+	if global {
+		scope = network.GlobalScope
+	}
+	return &network.CapabilitiesResponse{Scope: scope, ConnectivityScope: network.LocalScope}
+}
+
+// Serve logs the startup banner and handles plugin requests on the given unix socket until an error occurs.
+func (d *Driver) Serve(socketAddress string) error {
+	d.socketAddress = socketAddress
+	d.bridge.Lock()
+	shutdownMode := d.bridge.config.ShutdownMode
+	d.bridge.Unlock()
+	if !shutdownMode.valid() {
+		return fmt.Errorf("unknown shutdown mode %q, expected %s or %s", shutdownMode, ShutdownLeave, ShutdownPurge)
+	}
+	d.LogStartupBanner()
+	if d.bridge.dryRun() {
+		logrus.Warn("DRY RUN: requests are validated and answered, but no network is created on this host")
+	}
+	d.bridge.checkModules()
+	err := d.bridge.restoreState()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to restore driver state")
+	}
+	d.bridge.markStateLoaded(err)
+	d.bridge.reconcileOnStart()
+	d.bridge.updateObjectGauges()
+	d.bridge.handleStateDumps()
+	d.bridge.startReaper()
+	d.bridge.startFlowLog()
+
+	d.bridge.Lock()
+	debugAddress := d.bridge.config.DebugAddress
+	metricsAddress := d.bridge.config.MetricsAddress
+	d.bridge.Unlock()
+	if debugAddress != "" {
+		go func() {
+			if err := d.serveDebug(debugAddress); err != nil {
+				logrus.WithError(err).Errorf("Debug server on %s failed", debugAddress)
+			}
+		}()
+	}
+	if metricsAddress != "" {
+		go func() {
+			if err := d.serveMetrics(metricsAddress); err != nil {
+				logrus.WithError(err).Errorf("Metrics server on %s failed", metricsAddress)
+			}
+		}()
+	}
+
+	h := network.NewHandler(d)
+	return h.ServeUnix(socketAddress, 0)
+}
+
+// LogStartupBanner logs, in a single line, the version and effective configuration of this driver instance.
+func (d *Driver) LogStartupBanner() {
+	d.bridge.Lock()
+	config := d.bridge.config
+	d.bridge.Unlock()
+
+	capabilities := d.capabilities()
+	logrus.WithFields(logrus.Fields{
+		"version":                Version,
+		"socket":                 d.socketAddress,
+		"scope":                  capabilities.Scope,
+		"connectivity_scope":     capabilities.ConnectivityScope,
+		"iptables":               config.EnableIPTables,
+		"ip_forwarding":          config.EnableIPForwarding,
+		"debug_address":          config.DebugAddress,
+		"metrics_address":        config.MetricsAddress,
+		"auto_load_modules":      config.AutoLoadModules,
+		"state_dump_path":        config.StateDumpPath,
+		"data_root":              config.DataRoot,
+		"operation_timeout":      config.OperationTimeout.String(),
+		"warm_restart":           config.WarmRestart,
+		"dry_run":                config.DryRun,
+		"transient_errnos":       FormatErrnos(config.TransientErrnos),
+		"no_cleanup":             config.NoCleanup,
+		"log_format":             config.LogFormat,
+		"shutdown_mode":          config.ShutdownMode,
+		"reap_grace_period":      config.ReapGracePeriod.String(),
+		"flow_log":               config.FlowLogPath,
+		"flow_log_sample_rate":   config.FlowLogSampleRate,
+		"kernel_features":        d.KernelFeatures(),
+		"container_iface_prefix": defaultContainerVethPrefix,
+	}).Info("Starting l2bridge driver")
+}
+
+// KernelFeatures reports which optional kernel features are available on the host. The kernel is probed once and
+// the results are cached.
+func (d *Driver) KernelFeatures() map[string]bool {
+	return d.bridge.kernelFeatures()
 }
 
 // unwrap gives the pointed to value if the i is an non-nil pointer.
@@ -31,49 +153,103 @@ func unwrap(i interface{}) interface{} {
 	return i
 }
 
-// logRequest logs request inputs and results.
-func logRequest(fname string, req interface{}, res interface{}, err error) {
-	req, res = unwrap(req), unwrap(res)
+// logRequest logs request inputs and results, records the request latency, and tracks the last error of the
+// network or endpoint the request concerned.
+func (d *Driver) logRequest(fname string, start time.Time, req interface{}, res interface{}, err error) {
+	d.latency.observe(fname, time.Since(start))
+	d.bridge.countRequest(fname, err)
+
+	// Queries must not clear the error left by a failed operation.
+	if nid, eid := requestIDs(req); nid != "" && fname != "EndpointInfo" {
+		d.bridge.recordResult(nid, eid, err)
+	}
+
+	if nid, _ := requestIDs(req); err == nil && nid != "" && d.bridge.isQuiet(nid) {
+		return
+	}
+
+	log := d.requestLog(fname, req, res)
 	if err == nil {
-		if res == nil {
-			logrus.Infof("%s(%v)", fname, req)
-		} else {
-			logrus.Infof("%s(%v): %v", fname, req, res)
-		}
+		log.Infof("%s succeeded", fname)
 		return
 	}
+	class := errorClass(err)
+	log = log.WithError(err).WithField("error_class", class)
+	switch class {
+	case "MaskableError", "RetryError":
+		log.Infof("%s failed", fname)
+	case "TimeoutError", "InternalError", "UNKNOWN":
+		// Unclassified errors should be treated as bad.
+		log.Errorf("%s failed", fname)
+	default:
+		log.Warnf("%s failed", fname)
+	}
+}
+
+// errorClass names the libnetwork error type of err, or UNKNOWN if it is unclassified.
+func errorClass(err error) string {
 	switch err.(type) {
 	case types.MaskableError:
-		logrus.WithError(err).Infof("[MaskableError] %s(%v): %v", fname, req, err)
+		return "MaskableError"
 	case types.RetryError:
-		logrus.WithError(err).Infof("[RetryError] %s(%v): %v", fname, req, err)
+		return "RetryError"
 	case types.BadRequestError:
-		logrus.WithError(err).Warnf("[BadRequestError] %s(%v): %v", fname, req, err)
+		return "BadRequestError"
 	case types.NotFoundError:
-		logrus.WithError(err).Warnf("[NotFoundError] %s(%v): %v", fname, req, err)
+		return "NotFoundError"
 	case types.ForbiddenError:
-		logrus.WithError(err).Warnf("[ForbiddenError] %s(%v): %v", fname, req, err)
+		return "ForbiddenError"
 	case types.NoServiceError:
-		logrus.WithError(err).Warnf("[NoServiceError] %s(%v): %v", fname, req, err)
+		return "NoServiceError"
 	case types.NotImplementedError:
-		logrus.WithError(err).Warnf("[NotImplementedError] %s(%v): %v", fname, req, err)
+		return "NotImplementedError"
 	case types.TimeoutError:
-		logrus.WithError(err).Errorf("[TimeoutError] %s(%v): %v", fname, req, err)
+		return "TimeoutError"
 	case types.InternalError:
-		logrus.WithError(err).Errorf("[InternalError] %s(%v): %v", fname, req, err)
+		return "InternalError"
 	default:
-		// Unclassified errors should be treated as bad.
-		logrus.WithError(err).Errorf("[UNKNOWN] %s(%v): %v", fname, req, err)
+		return "UNKNOWN"
+	}
+}
+
+// requestIDs extracts the network and endpoint ids targeted by a request, if any.
+func requestIDs(req interface{}) (nid, eid string) {
+	switch r := req.(type) {
+	case *network.CreateNetworkRequest:
+		return r.NetworkID, ""
+	case *network.AllocateNetworkRequest:
+		return r.NetworkID, ""
+	case *network.DeleteNetworkRequest:
+		return r.NetworkID, ""
+	case *network.FreeNetworkRequest:
+		return r.NetworkID, ""
+	case *network.CreateEndpointRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.DeleteEndpointRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.InfoRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.JoinRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.LeaveRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.ProgramExternalConnectivityRequest:
+		return r.NetworkID, r.EndpointID
+	case *network.RevokeExternalConnectivityRequest:
+		return r.NetworkID, r.EndpointID
 	}
+	return "", ""
 }
 
 func (d *Driver) GetCapabilities() (res *network.CapabilitiesResponse, err error) {
-	defer func() { logRequest("GetCapabilities", nil, res, err) }()
-	return capabilities, nil
+	defer func(start time.Time) { d.logRequest("GetCapabilities", start, nil, res, err) }(time.Now())
+	return d.capabilities(), nil
 }
 
 func (d *Driver) CreateNetwork(req *network.CreateNetworkRequest) (err error) {
-	defer func() { logRequest("CreateNetwork", req, nil, err) }()
+	defer func(start time.Time) { d.logRequest("CreateNetwork", start, req, nil, err) }(time.Now())
+	ctx, cancel := d.requestContext()
+	defer cancel()
 
 	// Convert string IP addresses in the request to net.IPNet.
 	ipv4, err := ParseIPAMDataSlice(req.IPv4Data)
@@ -86,32 +262,60 @@ func (d *Driver) CreateNetwork(req *network.CreateNetworkRequest) (err error) {
 	}
 
 	// Call into the real bridge driver.
-	return d.bridge.CreateNetwork(req.NetworkID, req.Options, ipv4, ipv6)
+	return d.bridge.CreateNetwork(ctx, req.NetworkID, req.Options, ipv4, ipv6)
 }
 
 func (d *Driver) AllocateNetwork(req *network.AllocateNetworkRequest) (res *network.AllocateNetworkResponse, err error) {
-	defer func() { logRequest("AllocateNetwork", req, res, err) }()
-	return nil, types.NotImplementedErrorf("not implemented")
+	defer func(start time.Time) { d.logRequest("AllocateNetwork", start, req, res, err) }(time.Now())
+
+	ipv4, err := ParseIPAMDataSlice(ipamDataPointers(req.IPv4Data))
+	if err != nil {
+		return nil, types.BadRequestErrorf("invalid IPv4 information: %v", err)
+	}
+	ipv6, err := ParseIPAMDataSlice(ipamDataPointers(req.IPv6Data))
+	if err != nil {
+		return nil, types.BadRequestErrorf("invalid IPv6 information: %v", err)
+	}
+
+	opts, err := d.bridge.AllocateNetwork(req.NetworkID, req.Options, ipv4, ipv6)
+	if err != nil {
+		return nil, err
+	}
+	return &network.AllocateNetworkResponse{Options: opts}, nil
+}
+
+// ipamDataPointers adapts the IPAM data of an AllocateNetworkRequest, which unlike other requests is not held by
+// pointer.
+func ipamDataPointers(in []network.IPAMData) []*network.IPAMData {
+	out := make([]*network.IPAMData, len(in))
+	for i := range in {
+		out[i] = &in[i]
+	}
+	return out
 }
 
 func (d *Driver) DeleteNetwork(req *network.DeleteNetworkRequest) (err error) {
-	defer func() { logRequest("DeleteNetwork", req, nil, err) }()
-	return d.bridge.DeleteNetwork(req.NetworkID)
+	defer func(start time.Time) { d.logRequest("DeleteNetwork", start, req, nil, err) }(time.Now())
+	ctx, cancel := d.requestContext()
+	defer cancel()
+	return d.bridge.DeleteNetwork(ctx, req.NetworkID)
 }
 
 func (d *Driver) FreeNetwork(req *network.FreeNetworkRequest) (err error) {
-	defer func() { logRequest("FreeNetwork", req, nil, err) }()
-	return types.NotImplementedErrorf("not implemented")
+	defer func(start time.Time) { d.logRequest("FreeNetwork", start, req, nil, err) }(time.Now())
+	return d.bridge.FreeNetwork(req.NetworkID)
 }
 
 func (d *Driver) CreateEndpoint(req *network.CreateEndpointRequest) (res *network.CreateEndpointResponse, err error) {
-	defer func() { logRequest("CreateEndpoint", req, res, err) }()
+	defer func(start time.Time) { d.logRequest("CreateEndpoint", start, req, res, err) }(time.Now())
+	ctx, cancel := d.requestContext()
+	defer cancel()
 
 	ei, err := ParseEndpointInterface(req.Interface)
 	if err != nil {
 		return nil, types.BadRequestErrorf("invalid endpoint info: %v", err)
 	}
-	ei, err = d.bridge.CreateEndpoint(req.NetworkID, req.EndpointID, ei, req.Options)
+	ei, err = d.bridge.CreateEndpoint(ctx, req.NetworkID, req.EndpointID, ei, req.Options)
 	if err != nil {
 		return nil, err
 	}
@@ -119,12 +323,14 @@ func (d *Driver) CreateEndpoint(req *network.CreateEndpointRequest) (res *networ
 }
 
 func (d *Driver) DeleteEndpoint(req *network.DeleteEndpointRequest) (err error) {
-	defer func() { logRequest("DeleteEndpoint", req, nil, err) }()
-	return d.bridge.DeleteEndpoint(req.NetworkID, req.EndpointID)
+	defer func(start time.Time) { d.logRequest("DeleteEndpoint", start, req, nil, err) }(time.Now())
+	ctx, cancel := d.requestContext()
+	defer cancel()
+	return d.bridge.DeleteEndpoint(ctx, req.NetworkID, req.EndpointID)
 }
 
 func (d *Driver) EndpointInfo(req *network.InfoRequest) (res *network.InfoResponse, err error) {
-	defer func() { logRequest("EndpointInfo", req, res, err) }()
+	defer func(start time.Time) { d.logRequest("EndpointInfo", start, req, res, err) }(time.Now())
 	info, err := d.bridge.EndpointInfo(req.NetworkID, req.EndpointID)
 	if err != nil {
 		return nil, err
@@ -132,9 +338,64 @@ func (d *Driver) EndpointInfo(req *network.InfoRequest) (res *network.InfoRespon
 	return &network.InfoResponse{Value: info}, nil
 }
 
+// RebuildNetwork recreates the bridge of a single network and reattaches its ports and endpoints.
+func (d *Driver) RebuildNetwork(networkID string) error {
+	return d.bridge.RebuildNetwork(networkID)
+}
+
+// PlanDelete describes what deleting a network would tear down, without deleting it.
+func (d *Driver) PlanDelete(networkID string) (*DeletePlan, error) {
+	return d.bridge.PlanDelete(networkID)
+}
+
+// BridgeVLANs reports the VLANs configured on a network's bridge and their port memberships.
+func (d *Driver) BridgeVLANs(networkID string) ([]BridgeVLAN, error) {
+	return d.bridge.BridgeVLANs(networkID)
+}
+
+// Reconcile deletes the bridges, veths and endpoint FDB entries left behind by this driver which no known network or
+// endpoint holds, or only logs them with NoCleanup. A pass is also run on startup, once the state is restored.
+func (d *Driver) Reconcile() (*ReconcileSummary, error) {
+	summary, err := d.bridge.Reconcile()
+	d.bridge.recordReconcile(summary, err)
+	return summary, err
+}
+
+// AdoptMigratedEndpoint recreates an endpoint migrated from another host with its existing address and MAC.
+func (d *Driver) AdoptMigratedEndpoint(networkID, endpointID string, ei EndpointInterface) error {
+	return d.bridge.AdoptMigratedEndpoint(networkID, endpointID, ei)
+}
+
+// SetNetworkDraining starts or stops draining a network ahead of its deletion.
+func (d *Driver) SetNetworkDraining(networkID string, on bool) error {
+	return d.bridge.SetNetworkDraining(networkID, on)
+}
+
+// SetNetworkLogging enables or disables the logging of successful requests on a network.
+func (d *Driver) SetNetworkLogging(networkID string, on bool) error {
+	return d.bridge.SetNetworkLogging(networkID, on)
+}
+
+// SetEndpointMeta replaces the opaque metadata stored on an endpoint, as reported by EndpointInfo.
+func (d *Driver) SetEndpointMeta(networkID, endpointID string, meta map[string]string) error {
+	return d.bridge.SetEndpointMeta(networkID, endpointID, meta)
+}
+
+// SetEndpointVLAN replaces the VLANs of an endpoint's bridge port with the given untagged PVID and tagged VLANs.
+func (d *Driver) SetEndpointVLAN(networkID, endpointID string, pvid uint16, tagged []uint16) error {
+	return d.bridge.SetEndpointVLAN(networkID, endpointID, pvid, tagged)
+}
+
+// SetEndpointAddress renumbers a joined endpoint, replacing its address of the same family as newAddr.
+func (d *Driver) SetEndpointAddress(networkID, endpointID string, newAddr *net.IPNet) error {
+	return d.bridge.SetEndpointAddress(networkID, endpointID, newAddr)
+}
+
 func (d *Driver) Join(req *network.JoinRequest) (res *network.JoinResponse, err error) {
-	defer func() { logRequest("Join", req, res, err) }()
-	info, err := d.bridge.Join(req.NetworkID, req.EndpointID, req.SandboxKey, req.Options)
+	defer func(start time.Time) { d.logRequest("Join", start, req, res, err) }(time.Now())
+	ctx, cancel := d.requestContext()
+	defer cancel()
+	info, err := d.bridge.Join(ctx, req.NetworkID, req.EndpointID, req.SandboxKey, req.Options)
 	if err != nil {
 		return nil, err
 	}
@@ -142,31 +403,33 @@ func (d *Driver) Join(req *network.JoinRequest) (res *network.JoinResponse, err
 }
 
 func (d *Driver) Leave(req *network.LeaveRequest) (err error) {
-	defer func() { logRequest("Leave", req, nil, err) }()
-	return d.bridge.Leave(req.NetworkID, req.EndpointID)
+	defer func(start time.Time) { d.logRequest("Leave", start, req, nil, err) }(time.Now())
+	ctx, cancel := d.requestContext()
+	defer cancel()
+	return d.bridge.Leave(ctx, req.NetworkID, req.EndpointID)
 }
 
 func (d *Driver) DiscoverNew(notif *network.DiscoveryNotification) (err error) {
-	defer func() { logRequest("DiscoverNew", notif, nil, err) }()
+	defer func(start time.Time) { d.logRequest("DiscoverNew", start, notif, nil, err) }(time.Now())
 	return nil
 }
 
 func (d *Driver) DiscoverDelete(notif *network.DiscoveryNotification) (err error) {
-	defer func() { logRequest("DiscoverDelete", notif, nil, err) }()
+	defer func(start time.Time) { d.logRequest("DiscoverDelete", start, notif, nil, err) }(time.Now())
 	return nil
 }
 
 // ProgramExternalConnectivity is called after Join for non-internal networks to give external network access.
-// Although this driver does not support external connectivity, it does not return an error because libnetwork
-// will fail the endpoint initialization if any error is returned.
+// The ports of the request's port map are published on the host. Only networks created with l2bridge.masquerade are
+// given outbound access; for others only the ports are published, and a request without any takes no action.
 func (d *Driver) ProgramExternalConnectivity(req *network.ProgramExternalConnectivityRequest) (err error) {
-	defer func() { logRequest("ProgramExternalConnectivity", req, nil, err) }()
-	return nil
+	defer func(start time.Time) { d.logRequest("ProgramExternalConnectivity", start, req, nil, err) }(time.Now())
+	return d.bridge.ProgramExternalConnectivity(req.NetworkID, req.EndpointID, req.Options)
 }
 
-// RevokeExternalConnectivity is called bedore Leave when tearing down an endpoint to remove up external network access.
-// As for ProgramExternalConnectivity, we return no error here, bt take no action.
+// RevokeExternalConnectivity is called before Leave when tearing down an endpoint to remove up external network access.
+// It removes the rules installed by ProgramExternalConnectivity, if any.
 func (d *Driver) RevokeExternalConnectivity(req *network.RevokeExternalConnectivityRequest) (err error) {
-	defer func() { logRequest("RevokeExternalConnectivity", req, nil, err) }()
-	return nil
+	defer func(start time.Time) { d.logRequest("RevokeExternalConnectivity", start, req, nil, err) }(time.Now())
+	return d.bridge.RevokeExternalConnectivity(req.NetworkID, req.EndpointID)
 }
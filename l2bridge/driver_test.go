@@ -0,0 +1,122 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// captureLogs records the entries logged during the test. The hooks installed by drivers, such as the dry run one,
+// are kept for the tests that follow.
+func captureLogs(t *testing.T) *logtest.Hook {
+	hooks := make(logrus.LevelHooks)
+	for level, levelHooks := range logrus.StandardLogger().Hooks {
+		hooks[level] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(hooks) })
+	return logtest.NewGlobal()
+}
+
+func TestLogStartupBanner(t *testing.T) {
+	config := DefaultConfiguration()
+	config.DryRun = true
+	config.MetricsAddress = "127.0.0.1:9323"
+	config.OperationTimeout = 30 * time.Second
+	config.TransientErrnos = []syscall.Errno{syscall.EBUSY}
+	config.FlowLogPath = "-"
+	config.FlowLogSampleRate = 10
+	config.WarmRestart = false
+	d := NewDriver(config)
+	d.socketAddress = "/run/docker/plugins/l2bridge.sock"
+
+	hook := captureLogs(t)
+	d.LogStartupBanner()
+
+	var banner *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Starting l2bridge driver" {
+			banner = entry
+		}
+	}
+	if banner == nil {
+		t.Fatal("expected the startup banner to be logged")
+	}
+	for field, want := range map[string]string{
+		"version":              Version,
+		"socket":               "/run/docker/plugins/l2bridge.sock",
+		"scope":                "local",
+		"dry_run":              "true",
+		"warm_restart":         "false",
+		"iptables":             "true",
+		"metrics_address":      "127.0.0.1:9323",
+		"debug_address":        "",
+		"operation_timeout":    "30s",
+		"transient_errnos":     FormatErrnos([]syscall.Errno{syscall.EBUSY}),
+		"flow_log":             "-",
+		"flow_log_sample_rate": "10",
+	} {
+		if got := fmt.Sprint(banner.Data[field]); got != want {
+			t.Errorf("expected banner field %s %q, got %q", field, want, got)
+		}
+	}
+}
+
+func TestNetworkLogging(t *testing.T) {
+	tests := []struct {
+		name   string
+		label  string
+		set    string // on or off, to change the logging through SetNetworkLogging
+		err    error
+		logged bool
+		level  logrus.Level
+	}{
+		{name: "logged success", logged: true, level: logrus.InfoLevel},
+		{name: "quiet success", label: "false"},
+		{name: "quiet failure", label: "false", err: types.BadRequestErrorf("bad"), logged: true, level: logrus.WarnLevel},
+		{name: "silenced by the management API", set: "off"},
+		{name: "re-enabled by the management API", label: "false", set: "on", logged: true, level: logrus.InfoLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver(&Configuration{DryRun: true})
+			var opts map[string]interface{}
+			if tt.label != "" {
+				opts = map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.LogRequests: tt.label}}
+			}
+			if err := d.bridge.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			if tt.set != "" {
+				if err := d.SetNetworkLogging(testID(1), tt.set == "on"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			hook := captureLogs(t)
+			req := &network.CreateEndpointRequest{NetworkID: testID(1), EndpointID: testID(2)}
+			d.logRequest("CreateEndpoint", time.Now(), req, nil, tt.err)
+			var entry *logrus.Entry
+			for _, e := range hook.AllEntries() {
+				if strings.HasPrefix(e.Message, "CreateEndpoint ") {
+					entry = e
+				}
+			}
+			if (entry != nil) != tt.logged {
+				t.Fatalf("expected the request logged %v, got %v", tt.logged, entry)
+			}
+			if entry != nil && entry.Level != tt.level {
+				t.Errorf("expected the request logged at %s, got %s", tt.level, entry.Level)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package l2bridge
+
+import (
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// dryRun reports whether the driver validates requests without touching the host.
+func (d *bridgeDriver) dryRun() bool {
+	return d.config.DryRun
+}
+
+// declareDryRunNetwork records a validated network without creating its bridge or attaching its uplink, so that
+// requests for its endpoints are validated against it.
+func (d *bridgeDriver) declareDryRunNetwork(config *networkConfiguration) {
+	n := &bridgeNetwork{
+		id:        config.ID,
+		endpoints: make(map[string]*bridgeEndpoint),
+		config:    config,
+		bridge:    &bridgeInterface{nlh: d.nlh},
+		driver:    d,
+		quiet:     config.QuietRequests,
+	}
+	d.Lock()
+	d.networks[config.ID] = n
+	d.Unlock()
+	logrus.Infof("Dry run: declared network %s without creating bridge %s", config.ID, config.BridgeName)
+}
+
+// dryRunLogOnce installs the dry run log hook once, however many dry run drivers are made.
+var dryRunLogOnce sync.Once
+
+// dryRunLogHook marks every log entry of a dry run driver, so that it is never mistaken for a live one.
+type dryRunLogHook struct{}
+
+func (dryRunLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (dryRunLogHook) Fire(entry *logrus.Entry) error {
+	entry.Data["dry_run"] = true
+	return nil
+}
+
+// dryRunHandle is the NetlinkHandle of a dry run driver. It makes no change to the host and sees none of it: links
+// added through it are only remembered, so that they can be looked up again, and every other change succeeds
+// without effect.
+type dryRunHandle struct {
+	sync.Mutex
+	links map[string]netlink.Link
+}
+
+func newDryRunHandle() NetlinkHandle {
+	return &dryRunHandle{links: make(map[string]netlink.Link)}
+}
+
+func (h *dryRunHandle) LinkAdd(link netlink.Link) error {
+	h.Lock()
+	defer h.Unlock()
+	h.links[link.Attrs().Name] = link
+	if veth, ok := link.(*netlink.Veth); ok {
+		h.links[veth.PeerName] = &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: veth.PeerName}, PeerName: veth.Name}
+	}
+	return nil
+}
+
+func (h *dryRunHandle) LinkDel(link netlink.Link) error {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.links, link.Attrs().Name)
+	if veth, ok := link.(*netlink.Veth); ok {
+		delete(h.links, veth.PeerName)
+	}
+	return nil
+}
+
+func (h *dryRunHandle) LinkByName(name string) (netlink.Link, error) {
+	h.Lock()
+	defer h.Unlock()
+	if link, ok := h.links[name]; ok {
+		return link, nil
+	}
+	return nil, netlink.LinkNotFoundError{}
+}
+
+func (h *dryRunHandle) LinkByIndex(index int) (netlink.Link, error) {
+	return nil, netlink.LinkNotFoundError{}
+}
+
+func (h *dryRunHandle) LinkList() ([]netlink.Link, error) {
+	h.Lock()
+	defer h.Unlock()
+	links := make([]netlink.Link, 0, len(h.links))
+	for _, link := range h.links {
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (h *dryRunHandle) LinkSetUp(link netlink.Link) error                             { return nil }
+func (h *dryRunHandle) LinkSetDown(link netlink.Link) error                           { return nil }
+func (h *dryRunHandle) LinkSetMTU(link netlink.Link, mtu int) error                   { return nil }
+func (h *dryRunHandle) LinkSetMaster(link netlink.Link, master *netlink.Bridge) error { return nil }
+func (h *dryRunHandle) LinkSetNoMaster(link netlink.Link) error                       { return nil }
+func (h *dryRunHandle) LinkSetHairpin(link netlink.Link, mode bool) error             { return nil }
+func (h *dryRunHandle) LinkSetAlias(link netlink.Link, name string) error             { return nil }
+func (h *dryRunHandle) SetPromiscOn(link netlink.Link) error                          { return nil }
+func (h *dryRunHandle) SetPromiscOff(link netlink.Link) error                         { return nil }
+func (h *dryRunHandle) LinkSetLearning(link netlink.Link, mode bool) error            { return nil }
+func (h *dryRunHandle) AddrAdd(link netlink.Link, addr *netlink.Addr) error           { return nil }
+func (h *dryRunHandle) AddrDel(link netlink.Link, addr *netlink.Addr) error           { return nil }
+func (h *dryRunHandle) AddrReplace(link netlink.Link, addr *netlink.Addr) error       { return nil }
+func (h *dryRunHandle) NeighAdd(neigh *netlink.Neigh) error                           { return nil }
+func (h *dryRunHandle) NeighSet(neigh *netlink.Neigh) error                           { return nil }
+func (h *dryRunHandle) NeighDel(neigh *netlink.Neigh) error                           { return nil }
+
+func (h *dryRunHandle) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	return nil
+}
+
+func (h *dryRunHandle) LinkGetProtinfo(link netlink.Link) (netlink.Protinfo, error) {
+	return netlink.Protinfo{}, nil
+}
+
+func (h *dryRunHandle) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	return nil, nil
+}
+
+func (h *dryRunHandle) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	return nil, nil
+}
+
+func (h *dryRunHandle) ConntrackDeleteFilter(table netlink.ConntrackTableType, family netlink.InetFamily, filter netlink.CustomConntrackFilter) (uint, error) {
+	return 0, nil
+}
+
+func (h *dryRunHandle) BridgeVlanList() (map[int32][]*nl.BridgeVlanInfo, error) {
+	return map[int32][]*nl.BridgeVlanInfo{}, nil
+}
+
+func (h *dryRunHandle) BridgeVlanAdd(link netlink.Link, vid uint16, pvid, untagged, self, master bool) error {
+	return nil
+}
+
+func (h *dryRunHandle) BridgeVlanDel(link netlink.Link, vid uint16, pvid, untagged, self, master bool) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package l2bridge
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxDSCP        = 63
+	maxSkbPriority = 15
+)
+
+// parseDSCPMap parses a comma separated list of dscp:priority pairs.
+func parseDSCPMap(s string) (map[uint8]uint32, error) {
+	m := make(map[uint8]uint32)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("entry %q is not of the form dscp:priority", entry)
+		}
+		dscp, err := strconv.ParseUint(parts[0], 10, 8)
+		if err != nil || dscp > maxDSCP {
+			return nil, fmt.Errorf("entry %q has invalid dscp value, must be between 0 and %d", entry, maxDSCP)
+		}
+		prio, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil || prio > maxSkbPriority {
+			return nil, fmt.Errorf("entry %q has invalid priority value, must be between 0 and %d", entry, maxSkbPriority)
+		}
+		if _, ok := m[uint8(dscp)]; ok {
+			return nil, fmt.Errorf("dscp value %d is mapped more than once", dscp)
+		}
+		m[uint8(dscp)] = uint32(prio)
+	}
+	return m, nil
+}
+
+// setupDSCPMap installs ingress filters on the named interface setting the skb priority of IPv4 and IPv6 packets
+// according to their DSCP mark.
+func setupDSCPMap(ifName string, dscpMap map[uint8]uint32) error {
+	if err := setupIngressQdisc(ifName); err != nil {
+		return err
+	}
+
+	dscps := make([]int, 0, len(dscpMap))
+	for dscp := range dscpMap {
+		dscps = append(dscps, int(dscp))
+	}
+	sort.Ints(dscps)
+
+	for _, dscp := range dscps {
+		tos := fmt.Sprintf("0x%02x", dscp<<2)
+		prio := strconv.FormatUint(uint64(dscpMap[uint8(dscp)]), 10)
+		if err := tc("filter", "add", "dev", ifName, "parent", "ffff:", "protocol", "ip", "u32",
+			"match", "ip", "dsfield", tos, "0xfc", "action", "skbedit", "priority", prio); err != nil {
+			return err
+		}
+		if err := tc("filter", "add", "dev", ifName, "parent", "ffff:", "protocol", "ipv6", "u32",
+			"match", "ip6", "priority", tos, "0xfc", "action", "skbedit", "priority", prio); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeDSCPMap removes the filters installed by setupDSCPMap.
+func removeDSCPMap(ifName string) error {
+	return removeIngressQdisc(ifName)
+}
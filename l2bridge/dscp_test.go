@@ -0,0 +1,80 @@
+package l2bridge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordCommands replaces runCommand for the duration of the test, returning the commands run, joined by spaces.
+func recordCommands(t *testing.T) *[]string {
+	var cmds []string
+	orig := runCommand
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		cmds = append(cmds, name+" "+strings.Join(args, " "))
+		return nil, nil
+	}
+	t.Cleanup(func() { runCommand = orig })
+	return &cmds
+}
+
+func TestParseDSCPMap(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[uint8]uint32
+		err  string
+	}{
+		{in: "46:5", want: map[uint8]uint32{46: 5}},
+		{in: " 46:5 , 10:1,", want: map[uint8]uint32{46: 5, 10: 1}},
+		{in: "", want: map[uint8]uint32{}},
+		{in: "0:0,63:15", want: map[uint8]uint32{0: 0, 63: 15}},
+		{in: "46", err: "not of the form"},
+		{in: "46:5:1", err: "not of the form"},
+		{in: "64:1", err: "invalid dscp"},
+		{in: "ef:1", err: "invalid dscp"},
+		{in: "46:16", err: "invalid priority"},
+		{in: "46:-1", err: "invalid priority"},
+		{in: "46:5,46:6", err: "more than once"},
+	}
+	for _, tt := range tests {
+		got, err := parseDSCPMap(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseDSCPMap(%q): expected an error containing %q, got %v", tt.in, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDSCPMap(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDSCPMap(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSetupDSCPMap(t *testing.T) {
+	cmds := recordCommands(t)
+	if err := setupDSCPMap("veth1", map[uint8]uint32{46: 5, 10: 1}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"tc qdisc replace dev veth1 handle ffff: ingress",
+		"tc filter add dev veth1 parent ffff: protocol ip u32 match ip dsfield 0x28 0xfc action skbedit priority 1",
+		"tc filter add dev veth1 parent ffff: protocol ipv6 u32 match ip6 priority 0x28 0xfc action skbedit priority 1",
+		"tc filter add dev veth1 parent ffff: protocol ip u32 match ip dsfield 0xb8 0xfc action skbedit priority 5",
+		"tc filter add dev veth1 parent ffff: protocol ipv6 u32 match ip6 priority 0xb8 0xfc action skbedit priority 5",
+	}
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(*cmds, "\n"))
+	}
+
+	*cmds = nil
+	if err := removeDSCPMap("veth1"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"tc qdisc del dev veth1 handle ffff: ingress"}; !equalStrings(*cmds, want) {
+		t.Errorf("expected %v, got %v", want, *cmds)
+	}
+}
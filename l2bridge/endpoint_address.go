@@ -0,0 +1,200 @@
+package l2bridge
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// SetEndpointAddress renumbers a joined endpoint without restarting its container. The new address is added to the
+// container interface before the old one of the same family is removed, conntrack entries of the old address are
+// flushed, published ports and masquerading follow the new address, and the stored endpoint state is updated.
+func (d *bridgeDriver) SetEndpointAddress(nid, eid string, newAddr *net.IPNet) error {
+	if newAddr == nil || newAddr.IP == nil {
+		return types.BadRequestErrorf("no address given for endpoint %s", eid)
+	}
+	if ip4 := newAddr.IP.To4(); ip4 != nil {
+		newAddr = &net.IPNet{IP: ip4, Mask: newAddr.Mask}
+	}
+	v6 := newAddr.IP.To4() == nil
+
+	defer d.lockNetwork(nid)()
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	ei := &EndpointInterface{Address: newAddr}
+	if v6 {
+		ei = &EndpointInterface{AddressIPv6: newAddr}
+	}
+	if err := n.config.validateEndpointAddress(ei); err != nil {
+		return err
+	}
+
+	// The network lock keeps other requests from taking the address until it is assigned.
+	n.Lock()
+	oldAddr, sandboxKey := ep.addr, ep.sandboxKey
+	if v6 {
+		oldAddr = ep.addrv6
+	}
+	for _, other := range n.endpoints {
+		for _, ip := range other.addresses() {
+			if ip.Equal(newAddr.IP) {
+				n.Unlock()
+				return types.ForbiddenErrorf("address %s is already allocated to endpoint %s", newAddr.IP, other.id)
+			}
+		}
+	}
+	n.Unlock()
+
+	if oldAddr == nil {
+		return types.ForbiddenErrorf("endpoint %s has no address of the family of %s to replace", eid, newAddr.IP)
+	}
+	if sandboxKey == "" {
+		return types.ForbiddenErrorf("endpoint %s is not joined to a sandbox", eid)
+	}
+
+	if err := d.renumber(sandboxKey, ep.macAddress, oldAddr, newAddr); err != nil {
+		return internalErrorf("failed to renumber endpoint %s from %s to %s: %v", eid, oldAddr.IP, newAddr.IP, err)
+	}
+
+	if err := flushConntrack(d.nlh, oldAddr.IP); err != nil {
+		logrus.WithError(err).Warnf("Failed to flush conntrack entries for %s on endpoint (%s) renumbering", oldAddr.IP, eid)
+	}
+
+	// Move the state installed on Join from the old address to the new one.
+	if v6 && n.config.ProxyNDP && ep.config.wantsIPv6() {
+		if err := n.bridge.delProxyNeighbor(oldAddr.IP); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove proxy neighbor entry for %s on endpoint (%s) renumbering", oldAddr.IP, eid)
+		}
+		if err := n.bridge.addProxyNeighbor(newAddr.IP); err != nil {
+			logrus.WithError(err).Warnf("Failed to add proxy neighbor entry for %s on endpoint (%s) renumbering", newAddr.IP, eid)
+		}
+	}
+
+	n.Lock()
+	if v6 {
+		ep.addrv6 = newAddr
+	} else {
+		ep.addr = newAddr
+	}
+	n.Unlock()
+	n.updatePeerPolicies()
+	if !v6 {
+		if err := n.moveExternalConnectivity(ep); err != nil {
+			d.storeSync("endpoint renumbering")
+			return err
+		}
+	}
+	d.storeSync("endpoint renumbering")
+
+	if ep.config.Antispoof {
+		if err := ep.removeAntispoof(); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove anti-spoofing rules on endpoint (%s) renumbering", eid)
+		}
+		if err := ep.setupAntispoof(); err != nil {
+			return internalErrorf("failed to install anti-spoofing rules for endpoint %s: %v", eid, err)
+		}
+	}
+	return nil
+}
+
+// renumberSandboxInterface replaces oldAddr by newAddr on the interface with the given MAC in the sandbox.
+func renumberSandboxInterface(sandboxKey string, mac net.HardwareAddr, oldAddr, newAddr *net.IPNet) error {
+	sbox, err := netns.GetFromPath(sandboxKey)
+	if err != nil {
+		return fmt.Errorf("failed to open sandbox %s: %w", sandboxKey, err)
+	}
+	defer sbox.Close()
+
+	nlh, err := netlink.NewHandleAt(sbox)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink handle in sandbox %s: %w", sandboxKey, err)
+	}
+	defer nlh.Delete()
+
+	link, err := sandboxLinkByMAC(nlh, sandboxKey, mac)
+	if err != nil {
+		return err
+	}
+
+	if err := nlh.AddrAdd(link, &netlink.Addr{IPNet: newAddr}); err != nil {
+		return fmt.Errorf("failed to add %s to %s: %w", newAddr, link.Attrs().Name, err)
+	}
+	if err := nlh.AddrDel(link, &netlink.Addr{IPNet: oldAddr}); err != nil {
+		return fmt.Errorf("failed to remove %s from %s: %w", oldAddr, link.Attrs().Name, err)
+	}
+
+	if err := flushConntrack(nlh, oldAddr.IP); err != nil {
+		logrus.WithError(err).Warnf("Failed to flush conntrack entries for %s in sandbox %s", oldAddr.IP, sandboxKey)
+	}
+	return nil
+}
+
+// sandboxLinkByMAC finds the interface with the given MAC through the netlink handle of the sandbox.
+func sandboxLinkByMAC(nlh *netlink.Handle, sandboxKey string, mac net.HardwareAddr) (netlink.Link, error) {
+	links, err := nlh.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		if bytes.Equal(l.Attrs().HardwareAddr, mac) {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("no interface with MAC %s in sandbox %s", mac, sandboxKey)
+}
+
+// reclaimSandboxInterface moves the interface with the given MAC out of the sandbox back into the host namespace,
+// under its name before it was moved in. Nothing is done if the sandbox is gone.
+func reclaimSandboxInterface(sandboxKey string, mac net.HardwareAddr, name string) error {
+	sbox, err := netns.GetFromPath(sandboxKey)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open sandbox %s: %w", sandboxKey, err)
+	}
+	defer sbox.Close()
+
+	host, err := netns.GetFromPath("/proc/self/ns/net")
+	if err != nil {
+		return fmt.Errorf("failed to open the host network namespace: %w", err)
+	}
+	defer host.Close()
+
+	nlh, err := netlink.NewHandleAt(sbox)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink handle in sandbox %s: %w", sandboxKey, err)
+	}
+	defer nlh.Delete()
+
+	link, err := sandboxLinkByMAC(nlh, sandboxKey, mac)
+	if err != nil {
+		return err
+	}
+	if err := nlh.LinkSetDown(link); err != nil {
+		return fmt.Errorf("failed to set %s down: %w", link.Attrs().Name, err)
+	}
+	if err := nlh.LinkSetName(link, name); err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %w", link.Attrs().Name, name, err)
+	}
+	if err := nlh.LinkSetNsFd(link, int(host)); err != nil {
+		return fmt.Errorf("failed to move %s to the host namespace: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package l2bridge
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/docker/libnetwork/types"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	ip, pool, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.IP = ip
+	return pool
+}
+
+func TestValidateEndpointAddress(t *testing.T) {
+	config := &networkConfiguration{
+		PoolIPv4:      mustCIDR(t, "10.1.0.0/16"),
+		SecondaryIPv4: []secondarySubnet{{Pool: mustCIDR(t, "10.2.0.0/24")}},
+		PoolIPv6:      mustCIDR(t, "2001:db8:1::/64"),
+	}
+	v4only := &networkConfiguration{PoolIPv4: mustCIDR(t, "10.1.0.0/16")}
+	tests := []struct {
+		name   string
+		config *networkConfiguration
+		v4, v6 string
+		err    string
+	}{
+		{name: "v4 in pool", config: config, v4: "10.1.0.2/16"},
+		{name: "v4 in secondary pool", config: config, v4: "10.2.0.2/24"},
+		{name: "v4 outside pools", config: config, v4: "10.3.0.2/16", err: "10.3.0.2 is outside of the network's IPv4 pools 10.1.0.0/16, 10.2.0.0/24"},
+		{name: "v6 in pool", config: config, v6: "2001:db8:1::2/64"},
+		{name: "v6 outside pool", config: config, v6: "2001:db8:2::2/64", err: "2001:db8:2::2 is outside of the network's IPv6 pools 2001:db8:1::/64"},
+		{name: "v6 without pool", config: v4only, v6: "2001:db8:1::2/64", err: "has no IPv6 pool"},
+		{name: "dual stack", config: config, v4: "10.1.0.2/16", v6: "2001:db8:1::2/64"},
+	}
+	for _, tt := range tests {
+		ei := &EndpointInterface{}
+		if tt.v4 != "" {
+			ei.Address = mustCIDR(t, tt.v4)
+		}
+		if tt.v6 != "" {
+			ei.AddressIPv6 = mustCIDR(t, tt.v6)
+		}
+		err := tt.config.validateEndpointAddress(ei)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Errorf("%s: expected a BadRequestError, got %v", tt.name, err)
+		} else if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestFillEndpointPrefix(t *testing.T) {
+	config := &networkConfiguration{
+		PoolIPv4:      mustCIDR(t, "10.1.0.0/16"),
+		SecondaryIPv4: []secondarySubnet{{Pool: mustCIDR(t, "10.2.0.0/24")}},
+		PoolIPv6:      mustCIDR(t, "2001:db8:1::/64"),
+	}
+	tests := []struct {
+		name   string
+		config *networkConfiguration
+		ip     string
+		mask   net.IPMask
+		want   string
+	}{
+		{name: "v4 pool", config: config, ip: "10.1.0.2", want: "10.1.0.2/16"},
+		{name: "v4 secondary pool", config: config, ip: "10.2.0.2", want: "10.2.0.2/24"},
+		{name: "v4 outside pools", config: config, ip: "10.3.0.2", want: "10.3.0.2/16"},
+		{name: "v4 given prefix", config: config, ip: "10.1.0.2", mask: net.CIDRMask(24, 32), want: "10.1.0.2/24"},
+		{name: "v4 without pool", config: &networkConfiguration{}, ip: "10.1.0.2", want: "10.1.0.2/32"},
+		{name: "v6 pool", config: config, ip: "2001:db8:1::2", want: "2001:db8:1::2/64"},
+		{name: "v6 without pool", config: &networkConfiguration{}, ip: "2001:db8:1::2", want: "2001:db8:1::2/128"},
+	}
+	for _, tt := range tests {
+		addr := &net.IPNet{IP: net.ParseIP(tt.ip), Mask: tt.mask}
+		ei := &EndpointInterface{}
+		if addr.IP.To4() != nil {
+			addr.IP = addr.IP.To4()
+			ei.Address = addr
+		} else {
+			ei.AddressIPv6 = addr
+		}
+		tt.config.fillEndpointPrefix(ei)
+		if addr.String() != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, addr)
+		}
+	}
+}
+
+func TestCreateEndpointOutsidePools(t *testing.T) {
+	d := newDryRunDriver()
+	newDualStackNetwork(t, d, testID(1))
+	tests := []struct {
+		name   string
+		v4, v6 string
+		err    bool
+	}{
+		{name: "in pools", v4: "10.1.0.2/16", v6: "2001:db8:1::2/64"},
+		{name: "v4 outside", v4: "192.168.0.2/24", err: true},
+		{name: "v6 outside", v4: "10.1.0.3/16", v6: "2001:db8:9::2/64", err: true},
+	}
+	for j, tt := range tests {
+		ei := &EndpointInterface{Address: mustCIDR(t, tt.v4)}
+		if tt.v6 != "" {
+			ei.AddressIPv6 = mustCIDR(t, tt.v6)
+		}
+		_, err := d.CreateEndpoint(context.Background(), testID(1), testID(2+j), ei, nil)
+		if !tt.err {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Errorf("%s: expected a BadRequestError, got %v", tt.name, err)
+		}
+		if n, _ := d.getNetwork(testID(1)); n.endpoints[testID(2+j)] != nil {
+			t.Errorf("%s: expected the endpoint not to be created", tt.name)
+		}
+	}
+}
+
+func TestCreateEndpointWithoutPrefix(t *testing.T) {
+	d := newDryRunDriver()
+	newDualStackNetwork(t, d, testID(1))
+	tests := []struct {
+		name         string
+		in           network.EndpointInterface
+		want, wantV6 string
+		err          bool
+	}{
+		{name: "v4 without prefix", in: network.EndpointInterface{Address: "10.1.0.2"}, want: "10.1.0.2/16"},
+		{name: "v4 with prefix", in: network.EndpointInterface{Address: "10.1.0.3/24"}, want: "10.1.0.3/24"},
+		{name: "v6 without prefix", in: network.EndpointInterface{Address: "10.1.0.4", AddressIPv6: "2001:db8:1::4"},
+			want: "10.1.0.4/16", wantV6: "2001:db8:1::4/64"},
+		{name: "invalid address", in: network.EndpointInterface{Address: "10.1.0"}, err: true},
+	}
+	for j, tt := range tests {
+		ei, err := ParseEndpointInterface(&tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected a parse error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if _, err := d.CreateEndpoint(context.Background(), testID(1), testID(2+j), ei, nil); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		n, _ := d.getNetwork(testID(1))
+		ep := n.endpoints[testID(2+j)]
+		if ep.addr.String() != tt.want {
+			t.Errorf("%s: expected address %s, got %s", tt.name, tt.want, ep.addr)
+		}
+		if tt.wantV6 != "" && ep.addrv6.String() != tt.wantV6 {
+			t.Errorf("%s: expected IPv6 address %s, got %s", tt.name, tt.wantV6, ep.addrv6)
+		}
+	}
+}
+
+func TestCreateEndpointProvidedAndGenerated(t *testing.T) {
+	// Endpoint 2 holds 02:42:0a:01:00:05, 10.1.0.5 and, as if provided, the address derived from 02:42:0a:01:00:07.
+	taken := &EndpointInterface{
+		Address:     mustCIDR(t, "10.1.0.5/16"),
+		AddressIPv6: mustCIDR(t, "2001:db8:1::242:a01:7/64"),
+	}
+	taken.MacAddress, _ = net.ParseMAC("02:42:0a:01:00:05")
+
+	tests := []struct {
+		name      string
+		mac, v6   string
+		v4        string
+		wantV6    string // For a provided MAC, the address derived from it
+		forbidden bool
+		conflict  bool
+	}{
+		{name: "MAC and IPv6 address generated", v4: "10.1.0.6/16"},
+		{name: "MAC provided", v4: "10.1.0.6/16", mac: "02:42:0a:01:00:06", wantV6: "2001:db8:1::242:a01:6/64"},
+		{name: "IPv6 address provided", v4: "10.1.0.6/16", v6: "2001:db8:1::6/64"},
+		{name: "MAC and IPv6 address provided", v4: "10.1.0.6/16", mac: "02:42:0a:01:00:06", v6: "2001:db8:1::6/64"},
+		{name: "MAC in use", v4: "10.1.0.6/16", mac: "02:42:0a:01:00:05", conflict: true},
+		{name: "IPv4 address in use", v4: "10.1.0.5/16", conflict: true},
+		{name: "IPv6 address in use", v4: "10.1.0.6/16", v6: "2001:db8:1::242:a01:7/64", conflict: true},
+		{name: "address derived from MAC in use", v4: "10.1.0.6/16", mac: "02:42:0a:01:00:07", forbidden: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			newDualStackNetwork(t, d, testID(1))
+			ctx := context.Background()
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), taken, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			ei := &EndpointInterface{Address: mustCIDR(t, tt.v4)}
+			if tt.mac != "" {
+				ei.MacAddress, _ = net.ParseMAC(tt.mac)
+			}
+			if tt.v6 != "" {
+				ei.AddressIPv6 = mustCIDR(t, tt.v6)
+			}
+			out, err := d.CreateEndpoint(ctx, testID(1), testID(3), ei, nil)
+			n, _ := d.getNetwork(testID(1))
+			if tt.conflict || tt.forbidden {
+				if _, ok := err.(types.BadRequestError); tt.conflict && !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				if _, ok := err.(types.ForbiddenError); tt.forbidden && !ok {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+				if n.endpoints[testID(3)] != nil {
+					t.Error("expected the endpoint not to be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Provided values are kept and left out of the response; generated ones fill the gaps and are returned.
+			ep := n.endpoints[testID(3)]
+			if tt.mac != "" {
+				if ep.macAddress.String() != tt.mac || out.MacAddress != nil {
+					t.Errorf("expected the provided MAC %s kept, got %s and %s in the response", tt.mac, ep.macAddress, out.MacAddress)
+				}
+			} else if out.MacAddress == nil || !bytes.Equal(out.MacAddress, ep.macAddress) || bytes.Equal(ep.macAddress, taken.MacAddress) {
+				t.Errorf("expected a unique MAC generated and returned, got %s and %s in the response", ep.macAddress, out.MacAddress)
+			}
+			if ep.addr.String() != tt.v4 || out.Address != nil {
+				t.Errorf("expected the provided address %s kept, got %s and %v in the response", tt.v4, ep.addr, out.Address)
+			}
+			switch {
+			case tt.v6 != "":
+				if ep.addrv6.String() != tt.v6 || out.AddressIPv6 != nil {
+					t.Errorf("expected the provided IPv6 address %s kept, got %s and %v in the response", tt.v6, ep.addrv6, out.AddressIPv6)
+				}
+			case tt.wantV6 != "":
+				if ep.addrv6.String() != tt.wantV6 || out.AddressIPv6.String() != tt.wantV6 {
+					t.Errorf("expected IPv6 address %s derived and returned, got %s and %v in the response", tt.wantV6, ep.addrv6, out.AddressIPv6)
+				}
+			default:
+				if ep.addrv6 == nil || out.AddressIPv6.String() != ep.addrv6.String() {
+					t.Errorf("expected an IPv6 address derived and returned, got %v and %v in the response", ep.addrv6, out.AddressIPv6)
+				}
+			}
+		})
+	}
+}
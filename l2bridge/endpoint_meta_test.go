@@ -0,0 +1,111 @@
+package l2bridge
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestValidateEndpointMeta(t *testing.T) {
+	tests := []struct {
+		name string
+		meta map[string]string
+		err  bool
+	}{
+		{name: "none"},
+		{name: "small", meta: map[string]string{"owner": "team-a", "ticket": "OPS-1"}},
+		{name: "at the limit", meta: map[string]string{"k": strings.Repeat("v", maxEndpointMetaSize-1)}},
+		{name: "over the limit", meta: map[string]string{"k": strings.Repeat("v", maxEndpointMetaSize)}, err: true},
+		{name: "empty key", meta: map[string]string{"": "v"}, err: true},
+	}
+	for _, tt := range tests {
+		err := validateEndpointMeta(tt.meta)
+		if !tt.err {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(types.BadRequestError); !ok {
+			t.Errorf("%s: expected a BadRequestError, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestEndpointMetaRoundTrip(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, 2).To4(), Mask: net.CIDRMask(16, 32)}}
+	opts := map[string]interface{}{label.MetaPrefix + "owner": "team-a", label.MetaPrefix + "ticket": "OPS-1"}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	checkMeta := func(want map[string]string) {
+		t.Helper()
+		info, err := d.EndpointInfo(testID(1), testID(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]string{}
+		for k, v := range info {
+			if strings.HasPrefix(k, label.MetaPrefix) {
+				got[strings.TrimPrefix(k, label.MetaPrefix)] = v
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("expected metadata %v, got %v", want, got)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("expected metadata %s=%s, got %q", k, v, got[k])
+			}
+		}
+	}
+	checkMeta(map[string]string{"owner": "team-a", "ticket": "OPS-1"})
+
+	// Setting the metadata replaces it rather than merging.
+	if err := d.SetEndpointMeta(testID(1), testID(2), map[string]string{"owner": "team-b"}); err != nil {
+		t.Fatal(err)
+	}
+	checkMeta(map[string]string{"owner": "team-b"})
+
+	if err := d.SetEndpointMeta(testID(1), testID(2), map[string]string{"k": strings.Repeat("v", maxEndpointMetaSize)}); err == nil {
+		t.Error("expected oversized metadata to be rejected")
+	}
+	checkMeta(map[string]string{"owner": "team-b"})
+	if err := d.SetEndpointMeta(testID(1), testID(3), map[string]string{"owner": "team-b"}); err == nil {
+		t.Error("expected setting the metadata of an unknown endpoint to fail")
+	}
+
+	// The metadata is persisted with the endpoint.
+	d.config.DryRun = false
+	d.config.DataRoot = t.TempDir()
+	if err := d.storeUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(d.config.DataRoot, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state storedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Networks) != 1 || len(state.Networks[0].Endpoints) != 1 {
+		t.Fatalf("expected one stored endpoint, got %+v", state)
+	}
+	if meta := state.Networks[0].Endpoints[0].Meta; len(meta) != 1 || meta["owner"] != "team-b" {
+		t.Errorf("expected the metadata stored, got %v", meta)
+	}
+}
@@ -0,0 +1,86 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestSetEndpointAddress(t *testing.T) {
+	d := newDryRunDriver()
+	newDualStackNetwork(t, d, testID(1))
+	ctx := context.Background()
+	for j, addr := range []string{"10.1.0.2", "10.1.0.3"} {
+		ei := &EndpointInterface{Address: &net.IPNet{IP: net.ParseIP(addr).To4(), Mask: net.CIDRMask(16, 32)}}
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(2+j), ei, map[string]interface{}{label.IPFamily: ipFamilyV4}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const sandbox = "/var/run/docker/netns/x"
+	if _, err := d.Join(ctx, testID(1), testID(2), sandbox, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	type swap struct{ sandbox, old, new string }
+	var swaps []swap
+	d.renumber = func(sandboxKey string, mac net.HardwareAddr, oldAddr, newAddr *net.IPNet) error {
+		swaps = append(swaps, swap{sandboxKey, oldAddr.String(), newAddr.String()})
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		eid     string
+		addr    string
+		errType string
+	}{
+		{name: "renumbered", eid: testID(2), addr: "10.1.0.10/16"},
+		{name: "outside pool", eid: testID(2), addr: "10.2.0.10/16", errType: "badrequest"},
+		{name: "allocated", eid: testID(2), addr: "10.1.0.3/16", errType: "forbidden"},
+		{name: "no address of the family", eid: testID(2), addr: "2001:db8:1::10/64", errType: "forbidden"},
+		{name: "not joined", eid: testID(3), addr: "10.1.0.11/16", errType: "forbidden"},
+		{name: "unknown endpoint", eid: testID(4), addr: "10.1.0.12/16", errType: "notfound"},
+	}
+	for _, tt := range tests {
+		ip, mask, _ := net.ParseCIDR(tt.addr)
+		err := d.SetEndpointAddress(testID(1), tt.eid, &net.IPNet{IP: ip, Mask: mask.Mask})
+		var ok bool
+		switch tt.errType {
+		case "badrequest":
+			_, ok = err.(types.BadRequestError)
+		case "forbidden":
+			_, ok = err.(types.ForbiddenError)
+		case "notfound":
+			_, ok = err.(EndpointNotFoundError)
+		default:
+			ok = err == nil
+		}
+		if !ok {
+			t.Errorf("%s: unexpected result %v", tt.name, err)
+		}
+	}
+
+	if want := []swap{{sandbox, "10.1.0.2/16", "10.1.0.10/16"}}; len(swaps) != 1 || swaps[0] != want[0] {
+		t.Errorf("expected the sandbox interface renumbered %v, got %v", want, swaps)
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.IPv4Address] != "10.1.0.10/16" {
+		t.Errorf("expected the endpoint to report its new address, got %s", info[label.IPv4Address])
+	}
+
+	// The old address is free for another endpoint, while the new one is taken.
+	ei := &EndpointInterface{Address: &net.IPNet{IP: net.ParseIP("10.1.0.2").To4(), Mask: net.CIDRMask(16, 32)}}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(5), ei, map[string]interface{}{label.IPFamily: ipFamilyV4}); err != nil {
+		t.Errorf("expected the old address to be free: %v", err)
+	}
+	ei = &EndpointInterface{Address: &net.IPNet{IP: net.ParseIP("10.1.0.10").To4(), Mask: net.CIDRMask(16, 32)}}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(6), ei, map[string]interface{}{label.IPFamily: ipFamilyV4}); err == nil {
+		t.Error("expected the new address to be taken")
+	}
+}
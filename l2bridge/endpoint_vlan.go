@@ -0,0 +1,136 @@
+package l2bridge
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// Valid VLAN ids; 0 and 4095 are reserved.
+const (
+	minVLAN = 1
+	maxVLAN = 4094
+)
+
+// endpointVLAN is the VLAN assignment of an endpoint's bridge port.
+type endpointVLAN struct {
+	PVID   uint16
+	Tagged []uint16
+}
+
+func (v *endpointVLAN) report(m map[string]string) {
+	m[label.VLANPVID] = strconv.Itoa(int(v.PVID))
+	if len(v.Tagged) != 0 {
+		tagged := make([]string, len(v.Tagged))
+		for i, vid := range v.Tagged {
+			tagged[i] = strconv.Itoa(int(vid))
+		}
+		m[label.VLANTagged] = strings.Join(tagged, ",")
+	}
+}
+
+// validateEndpointVLAN checks that every VLAN id is valid and given once, with the PVID not also tagged.
+func validateEndpointVLAN(pvid uint16, tagged []uint16) error {
+	if pvid < minVLAN || pvid > maxVLAN {
+		return fmt.Errorf("pvid %d is outside of %d-%d", pvid, minVLAN, maxVLAN)
+	}
+	seen := map[uint16]bool{pvid: true}
+	for _, vid := range tagged {
+		if vid < minVLAN || vid > maxVLAN {
+			return fmt.Errorf("tagged vlan %d is outside of %d-%d", vid, minVLAN, maxVLAN)
+		}
+		if seen[vid] {
+			return fmt.Errorf("vlan %d is given more than once", vid)
+		}
+		seen[vid] = true
+	}
+	return nil
+}
+
+// SetEndpointVLAN reprograms the VLANs of an endpoint's bridge port, replacing every VLAN of the port with the given
+// untagged PVID and tagged VLANs. The bridge must filter VLANs for the assignment to take effect. If the new set
+// cannot be applied, the port's previous VLANs are restored.
+func (d *bridgeDriver) SetEndpointVLAN(nid, eid string, pvid uint16, tagged []uint16) error {
+	if err := validateEndpointVLAN(pvid, tagged); err != nil {
+		return types.BadRequestErrorf("invalid vlans for endpoint %s: %v", eid, err)
+	}
+
+	defer d.lockNetwork(nid)()
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	path := filepath.Join("/sys/class/net", n.config.BridgeName, "bridge/vlan_filtering")
+	if filtering, err := getSysBoolParam(path); err != nil || !filtering {
+		return types.ForbiddenErrorf("bridge %s of network %s does not filter vlans", n.config.BridgeName, nid)
+	}
+
+	link, err := d.nlh.LinkByName(ep.hostIfName)
+	if err != nil {
+		return internalErrorf("failed to find host interface %s of endpoint %s: %v", ep.hostIfName, eid, err)
+	}
+	all, err := d.nlh.BridgeVlanList()
+	if err != nil {
+		return internalErrorf("failed to list vlans of host interface %s: %v", ep.hostIfName, err)
+	}
+	old := all[int32(link.Attrs().Index)]
+
+	// Flush the old associations first, so that the port never carries a VLAN of both assignments. VLANs configured
+	// outside the driver are flushed as well.
+	if err := setPortVLANs(d.nlh, link, old, vlanInfos(pvid, tagged)); err != nil {
+		if all, lerr := d.nlh.BridgeVlanList(); lerr != nil {
+			logrus.WithError(lerr).Errorf("Failed to restore vlans of host interface %s", ep.hostIfName)
+		} else if rerr := setPortVLANs(d.nlh, link, all[int32(link.Attrs().Index)], old); rerr != nil {
+			logrus.WithError(rerr).Errorf("Failed to restore vlans of host interface %s", ep.hostIfName)
+		}
+		return internalErrorf("failed to set vlans of endpoint %s: %v", eid, err)
+	}
+
+	sorted := append([]uint16{}, tagged...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n.Lock()
+	ep.vlan = &endpointVLAN{PVID: pvid, Tagged: sorted}
+	n.Unlock()
+	d.storeSync("endpoint vlan change")
+	return nil
+}
+
+// vlanInfos describes a VLAN assignment the way the kernel reports it.
+func vlanInfos(pvid uint16, tagged []uint16) []*nl.BridgeVlanInfo {
+	infos := []*nl.BridgeVlanInfo{{Vid: pvid, Flags: nl.BRIDGE_VLAN_INFO_PVID | nl.BRIDGE_VLAN_INFO_UNTAGGED}}
+	for _, vid := range tagged {
+		infos = append(infos, &nl.BridgeVlanInfo{Vid: vid})
+	}
+	return infos
+}
+
+// setPortVLANs removes the given VLANs from the port, then adds the others.
+func setPortVLANs(nlh NetlinkHandle, link netlink.Link, remove, add []*nl.BridgeVlanInfo) error {
+	for _, v := range remove {
+		if err := nlh.BridgeVlanDel(link, v.Vid, v.PortVID(), v.EngressUntag(), false, true); err != nil {
+			return err
+		}
+	}
+	for _, v := range add {
+		if err := nlh.BridgeVlanAdd(link, v.Vid, v.PortVID(), v.EngressUntag(), false, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package l2bridge
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestValidateEndpointVLAN(t *testing.T) {
+	tests := []struct {
+		pvid   uint16
+		tagged []uint16
+		err    bool
+	}{
+		{pvid: 1},
+		{pvid: 4094, tagged: []uint16{1, 200}},
+		{pvid: 0, err: true},
+		{pvid: 4095, err: true},
+		{pvid: 10, tagged: []uint16{0}, err: true},
+		{pvid: 10, tagged: []uint16{4095}, err: true},
+		{pvid: 10, tagged: []uint16{10}, err: true},
+		{pvid: 10, tagged: []uint16{20, 20}, err: true},
+	}
+	for _, tt := range tests {
+		if err := validateEndpointVLAN(tt.pvid, tt.tagged); (err != nil) != tt.err {
+			t.Errorf("pvid %d tagged %v: expected error %v, got %v", tt.pvid, tt.tagged, tt.err, err)
+		}
+	}
+}
+
+// vlanTestHandle is a dry run handle keeping the VLANs of each port, failing to add the VLAN failVid, and recording
+// the VLAN changes in order as +vid or -vid.
+type vlanTestHandle struct {
+	*dryRunHandle
+	vlans   map[int32][]*nl.BridgeVlanInfo
+	failVid uint16
+	ops     []string
+}
+
+func (h *vlanTestHandle) BridgeVlanList() (map[int32][]*nl.BridgeVlanInfo, error) {
+	all := make(map[int32][]*nl.BridgeVlanInfo)
+	for index, infos := range h.vlans {
+		all[index] = append([]*nl.BridgeVlanInfo{}, infos...)
+	}
+	return all, nil
+}
+
+func (h *vlanTestHandle) BridgeVlanAdd(link netlink.Link, vid uint16, pvid, untagged, self, master bool) error {
+	if vid == h.failVid {
+		return errors.New("vlan add failed")
+	}
+	h.ops = append(h.ops, "+"+strconv.Itoa(int(vid)))
+	info := &nl.BridgeVlanInfo{Vid: vid}
+	if pvid {
+		info.Flags |= nl.BRIDGE_VLAN_INFO_PVID
+	}
+	if untagged {
+		info.Flags |= nl.BRIDGE_VLAN_INFO_UNTAGGED
+	}
+	index := int32(link.Attrs().Index)
+	h.vlans[index] = append(h.vlans[index], info)
+	return nil
+}
+
+func (h *vlanTestHandle) BridgeVlanDel(link netlink.Link, vid uint16, pvid, untagged, self, master bool) error {
+	h.ops = append(h.ops, "-"+strconv.Itoa(int(vid)))
+	index := int32(link.Attrs().Index)
+	kept := h.vlans[index][:0]
+	for _, info := range h.vlans[index] {
+		if info.Vid != vid {
+			kept = append(kept, info)
+		}
+	}
+	h.vlans[index] = kept
+	return nil
+}
+
+// portVLANs describes the VLANs of a port, sorted, as vid or vid:pvid for the untagged PVID.
+func portVLANs(infos []*nl.BridgeVlanInfo) []string {
+	vlans := make([]string, 0, len(infos))
+	for _, info := range infos {
+		v := strconv.Itoa(int(info.Vid))
+		if info.PortVID() && info.EngressUntag() {
+			v += ":pvid"
+		}
+		vlans = append(vlans, v)
+	}
+	sort.Strings(vlans)
+	return vlans
+}
+
+// newEndpointVLANDriver returns a dry run driver with an endpoint whose port, index 5, carries PVID 1 and tagged
+// VLAN 5 on a bridge filtering VLANs unless told otherwise.
+func newEndpointVLANDriver(t *testing.T, filtering bool) (*bridgeDriver, *vlanTestHandle) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16")}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	h := &vlanTestHandle{dryRunHandle: d.nlh.(*dryRunHandle), vlans: map[int32][]*nl.BridgeVlanInfo{5: vlanInfos(1, []uint16{5})}}
+	h.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: n.endpoints[testID(2)].hostIfName, Index: 5}})
+	d.nlh = h
+
+	sysctls := fakeSysctls(t)
+	if filtering {
+		sysctls[filepath.Join("/sys/class/net", n.config.BridgeName, "bridge/vlan_filtering")] = "1\n"
+	}
+	return d, h
+}
+
+func TestSetEndpointVLAN(t *testing.T) {
+	d, h := newEndpointVLANDriver(t, true)
+	if err := d.SetEndpointVLAN(testID(1), testID(2), 10, []uint16{30, 20}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10:pvid", "20", "30"}; !equalStrings(portVLANs(h.vlans[5]), want) {
+		t.Errorf("expected port vlans %v, got %v", want, portVLANs(h.vlans[5]))
+	}
+	// The old VLANs are flushed before any new one is added.
+	if want := []string{"-1", "-5", "+10", "+30", "+20"}; !equalStrings(h.ops, want) {
+		t.Errorf("expected vlan changes %v, got %v", want, h.ops)
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.VLANPVID] != "10" || info[label.VLANTagged] != "20,30" {
+		t.Errorf("expected pvid 10 tagged 20,30 in endpoint info, got %q and %q", info[label.VLANPVID], info[label.VLANTagged])
+	}
+}
+
+func TestSetEndpointVLANRestoresOnFailure(t *testing.T) {
+	d, h := newEndpointVLANDriver(t, true)
+	h.failVid = 30
+	err := d.SetEndpointVLAN(testID(1), testID(2), 10, []uint16{20, 30})
+	if _, ok := err.(types.InternalError); !ok {
+		t.Fatalf("expected an InternalError, got %v", err)
+	}
+	if want := []string{"1:pvid", "5"}; !equalStrings(portVLANs(h.vlans[5]), want) {
+		t.Errorf("expected the previous port vlans %v restored, got %v", want, portVLANs(h.vlans[5]))
+	}
+	info, _ := d.EndpointInfo(testID(1), testID(2))
+	if _, ok := info[label.VLANPVID]; ok {
+		t.Errorf("expected no vlan assignment recorded, got pvid %q", info[label.VLANPVID])
+	}
+}
+
+func TestSetEndpointVLANRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		filtering bool
+		eid       string
+		pvid      uint16
+		tagged    []uint16
+		check     func(error) bool
+	}{
+		{name: "overlapping vlans", filtering: true, eid: testID(2), pvid: 10, tagged: []uint16{10},
+			check: func(err error) bool { _, ok := err.(types.BadRequestError); return ok }},
+		{name: "out of range", filtering: true, eid: testID(2), pvid: 4095,
+			check: func(err error) bool { _, ok := err.(types.BadRequestError); return ok }},
+		{name: "bridge not filtering", eid: testID(2), pvid: 10,
+			check: func(err error) bool { _, ok := err.(types.ForbiddenError); return ok }},
+		{name: "unknown endpoint", filtering: true, eid: testID(3), pvid: 10,
+			check: func(err error) bool { _, ok := err.(types.NotFoundError); return ok }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, h := newEndpointVLANDriver(t, tt.filtering)
+			if err := d.SetEndpointVLAN(testID(1), tt.eid, tt.pvid, tt.tagged); !tt.check(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(h.ops) != 0 {
+				t.Errorf("expected the port vlans untouched, got changes %v", h.ops)
+			}
+		})
+	}
+}
@@ -34,6 +34,16 @@ func (eitp *ErrInvalidTransportPortsOption) Error() string {
 // BadRequest denotes the type of this error
 func (eitp *ErrInvalidTransportPortsOption) BadRequest() {}
 
+// ErrInvalidPortBindingsOption is returned when the driver receives a request with a PortMap key that could not be decoded.
+type ErrInvalidPortBindingsOption struct{}
+
+func (eipb *ErrInvalidPortBindingsOption) Error() string {
+	return "specified port bindings could not be decoded"
+}
+
+// BadRequest denotes the type of this error
+func (eipb *ErrInvalidPortBindingsOption) BadRequest() {}
+
 // ErrInvalidGateway is returned when the user provided default gateway (v4/v6) is not not valid.
 type ErrInvalidGateway struct{}
 
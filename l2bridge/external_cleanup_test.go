@@ -0,0 +1,128 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/types"
+)
+
+// recordRules replaces programRule to record the rules programmed, as action table chain args.
+func recordRules(t *testing.T) *[]string {
+	var rules []string
+	orig := programRule
+	programRule = func(table iptables.Table, chain string, action iptables.Action, args []string) error {
+		rules = append(rules, strings.Join(append([]string{string(action), string(table), chain}, args...), " "))
+		return nil
+	}
+	t.Cleanup(func() { programRule = orig })
+	return &rules
+}
+
+// TestRevokeOutOfOrder checks the external connectivity of an endpoint is removed exactly once, and its host port
+// released, however its revoke, leave and delete are ordered, and if the revoke or leave never come.
+func TestRevokeOutOfOrder(t *testing.T) {
+	const hostPort = 18080
+	tests := []struct {
+		name  string
+		steps []string
+	}{
+		{name: "in order", steps: []string{"revoke", "leave", "delete"}},
+		{name: "no revoke", steps: []string{"leave", "delete"}},
+		{name: "revoke twice", steps: []string{"revoke", "revoke", "leave", "delete"}},
+		{name: "revoke after leave", steps: []string{"leave", "revoke", "delete"}},
+		{name: "delete without leave or revoke", steps: []string{"delete"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, 2).To4(), Mask: net.CIDRMask(16, 32)}}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/x", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// A dry run programs no rules, so the endpoint is given those ProgramExternalConnectivity would have.
+			n, _ := d.getNetwork(testID(1))
+			ep := n.endpoints[testID(2)]
+			addr := ep.addr.IP
+			pb := types.PortBinding{Proto: types.TCP, IP: addr, Port: 80, HostPort: hostPort, HostPortEnd: hostPort}
+			if _, err := portallocator.Get().RequestPort(nil, "tcp", hostPort); err != nil {
+				t.Fatal(err)
+			}
+			ep.portMapping = []types.PortBinding{pb}
+			ep.masqueradeIface, ep.masqueradeAddr = "eth0", addr
+
+			rules := recordRules(t)
+			for _, step := range tt.steps {
+				var err error
+				switch step {
+				case "revoke":
+					err = d.RevokeExternalConnectivity(testID(1), testID(2))
+				case "leave":
+					err = d.Leave(ctx, testID(1), testID(2))
+				case "delete":
+					err = d.DeleteEndpoint(ctx, testID(1), testID(2))
+				}
+				if err != nil {
+					t.Fatalf("%s: %v", step, err)
+				}
+			}
+
+			var want []string
+			for _, r := range append(portMappingRules(n.config.BridgeName, pb), masqueradeRules(n.config.BridgeName, "eth0", addr)...) {
+				want = append(want, strings.Join(append([]string{string(iptables.Delete), string(r.table), r.chain}, r.args...), " "))
+			}
+			sort.Strings(want)
+			sort.Strings(*rules)
+			if !equalStrings(*rules, want) {
+				t.Errorf("expected every rule deleted once\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(*rules, "\n"))
+			}
+			if _, err := portallocator.Get().RequestPort(nil, "tcp", hostPort); err != nil {
+				t.Errorf("expected host port %d released, got %v", hostPort, err)
+			} else {
+				portallocator.Get().ReleasePort(nil, "tcp", hostPort)
+			}
+
+			if len(n.endpoints) != 0 {
+				t.Errorf("expected the endpoint deleted, got %v", n.endpoints)
+			}
+			if err := d.RevokeExternalConnectivity(testID(1), testID(2)); err == nil {
+				t.Error("expected revoking a deleted endpoint to fail")
+			} else if _, ok := err.(EndpointNotFoundError); !ok {
+				t.Errorf("expected an EndpointNotFoundError, got %v", err)
+			}
+		})
+	}
+}
+
+// TestRevokeWithoutRules checks revoking an endpoint's rules is a no-op once they are gone, as when libnetwork revokes
+// after leave already removed them.
+func TestRevokeWithoutRules(t *testing.T) {
+	rules := recordRules(t)
+	d := newDryRunDriver()
+	n := &bridgeNetwork{id: testID(1), config: &networkConfiguration{BridgeName: "br0"}, driver: d}
+	ep := &bridgeEndpoint{id: testID(2)}
+	for j := 0; j < 2; j++ {
+		if err := n.revokePortMapping(ep); err != nil {
+			t.Errorf("revoke %d: %v", j, err)
+		}
+		if err := n.revokeMasquerade(ep); err != nil {
+			t.Errorf("revoke %d: %v", j, err)
+		}
+	}
+	if len(*rules) != 0 {
+		t.Errorf("expected no rules programmed, got %v", *rules)
+	}
+}
@@ -0,0 +1,70 @@
+package l2bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+)
+
+const defaultIPAMTimeout = 10 * time.Second
+
+// externalAddressRequest is posted to the external IPAM service to request an endpoint address of the family, v4 or
+// v6.
+type externalAddressRequest struct {
+	NetworkID  string
+	EndpointID string
+	Family     string
+	Pool       string
+}
+
+// externalAddressResponse carries the address, in CIDR notation, assigned by the external IPAM service.
+type externalAddressResponse struct {
+	Address string
+}
+
+// requestExternalAddress asks the IPAM service at url for an address of the family for the endpoint, waiting at most
+// timeout.
+func requestExternalAddress(url string, timeout time.Duration, nid, eid, family string, pool *net.IPNet) (*net.IPNet, error) {
+	body := externalAddressRequest{NetworkID: nid, EndpointID: eid, Family: family}
+	if pool != nil {
+		body.Pool = pool.String()
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return nil, types.RetryErrorf("timed out after %v waiting for an address from IPAM service %s", timeout, url)
+		}
+		return nil, internalErrorf("failed to request an address from IPAM service %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, types.InternalErrorf("IPAM service %s responded with %s", url, resp.Status)
+	}
+
+	var out externalAddressResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			return nil, types.RetryErrorf("timed out after %v waiting for an address from IPAM service %s", timeout, url)
+		}
+		return nil, internalErrorf("invalid response from IPAM service %s: %v", url, err)
+	}
+	addr, err := ParseIPv4(out.Address)
+	if err != nil {
+		return nil, internalErrorf("IPAM service %s assigned an invalid address %q: %v", url, out.Address, err)
+	}
+	if (addr.IP.To4() != nil) != (family == ipFamilyV4) {
+		return nil, types.InternalErrorf("IPAM service %s assigned %s, which is not an IP%s address", url, out.Address, family)
+	}
+	return addr, nil
+}
@@ -0,0 +1,71 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestRequestExternalAddress(t *testing.T) {
+	_, pool4, _ := net.ParseCIDR("10.1.0.0/16")
+	_, pool6, _ := net.ParseCIDR("2001:db8:1::/64")
+	tests := []struct {
+		name    string
+		family  string
+		pool    *net.IPNet
+		status  int
+		address string
+		delay   time.Duration
+		want    string
+		errType string
+	}{
+		{name: "v4", family: ipFamilyV4, pool: pool4, status: http.StatusOK, address: "10.1.0.7/16", want: "10.1.0.7/16"},
+		{name: "v6", family: ipFamilyV6, pool: pool6, status: http.StatusOK, address: "2001:db8:1::7/64", want: "2001:db8:1::7/64"},
+		{name: "v4 for a v6 request", family: ipFamilyV6, pool: pool6, status: http.StatusOK, address: "10.1.0.7/16", errType: "internal"},
+		{name: "v6 for a v4 request", family: ipFamilyV4, pool: pool4, status: http.StatusOK, address: "2001:db8:1::7/64", errType: "internal"},
+		{name: "invalid address", family: ipFamilyV4, pool: pool4, status: http.StatusOK, address: "10.1.0.7", errType: "internal"},
+		{name: "service error", family: ipFamilyV4, pool: pool4, status: http.StatusServiceUnavailable, errType: "internal"},
+		{name: "slow service", family: ipFamilyV4, pool: pool4, status: http.StatusOK, address: "10.1.0.7/16", delay: 200 * time.Millisecond, errType: "retry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req externalAddressRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				if req.NetworkID != "n" || req.EndpointID != "e" || req.Family != tt.family || req.Pool != tt.pool.String() {
+					t.Errorf("unexpected request %+v", req)
+				}
+				time.Sleep(tt.delay)
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(externalAddressResponse{Address: tt.address})
+			}))
+			defer srv.Close()
+
+			addr, err := requestExternalAddress(srv.URL, 50*time.Millisecond, "n", "e", tt.family, tt.pool)
+			switch tt.errType {
+			case "retry":
+				if _, ok := err.(types.RetryError); !ok {
+					t.Fatalf("expected a RetryError, got %v", err)
+				}
+			case "internal":
+				if _, ok := err.(types.InternalError); !ok {
+					t.Fatalf("expected an InternalError, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if addr.String() != tt.want {
+					t.Errorf("expected %s, got %s", tt.want, addr)
+				}
+			}
+		})
+	}
+}
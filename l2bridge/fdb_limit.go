@@ -0,0 +1,102 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxFDBLimit bounds the number of learned FDB entries a bridge may be limited to.
+const maxFDBLimit = 1 << 31
+
+// fdbNearLimit is the fraction of the limit past which a bridge's FDB is reported as near its limit.
+const fdbNearLimit = 0.9
+
+// Metrics describing the learned FDB entries of bridges with a limit.
+const (
+	metricFDBLearned    = "l2bridge_fdb_learned"
+	metricFDBMaxLearned = "l2bridge_fdb_max_learned"
+	metricFDBNearLimit  = "l2bridge_fdb_near_limit"
+)
+
+func registerFDBMetrics(r *metricsRegistry) {
+	r.register(metricFDBLearned, metricGauge, "Learned FDB entries of bridges with a limit, by bridge.", "bridge")
+	r.register(metricFDBMaxLearned, metricGauge, "Limit of learned FDB entries, by bridge.", "bridge")
+	r.register(metricFDBNearLimit, metricGauge, "Whether a bridge holds at least 90% of its learned FDB entry limit, by bridge.", "bridge")
+}
+
+// ipLink runs the ip utility on links with the given arguments, returning its output.
+func ipLink(args ...string) ([]byte, error) {
+	args = append([]string{"link"}, args...)
+	out, err := runCommand("ip", args...)
+	if err != nil {
+		return nil, fmt.Errorf("ip %s failed: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// setupFDBLimit limits the number of FDB entries the bridge learns. Kernels without the limit, added in 6.8, only
+// produce a warning, so that the network remains usable if unprotected.
+func setupFDBLimit(config *networkConfiguration, i *bridgeInterface) error {
+	limit := strconv.FormatUint(uint64(config.FDBMax), 10)
+	if _, err := ipLink("set", "dev", config.BridgeName, "type", "bridge", "fdb_max_learned", limit); err != nil {
+		logrus.WithError(err).Warnf("Kernel does not support limiting learned FDB entries on bridge %s, its FDB is unbounded", config.BridgeName)
+		return nil
+	}
+	// Older kernels may accept the request while ignoring the attribute.
+	if _, max, err := readFDBLearned(config.BridgeName); err != nil || max != uint64(config.FDBMax) {
+		logrus.Warnf("Kernel does not support limiting learned FDB entries on bridge %s, its FDB is unbounded", config.BridgeName)
+	}
+	return nil
+}
+
+// readFDBLearned returns the number of FDB entries the bridge has learned and the limit, as reported by ip.
+func readFDBLearned(bridgeName string) (learned, max uint64, err error) {
+	out, err := ipLink("-d", "-j", "show", "dev", bridgeName)
+	if err != nil {
+		return 0, 0, err
+	}
+	var links []struct {
+		LinkInfo struct {
+			InfoData struct {
+				FDBLearned    *uint64 `json:"fdb_n_learned"`
+				FDBMaxLearned *uint64 `json:"fdb_max_learned"`
+			} `json:"info_data"`
+		} `json:"linkinfo"`
+	}
+	if err := json.Unmarshal(out, &links); err != nil {
+		return 0, 0, fmt.Errorf("invalid output of ip link show: %w", err)
+	}
+	if len(links) != 1 || links[0].LinkInfo.InfoData.FDBLearned == nil || links[0].LinkInfo.InfoData.FDBMaxLearned == nil {
+		return 0, 0, fmt.Errorf("learned FDB entries of bridge %s are not reported", bridgeName)
+	}
+	return *links[0].LinkInfo.InfoData.FDBLearned, *links[0].LinkInfo.InfoData.FDBMaxLearned, nil
+}
+
+// updateFDBMetrics samples the learned FDB entries of every bridge with a limit.
+func (d *bridgeDriver) updateFDBMetrics() {
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		bridgeName, limited := n.config.BridgeName, n.config.FDBMax != 0
+		n.Unlock()
+		if !limited {
+			continue
+		}
+
+		learned, max, err := readFDBLearned(bridgeName)
+		if err != nil {
+			logrus.WithError(err).Debugf("Failed to read learned FDB entries of bridge %s", bridgeName)
+			continue
+		}
+		near := 0.0
+		if max != 0 && float64(learned) >= fdbNearLimit*float64(max) {
+			near = 1
+		}
+		d.metrics.set(metricFDBLearned, float64(learned), "bridge", bridgeName)
+		d.metrics.set(metricFDBMaxLearned, float64(max), "bridge", bridgeName)
+		d.metrics.set(metricFDBNearLimit, near, "bridge", bridgeName)
+	}
+}
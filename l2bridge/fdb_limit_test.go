@@ -0,0 +1,133 @@
+package l2bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFDBMaxLabel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint32
+		err  bool
+	}{
+		{in: "1", want: 1},
+		{in: "65536", want: 65536},
+		{in: strconv.Itoa(maxFDBLimit), want: maxFDBLimit},
+		{in: "0", err: true},
+		{in: strconv.Itoa(maxFDBLimit + 1), err: true},
+		{in: "many", err: true},
+	}
+	for _, tt := range tests {
+		c := &networkConfiguration{}
+		err := c.fromLabels(map[string]interface{}{label.FDBMax: tt.in})
+		if (err != nil) != tt.err {
+			t.Errorf("%s=%s: expected error %v, got %v", label.FDBMax, tt.in, tt.err, err)
+			continue
+		}
+		if c.FDBMax != tt.want {
+			t.Errorf("%s=%s: expected limit %d, got %d", label.FDBMax, tt.in, tt.want, c.FDBMax)
+		}
+	}
+}
+
+// fakeIPLink replaces runCommand with an ip utility reporting the given learned FDB entries and limit of each bridge,
+// and failing to set the limit if unsupported.
+func fakeIPLink(t *testing.T, unsupported bool, fdb map[string][2]uint64) *[]string {
+	var cmds []string
+	orig := runCommand
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		cmds = append(cmds, name+" "+strings.Join(args, " "))
+		if name != "ip" || len(args) < 2 {
+			return nil, errors.New("unexpected command")
+		}
+		if args[1] == "set" {
+			if unsupported {
+				return []byte("Error: unknown attribute"), errors.New("exit status 255")
+			}
+			return nil, nil
+		}
+		entries, ok := fdb[args[len(args)-1]]
+		if !ok {
+			return []byte(`[{"linkinfo":{"info_data":{}}}]`), nil
+		}
+		return []byte(fmt.Sprintf(`[{"linkinfo":{"info_data":{"fdb_n_learned":%d,"fdb_max_learned":%d}}}]`, entries[0], entries[1])), nil
+	}
+	t.Cleanup(func() { runCommand = orig })
+	return &cmds
+}
+
+func TestSetupFDBLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		unsupported bool
+		fdb         map[string][2]uint64
+		warned      bool
+	}{
+		{name: "supported", fdb: map[string][2]uint64{"br0": {0, 1000}}},
+		{name: "set rejected", unsupported: true, warned: true},
+		{name: "limit ignored", fdb: map[string][2]uint64{"br0": {0, 0}}, warned: true},
+		{name: "limit not reported", warned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmds := fakeIPLink(t, tt.unsupported, tt.fdb)
+			hook := captureLogs(t)
+			config := &networkConfiguration{BridgeName: "br0", FDBMax: 1000}
+			if err := setupFDBLimit(config, &bridgeInterface{}); err != nil {
+				t.Fatalf("expected the network usable without the limit, got %v", err)
+			}
+			if (*cmds)[0] != "ip link set dev br0 type bridge fdb_max_learned 1000" {
+				t.Errorf("expected the limit set on br0, got %v", *cmds)
+			}
+			warned := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "its FDB is unbounded") {
+					warned = true
+				}
+			}
+			if warned != tt.warned {
+				t.Errorf("expected warning %v, got %v", tt.warned, warned)
+			}
+		})
+	}
+}
+
+func TestUpdateFDBMetrics(t *testing.T) {
+	d := newDryRunDriver()
+	bridges := make(map[int]string)
+	for n, max := range map[int]string{1: "100", 2: "100", 3: ""} {
+		opts := map[string]interface{}{}
+		if max != "" {
+			opts[netlabel.GenericData] = map[string]interface{}{label.FDBMax: max}
+		}
+		if err := d.CreateNetwork(context.Background(), testID(n), opts, testIPAMData(t, fmt.Sprintf("10.%d.0.0/16", n)), nil); err != nil {
+			t.Fatal(err)
+		}
+		nw, _ := d.getNetwork(testID(n))
+		bridges[n] = nw.config.BridgeName
+	}
+	cmds := fakeIPLink(t, false, map[string][2]uint64{bridges[1]: {95, 100}, bridges[2]: {10, 100}, bridges[3]: {50, 0}})
+	d.updateFDBMetrics()
+
+	for n, want := range map[int][3]float64{1: {95, 100, 1}, 2: {10, 100, 0}} {
+		for i, metric := range []string{metricFDBLearned, metricFDBMaxLearned, metricFDBNearLimit} {
+			if got := metricSample(d.metrics, metric, "bridge", bridges[n]); got != want[i] {
+				t.Errorf("network %d: expected %s %v, got %v", n, metric, want[i], got)
+			}
+		}
+	}
+	for _, cmd := range *cmds {
+		if strings.HasSuffix(cmd, " "+bridges[3]) {
+			t.Errorf("expected the unlimited bridge left unsampled, got %s", cmd)
+		}
+	}
+}
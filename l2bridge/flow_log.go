@@ -0,0 +1,292 @@
+package l2bridge
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// flowLogQueueLen bounds the flow records waiting to be written. Records sampled while it is full are dropped.
+	flowLogQueueLen = 1024
+	// flowLogMaxLine bounds a conntrack event line. The conntrack tool is restarted past a longer one.
+	flowLogMaxLine = 4096
+	// flowLogRestartDelay is how long the exporter waits before restarting an exited conntrack tool.
+	flowLogRestartDelay = 10 * time.Second
+)
+
+// Metrics describing the flow log exporter.
+const (
+	metricFlowLogRecords = "l2bridge_flow_log_records_total"
+	metricFlowLogDropped = "l2bridge_flow_log_dropped_total"
+)
+
+func registerFlowLogMetrics(r *metricsRegistry) {
+	r.register(metricFlowLogRecords, metricCounter, "Flow records written to the flow log.")
+	r.register(metricFlowLogDropped, metricCounter, "Sampled flow records dropped rather than written, by reason.", "reason")
+}
+
+// flowRecord is a flow of a NATed endpoint, written as a line of JSON once conntrack forgets it. Bytes and packets
+// are in both directions, and are zero unless the host counts them, with net.netfilter.nf_conntrack_acct. So is the
+// duration, with net.netfilter.nf_conntrack_timestamp.
+type flowRecord struct {
+	Time     time.Time `json:"time"`
+	Network  string    `json:"network"`
+	Endpoint string    `json:"endpoint"`
+	Proto    string    `json:"proto"`
+	Src      string    `json:"src"`
+	Dst      string    `json:"dst"`
+	SrcPort  uint16    `json:"sport,omitempty"`
+	DstPort  uint16    `json:"dport,omitempty"`
+	Packets  uint64    `json:"packets"`
+	Bytes    uint64    `json:"bytes"`
+	Duration uint64    `json:"duration_seconds"`
+}
+
+// flowOwner is the endpoint a flow belongs to.
+type flowOwner struct {
+	network  string
+	endpoint string
+}
+
+// conntrackEvent is a flow as reported by the conntrack tool, with the original direction's tuple and the reply
+// direction's source.
+type conntrackEvent struct {
+	event    string
+	proto    string
+	src, dst net.IP
+	sport    uint16
+	dport    uint16
+	replySrc net.IP
+	packets  uint64
+	bytes    uint64
+	duration uint64
+}
+
+// parseConntrackEvent parses a line of `conntrack -E -o extended,ktimestamp`, such as
+//
+//	[DESTROY] ipv4 2 tcp 6 src=10.1.0.2 dst=1.1.1.1 sport=40000 dport=80 packets=6 bytes=400 src=1.1.1.1 dst=192.168.1.5 sport=80 dport=40000 packets=5 bytes=3000 [ASSURED] delta-time=12
+func parseConntrackEvent(line string) (conntrackEvent, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || !strings.HasPrefix(fields[0], "[") {
+		return conntrackEvent{}, false
+	}
+	ev := conntrackEvent{event: strings.Trim(fields[0], "[]"), proto: fields[3]}
+	srcs := 0
+	for _, f := range fields[5:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		n, _ := strconv.ParseUint(kv[1], 10, 64)
+		reply := srcs > 1
+		switch kv[0] {
+		case "src":
+			srcs++
+			if srcs == 1 {
+				ev.src = net.ParseIP(kv[1])
+			} else if srcs == 2 {
+				ev.replySrc = net.ParseIP(kv[1])
+			}
+		case "dst":
+			if srcs == 1 {
+				ev.dst = net.ParseIP(kv[1])
+			}
+		case "sport":
+			if !reply {
+				ev.sport = uint16(n)
+			}
+		case "dport":
+			if !reply {
+				ev.dport = uint16(n)
+			}
+		case "packets":
+			ev.packets += n
+		case "bytes":
+			ev.bytes += n
+		case "delta-time":
+			ev.duration = n
+		}
+	}
+	if ev.src == nil || ev.dst == nil {
+		return conntrackEvent{}, false
+	}
+	return ev, true
+}
+
+// flowLogger samples the flows conntrack forgets and writes records of those of NATed endpoints to a sink. Records
+// are queued, in bounded memory, for a single writer, so that a slow sink drops records rather than stalling the
+// conntrack tool.
+type flowLogger struct {
+	rate    uint64 // One in rate ended flows is sampled
+	seen    uint64
+	owners  func() map[string]flowOwner // key: endpoint address
+	records chan flowRecord
+	done    chan struct{}
+	metrics *metricsRegistry
+}
+
+// newFlowLogger starts writing the records of the flow logger to the sink, until it is closed.
+func newFlowLogger(rate uint, sink io.Writer, owners func() map[string]flowOwner, metrics *metricsRegistry, queue int) *flowLogger {
+	if rate == 0 {
+		rate = 1
+	}
+	fl := &flowLogger{
+		rate:    uint64(rate),
+		owners:  owners,
+		records: make(chan flowRecord, queue),
+		done:    make(chan struct{}),
+		metrics: metrics,
+	}
+	go func() {
+		defer close(fl.done)
+		enc := json.NewEncoder(sink)
+		for r := range fl.records {
+			if err := enc.Encode(r); err != nil {
+				fl.metrics.inc(metricFlowLogDropped, "reason", "write")
+				logrus.WithError(err).Debug("Failed to write flow record")
+				continue
+			}
+			fl.metrics.inc(metricFlowLogRecords)
+		}
+	}()
+	return fl
+}
+
+// handle samples the conntrack event on the line, and queues a record of it if it is the end of a flow of a NATed
+// endpoint.
+func (fl *flowLogger) handle(line string, now time.Time) {
+	ev, ok := parseConntrackEvent(line)
+	if !ok || ev.event != "DESTROY" {
+		return
+	}
+	if atomic.AddUint64(&fl.seen, 1)%fl.rate != 0 {
+		return
+	}
+
+	owners := fl.owners()
+	owner, ok := owners[ev.src.String()]
+	if !ok && ev.replySrc != nil {
+		// A published port: the endpoint replies to the connection made to the host.
+		owner, ok = owners[ev.replySrc.String()]
+	}
+	if !ok {
+		return
+	}
+
+	r := flowRecord{
+		Time:     now,
+		Network:  owner.network,
+		Endpoint: owner.endpoint,
+		Proto:    ev.proto,
+		Src:      ev.src.String(),
+		Dst:      ev.dst.String(),
+		SrcPort:  ev.sport,
+		DstPort:  ev.dport,
+		Packets:  ev.packets,
+		Bytes:    ev.bytes,
+		Duration: ev.duration,
+	}
+	select {
+	case fl.records <- r:
+	default:
+		fl.metrics.inc(metricFlowLogDropped, "reason", "queue_full")
+	}
+}
+
+// consume handles each conntrack event line read from r, until it ends or a line is too long.
+func (fl *flowLogger) consume(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, flowLogMaxLine), flowLogMaxLine)
+	for scanner.Scan() {
+		fl.handle(scanner.Text(), time.Now())
+	}
+	return scanner.Err()
+}
+
+// close stops the flow logger once the queued records are written.
+func (fl *flowLogger) close() {
+	close(fl.records)
+	<-fl.done
+}
+
+// natEndpoints returns the owners of the addresses of endpoints whose traffic the driver NATs, masqueraded or with
+// published ports.
+func (d *bridgeDriver) natEndpoints() map[string]flowOwner {
+	owners := make(map[string]flowOwner)
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		for _, ep := range n.endpoints {
+			if ep.addr != nil && (ep.masqueradeAddr != nil || len(ep.portMapping) != 0) {
+				owners[ep.addr.IP.String()] = flowOwner{network: n.id, endpoint: ep.id}
+			}
+		}
+		n.Unlock()
+	}
+	return owners
+}
+
+// startFlowLog exports the configured sample of the flows of NATed endpoints to the flow log sink, a file or - for
+// the standard output. Flow logs are left disabled, with a warning, if the sink cannot be opened or the conntrack tool
+// is missing, and the tool is restarted should it exit.
+func (d *bridgeDriver) startFlowLog() {
+	d.Lock()
+	path, rate := d.config.FlowLogPath, d.config.FlowLogSampleRate
+	d.Unlock()
+	if path == "" || d.dryRun() {
+		return
+	}
+
+	if _, err := exec.LookPath("conntrack"); err != nil {
+		logrus.WithError(err).Warn("Flow logs are disabled, the conntrack tool is missing")
+		return
+	}
+	sink := io.Writer(os.Stdout)
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			logrus.WithError(err).Warnf("Flow logs are disabled, failed to open %s", path)
+			return
+		}
+		sink = f
+	}
+
+	fl := newFlowLogger(rate, sink, d.natEndpoints, d.metrics, flowLogQueueLen)
+	go func() {
+		for {
+			err := runConntrackEvents(fl)
+			logrus.WithError(err).Warnf("Conntrack event stream ended, restarting it in %s", flowLogRestartDelay)
+			time.Sleep(flowLogRestartDelay)
+		}
+	}()
+	logrus.Infof("Exporting one in %d flows of NATed endpoints to %s", fl.rate, path)
+}
+
+// runConntrackEvents feeds the conntrack tool's reports of ended flows to the flow logger until the tool exits.
+func runConntrackEvents(fl *flowLogger) error {
+	cmd := exec.Command("conntrack", "-E", "-e", "DESTROY", "-o", "extended,ktimestamp")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	err = fl.consume(out)
+	if err != nil {
+		cmd.Process.Kill()
+	}
+	if werr := cmd.Wait(); err == nil {
+		err = werr
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package l2bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// Synthetic conntrack events: an outbound flow of the masqueraded endpoint 10.1.0.2, a flow to a port published by
+	// the endpoint 10.1.0.3, and a flow of an address the driver does not NAT.
+	ctOutbound  = "[DESTROY] ipv4     2 tcp      6 src=10.1.0.2 dst=1.1.1.1 sport=40000 dport=80 packets=6 bytes=400 src=1.1.1.1 dst=192.168.1.5 sport=80 dport=40000 packets=5 bytes=3000 [ASSURED] delta-time=12"
+	ctPublished = "[DESTROY] ipv4     2 udp      17 src=192.168.1.9 dst=192.168.1.5 sport=5353 dport=8053 packets=1 bytes=60 src=10.1.0.3 dst=192.168.1.9 sport=53 dport=5353 packets=1 bytes=90 delta-time=30"
+	ctForeign   = "[DESTROY] ipv4     2 tcp      6 src=172.17.0.2 dst=1.1.1.1 sport=40001 dport=443 packets=2 bytes=120 src=1.1.1.1 dst=172.17.0.2 sport=443 dport=40001 packets=2 bytes=120"
+	ctNew       = "    [NEW] ipv4     2 tcp      6 120 SYN_SENT src=10.1.0.2 dst=1.1.1.1 sport=40002 dport=80 [UNREPLIED] src=1.1.1.1 dst=192.168.1.5 sport=80 dport=40002"
+)
+
+func testFlowOwners() map[string]flowOwner {
+	return map[string]flowOwner{
+		"10.1.0.2": {network: "n1", endpoint: "e1"},
+		"10.1.0.3": {network: "n1", endpoint: "e2"},
+	}
+}
+
+func TestParseConntrackEvent(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+		want conntrackEvent
+	}{
+		{line: ctOutbound, ok: true, want: conntrackEvent{event: "DESTROY", proto: "tcp", sport: 40000, dport: 80, packets: 11, bytes: 3400, duration: 12}},
+		{line: ctPublished, ok: true, want: conntrackEvent{event: "DESTROY", proto: "udp", sport: 5353, dport: 8053, packets: 2, bytes: 150, duration: 30}},
+		{line: "[DESTROY] ipv4 2 tcp 6 garbage", ok: false},
+		{line: "", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseConntrackEvent(tt.line)
+		if ok != tt.ok {
+			t.Errorf("parseConntrackEvent(%q): expected ok %v", tt.line, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if got.event != tt.want.event || got.proto != tt.want.proto || got.sport != tt.want.sport || got.dport != tt.want.dport ||
+			got.packets != tt.want.packets || got.bytes != tt.want.bytes || got.duration != tt.want.duration {
+			t.Errorf("parseConntrackEvent(%q) = %+v, expected %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFlowLogRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      uint
+		events    []string
+		endpoints []string
+	}{
+		{name: "all", rate: 1, events: []string{ctOutbound, ctPublished, ctForeign, ctNew, "garbage"}, endpoints: []string{"e1", "e2"}},
+		{name: "unset rate", rate: 0, events: []string{ctOutbound, ctPublished}, endpoints: []string{"e1", "e2"}},
+		{name: "one in two", rate: 2, events: []string{ctOutbound, ctPublished, ctForeign, ctOutbound}, endpoints: []string{"e2", "e1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sink bytes.Buffer
+			metrics := newMetricsRegistry()
+			registerFlowLogMetrics(metrics)
+			fl := newFlowLogger(tt.rate, &sink, testFlowOwners, metrics, flowLogQueueLen)
+			if err := fl.consume(strings.NewReader(strings.Join(tt.events, "\n"))); err != nil {
+				t.Fatal(err)
+			}
+			fl.close()
+
+			var endpoints []string
+			dec := json.NewDecoder(&sink)
+			for dec.More() {
+				var r flowRecord
+				if err := dec.Decode(&r); err != nil {
+					t.Fatal(err)
+				}
+				if r.Network != "n1" || r.Proto == "" || r.Src == "" || r.Dst == "" || r.Bytes == 0 || r.Duration == 0 {
+					t.Errorf("incomplete flow record %+v", r)
+				}
+				endpoints = append(endpoints, r.Endpoint)
+			}
+			if !equalStrings(endpoints, tt.endpoints) {
+				t.Errorf("expected records of %v, got %v", tt.endpoints, endpoints)
+			}
+			if got := metrics.families[metricFlowLogRecords].samples[""]; got != float64(len(tt.endpoints)) {
+				t.Errorf("expected %d records counted, got %v", len(tt.endpoints), got)
+			}
+		})
+	}
+}
+
+// blockingWriter blocks every write until released.
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestFlowLogDropsWhenQueueFull(t *testing.T) {
+	metrics := newMetricsRegistry()
+	registerFlowLogMetrics(metrics)
+	w := blockingWriter{release: make(chan struct{})}
+	fl := newFlowLogger(1, w, testFlowOwners, metrics, 1)
+	for i := 0; i < 4; i++ {
+		fl.handle(ctOutbound, time.Now())
+	}
+	// At most one record is being written and one queued, the rest are dropped rather than blocking.
+	if got := metrics.families[metricFlowLogDropped].samples[renderLabels([]string{"reason", "queue_full"})]; got < 2 {
+		t.Errorf("expected at least 2 records dropped, got %v", got)
+	}
+	close(w.release)
+	fl.close()
+}
@@ -0,0 +1,54 @@
+package l2bridge
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// isForeign reports whether the bridge exists and was not created by the driver, as a bridge made by the host's
+// provisioning with its physical interface attached. Such a bridge is used as is, and kept when the network is deleted.
+func (i *bridgeInterface) isForeign() bool {
+	return i.exists() && i.Link.Attrs().Alias != ownedLinkAlias
+}
+
+// foreignBridgeAddrs returns the addresses the network assigns to its foreign bridge which the bridge does not hold
+// yet, those to remove again when the network is deleted.
+func foreignBridgeAddrs(config *networkConfiguration, i *bridgeInterface) ([]*net.IPNet, error) {
+	held, err := i.nlh.AddrList(i.Link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []*net.IPNet
+	for _, addr := range append([]*net.IPNet{config.BridgeIPv4, config.BridgeIPv6}, config.SecondaryBridgeIPs...) {
+		if addr == nil {
+			continue
+		}
+		found := false
+		for _, h := range held {
+			if h.IP.Equal(addr.IP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// releaseForeignBridge removes the addresses the driver added to the network's foreign bridge, leaving the bridge
+// and the ports attached by others in place.
+func (n *bridgeNetwork) releaseForeignBridge() {
+	for _, addr := range n.bridgeAddrs {
+		err := n.driver.nlh.AddrDel(n.bridge.Link, &netlink.Addr{IPNet: addr})
+		if err != nil && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+			logrus.WithError(err).Warnf("Failed to remove address %s from bridge %s on network %s delete", addr, n.config.BridgeName, n.id)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestCheckGatewayAddress(t *testing.T) {
+	tests := []struct {
+		gw, pool string
+		err      string
+	}{
+		{gw: "10.0.0.1", pool: "10.0.0.0/24"},
+		{gw: "10.0.0.254", pool: "10.0.0.0/24"},
+		{gw: "10.0.0.0", pool: "10.0.0.0/24", err: "network address"},
+		{gw: "10.0.0.255", pool: "10.0.0.0/24", err: "broadcast address"},
+		{gw: "10.0.0.3", pool: "10.0.0.0/30", err: "broadcast address"},
+		// Point to point subnets have neither network nor broadcast address.
+		{gw: "10.0.0.0", pool: "10.0.0.0/31"},
+		{gw: "10.0.0.1", pool: "10.0.0.0/31"},
+		{gw: "10.0.0.0", pool: "10.0.0.0/32"},
+		// IPv6 has no broadcast address, and its subnet-router anycast address is checked on its own.
+		{gw: "2001:db8:1::", pool: "2001:db8:1::/64"},
+		{gw: "2001:db8:1::ffff:ffff:ffff:ffff", pool: "2001:db8:1::/64"},
+	}
+	for _, tt := range tests {
+		_, pool, _ := net.ParseCIDR(tt.pool)
+		gw := net.ParseIP(tt.gw)
+		if gw.To4() != nil {
+			gw = gw.To4()
+		}
+		err := checkGatewayAddress(gw, pool)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("gateway %s of %s: %v", tt.gw, tt.pool, err)
+			}
+			continue
+		}
+		if _, ok := err.(types.BadRequestError); !ok || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("gateway %s of %s: expected a BadRequestError containing %q, got %v", tt.gw, tt.pool, tt.err, err)
+		}
+	}
+}
+
+// ipamWithGateway returns the IPAM data of the pool with the given gateway.
+func ipamWithGateway(t *testing.T, pool, gateway string) []*IPAMData {
+	t.Helper()
+	data := testIPAMData(t, pool)
+	gw := net.ParseIP(gateway)
+	if gw.To4() != nil {
+		gw = gw.To4()
+	}
+	gwNet := &net.IPNet{IP: gw, Mask: data[0].Pool.Mask}
+	data[0].Gateway = gwNet
+	for key := range data[0].AuxAddresses {
+		data[0].AuxAddresses[key] = gwNet
+	}
+	return data
+}
+
+func TestCreateNetworkGatewayPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		v4, v6  []*IPAMData
+		anycast string
+		err     string
+	}{
+		{name: "valid", v4: ipamWithGateway(t, "10.0.0.0/24", "10.0.0.1"), v6: ipamWithGateway(t, "2001:db8:1::/64", "2001:db8:1::1")},
+		{name: "v4 network address", v4: ipamWithGateway(t, "10.0.0.0/24", "10.0.0.0"), err: "network address"},
+		{name: "v4 broadcast address", v4: ipamWithGateway(t, "10.0.0.0/24", "10.0.0.255"), err: "broadcast address"},
+		{name: "secondary v4 broadcast address", v4: append(testIPAMData(t, "10.0.0.0/24"), ipamWithGateway(t, "10.0.1.0/24", "10.0.1.255")...),
+			err: "broadcast address"},
+		{name: "v6 anycast allowed", v4: testIPAMData(t, "10.0.0.0/24"), v6: ipamWithGateway(t, "2001:db8:1::/64", "2001:db8:1::")},
+		{name: "v6 anycast disallowed", v4: testIPAMData(t, "10.0.0.0/24"), v6: ipamWithGateway(t, "2001:db8:1::/64", "2001:db8:1::"),
+			anycast: "false", err: "subnet-router anycast"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			d.ipv6Disabled = func() bool { return false }
+			opts := map[string]interface{}{netlabel.EnableIPv6: tt.v6 != nil}
+			if tt.anycast != "" {
+				opts[netlabel.GenericData] = map[string]interface{}{label.IPv6GatewayAnycast: tt.anycast}
+			}
+			err := d.CreateNetwork(context.Background(), testID(1), opts, tt.v4, tt.v6)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if _, ok := err.(types.BadRequestError); !ok || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected a BadRequestError containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
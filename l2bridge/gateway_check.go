@@ -0,0 +1,140 @@
+package l2bridge
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// Results of the gateway check, as reported in the endpoint info.
+const (
+	gwPending     = "pending"
+	gwReachable   = "reachable"
+	gwUnreachable = "unreachable"
+)
+
+const (
+	// gatewayCheckAttempts bounds how many times the gateway is probed, allowing the container time to come up.
+	gatewayCheckAttempts = 10
+	gatewayCheckInterval = time.Second
+
+	metricGatewayChecks = "l2bridge_gateway_checks_total"
+)
+
+func registerGatewayMetrics(r *metricsRegistry) {
+	r.register(metricGatewayChecks, metricCounter, "Gateway checks of joined endpoints, by result.", "result")
+}
+
+// verifyGateway checks in the background that the endpoint can resolve its gateway from its sandbox, and records the
+// result on the endpoint. An unreachable gateway is only logged, since the container may still be starting. The check
+// stops when the endpoint leaves the sandbox.
+func (d *bridgeDriver) verifyGateway(n *bridgeNetwork, ep *bridgeEndpoint, sandboxKey string) {
+	gw := ep.gatewayv4
+	if gw == nil {
+		gw = ep.gatewayv6
+	}
+	if gw == nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	n.Lock()
+	ep.gwReachable = gwPending
+	ep.gwCheckStop = stop
+	n.Unlock()
+
+	go func() {
+		var err error
+		for attempt := 0; attempt < gatewayCheckAttempts; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-time.After(gatewayCheckInterval):
+				case <-stop:
+					return
+				}
+			}
+			// Stop once the endpoint has left the sandbox.
+			n.Lock()
+			joined := ep.sandboxKey == sandboxKey
+			n.Unlock()
+			if !joined {
+				return
+			}
+
+			var ok bool
+			if ok, err = d.probeGateway(sandboxKey, ep.macAddress, gw); ok {
+				d.recordGatewayCheck(n, ep, sandboxKey, gwReachable)
+				return
+			}
+		}
+		logrus.WithError(err).Warnf("Endpoint (%s) could not resolve its gateway %s", ep.id, gw)
+		d.recordGatewayCheck(n, ep, sandboxKey, gwUnreachable)
+	}()
+}
+
+func (d *bridgeDriver) recordGatewayCheck(n *bridgeNetwork, ep *bridgeEndpoint, sandboxKey, result string) {
+	n.Lock()
+	if ep.sandboxKey == sandboxKey {
+		ep.gwReachable = result
+	}
+	n.Unlock()
+	d.metrics.inc(metricGatewayChecks, "result", result)
+}
+
+// probeSandboxGateway sends a datagram to the gateway from the sandbox, so that the kernel resolves it, and reports
+// whether the sandbox interface with the given MAC has a valid neighbor entry for it.
+func probeSandboxGateway(sandboxKey string, mac net.HardwareAddr, gw net.IP) (bool, error) {
+	var resolved bool
+	err := inSandbox(sandboxKey, func() error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return err
+		}
+		var link netlink.Link
+		for _, l := range links {
+			if bytes.Equal(l.Attrs().HardwareAddr, mac) {
+				link = l
+				break
+			}
+		}
+		if link == nil {
+			return fmt.Errorf("no interface with mac address %s in the sandbox yet", mac)
+		}
+
+		// Any datagram makes the kernel resolve the gateway; the discard port expects no reply.
+		conn, err := net.Dial("udp", net.JoinHostPort(gw.String(), "9"))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte{0}); err != nil {
+			return err
+		}
+
+		family := netlink.FAMILY_V4
+		if gw.To4() == nil {
+			family = netlink.FAMILY_V6
+		}
+		for i := 0; i < 5 && !resolved; i++ {
+			time.Sleep(100 * time.Millisecond)
+			neighs, err := netlink.NeighList(link.Attrs().Index, family)
+			if err != nil {
+				return err
+			}
+			for _, neigh := range neighs {
+				if neigh.IP.Equal(gw) && neigh.State&(netlink.NUD_INCOMPLETE|netlink.NUD_FAILED) == 0 && neigh.HardwareAddr != nil {
+					resolved = true
+				}
+			}
+		}
+		if !resolved {
+			return fmt.Errorf("no neighbor entry for %s", gw)
+		}
+		return nil
+	})
+	return resolved, err
+}
@@ -0,0 +1,127 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestParseVerifyGateway(t *testing.T) {
+	tests := []struct {
+		opt        interface{}
+		want       bool
+		badRequest bool
+	}{
+		{opt: "true", want: true},
+		{opt: true, want: true},
+		{opt: "false"},
+		{opt: "sometimes", badRequest: true},
+	}
+	for _, tt := range tests {
+		ec, err := parseEndpointOptions(map[string]interface{}{label.VerifyGateway: tt.opt})
+		if tt.badRequest {
+			if _, ok := err.(types.BadRequestError); !ok {
+				t.Errorf("%v: expected a BadRequestError, got %v", tt.opt, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.opt, err)
+		} else if ec.VerifyGW != tt.want {
+			t.Errorf("%v: expected %v, got %v", tt.opt, tt.want, ec.VerifyGW)
+		}
+	}
+}
+
+// gatewayProbe is a fake probeGateway answering with a fixed result and recording its calls.
+type gatewayProbe struct {
+	sync.Mutex
+	ok     bool
+	called chan struct{}
+	calls  []string
+}
+
+func (p *gatewayProbe) probe(sandboxKey string, mac net.HardwareAddr, gw net.IP) (bool, error) {
+	p.Lock()
+	p.calls = append(p.calls, sandboxKey+" "+mac.String()+" "+gw.String())
+	p.Unlock()
+	p.called <- struct{}{}
+	return p.ok, nil
+}
+
+// newGatewayCheckEndpoint creates a joined endpoint of a dry run driver, checked with the given probe.
+func newGatewayCheckEndpoint(t *testing.T, p *gatewayProbe) (*bridgeDriver, *bridgeNetwork, *bridgeEndpoint) {
+	d := newDryRunDriver()
+	d.probeGateway = p.probe
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := net.ParseMAC("02:42:0a:01:00:05")
+	ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16"), MacAddress: mac}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, map[string]interface{}{label.VerifyGateway: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	ep := n.endpoints[testID(2)]
+	n.Lock()
+	ep.sandboxKey = "/var/run/docker/netns/test"
+	n.Unlock()
+	return d, n, ep
+}
+
+func TestVerifyGatewayReachable(t *testing.T) {
+	p := &gatewayProbe{ok: true, called: make(chan struct{}, gatewayCheckAttempts)}
+	d, n, ep := newGatewayCheckEndpoint(t, p)
+	d.verifyGateway(n, ep, ep.sandboxKey)
+	<-p.called
+
+	deadline := time.Now().Add(time.Second)
+	for metricSample(d.metrics, metricGatewayChecks, "result", gwReachable) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the gateway check recorded as reachable")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.GatewayReachable] != gwReachable {
+		t.Errorf("expected %s %s in endpoint info, got %q", label.GatewayReachable, gwReachable, info[label.GatewayReachable])
+	}
+	if want := []string{"/var/run/docker/netns/test 02:42:0a:01:00:05 10.1.0.1"}; !equalStrings(p.calls, want) {
+		t.Errorf("expected probes %v, got %v", want, p.calls)
+	}
+}
+
+func TestVerifyGatewayStopsOnLeave(t *testing.T) {
+	p := &gatewayProbe{called: make(chan struct{}, gatewayCheckAttempts)}
+	d, n, ep := newGatewayCheckEndpoint(t, p)
+	d.verifyGateway(n, ep, ep.sandboxKey)
+	<-p.called
+
+	info, _ := d.EndpointInfo(testID(1), testID(2))
+	if info[label.GatewayReachable] != gwPending {
+		t.Errorf("expected the check pending while the gateway does not resolve, got %q", info[label.GatewayReachable])
+	}
+
+	n.leaveEndpoint(ep)
+	select {
+	case <-p.called:
+		t.Error("expected no probe once the endpoint left")
+	case <-time.After(gatewayCheckInterval + 100*time.Millisecond):
+	}
+	info, _ = d.EndpointInfo(testID(1), testID(2))
+	if _, ok := info[label.GatewayReachable]; ok {
+		t.Errorf("expected no gateway result after leave, got %q", info[label.GatewayReachable])
+	}
+	if got := metricSample(d.metrics, metricGatewayChecks, "result", gwUnreachable); got != 0 {
+		t.Errorf("expected no unreachable check recorded, got %v", got)
+	}
+}
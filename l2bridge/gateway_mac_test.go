@@ -0,0 +1,67 @@
+package l2bridge
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// macTestHandle is a dry run handle recording the hardware addresses assigned to links.
+type macTestHandle struct {
+	*dryRunHandle
+	assigned []net.HardwareAddr
+}
+
+func (h *macTestHandle) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	h.assigned = append(h.assigned, hwaddr)
+	return nil
+}
+
+func TestGatewayMAC(t *testing.T) {
+	tests := []struct {
+		name   string
+		v4, v6 string
+		want   string
+	}{
+		{name: "v4 gateway", v4: "10.1.0.1", want: "02:42:0a:01:00:01"},
+		{name: "v4 gateway preferred", v4: "10.1.0.1", v6: "2001:db8:1::a02:3", want: "02:42:0a:01:00:01"},
+		{name: "v6 gateway", v6: "2001:db8:1::a02:3", want: "02:42:0a:02:00:03"},
+	}
+	for _, tt := range tests {
+		config := &networkConfiguration{DefaultGatewayIPv4: net.ParseIP(tt.v4), DefaultGatewayIPv6: net.ParseIP(tt.v6)}
+		if got := gatewayMAC(config).String(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestStableGatewayMACAcrossRecreation(t *testing.T) {
+	tests := []struct {
+		name   string
+		stable bool
+		gw     string
+		same   bool
+	}{
+		{name: "stable", stable: true, gw: "10.1.0.1", same: true},
+		{name: "random", gw: "10.1.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &macTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+			config := &networkConfiguration{BridgeName: "l2b-test", StableGatewayMAC: tt.stable, DefaultGatewayIPv4: net.ParseIP(tt.gw)}
+			for j := 0; j < 2; j++ {
+				if err := setupDevice(config, &bridgeInterface{nlh: h}); err != nil {
+					t.Fatal(err)
+				}
+				h.LinkDel(&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: config.BridgeName}})
+			}
+			if len(h.assigned) != 2 {
+				t.Fatalf("expected a MAC set on each creation, got %v", h.assigned)
+			}
+			if same := h.assigned[0].String() == h.assigned[1].String(); same != tt.same {
+				t.Errorf("expected the same MAC across recreations %v, got %v", tt.same, h.assigned)
+			}
+		})
+	}
+}
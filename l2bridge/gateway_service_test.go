@@ -0,0 +1,49 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestJoinDisableGatewayService(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]interface{}
+		disable bool
+	}{
+		{name: "default", disable: true},
+		{name: "disabled", labels: map[string]interface{}{label.DisableGatewayService: "true"}, disable: true},
+		{name: "enabled", labels: map[string]interface{}{label.DisableGatewayService: "false"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			var opts map[string]interface{}
+			if tt.labels != nil {
+				opts = map[string]interface{}{netlabel.GenericData: tt.labels}
+			}
+			if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, 2).To4(), Mask: net.CIDRMask(16, 32)}}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+				t.Fatal(err)
+			}
+			res, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/x", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.DisableGatewayService != tt.disable {
+				t.Errorf("expected DisableGatewayService %v, got %v", tt.disable, res.DisableGatewayService)
+			}
+			if res.Marshal().DisableGatewayService != tt.disable {
+				t.Errorf("expected DisableGatewayService %v in the plugin response", tt.disable)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/docker/libnetwork/ns"
+	"github.com/sirupsen/logrus"
+)
+
+// healthStatus is reported by the health endpoint.
+type healthStatus struct {
+	Healthy bool `json:"healthy"`
+	// StateLoaded is set once the persisted state has been restored, or found missing, on startup.
+	StateLoaded   bool             `json:"state_loaded"`
+	RestoreError  string           `json:"restore_error,omitempty"`
+	NetlinkError  string           `json:"netlink_error,omitempty"`
+	LastReconcile *reconcileResult `json:"last_reconcile,omitempty"`
+}
+
+// reconcileResult describes the last Reconcile pass.
+type reconcileResult struct {
+	Time time.Time `json:"time"`
+	OK   bool      `json:"ok"`
+	// Error is why the pass failed, or the first link it failed to remove.
+	Error string `json:"error,omitempty"`
+}
+
+// markStateLoaded records that startup is done restoring the persisted state, with the error restoring it if any.
+func (d *bridgeDriver) markStateLoaded(err error) {
+	d.Lock()
+	d.stateLoaded = true
+	if err != nil {
+		d.restoreErr = err.Error()
+	}
+	d.Unlock()
+}
+
+// recordReconcile records the outcome of a Reconcile pass for the health endpoint.
+func (d *bridgeDriver) recordReconcile(summary *ReconcileSummary, err error) {
+	result := &reconcileResult{Time: time.Now(), OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	} else if len(summary.Errors) != 0 {
+		result.OK = false
+		result.Error = summary.Errors[0]
+	}
+	d.Lock()
+	d.lastReconcile = result
+	d.Unlock()
+}
+
+// health reports whether the driver is ready to serve requests: its state is loaded and netlink answers.
+func (d *bridgeDriver) health() *healthStatus {
+	d.Lock()
+	if d.nlh == nil {
+		d.nlh = newMeteredHandle(ns.NlHandle(), d.metrics)
+	}
+	nlh := d.nlh
+	status := &healthStatus{
+		StateLoaded:   d.stateLoaded,
+		RestoreError:  d.restoreErr,
+		LastReconcile: d.lastReconcile,
+	}
+	d.Unlock()
+
+	if _, err := nlh.LinkList(); err != nil {
+		status.NetlinkError = err.Error()
+	}
+	status.Healthy = status.StateLoaded && status.NetlinkError == ""
+	return status
+}
+
+// handleHealth reports the driver's health, with status 200 once it is ready to serve and 503 until then.
+func (d *Driver) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status := d.bridge.health()
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logrus.WithError(err).Warn("Failed to write debug response")
+	}
+}
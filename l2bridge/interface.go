@@ -3,6 +3,7 @@ package l2bridge
 import (
 	"fmt"
 
+	"github.com/docker/libnetwork/types"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 )
@@ -10,14 +11,14 @@ import (
 // Interface models the bridge network device.
 type bridgeInterface struct {
 	Link netlink.Link
-	nlh  *netlink.Handle
+	nlh  NetlinkHandle
 }
 
 // newInterface creates a new bridge interface structure. It attempts to find
 // an already existing device identified by the configuration BridgeName field,
 // or the default bridge name when unspecified, but doesn't attempt to create
 // one when missing
-func newInterface(nlh *netlink.Handle, config *networkConfiguration) (*bridgeInterface, error) {
+func newInterface(nlh NetlinkHandle, config *networkConfiguration) (*bridgeInterface, error) {
 	var err error
 	i := &bridgeInterface{nlh: nlh}
 
@@ -26,7 +27,7 @@ func newInterface(nlh *netlink.Handle, config *networkConfiguration) (*bridgeInt
 	if err != nil {
 		logrus.Debugf("Did not find any interface with name %s: %v", config.BridgeName, err)
 	} else if _, ok := i.Link.(*netlink.Bridge); !ok {
-		return nil, fmt.Errorf("existing interface %s is not a bridge", i.Link.Attrs().Name)
+		return nil, types.BadRequestErrorf("bridge name %s is taken by an existing non-bridge device of type %s", i.Link.Attrs().Name, i.Link.Type())
 	}
 	return i, nil
 }
@@ -40,12 +41,12 @@ func (i *bridgeInterface) exists() bool {
 func (i *bridgeInterface) addresses() ([]netlink.Addr, []netlink.Addr, error) {
 	v4addr, err := i.nlh.AddrList(i.Link, netlink.FAMILY_V4)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to retrieve V4 addresses: %v", err)
+		return nil, nil, fmt.Errorf("Failed to retrieve V4 addresses: %w", err)
 	}
 
 	v6addr, err := i.nlh.AddrList(i.Link, netlink.FAMILY_V6)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to retrieve V6 addresses: %v", err)
+		return nil, nil, fmt.Errorf("Failed to retrieve V6 addresses: %w", err)
 	}
 
 	if len(v4addr) == 0 {
@@ -0,0 +1,93 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+// newDualStackNetwork creates a network with the 10.1.0.0/16 and 2001:db8:1::/64 pools on a dry run driver.
+func newDualStackNetwork(t *testing.T, d *bridgeDriver, nid string) {
+	d.ipv6Disabled = func() bool { return false }
+	opts := map[string]interface{}{netlabel.EnableIPv6: true}
+	if err := d.CreateNetwork(context.Background(), nid, opts, testIPAMData(t, "10.1.0.0/16"), testIPAMData(t, "2001:db8:1::/64")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEndpointIPFamily(t *testing.T) {
+	tests := []struct {
+		family     string
+		v4, v6     bool
+		infoFamily string
+	}{
+		{family: "", v4: true, v6: true, infoFamily: ipFamilyDual},
+		{family: ipFamilyDual, v4: true, v6: true, infoFamily: ipFamilyDual},
+		{family: ipFamilyV4, v4: true, infoFamily: ipFamilyV4},
+		{family: ipFamilyV6, v6: true, infoFamily: ipFamilyV6},
+	}
+	for _, tt := range tests {
+		t.Run("family "+tt.family, func(t *testing.T) {
+			d := newDryRunDriver()
+			newDualStackNetwork(t, d, testID(1))
+			ei := &EndpointInterface{
+				Address:     &net.IPNet{IP: net.ParseIP("10.1.0.5").To4(), Mask: net.CIDRMask(16, 32)},
+				AddressIPv6: &net.IPNet{IP: net.ParseIP("2001:db8:1::5"), Mask: net.CIDRMask(64, 128)},
+			}
+			var opts map[string]interface{}
+			if tt.family != "" {
+				opts = map[string]interface{}{label.IPFamily: tt.family}
+			}
+			if _, err := d.CreateEndpoint(context.Background(), testID(1), testID(2), ei, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			n, _ := d.getNetwork(testID(1))
+			ep := n.endpoints[testID(2)]
+			if (ep.addr != nil) != tt.v4 || (ep.gatewayv4 != nil) != tt.v4 {
+				t.Errorf("expected IPv4 %v, got address %v and gateway %v", tt.v4, ep.addr, ep.gatewayv4)
+			}
+			if (ep.addrv6 != nil) != tt.v6 || (ep.gatewayv6 != nil) != tt.v6 {
+				t.Errorf("expected IPv6 %v, got address %v and gateway %v", tt.v6, ep.addrv6, ep.gatewayv6)
+			}
+			if tt.v6 && !ep.gatewayv6.Equal(net.ParseIP("2001:db8:1::1")) {
+				t.Errorf("expected IPv6 gateway 2001:db8:1::1, got %v", ep.gatewayv6)
+			}
+			info, err := d.EndpointInfo(testID(1), testID(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info[label.IPFamily] != tt.infoFamily {
+				t.Errorf("expected %s %s in endpoint info, got %s", label.IPFamily, tt.infoFamily, info[label.IPFamily])
+			}
+		})
+	}
+}
+
+func TestValidateIPFamily(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("10.1.0.0/16")
+	_, v6, _ := net.ParseCIDR("2001:db8:1::/64")
+	tests := []struct {
+		family     string
+		pool4      *net.IPNet
+		pool6      *net.IPNet
+		badRequest bool
+	}{
+		{family: ipFamilyV4, pool4: v4},
+		{family: ipFamilyV4, pool6: v6, badRequest: true},
+		{family: ipFamilyV6, pool4: v4, pool6: v6},
+		{family: ipFamilyV6, pool4: v4, badRequest: true},
+		{family: ipFamilyDual, pool4: v4},
+	}
+	for _, tt := range tests {
+		c := &networkConfiguration{PoolIPv4: tt.pool4, PoolIPv6: tt.pool6}
+		err := c.validateIPFamily(tt.family)
+		if _, ok := err.(types.BadRequestError); ok != tt.badRequest {
+			t.Errorf("family %s with pools %v and %v: expected bad request %v, got %v", tt.family, tt.pool4, tt.pool6, tt.badRequest, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package l2bridge
+
+import (
+	"net"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+)
+
+// GatewayLookup finds the gateway a companion IPAM driver reserved for a pool, or nil if it has no such pool.
+type GatewayLookup interface {
+	PoolGateway(pool *net.IPNet) net.IP
+}
+
+// UseIPAM makes the driver take the default gateway of networks whose pools come from a companion IPAM driver from
+// that driver, so that containers route through the real gateway of the physical subnet.
+func (d *Driver) UseIPAM(gateways GatewayLookup) {
+	d.bridge.Lock()
+	d.bridge.ipamGateways = gateways
+	d.bridge.Unlock()
+}
+
+// applyIPAMGateways returns the IPAM data with the gateway reserved by the companion IPAM driver filled in for each
+// pool given no default gateway. Such a gateway belongs to a router on the wire, so the bridge does not claim it
+// unless the network asks it to.
+func (d *bridgeDriver) applyIPAMGateways(config *networkConfiguration, data []*IPAMData, gwKey string) []*IPAMData {
+	d.Lock()
+	gateways := d.ipamGateways
+	d.Unlock()
+	if gateways == nil {
+		return data
+	}
+
+	out := make([]*IPAMData, len(data))
+	for i, in := range data {
+		out[i] = in
+		if in.Pool == nil {
+			continue
+		}
+		if _, ok := in.AuxAddresses[gwKey]; ok {
+			continue
+		}
+		gw := gateways.PoolGateway(in.Pool)
+		if gw == nil {
+			continue
+		}
+
+		filled := *in
+		filled.AuxAddresses = map[string]*net.IPNet{gwKey: {IP: gw, Mask: in.Pool.Mask}}
+		for k, v := range in.AuxAddresses {
+			filled.AuxAddresses[k] = types.GetIPNetCopy(v)
+		}
+		out[i] = &filled
+		if config.AssignGatewayToBridge == nil {
+			assign := false
+			config.AssignGatewayToBridge = &assign
+		}
+		logrus.Infof("Network %s routes pool %s through gateway %s, reserved by the IPAM driver and not held by the bridge unless %s is set",
+			config.ID, in.Pool, gw, label.AssignGatewayToBridge)
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package l2bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestCreateNetworkIPv6Disabled(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabled   bool
+		enableIPv6 bool
+		v6Data     bool
+		ignore     bool
+		badRequest bool
+		wantIPv6   bool
+	}{
+		{name: "enabled kernel", enableIPv6: true, v6Data: true, wantIPv6: true},
+		{name: "disabled kernel", disabled: true, enableIPv6: true, v6Data: true, badRequest: true},
+		{name: "disabled kernel with v6 pool only", disabled: true, v6Data: true, badRequest: true},
+		{name: "disabled kernel ignored", disabled: true, enableIPv6: true, v6Data: true, ignore: true},
+		{name: "disabled kernel without v6", disabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			d.ipv6Disabled = func() bool { return tt.disabled }
+			opts := map[string]interface{}{netlabel.EnableIPv6: tt.enableIPv6}
+			if tt.ignore {
+				opts[netlabel.GenericData] = map[string]interface{}{label.IgnoreIPv6Disabled: "true", label.ProxyNDP: "true"}
+			}
+			var v6Data []*IPAMData
+			if tt.v6Data {
+				v6Data = testIPAMData(t, "2001:db8:1::/64")
+			}
+
+			err := d.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), v6Data)
+			if tt.badRequest {
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "disabled in kernel") {
+					t.Errorf("expected the error to say IPv6 is disabled in the kernel, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, _ := d.getNetwork(testID(1))
+			if n.config.EnableIPv6 != tt.wantIPv6 || (n.config.PoolIPv6 != nil) != tt.wantIPv6 {
+				t.Errorf("expected IPv6 %v, got enabled %v with pool %v", tt.wantIPv6, n.config.EnableIPv6, n.config.PoolIPv6)
+			}
+			if n.config.ProxyNDP {
+				t.Error("expected the options depending on IPv6 dropped")
+			}
+		})
+	}
+}
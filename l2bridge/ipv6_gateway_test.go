@@ -0,0 +1,87 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestJoinIPv6GatewayOnLink(t *testing.T) {
+	gw := net.ParseIP("2001:db8:1::1")
+	tests := []struct {
+		name   string
+		onLink string
+		routed bool
+	}{
+		{name: "default"},
+		{name: "on-link", onLink: "true"},
+		{name: "routed", onLink: "false", routed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			d.ipv6Disabled = func() bool { return false }
+			ctx := context.Background()
+			opts := map[string]interface{}{netlabel.EnableIPv6: true}
+			if tt.onLink != "" {
+				opts[netlabel.GenericData] = map[string]interface{}{label.IPv6GatewayOnLink: tt.onLink}
+			}
+			if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), testIPAMData(t, "2001:db8:1::/64")); err != nil {
+				t.Fatal(err)
+			}
+			ei := &EndpointInterface{
+				Address:     &net.IPNet{IP: net.ParseIP("10.1.0.5").To4(), Mask: net.CIDRMask(16, 32)},
+				AddressIPv6: &net.IPNet{IP: net.ParseIP("2001:db8:1::5"), Mask: net.CIDRMask(64, 128)},
+			}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+				t.Fatal(err)
+			}
+			res, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/x", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.routed {
+				if !res.GatewayIPv6.Equal(gw) || len(res.StaticRoutes) != 0 {
+					t.Errorf("expected on-link gateway %s and no routes, got %v and %v", gw, res.GatewayIPv6, res.StaticRoutes)
+				}
+				return
+			}
+			if res.GatewayIPv6 != nil {
+				t.Errorf("expected no on-link IPv6 gateway, got %v", res.GatewayIPv6)
+			}
+			if len(res.StaticRoutes) != 2 {
+				t.Fatalf("expected a route to the gateway and a default route, got %v", res.StaticRoutes)
+			}
+			host, def := res.StaticRoutes[0], res.StaticRoutes[1]
+			if host.Destination.String() != "2001:db8:1::1/128" || host.RouteType != types.CONNECTED {
+				t.Errorf("expected a connected route to the gateway, got %+v", host)
+			}
+			if def.Destination.String() != "::/0" || def.RouteType != types.NEXTHOP || !def.NextHop.Equal(gw) {
+				t.Errorf("expected a default route through the gateway, got %+v", def)
+			}
+		})
+	}
+}
+
+func TestIPv6GatewayRoutedRequiresGateway(t *testing.T) {
+	d := newDryRunDriver()
+	d.ipv6Disabled = func() bool { return false }
+	_, pool, _ := net.ParseCIDR("2001:db8:1::/64")
+	opts := map[string]interface{}{
+		netlabel.EnableIPv6:  true,
+		netlabel.GenericData: map[string]interface{}{label.IPv6GatewayOnLink: "false"},
+	}
+	err := d.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), []*IPAMData{{Pool: pool}})
+	if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("expected a BadRequestError routing to a missing IPv6 gateway, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "requires an IPv6 gateway") {
+		t.Errorf("expected the error to point at the missing gateway, got %v", err)
+	}
+}
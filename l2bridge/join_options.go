@@ -0,0 +1,75 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+// joinGatewayNone is the gateway option value installing no default gateway in the container.
+const joinGatewayNone = "none"
+
+// joinOptions are the options of a Join request shaping what the container sees.
+type joinOptions struct {
+	// ifPrefix replaces the network's container interface prefix. Docker names the interface by appending an index.
+	ifPrefix string
+	// gateway and gatewayv6 replace the endpoint's gateways, if set.
+	gateway   net.IP
+	gatewayv6 net.IP
+	// noGateway installs no default gateway of either family.
+	noGateway bool
+}
+
+// parseJoinOptions parses the options of a Join request. A requested gateway must be within the network's pool of
+// its family.
+func parseJoinOptions(config *networkConfiguration, opts map[string]interface{}) (*joinOptions, error) {
+	jo := &joinOptions{}
+
+	if opt, ok := opts[label.IfName]; ok {
+		prefix, ok := opt.(string)
+		if !ok {
+			return nil, types.BadRequestErrorf("unrecognized type for %s: %T", label.IfName, opt)
+		}
+		if err := validateBridgeName(prefix); err != nil {
+			return nil, types.BadRequestErrorf("invalid %s %v: %v", label.IfName, opt, err)
+		}
+		// Leave room for the index Docker appends.
+		if len(prefix) >= maxIfaceNameLen {
+			return nil, types.BadRequestErrorf("invalid %s %v: must be shorter than %d characters", label.IfName, opt, maxIfaceNameLen)
+		}
+		jo.ifPrefix = prefix
+	}
+
+	for _, key := range []string{label.GatewayIPv4, label.GatewayIPv6} {
+		opt, ok := opts[key]
+		if !ok {
+			continue
+		}
+		value := fmt.Sprint(opt)
+		if value == joinGatewayNone {
+			jo.noGateway = true
+			continue
+		}
+		gw := net.ParseIP(value)
+		if gw == nil {
+			return nil, types.BadRequestErrorf("invalid %s %v: not an IP address", key, opt)
+		}
+		if gw.To4() != nil {
+			if pools := config.poolsIPv4(); !poolsContain(pools, gw) {
+				return nil, types.BadRequestErrorf("invalid %s %v: not within the network's IPv4 subnets %v", key, opt, formatPools(pools))
+			}
+			jo.gateway = gw
+		} else {
+			if pools := config.poolsIPv6(); !poolsContain(pools, gw) {
+				return nil, types.BadRequestErrorf("invalid %s %v: not within the network's IPv6 subnets %v", key, opt, formatPools(pools))
+			}
+			jo.gatewayv6 = gw
+		}
+	}
+	if jo.noGateway && (jo.gateway != nil || jo.gatewayv6 != nil) {
+		return nil, types.BadRequestErrorf("%s cannot both give a gateway and be %s", label.GatewayIPv4, joinGatewayNone)
+	}
+	return jo, nil
+}
@@ -0,0 +1,129 @@
+package l2bridge
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/parsers/kernel"
+	"github.com/docker/libnetwork/ns"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// Kernel features reported by KernelFeatures.
+const (
+	featureVLANFiltering = "vlan_filtering"
+	featureVLANStats     = "vlan_stats"
+	featureMDB           = "mdb"
+	featureVXLAN         = "vxlan"
+	featureNFTables      = "nftables"
+	featureConntrack     = "conntrack_netlink"
+	featureAltNames      = "altnames"
+)
+
+// probeBridgeName names the short lived bridge created to discover the bridge features of the kernel.
+const probeBridgeName = "l2b-probe0"
+
+// kernelFeatures probes the kernel once and returns a copy of the cached results.
+func (d *bridgeDriver) kernelFeatures() map[string]bool {
+	d.featuresOnce.Do(func() {
+		d.features = d.probeKernel()
+	})
+
+	features := make(map[string]bool, len(d.features))
+	for k, v := range d.features {
+		features[k] = v
+	}
+	return features
+}
+
+// requireKernelFeatures rejects a network configuration that uses options the kernel cannot support.
+func (d *bridgeDriver) requireKernelFeatures(config *networkConfiguration) error {
+	features := d.kernelFeatures()
+	required := []struct {
+		used    bool
+		option  string
+		feature string
+	}{
+		{config.VLANStats, "l2bridge.vlan_stats", featureVLANStats},
+		{config.FlushConntrack, "l2bridge.flush_conntrack", featureConntrack},
+	}
+	for _, r := range required {
+		if available, probed := features[r.feature]; r.used && probed && !available {
+			return types.NotImplementedErrorf("%s requires kernel support for %s, which is unavailable on this host", r.option, r.feature)
+		}
+	}
+	return nil
+}
+
+// probeKernelFeatures discovers which optional kernel features are available on the host.
+func probeKernelFeatures() map[string]bool {
+	features := map[string]bool{
+		featureVXLAN:     moduleAvailable("vxlan"),
+		featureNFTables:  moduleAvailable("nf_tables"),
+		featureConntrack: moduleAvailable("nf_conntrack_netlink"),
+	}
+
+	if kv, err := kernel.GetKernelVersion(); err != nil {
+		logrus.WithError(err).Warn("Failed to check kernel version while probing kernel features")
+	} else {
+		features[featureAltNames] = kernel.CompareKernelVersion(*kv, kernel.VersionInfo{Kernel: 5, Major: 5}) >= 0
+	}
+
+	// The bridge options offered by the kernel are only visible on an existing bridge.
+	nlh := ns.NlHandle()
+	probe := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: probeBridgeName}}
+	if err := nlh.LinkAdd(probe); err != nil {
+		logrus.WithError(err).Warn("Failed to create a bridge to probe kernel features")
+		return features
+	}
+	defer func() {
+		if err := nlh.LinkDel(probe); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove kernel feature probe bridge %s", probeBridgeName)
+		}
+	}()
+
+	for feature, param := range map[string]string{
+		featureVLANFiltering: "vlan_filtering",
+		featureVLANStats:     "vlan_stats_enabled",
+		featureMDB:           "multicast_snooping",
+	} {
+		_, err := os.Stat(filepath.Join("/sys/class/net", probeBridgeName, "bridge", param))
+		features[feature] = err == nil
+	}
+	return features
+}
+
+// moduleAvailable reports whether the named kernel module is loaded, built in, or installed to be loaded.
+func moduleAvailable(name string) bool {
+	if moduleLoaded(name) {
+		return true
+	}
+
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+	f, err := os.Open(filepath.Join("/lib/modules", strings.TrimSpace(string(release)), "modules.dep"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		module := strings.SplitN(scanner.Text(), ":", 2)[0]
+		base := filepath.Base(module)
+		if i := strings.Index(base, ".ko"); i >= 0 {
+			base = base[:i]
+		}
+		if strings.Replace(base, "-", "_", -1) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestKernelFeaturesProbedOnce(t *testing.T) {
+	d := NewDriver(&Configuration{DryRun: true})
+	probes := 0
+	d.bridge.probeKernel = func() map[string]bool {
+		probes++
+		return map[string]bool{featureVLANFiltering: true, featureNFTables: false}
+	}
+
+	features := d.KernelFeatures()
+	if !features[featureVLANFiltering] || features[featureNFTables] {
+		t.Errorf("expected the probed features, got %v", features)
+	}
+	// Callers are given a copy, which they may change without affecting the cache.
+	features[featureNFTables] = true
+	if d.KernelFeatures()[featureNFTables] {
+		t.Error("expected the cached features not to change with a returned copy")
+	}
+
+	rec := httptest.NewRecorder()
+	d.handleKernel(rec, httptest.NewRequest("GET", "/debug/kernel", nil))
+	var got map[string]bool
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(got) != 2 || !got[featureVLANFiltering] || got[featureNFTables] {
+		t.Errorf("expected the probed features at /debug/kernel, got %v", got)
+	}
+	if probes != 1 {
+		t.Errorf("expected the kernel probed once, got %d probes", probes)
+	}
+}
+
+func TestRequireKernelFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		features map[string]bool
+		config   networkConfiguration
+		option   string
+	}{
+		{name: "no options", features: map[string]bool{featureVLANStats: false}},
+		{name: "available", features: map[string]bool{featureVLANStats: true}, config: networkConfiguration{VLANStats: true}},
+		{name: "not probed", features: map[string]bool{}, config: networkConfiguration{VLANStats: true}},
+		{name: "vlan stats unavailable", features: map[string]bool{featureVLANStats: false}, config: networkConfiguration{VLANStats: true},
+			option: "l2bridge.vlan_stats"},
+		{name: "conntrack unavailable", features: map[string]bool{featureConntrack: false}, config: networkConfiguration{FlushConntrack: true},
+			option: "l2bridge.flush_conntrack"},
+	}
+	for _, tt := range tests {
+		d := newDryRunDriver()
+		d.probeKernel = func() map[string]bool { return tt.features }
+		err := d.requireKernelFeatures(&tt.config)
+		if tt.option == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(types.NotImplementedError); !ok {
+			t.Errorf("%s: expected a NotImplementedError, got %v", tt.name, err)
+		} else if !strings.Contains(err.Error(), tt.option) {
+			t.Errorf("%s: expected the error to name %s, got %v", tt.name, tt.option, err)
+		}
+	}
+}
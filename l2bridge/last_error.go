@@ -0,0 +1,58 @@
+package l2bridge
+
+import (
+	"time"
+)
+
+// maxLastErrorLen bounds the length of a stored error message.
+const maxLastErrorLen = 512
+
+// lastError describes the most recent failed operation on a network or endpoint.
+type lastError struct {
+	Message string    `json:"message"`
+	Class   string    `json:"class"`
+	Time    time.Time `json:"time"`
+}
+
+// newLastError returns the record of err, or nil if err is nil.
+func newLastError(err error) *lastError {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if len(msg) > maxLastErrorLen {
+		msg = msg[:maxLastErrorLen] + "..."
+	}
+	return &lastError{Message: msg, Class: errorClass(err), Time: time.Now().UTC()}
+}
+
+// report adds the error to an endpoint info map under keys with the given prefix.
+func (e *lastError) report(m map[string]string, prefix string) {
+	if e == nil {
+		return
+	}
+	m[prefix] = e.Message
+	m[prefix+"_class"] = e.Class
+	m[prefix+"_time"] = e.Time.Format(time.RFC3339)
+}
+
+// recordResult stores the outcome of an operation as the last error of the endpoint, or of the network if eid is
+// empty or the endpoint is unknown. A successful operation clears the last error.
+func (d *bridgeDriver) recordResult(nid, eid string, err error) {
+	d.Lock()
+	n, ok := d.networks[nid]
+	d.Unlock()
+	if !ok || n == nil {
+		return
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	if ep, ok := n.endpoints[eid]; ok && eid != "" {
+		ep.lastErr = newLastError(err)
+		return
+	}
+	if eid == "" || err != nil {
+		n.lastErr = newLastError(err)
+	}
+}
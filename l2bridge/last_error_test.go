@@ -0,0 +1,101 @@
+package l2bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-plugins-helpers/network"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestNewLastError(t *testing.T) {
+	long := strings.Repeat("x", 2*maxLastErrorLen)
+	tests := []struct {
+		name  string
+		err   error
+		msg   string
+		class string
+	}{
+		{name: "success"},
+		{name: "bad request", err: types.BadRequestErrorf("bad"), msg: "bad", class: "BadRequestError"},
+		{name: "retry", err: types.RetryErrorf("busy"), msg: "busy", class: "RetryError"},
+		{name: "truncated", err: types.InternalErrorf("%s", long), msg: long[:maxLastErrorLen] + "...", class: "InternalError"},
+	}
+	for _, tt := range tests {
+		e := newLastError(tt.err)
+		if tt.err == nil {
+			if e != nil {
+				t.Errorf("%s: expected no last error, got %+v", tt.name, e)
+			}
+			continue
+		}
+		if e.Message != tt.msg || e.Class != tt.class || e.Time.IsZero() {
+			t.Errorf("%s: expected %q of class %s, got %+v", tt.name, tt.msg, tt.class, e)
+		}
+	}
+}
+
+func TestLastErrorSetAndCleared(t *testing.T) {
+	config := DefaultConfiguration()
+	config.DryRun = true
+	d := NewDriver(config)
+	if err := d.bridge.CreateNetwork(context.Background(), testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	create := func(eid string) error {
+		_, err := d.CreateEndpoint(&network.CreateEndpointRequest{NetworkID: testID(1), EndpointID: eid,
+			Interface: &network.EndpointInterface{Address: "10.1.0." + eid[:1] + "/16"}})
+		return err
+	}
+	if err := create(testID(2)); err != nil {
+		t.Fatal(err)
+	}
+	info := func() map[string]string {
+		t.Helper()
+		m, err := d.bridge.EndpointInfo(testID(1), testID(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	// A failed join is recorded on the endpoint, and a failed create of an unknown endpoint on the network.
+	d.bridge.SetNetworkDraining(testID(1), true)
+	if _, err := d.Join(&network.JoinRequest{NetworkID: testID(1), EndpointID: testID(2), SandboxKey: "/var/run/docker/netns/x"}); err == nil {
+		t.Fatal("expected a join on a draining network to fail")
+	}
+	if err := create(testID(3)); err == nil {
+		t.Fatal("expected an endpoint create on a draining network to fail")
+	}
+	m := info()
+	if !strings.Contains(m[label.LastErrorPrefix], "accepts no new joins") || m[label.LastErrorPrefix+"_class"] != "ForbiddenError" {
+		t.Errorf("expected the failed join as the endpoint's last error, got %q (%s)", m[label.LastErrorPrefix], m[label.LastErrorPrefix+"_class"])
+	}
+	if !strings.Contains(m[label.NetworkLastErrorPrefix], "accepts no new endpoints") {
+		t.Errorf("expected the failed create as the network's last error, got %q", m[label.NetworkLastErrorPrefix])
+	}
+	if m[label.LastErrorPrefix+"_time"] == "" {
+		t.Error("expected the time of the endpoint's last error")
+	}
+
+	// Querying the endpoint leaves its last error, while the next successful operation clears it.
+	if _, err := d.EndpointInfo(&network.InfoRequest{NetworkID: testID(1), EndpointID: testID(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if info()[label.LastErrorPrefix] == "" {
+		t.Error("expected querying the endpoint to keep its last error")
+	}
+	d.bridge.SetNetworkDraining(testID(1), false)
+	if _, err := d.Join(&network.JoinRequest{NetworkID: testID(1), EndpointID: testID(2), SandboxKey: "/var/run/docker/netns/x"}); err != nil {
+		t.Fatal(err)
+	}
+	if m := info(); m[label.LastErrorPrefix] != "" || m[label.LastErrorPrefix+"_class"] != "" {
+		t.Errorf("expected the endpoint's last error cleared, got %q", m[label.LastErrorPrefix])
+	}
+	d.bridge.recordResult(testID(1), "", nil)
+	if m := info(); m[label.NetworkLastErrorPrefix] != "" {
+		t.Errorf("expected the network's last error cleared, got %q", m[label.NetworkLastErrorPrefix])
+	}
+}
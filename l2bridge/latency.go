@@ -0,0 +1,88 @@
+package l2bridge
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of most recent requests per method over which percentiles are computed.
+const latencyWindow = 512
+
+// latencyTracker keeps a bounded window of recent request durations per driver method.
+type latencyTracker struct {
+	rings map[string]*latencyRing
+	sync.Mutex
+}
+
+type latencyRing struct {
+	durations [latencyWindow]time.Duration
+	next      int
+	full      bool
+}
+
+// latencySummary reports latency percentiles, in milliseconds, over the recent window of a method.
+type latencySummary struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{rings: make(map[string]*latencyRing)}
+}
+
+func (t *latencyTracker) observe(method string, d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	r, ok := t.rings[method]
+	if !ok {
+		r = &latencyRing{}
+		t.rings[method] = r
+	}
+	r.durations[r.next] = d
+	r.next = (r.next + 1) % latencyWindow
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// summaries computes the latency percentiles of every method observed so far.
+func (t *latencyTracker) summaries() map[string]latencySummary {
+	t.Lock()
+	defer t.Unlock()
+
+	out := make(map[string]latencySummary, len(t.rings))
+	for method, r := range t.rings {
+		n := r.next
+		if r.full {
+			n = latencyWindow
+		}
+		sorted := make([]time.Duration, n)
+		copy(sorted, r.durations[:n])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		out[method] = latencySummary{
+			Count: n,
+			P50:   percentile(sorted, 0.50),
+			P95:   percentile(sorted, 0.95),
+			P99:   percentile(sorted, 0.99),
+		}
+	}
+	return out
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations in milliseconds.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return float64(sorted[rank]) / float64(time.Millisecond)
+}
@@ -0,0 +1,73 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		want      latencySummary
+	}{
+		{name: "single", durations: []time.Duration{3 * time.Millisecond}, want: latencySummary{Count: 1, P50: 3, P95: 3, P99: 3}},
+		{name: "hundred", durations: millis(1, 100), want: latencySummary{Count: 100, P50: 50, P95: 95, P99: 99}},
+		{name: "unordered", durations: append(millis(51, 100), millis(1, 50)...), want: latencySummary{Count: 100, P50: 50, P95: 95, P99: 99}},
+		// Older durations leave the window, so a slow start is forgotten once the window is filled again.
+		{name: "window", durations: append(repeat(time.Second, latencyWindow), repeat(time.Millisecond, latencyWindow)...),
+			want: latencySummary{Count: latencyWindow, P50: 1, P95: 1, P99: 1}},
+		{name: "wrapped", durations: append(repeat(time.Second, latencyWindow), millis(1, 100)...),
+			want: latencySummary{Count: latencyWindow, P50: 1000, P95: 1000, P99: 1000}},
+	}
+	for _, tt := range tests {
+		tracker := newLatencyTracker()
+		for _, d := range tt.durations {
+			tracker.observe("CreateNetwork", d)
+		}
+		summaries := tracker.summaries()
+		if got := summaries["CreateNetwork"]; got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, got)
+		}
+		if _, ok := summaries["DeleteNetwork"]; ok {
+			t.Errorf("%s: expected no summary for a method never observed", tt.name)
+		}
+	}
+}
+
+// millis returns the durations of from to to milliseconds.
+func millis(from, to int) []time.Duration {
+	var ds []time.Duration
+	for ms := from; ms <= to; ms++ {
+		ds = append(ds, time.Duration(ms)*time.Millisecond)
+	}
+	return ds
+}
+
+// repeat returns the duration d n times.
+func repeat(d time.Duration, n int) []time.Duration {
+	ds := make([]time.Duration, n)
+	for j := range ds {
+		ds[j] = d
+	}
+	return ds
+}
+
+func TestHandleLatency(t *testing.T) {
+	d := NewDriver(&Configuration{DryRun: true})
+	for _, ms := range millis(1, 100) {
+		d.latency.observe("Join", ms)
+	}
+	rec := httptest.NewRecorder()
+	d.handleLatency(rec, httptest.NewRequest("GET", "/debug/latency", nil))
+
+	var got map[string]latencySummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if want := (latencySummary{Count: 100, P50: 50, P95: 95, P99: 99}); got["Join"] != want {
+		t.Errorf("expected %+v for Join, got %+v", want, got["Join"])
+	}
+}
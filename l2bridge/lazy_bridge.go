@@ -0,0 +1,42 @@
+package l2bridge
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// releaseLazyBridge deletes the bridge of a lazy network once none of its endpoints is joined, leaving the network
+// declared. The bridge is created again, with the endpoints still on the network as its ports, by ensureBridge when
+// an endpoint is next created or joined.
+func (d *bridgeDriver) releaseLazyBridge(n *bridgeNetwork) {
+	d.configNetwork.Lock()
+	defer d.configNetwork.Unlock()
+
+	n.Lock()
+	defer n.Unlock()
+	if !n.config.LazyBridge || n.pendingRebuild || !n.bridge.exists() {
+		return
+	}
+	for _, ep := range n.endpoints {
+		if ep.sandboxKey != "" {
+			return
+		}
+	}
+
+	log := logrus.WithField("network", n.id)
+	for _, cleanFunc := range n.iptCleanFuncs {
+		if err := cleanFunc(); err != nil {
+			log.WithError(err).Warn("Failed to clean iptables rules of lazy bridge")
+		}
+	}
+	n.iptCleanFuncs = nil
+	n.removeStaticFDB()
+
+	if err := d.nlh.LinkDel(n.bridge.Link); err != nil {
+		log.WithError(err).Warnf("Failed to delete lazy bridge %s", n.config.BridgeName)
+		return
+	}
+	d.markTearingDown(n.config.BridgeName)
+	n.bridge = &bridgeInterface{nlh: d.nlh}
+	n.pendingRebuild = true
+	log.Infof("Deleted lazy bridge %s, the last endpoint left", n.config.BridgeName)
+}
@@ -0,0 +1,161 @@
+package l2bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+// storedDeclared reads back whether the stored state has the network declared rather than realized.
+func storedDeclared(t *testing.T, d *bridgeDriver, nid string) bool {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(d.config.DataRoot, stateFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state storedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	for _, sn := range state.Networks {
+		if sn.Config.ID == nid {
+			return sn.Declared
+		}
+	}
+	t.Fatalf("expected network %s stored", nid)
+	return false
+}
+
+// TestLazyBridge follows a lazy network from its declaration through the creation of its bridge with the first
+// endpoint, its teardown as the last joined endpoint leaves, and its realization again on the next join.
+func TestLazyBridge(t *testing.T) {
+	sysctls := fakeSysctls(t)
+	d := newDryRunDriver()
+	h := &masterTestHandle{dryRunHandle: d.nlh.(*dryRunHandle), enslaved: make(map[string]string)}
+	d.nlh = h
+	d.config.DryRun = false
+	d.config.EnableIPTables = false
+	d.config.DataRoot = t.TempDir()
+
+	ctx := context.Background()
+	opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.LazyBridge: "true"}}
+	if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	bridgeName := n.config.BridgeName
+	realized := func() bool {
+		_, err := h.LinkByName(bridgeName)
+		return err == nil
+	}
+	if realized() || !storedDeclared(t, d, n.id) {
+		t.Fatal("expected the network declared without its bridge")
+	}
+
+	for _, eid := range []int{2, 3} {
+		ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.1.0.%d/16", eid))}
+		if _, err := d.CreateEndpoint(ctx, n.id, testID(eid), ei, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !realized() || storedDeclared(t, d, n.id) {
+		t.Fatal("expected the bridge created along with the first endpoint")
+	}
+
+	steps := []struct {
+		name     string
+		do       func() error
+		realized bool
+	}{
+		{name: "first join", do: func() error {
+			_, err := d.Join(ctx, n.id, testID(2), "/var/run/docker/netns/2", nil)
+			return err
+		}, realized: true},
+		{name: "second join", do: func() error {
+			_, err := d.Join(ctx, n.id, testID(3), "/var/run/docker/netns/3", nil)
+			return err
+		}, realized: true},
+		{name: "leave with an endpoint still joined", do: func() error {
+			return d.Leave(ctx, n.id, testID(2))
+		}, realized: true},
+		{name: "last leave", do: func() error {
+			return d.Leave(ctx, n.id, testID(3))
+		}},
+		{name: "join after the last leave", do: func() error {
+			_, err := d.Join(ctx, n.id, testID(2), "/var/run/docker/netns/2", nil)
+			return err
+		}, realized: true},
+	}
+	for _, step := range steps {
+		h.enslaved = make(map[string]string)
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if !step.realized {
+			// The sysctls of the bridge go with it.
+			for path := range sysctls {
+				if strings.Contains(path, "/"+bridgeName+"/") {
+					delete(sysctls, path)
+				}
+			}
+		}
+		if realized() != step.realized || storedDeclared(t, d, n.id) == step.realized {
+			t.Errorf("%s: expected the bridge realized %v, got %v and declared %v in the stored state",
+				step.name, step.realized, realized(), storedDeclared(t, d, n.id))
+		}
+	}
+
+	// The bridge realized again takes back the ports of the endpoints which stayed on the network.
+	for _, eid := range []string{testID(2), testID(3)} {
+		if port := n.endpoints[eid].hostIfName; h.enslaved[port] != bridgeName {
+			t.Errorf("expected %s of endpoint %s attached to the bridge again, got %v", port, eid, h.enslaved)
+		}
+	}
+	if deleted := h.deleted; len(deleted) != 1 || deleted[0] != bridgeName {
+		t.Errorf("expected only bridge %s deleted, on the last leave, got %v", bridgeName, deleted)
+	}
+
+	if err := d.DeleteNetwork(ctx, n.id); err != nil {
+		t.Fatal(err)
+	}
+	if realized() {
+		t.Error("expected the bridge deleted with the network")
+	}
+}
+
+// TestLazyBridgeRestored restores a lazy network stored declared, which keeps it without its bridge until used.
+func TestLazyBridgeRestored(t *testing.T) {
+	fakeSysctls(t)
+	dataRoot := t.TempDir()
+	before := newDryRunDriver()
+	before.config.DryRun, before.config.EnableIPTables, before.config.DataRoot = false, false, dataRoot
+	before.nlh = newDryRunHandle()
+	opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.LazyBridge: "true"}}
+	if err := before.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	after := newDryRunDriver()
+	after.config.DryRun, after.config.EnableIPTables, after.config.DataRoot = false, false, dataRoot
+	after.nlh = newDryRunHandle()
+	if err := after.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := after.getNetwork(testID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !n.pendingRebuild || n.bridge.exists() {
+		t.Error("expected the restored network declared without its bridge")
+	}
+	if _, err := after.nlh.LinkByName(n.config.BridgeName); err == nil {
+		t.Error("expected no bridge created on restore")
+	}
+}
@@ -0,0 +1,55 @@
+package l2bridge
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LogFormatText logs human readable lines, the default for interactive use.
+	LogFormatText = "text"
+	// LogFormatJSON logs one JSON object per line, for log pipelines.
+	LogFormatJSON = "json"
+)
+
+// setLogFormat switches the output of the standard logger to the given format.
+func setLogFormat(format string) {
+	switch format {
+	case LogFormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case LogFormatText, "":
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	default:
+		logrus.Warnf("Unknown log format %q, logging as %s", format, LogFormatText)
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}
+}
+
+// nextRequestID returns an id unique to a request among those this driver served.
+func (d *Driver) nextRequestID() string {
+	return strconv.FormatUint(atomic.AddUint64(&d.requests, 1), 10)
+}
+
+// requestLog returns the logger of a request, carrying the structured fields identifying it.
+func (d *Driver) requestLog(fname string, req interface{}, res interface{}) *logrus.Entry {
+	log := logrus.WithFields(logrus.Fields{
+		"method":     fname,
+		"request_id": d.nextRequestID(),
+	})
+	if nid, eid := requestIDs(req); nid != "" {
+		log = log.WithField("network_id", nid)
+		if eid != "" {
+			log = log.WithField("endpoint_id", eid)
+		}
+	}
+	if req != nil {
+		log = log.WithField("request", fmt.Sprintf("%v", unwrap(req)))
+	}
+	if res != nil {
+		log = log.WithField("response", fmt.Sprintf("%v", unwrap(res)))
+	}
+	return log
+}
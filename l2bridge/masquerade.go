@@ -0,0 +1,231 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// programRule programs an iptables rule of an endpoint. Tests replace it to record the rules programmed.
+var programRule = iptables.ProgramRule
+
+// iptablesRule is an iptables rule giving an endpoint outbound access, or publishing its ports.
+type iptablesRule struct {
+	table iptables.Table
+	chain string
+	args  []string
+}
+
+// masqueradeRules are the rules masquerading an endpoint's IPv4 address out of the given interface, and forwarding
+// its traffic there and back. They match the endpoint's address, so that rules of other endpoints are unaffected.
+func masqueradeRules(bridgeName, outIface string, ip net.IP) []iptablesRule {
+	addr := ip.String()
+	return []iptablesRule{
+		{iptables.Nat, "POSTROUTING", []string{"-s", addr, "-o", outIface, "-j", "MASQUERADE"}},
+		{iptables.Filter, "FORWARD", []string{"-i", bridgeName, "-o", outIface, "-s", addr, "-j", "ACCEPT"}},
+		{iptables.Filter, "FORWARD", []string{"-i", outIface, "-o", bridgeName, "-d", addr,
+			"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}},
+	}
+}
+
+// defaultRouteInterface returns the name of the interface the host's IPv4 default route leaves through.
+func defaultRouteInterface(nlh NetlinkHandle) (string, error) {
+	routes, err := nlh.RouteList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range routes {
+		if r.Dst != nil || r.LinkIndex == 0 {
+			continue
+		}
+		link, err := nlh.LinkByIndex(r.LinkIndex)
+		if err != nil {
+			return "", err
+		}
+		return link.Attrs().Name, nil
+	}
+	return "", fmt.Errorf("no IPv4 default route")
+}
+
+// ProgramExternalConnectivity publishes the ports of the endpoint's port map on the host, and gives the endpoint
+// outbound access through the host's default route, masquerading its address, if the network asked for it with
+// l2bridge.masquerade. The exposed ports of the request install no rules: the bridge accepts all traffic between
+// its ports, see setLocalForwarding, so there is nothing to open for them, and they are only recorded on Join.
+func (d *bridgeDriver) ProgramExternalConnectivity(nid, eid string, options map[string]interface{}) error {
+	defer d.lockNetwork(nid)()
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+	var bindings []types.PortBinding
+	if value, ok := options[netlabel.PortMap]; ok {
+		if bindings, err = parsePortBindings(value); err != nil {
+			return err
+		}
+	}
+
+	n.Lock()
+	// An internal network is never given outbound access, nor published.
+	internal, masquerade, bridgeName := n.config.Internal, n.config.Masquerade, n.config.BridgeName
+	programmed, mapped := ep.masqueradeIface != "", len(ep.portMapping) != 0
+	var addr net.IP
+	if ep.addr != nil {
+		addr = ep.addr.IP
+	}
+	n.Unlock()
+	if internal || addr == nil || d.dryRun() {
+		return nil
+	}
+
+	if len(bindings) != 0 && !mapped {
+		if err := n.programPortMapping(ep, bindings); err != nil {
+			return err
+		}
+		d.storeSync("port mapping program")
+	}
+	if !masquerade || programmed {
+		return nil
+	}
+
+	if err := n.programMasquerade(ep, bridgeName, addr); err != nil {
+		return err
+	}
+	d.storeSync("external connectivity program")
+	return nil
+}
+
+// programMasquerade gives the endpoint outbound access through the host's default route, masquerading the address.
+func (n *bridgeNetwork) programMasquerade(ep *bridgeEndpoint, bridgeName string, addr net.IP) error {
+	outIface, err := defaultRouteInterface(n.driver.nlh)
+	if err != nil {
+		return internalErrorf("failed to find the interface to masquerade endpoint %s out of: %v", ep.id, err)
+	}
+	rules := masqueradeRules(bridgeName, outIface, addr)
+	for i, r := range rules {
+		if err := programRule(r.table, r.chain, iptables.Insert, r.args); err != nil {
+			for _, done := range rules[:i] {
+				programRule(done.table, done.chain, iptables.Delete, done.args)
+			}
+			return internalErrorf("failed to program masquerading for endpoint %s: %v", ep.id, err)
+		}
+	}
+
+	n.Lock()
+	ep.masqueradeIface, ep.masqueradeAddr = outIface, addr
+	n.Unlock()
+	return nil
+}
+
+// moveExternalConnectivity reprograms the published ports and masquerading of a renumbered endpoint for its new IPv4
+// address. The ports keep the host ports they were given.
+func (n *bridgeNetwork) moveExternalConnectivity(ep *bridgeEndpoint) error {
+	n.Lock()
+	bindings := append([]types.PortBinding{}, ep.portMapping...)
+	masqueraded, bridgeName, addr := ep.masqueradeIface != "", n.config.BridgeName, ep.addr.IP
+	n.Unlock()
+
+	if len(bindings) != 0 {
+		if err := n.revokePortMapping(ep); err != nil {
+			logrus.WithError(err).Warnf("Failed to unpublish ports of endpoint (%s) on renumbering", ep.id)
+		}
+		for i := range bindings {
+			bindings[i].HostPortEnd = bindings[i].HostPort
+		}
+		if err := n.programPortMapping(ep, bindings); err != nil {
+			return err
+		}
+	}
+	if masqueraded {
+		if err := n.revokeMasquerade(ep); err != nil {
+			logrus.WithError(err).Warnf("Failed to revoke masquerading of endpoint (%s) on renumbering", ep.id)
+		}
+		if err := n.programMasquerade(ep, bridgeName, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokeExternalConnectivity removes the rules installed by ProgramExternalConnectivity for the endpoint.
+func (d *bridgeDriver) RevokeExternalConnectivity(nid, eid string) error {
+	defer d.lockNetwork(nid)()
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return types.InternalMaskableErrorf("%s", err)
+	}
+	ep, err := n.getEndpoint(eid)
+	if err != nil {
+		return err
+	}
+	if ep == nil {
+		return EndpointNotFoundError(eid)
+	}
+
+	if err := n.revokePortMapping(ep); err != nil {
+		return internalErrorf("failed to unpublish ports of endpoint %s: %v", eid, err)
+	}
+	if err := n.revokeMasquerade(ep); err != nil {
+		return internalErrorf("failed to revoke masquerading for endpoint %s: %v", eid, err)
+	}
+	d.storeSync("external connectivity revoke")
+	return nil
+}
+
+// revokeMasquerade removes the masquerading rules of the endpoint, if any, as they were programmed. It is also used
+// when tearing down endpoints of which libnetwork never revoked external connectivity.
+func (n *bridgeNetwork) revokeMasquerade(ep *bridgeEndpoint) error {
+	n.Lock()
+	outIface, addr, bridgeName := ep.masqueradeIface, ep.masqueradeAddr, n.config.BridgeName
+	ep.masqueradeIface, ep.masqueradeAddr = "", nil
+	n.Unlock()
+	if outIface == "" {
+		return nil
+	}
+
+	var errs []string
+	for _, r := range masqueradeRules(bridgeName, outIface, addr) {
+		if err := programRule(r.table, r.chain, iptables.Delete, r.args); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	var err error
+	if len(errs) != 0 {
+		err = fmt.Errorf("%v", errs)
+	}
+	n.driver.countRuleRemoval("iptables", err)
+	return err
+}
+
+// revokeAllExternalConnectivity removes the masquerading and port mapping rules of every endpoint of the network. It
+// is best effort.
+func (n *bridgeNetwork) revokeAllExternalConnectivity() {
+	n.Lock()
+	eps := make([]*bridgeEndpoint, 0, len(n.endpoints))
+	for _, ep := range n.endpoints {
+		eps = append(eps, ep)
+	}
+	n.Unlock()
+	sort.Slice(eps, func(i, j int) bool { return eps[i].id < eps[j].id })
+
+	for _, ep := range eps {
+		if err := n.revokePortMapping(ep); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove port mapping rules of endpoint (%s) on network %s delete", ep.id, n.id)
+		}
+		if err := n.revokeMasquerade(ep); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove masquerading rules of endpoint (%s) on network %s delete", ep.id, n.id)
+		}
+	}
+}
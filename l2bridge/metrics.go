@@ -0,0 +1,133 @@
+package l2bridge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kinds of metrics held by a metricsRegistry.
+const (
+	metricCounter = "counter"
+	metricGauge   = "gauge"
+)
+
+// metricsRegistry holds counters and gauges and writes them in the Prometheus text exposition format.
+type metricsRegistry struct {
+	families map[string]*metricFamily
+	sync.Mutex
+}
+
+// metricFamily is a named metric with one sample per label set.
+type metricFamily struct {
+	kind    string
+	help    string
+	labels  []string
+	samples map[string]float64 // key: rendered label set
+}
+
+// metricSchema describes a registered metric.
+type metricSchema struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Labels []string `json:"labels"`
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+// register declares a metric and the names of the labels its samples carry. Samples of undeclared metrics are
+// dropped.
+func (r *metricsRegistry) register(name, kind, help string, labels ...string) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.families[name]; !ok {
+		r.families[name] = &metricFamily{kind: kind, help: help, labels: labels, samples: make(map[string]float64)}
+	}
+}
+
+// add increases the sample of the metric with the given label name and value pairs.
+func (r *metricsRegistry) add(name string, delta float64, labels ...string) {
+	r.Lock()
+	defer r.Unlock()
+	if f, ok := r.families[name]; ok {
+		f.samples[renderLabels(labels)] += delta
+	}
+}
+
+// inc increases the sample of the metric with the given label name and value pairs by one.
+func (r *metricsRegistry) inc(name string, labels ...string) {
+	r.add(name, 1, labels...)
+}
+
+// set replaces the sample of the metric with the given label name and value pairs.
+func (r *metricsRegistry) set(name string, value float64, labels ...string) {
+	r.Lock()
+	defer r.Unlock()
+	if f, ok := r.families[name]; ok {
+		f.samples[renderLabels(labels)] = value
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// renderLabels formats label name and value pairs as a Prometheus label set.
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// schema describes every registered metric, sorted by name.
+func (r *metricsRegistry) schema() []metricSchema {
+	r.Lock()
+	defer r.Unlock()
+
+	schema := make([]metricSchema, 0, len(r.families))
+	for name, f := range r.families {
+		labels := append([]string{}, f.labels...)
+		schema = append(schema, metricSchema{Name: name, Type: f.kind, Help: f.help, Labels: labels})
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Name < schema[j].Name })
+	return schema
+}
+
+// writeText writes every metric, sorted by name and label set.
+func (r *metricsRegistry) writeText(w io.Writer) error {
+	r.Lock()
+	defer r.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := r.families[name]
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(f.samples))
+		for key := range f.samples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, key, strconv.FormatFloat(f.samples[key], 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
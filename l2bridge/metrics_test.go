@@ -0,0 +1,96 @@
+package l2bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// metricSample returns the sample of the metric with the given label name and value pairs.
+func metricSample(r *metricsRegistry, name string, labels ...string) float64 {
+	r.Lock()
+	defer r.Unlock()
+	if f, ok := r.families[name]; ok {
+		return f.samples[renderLabels(labels)]
+	}
+	return 0
+}
+
+func TestMetricsWriteText(t *testing.T) {
+	r := newMetricsRegistry()
+	r.register("b_total", metricCounter, "Things counted.", "kind")
+	r.register("a_value", metricGauge, "A value.")
+	r.inc("b_total", "kind", "veth")
+	r.add("b_total", 2, "kind", "veth")
+	r.inc("b_total", "kind", `a "quoted"`+"\n"+`\name`)
+	r.set("a_value", 1.5)
+	r.set("a_value", 0.25)
+	r.inc("undeclared_total")
+
+	var buf bytes.Buffer
+	if err := r.writeText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP a_value A value.\n" +
+		"# TYPE a_value gauge\n" +
+		"a_value 0.25\n" +
+		"# HELP b_total Things counted.\n" +
+		"# TYPE b_total counter\n" +
+		`b_total{kind="a \"quoted\"\n\\name"} 1` + "\n" +
+		`b_total{kind="veth"} 3` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestRenderLabels(t *testing.T) {
+	tests := []struct {
+		labels []string
+		want   string
+	}{
+		{},
+		{labels: []string{"kind", "veth"}, want: `{kind="veth"}`},
+		{labels: []string{"network", "n", "vlan", "10"}, want: `{network="n",vlan="10"}`},
+		{labels: []string{"kind", `a\b`}, want: `{kind="a\\b"}`},
+	}
+	for _, tt := range tests {
+		if got := renderLabels(tt.labels); got != tt.want {
+			t.Errorf("renderLabels(%q) = %s, expected %s", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsSchema(t *testing.T) {
+	r := newMetricsRegistry()
+	r.register("b_total", metricCounter, "Things counted.", "kind", "network")
+	r.register("a_value", metricGauge, "A value.")
+	r.register("b_total", metricGauge, "Registered again.")
+	want := []metricSchema{
+		{Name: "a_value", Type: metricGauge, Help: "A value.", Labels: []string{}},
+		{Name: "b_total", Type: metricCounter, Help: "Things counted.", Labels: []string{"kind", "network"}},
+	}
+	if got := r.schema(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected schema %+v, got %+v", want, got)
+	}
+}
+
+func TestHandleMetricsSchema(t *testing.T) {
+	d := NewDriver(&Configuration{DryRun: true})
+	rec := httptest.NewRecorder()
+	d.handleMetricsSchema(rec, httptest.NewRequest("GET", "/debug/metrics-schema", nil))
+	var schema []metricSchema
+	if err := json.Unmarshal(rec.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	for _, m := range schema {
+		if m.Name == metricGatewayChecks {
+			if m.Type != metricCounter || m.Help == "" || !equalStrings(m.Labels, []string{"result"}) {
+				t.Errorf("expected %s described as a counter by result, got %+v", metricGatewayChecks, m)
+			}
+			return
+		}
+	}
+	t.Errorf("expected %s in the schema, got %+v", metricGatewayChecks, schema)
+}
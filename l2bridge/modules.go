@@ -0,0 +1,65 @@
+package l2bridge
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// moduleLoaded reports whether the named kernel module is loaded or built into the running kernel. When this cannot
+// be determined, as in some containers, the module is assumed present and left for the kernel to refuse.
+func moduleLoaded(name string) bool {
+	if _, err := os.Stat(filepath.Join("/sys/module", name)); err == nil {
+		return true
+	}
+
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return true
+	}
+	f, err := os.Open(filepath.Join("/lib/modules", strings.TrimSpace(string(release)), "modules.builtin"))
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSuffix(filepath.Base(scanner.Text()), ".ko") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requireModule checks that the named kernel module is available, loading it if the driver is configured to do so.
+func (d *bridgeDriver) requireModule(name string) error {
+	if d.moduleLoaded(name) || d.dryRun() {
+		return nil
+	}
+
+	d.Lock()
+	autoLoad := d.config.AutoLoadModules
+	d.Unlock()
+	if !autoLoad {
+		return types.NotImplementedErrorf("kernel module %s is not loaded, load it or enable automatic module loading", name)
+	}
+
+	if out, err := runCommand("modprobe", name); err != nil {
+		return types.InternalErrorf("failed to load kernel module %s: %v (%s)", name, err, strings.TrimSpace(string(out)))
+	}
+	logrus.Infof("Loaded kernel module %s", name)
+	return nil
+}
+
+// checkModules reports at startup which kernel modules needed by the driver are unavailable.
+func (d *bridgeDriver) checkModules() {
+	if err := d.requireModule("bridge"); err != nil {
+		logrus.WithError(err).Warn("Networks cannot be created until the bridge module is available")
+	}
+}
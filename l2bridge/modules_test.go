@@ -0,0 +1,78 @@
+package l2bridge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestRequireModule(t *testing.T) {
+	tests := []struct {
+		name       string
+		loaded     bool
+		autoLoad   bool
+		dryRun     bool
+		modprobeOK bool
+		errType    string
+		modprobe   bool
+	}{
+		{name: "loaded", loaded: true},
+		{name: "missing", errType: "notimplemented"},
+		{name: "missing in a dry run", dryRun: true},
+		{name: "loaded automatically", autoLoad: true, modprobeOK: true, modprobe: true},
+		{name: "failed to load", autoLoad: true, errType: "internal", modprobe: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmds []string
+			orig := runCommand
+			runCommand = func(name string, args ...string) ([]byte, error) {
+				cmds = append(cmds, name+" "+strings.Join(args, " "))
+				if !tt.modprobeOK {
+					return []byte("modprobe: FATAL: Module 8021q not found"), errors.New("exit status 1")
+				}
+				return nil, nil
+			}
+			defer func() { runCommand = orig }()
+
+			config := DefaultConfiguration()
+			config.AutoLoadModules = tt.autoLoad
+			config.DryRun = tt.dryRun
+			d := NewBridgeDriver(config)
+			d.moduleLoaded = func(name string) bool {
+				if name != "8021q" {
+					t.Errorf("checked module %s rather than 8021q", name)
+				}
+				return tt.loaded
+			}
+
+			err := d.requireModule("8021q")
+			switch tt.errType {
+			case "notimplemented":
+				if _, ok := err.(types.NotImplementedError); !ok {
+					t.Fatalf("expected a NotImplementedError, got %v", err)
+				}
+			case "internal":
+				if _, ok := err.(types.InternalError); !ok {
+					t.Fatalf("expected an InternalError, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err != nil && !strings.Contains(err.Error(), "kernel module 8021q") {
+				t.Errorf("expected the error to name the missing module, got %v", err)
+			}
+			var want []string
+			if tt.modprobe {
+				want = []string{"modprobe 8021q"}
+			}
+			if !equalStrings(cmds, want) {
+				t.Errorf("expected commands %v, got %v", want, cmds)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package l2bridge
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Bytes of IP and TCP headers between an interface MTU and the TCP MSS it allows.
+const (
+	mssOverheadIPv4 = 40
+	mssOverheadIPv6 = 60
+)
+
+// mssClampTable is the name of the nftables bridge table clamping the MSS of TCP connections across the bridge.
+func (n *bridgeNetwork) mssClampTable() string {
+	return "l2b-mss-" + n.config.BridgeName
+}
+
+// clampMTU returns the MTU the MSS of the network's TCP connections must fit in, or 0 if all endpoints have the
+// same MTU. The caller must hold the network lock.
+func (n *bridgeNetwork) clampMTU() int {
+	clamp, mixed := 0, false
+	for _, ep := range n.endpoints {
+		if ep.mtu == 0 {
+			continue
+		}
+		if clamp != 0 && ep.mtu != clamp {
+			mixed = true
+		}
+		if clamp == 0 || ep.mtu < clamp {
+			clamp = ep.mtu
+		}
+	}
+	if !mixed {
+		return 0
+	}
+	return clamp
+}
+
+// updateMSSClamp installs, replaces or removes the MSS clamping rules of the network to match the MTUs of its
+// endpoints. While endpoints with differing MTUs share the bridge, TCP handshakes forwarded by it have their MSS
+// lowered to fit the smallest MTU, since the bridge cannot fragment or signal a smaller path MTU itself.
+func (n *bridgeNetwork) updateMSSClamp() error {
+	n.Lock()
+	defer n.Unlock()
+
+	want := n.clampMTU()
+	if want == n.mssClampMTU {
+		return nil
+	}
+
+	table := n.mssClampTable()
+	if n.mssClampMTU != 0 {
+		if err := nft("delete", "table", "bridge", table); err != nil {
+			return err
+		}
+		n.mssClampMTU = 0
+	}
+	if want == 0 {
+		return nil
+	}
+
+	if err := nft("add", "table", "bridge", table); err != nil {
+		return err
+	}
+	// Record the table as soon as it exists, so that a partial install is removed on the next update.
+	n.mssClampMTU = -1
+	if err := nft("add", "chain", "bridge", table, "forward",
+		"{", "type", "filter", "hook", "forward", "priority", "0", ";", "}"); err != nil {
+		return err
+	}
+	for _, rule := range []struct {
+		proto    string
+		overhead int
+	}{{"ip", mssOverheadIPv4}, {"ip6", mssOverheadIPv6}} {
+		mss := strconv.Itoa(want - rule.overhead)
+		if err := nft("add", "rule", "bridge", table, "forward", "meta", "protocol", rule.proto,
+			"tcp", "flags", "&", "(syn|rst)", "==", "syn",
+			"tcp", "option", "maxseg", "size", ">", mss, "tcp", "option", "maxseg", "size", "set", mss); err != nil {
+			return err
+		}
+	}
+	n.mssClampMTU = want
+	return nil
+}
+
+// removeMSSClamp removes the network's MSS clamping rules, if any, as the network is deleted.
+func (n *bridgeNetwork) removeMSSClamp() {
+	n.Lock()
+	defer n.Unlock()
+	if n.mssClampMTU == 0 {
+		return
+	}
+	err := nft("delete", "table", "bridge", n.mssClampTable())
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to remove MSS clamping on network (%s) delete", n.id)
+	}
+	n.driver.countRuleRemoval("nftables", err)
+	n.mssClampMTU = 0
+}
+
+// uplinkMSSClampTable is the name of the nftables bridge table fitting the traffic leaving the network through its
+// uplink to the uplink's MTU.
+func (n *bridgeNetwork) uplinkMSSClampTable() string {
+	return "l2b-umss-" + n.config.BridgeName
+}
+
+// uplinkMSSClampCmds are the nft commands fitting the traffic the bridge forwards out of the uplink to its MTU: TCP
+// handshakes have their MSS clamped, and IPv4 packets too large to pass that may not be fragmented are rejected with
+// ICMP fragmentation needed. Such a rejection carries no next-hop MTU, so senders fall back to their minimum path MTU;
+// IPv6 has no rejection with packet too big to use, and relies on the MSS clamp alone.
+func uplinkMSSClampCmds(table, uplink string, mtu int) [][]string {
+	cmds := [][]string{
+		{"add", "table", "bridge", table},
+		{"add", "chain", "bridge", table, "forward", "{", "type", "filter", "hook", "forward", "priority", "0", ";", "}"},
+	}
+	for _, rule := range []struct {
+		proto    string
+		overhead int
+	}{{"ip", mssOverheadIPv4}, {"ip6", mssOverheadIPv6}} {
+		mss := strconv.Itoa(mtu - rule.overhead)
+		cmds = append(cmds, []string{"add", "rule", "bridge", table, "forward", "oifname", uplink, "meta", "protocol", rule.proto,
+			"tcp", "flags", "&", "(syn|rst)", "==", "syn",
+			"tcp", "option", "maxseg", "size", ">", mss, "tcp", "option", "maxseg", "size", "set", mss})
+	}
+	return append(cmds, []string{"add", "rule", "bridge", table, "forward", "oifname", uplink, "meta", "protocol", "ip",
+		"ip", "frag-off", "&", "0x4000", "!=", "0", "ip", "length", ">", strconv.Itoa(mtu),
+		"reject", "with", "icmp", "type", "frag-needed"})
+}
+
+// setupUplinkMSSClamp fits the traffic leaving the network through its uplink to the uplink's MTU, for networks whose
+// bridge or endpoints use a larger, jumbo, MTU than the hosts beyond the uplink. Any table left from before is
+// replaced, so that the rules follow the uplink's current MTU.
+func (n *bridgeNetwork) setupUplinkMSSClamp(config *networkConfiguration, i *bridgeInterface) error {
+	link, err := i.nlh.LinkByName(n.uplinkPort)
+	if err != nil {
+		return fmt.Errorf("could not find uplink %s: %w", n.uplinkPort, err)
+	}
+	mtu := link.Attrs().MTU
+	if config.Mtu != 0 && config.Mtu <= mtu {
+		logrus.Infof("Uplink %s of network %s fits the network MTU %d, MSS clamping only applies to endpoints with a larger MTU",
+			n.uplinkPort, config.ID, config.Mtu)
+	}
+
+	table := n.uplinkMSSClampTable()
+	nft("delete", "table", "bridge", table)
+	for _, cmd := range uplinkMSSClampCmds(table, n.uplinkPort, mtu) {
+		if err := nft(cmd...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUplinkMSSClamp removes the table installed by setupUplinkMSSClamp as the network is deleted.
+func (n *bridgeNetwork) removeUplinkMSSClamp() {
+	err := nft("delete", "table", "bridge", n.uplinkMSSClampTable())
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to remove uplink MSS clamping on network (%s) delete", n.id)
+	}
+	n.driver.countRuleRemoval("nftables", err)
+}
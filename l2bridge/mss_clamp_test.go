@@ -0,0 +1,177 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestUplinkMSSClampCmds(t *testing.T) {
+	tests := []struct {
+		uplink string
+		mtu    int
+		want   []string // A fragment of each rule, in order
+	}{
+		{
+			uplink: "eth1", mtu: 1500,
+			want: []string{
+				"meta protocol ip tcp flags & (syn|rst) == syn tcp option maxseg size > 1460 tcp option maxseg size set 1460",
+				"meta protocol ip6 tcp flags & (syn|rst) == syn tcp option maxseg size > 1440 tcp option maxseg size set 1440",
+				"ip frag-off & 0x4000 != 0 ip length > 1500 reject with icmp type frag-needed",
+			},
+		},
+		{
+			uplink: "bond0.100", mtu: 1400,
+			want: []string{
+				"tcp option maxseg size set 1360",
+				"tcp option maxseg size set 1340",
+				"ip length > 1400 reject",
+			},
+		},
+	}
+	for _, tt := range tests {
+		cmds := uplinkMSSClampCmds("l2b-umss-br0", tt.uplink, tt.mtu)
+		if len(cmds) != 2+len(tt.want) {
+			t.Fatalf("uplink %s: expected %d commands, got %v", tt.uplink, 2+len(tt.want), cmds)
+		}
+		if chain := strings.Join(cmds[1], " "); !strings.Contains(chain, "hook forward") {
+			t.Errorf("uplink %s: expected the rules on the forward hook, got %s", tt.uplink, chain)
+		}
+		for i, fragment := range tt.want {
+			rule := strings.Join(cmds[2+i], " ")
+			if !strings.HasPrefix(rule, "add rule bridge l2b-umss-br0 forward oifname "+tt.uplink+" ") {
+				t.Errorf("uplink %s: rule %q does not target the uplink's egress", tt.uplink, rule)
+			}
+			if !strings.Contains(rule, fragment) {
+				t.Errorf("uplink %s: expected rule %q to contain %q", tt.uplink, rule, fragment)
+			}
+		}
+	}
+}
+
+func TestUplinkMSSClampRequiresUplink(t *testing.T) {
+	tests := []struct {
+		uplink     string
+		badRequest bool
+	}{
+		{uplink: "eth1"},
+		{uplink: "", badRequest: true},
+	}
+	for _, tt := range tests {
+		c := &networkConfiguration{UplinkMSSClamp: true, Uplink: tt.uplink}
+		err := c.Validate()
+		if _, ok := err.(types.BadRequestError); ok != tt.badRequest {
+			t.Errorf("uplink %q: expected bad request %v, got %v", tt.uplink, tt.badRequest, err)
+		}
+	}
+}
+
+func TestClampMTU(t *testing.T) {
+	tests := []struct {
+		mtus []int
+		want int
+	}{
+		{mtus: nil},
+		{mtus: []int{1500}},
+		{mtus: []int{9000, 9000}},
+		{mtus: []int{9000, 1500}, want: 1500},
+		{mtus: []int{1500, 9000, 4000}, want: 1500},
+		{mtus: []int{0, 9000}},
+	}
+	for _, tt := range tests {
+		n := &bridgeNetwork{endpoints: map[string]*bridgeEndpoint{}}
+		for i, mtu := range tt.mtus {
+			n.endpoints[testID(i)] = &bridgeEndpoint{mtu: mtu}
+		}
+		if got := n.clampMTU(); got != tt.want {
+			t.Errorf("endpoint MTUs %v: expected clamp %d, got %d", tt.mtus, tt.want, got)
+		}
+	}
+}
+
+func TestParseEndpointMTU(t *testing.T) {
+	tests := []struct {
+		opt        interface{}
+		want       int
+		badRequest bool
+	}{
+		{opt: "9000", want: 9000},
+		{opt: 1500, want: 1500},
+		{opt: strconv.Itoa(minMTU - 1), badRequest: true},
+		{opt: strconv.Itoa(maxMTU + 1), badRequest: true},
+		{opt: "jumbo", badRequest: true},
+	}
+	for _, tt := range tests {
+		ec, err := parseEndpointOptions(map[string]interface{}{label.MTU: tt.opt})
+		if tt.badRequest {
+			if _, ok := err.(types.BadRequestError); !ok {
+				t.Errorf("%v: expected a BadRequestError, got %v", tt.opt, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.opt, err)
+		} else if ec.MTU != tt.want {
+			t.Errorf("%v: expected MTU %d, got %d", tt.opt, tt.want, ec.MTU)
+		}
+	}
+}
+
+func TestMixedMTUClamp(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.MSSClamp: "true"}}
+	if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for eid, mtu := range map[int]string{2: "9000", 3: "1500"} {
+		ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.1.0.%d/16", eid))}
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(eid), ei, map[string]interface{}{label.MTU: mtu}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.MTU] != "9000" {
+		t.Errorf("expected %s 9000 in endpoint info, got %q", label.MTU, info[label.MTU])
+	}
+
+	n, _ := d.getNetwork(testID(1))
+	table := n.mssClampTable()
+	cmds := recordCommands(t)
+	if err := n.updateMSSClamp(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"nft add table bridge " + table,
+		"nft add chain bridge " + table + " forward { type filter hook forward priority 0 ; }",
+		"nft add rule bridge " + table + " forward meta protocol ip tcp flags & (syn|rst) == syn tcp option maxseg size > 1460 tcp option maxseg size set 1460",
+		"nft add rule bridge " + table + " forward meta protocol ip6 tcp flags & (syn|rst) == syn tcp option maxseg size > 1440 tcp option maxseg size set 1440",
+	}
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands\n%v\ngot\n%v", want, *cmds)
+	}
+
+	// Updating again with the same MTUs leaves the clamp alone, and it goes once the MTUs match.
+	*cmds = nil
+	if err := n.updateMSSClamp(); err != nil {
+		t.Fatal(err)
+	}
+	n.Lock()
+	delete(n.endpoints, testID(3))
+	n.Unlock()
+	if err := n.updateMSSClamp(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nft delete table bridge " + table}; !equalStrings(*cmds, want) {
+		t.Errorf("expected commands %v, got %v", want, *cmds)
+	}
+}
@@ -0,0 +1,241 @@
+package l2bridge
+
+import (
+	"net"
+	"time"
+
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// NetlinkHandle is the set of netlink operations used by the driver. It is satisfied by *netlink.Handle, and
+// wrapped to instrument or fake the kernel.
+type NetlinkHandle interface {
+	LinkAdd(link netlink.Link) error
+	LinkDel(link netlink.Link) error
+	LinkByName(name string) (netlink.Link, error)
+	LinkByIndex(index int) (netlink.Link, error)
+	LinkList() ([]netlink.Link, error)
+	LinkSetUp(link netlink.Link) error
+	LinkSetDown(link netlink.Link) error
+	LinkSetMTU(link netlink.Link, mtu int) error
+	LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error
+	LinkSetMaster(link netlink.Link, master *netlink.Bridge) error
+	LinkSetNoMaster(link netlink.Link) error
+	LinkSetHairpin(link netlink.Link, mode bool) error
+	LinkSetAlias(link netlink.Link, name string) error
+	SetPromiscOn(link netlink.Link) error
+	SetPromiscOff(link netlink.Link) error
+	LinkSetLearning(link netlink.Link, mode bool) error
+	LinkGetProtinfo(link netlink.Link) (netlink.Protinfo, error)
+	AddrAdd(link netlink.Link, addr *netlink.Addr) error
+	AddrDel(link netlink.Link, addr *netlink.Addr) error
+	AddrReplace(link netlink.Link, addr *netlink.Addr) error
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+	NeighAdd(neigh *netlink.Neigh) error
+	NeighSet(neigh *netlink.Neigh) error
+	NeighDel(neigh *netlink.Neigh) error
+	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+	ConntrackDeleteFilter(table netlink.ConntrackTableType, family netlink.InetFamily, filter netlink.CustomConntrackFilter) (uint, error)
+	BridgeVlanList() (map[int32][]*nl.BridgeVlanInfo, error)
+	BridgeVlanAdd(link netlink.Link, vid uint16, pvid, untagged, self, master bool) error
+	BridgeVlanDel(link netlink.Link, vid uint16, pvid, untagged, self, master bool) error
+}
+
+// Metrics describing netlink operations, by operation.
+const (
+	metricNetlinkOps      = "l2bridge_netlink_operations_total"
+	metricNetlinkErrors   = "l2bridge_netlink_errors_total"
+	metricNetlinkDuration = "l2bridge_netlink_duration_seconds_total"
+)
+
+func registerNetlinkMetrics(r *metricsRegistry) {
+	r.register(metricNetlinkOps, metricCounter, "Netlink operations performed, by operation.", "op")
+	r.register(metricNetlinkErrors, metricCounter, "Netlink operations that failed, by operation.", "op")
+	r.register(metricNetlinkDuration, metricCounter, "Time spent in netlink operations, by operation.", "op")
+}
+
+// meteredHandle counts the operations made through a NetlinkHandle, their errors and the time they take.
+type meteredHandle struct {
+	h       NetlinkHandle
+	metrics *metricsRegistry
+}
+
+func newMeteredHandle(h NetlinkHandle, metrics *metricsRegistry) NetlinkHandle {
+	return &meteredHandle{h: h, metrics: metrics}
+}
+
+func (m *meteredHandle) observe(op string, start time.Time, err error) {
+	m.metrics.inc(metricNetlinkOps, "op", op)
+	m.metrics.add(metricNetlinkDuration, time.Since(start).Seconds(), "op", op)
+	// Lookups of absent links are expected, as when checking that a link is gone.
+	if _, notFound := err.(netlink.LinkNotFoundError); err != nil && !notFound {
+		m.metrics.inc(metricNetlinkErrors, "op", op)
+	}
+}
+
+func (m *meteredHandle) LinkAdd(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_add", start, err) }(time.Now())
+	return m.h.LinkAdd(link)
+}
+
+func (m *meteredHandle) LinkDel(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_del", start, err) }(time.Now())
+	return m.h.LinkDel(link)
+}
+
+func (m *meteredHandle) LinkByName(name string) (link netlink.Link, err error) {
+	defer func(start time.Time) { m.observe("link_get", start, err) }(time.Now())
+	return m.h.LinkByName(name)
+}
+
+func (m *meteredHandle) LinkByIndex(index int) (link netlink.Link, err error) {
+	defer func(start time.Time) { m.observe("link_get", start, err) }(time.Now())
+	return m.h.LinkByIndex(index)
+}
+
+func (m *meteredHandle) LinkList() (links []netlink.Link, err error) {
+	defer func(start time.Time) { m.observe("link_list", start, err) }(time.Now())
+	return m.h.LinkList()
+}
+
+func (m *meteredHandle) LinkSetUp(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_set_up", start, err) }(time.Now())
+	return m.h.LinkSetUp(link)
+}
+
+func (m *meteredHandle) LinkSetDown(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_set_down", start, err) }(time.Now())
+	return m.h.LinkSetDown(link)
+}
+
+func (m *meteredHandle) LinkSetMTU(link netlink.Link, mtu int) (err error) {
+	defer func(start time.Time) { m.observe("link_set_mtu", start, err) }(time.Now())
+	return m.h.LinkSetMTU(link, mtu)
+}
+
+func (m *meteredHandle) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) (err error) {
+	defer func(start time.Time) { m.observe("link_set_hwaddr", start, err) }(time.Now())
+	return m.h.LinkSetHardwareAddr(link, hwaddr)
+}
+
+func (m *meteredHandle) LinkSetMaster(link netlink.Link, master *netlink.Bridge) (err error) {
+	defer func(start time.Time) { m.observe("link_set_master", start, err) }(time.Now())
+	return m.h.LinkSetMaster(link, master)
+}
+
+func (m *meteredHandle) LinkSetNoMaster(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_set_nomaster", start, err) }(time.Now())
+	return m.h.LinkSetNoMaster(link)
+}
+
+func (m *meteredHandle) LinkSetHairpin(link netlink.Link, mode bool) (err error) {
+	defer func(start time.Time) { m.observe("bridge_set_hairpin", start, err) }(time.Now())
+	return m.h.LinkSetHairpin(link, mode)
+}
+
+func (m *meteredHandle) LinkSetAlias(link netlink.Link, name string) (err error) {
+	defer func(start time.Time) { m.observe("link_set_alias", start, err) }(time.Now())
+	return m.h.LinkSetAlias(link, name)
+}
+
+func (m *meteredHandle) SetPromiscOn(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_set_promisc", start, err) }(time.Now())
+	return m.h.SetPromiscOn(link)
+}
+
+func (m *meteredHandle) SetPromiscOff(link netlink.Link) (err error) {
+	defer func(start time.Time) { m.observe("link_set_promisc", start, err) }(time.Now())
+	return m.h.SetPromiscOff(link)
+}
+
+func (m *meteredHandle) LinkSetLearning(link netlink.Link, mode bool) (err error) {
+	defer func(start time.Time) { m.observe("bridge_set_learning", start, err) }(time.Now())
+	return m.h.LinkSetLearning(link, mode)
+}
+
+func (m *meteredHandle) LinkGetProtinfo(link netlink.Link) (pi netlink.Protinfo, err error) {
+	defer func(start time.Time) { m.observe("bridge_get_protinfo", start, err) }(time.Now())
+	return m.h.LinkGetProtinfo(link)
+}
+
+func (m *meteredHandle) RouteList(link netlink.Link, family int) (routes []netlink.Route, err error) {
+	defer func(start time.Time) { m.observe("route_list", start, err) }(time.Now())
+	return m.h.RouteList(link, family)
+}
+
+func (m *meteredHandle) AddrAdd(link netlink.Link, addr *netlink.Addr) (err error) {
+	defer func(start time.Time) { m.observe("addr_add", start, err) }(time.Now())
+	return m.h.AddrAdd(link, addr)
+}
+
+func (m *meteredHandle) AddrDel(link netlink.Link, addr *netlink.Addr) (err error) {
+	defer func(start time.Time) { m.observe("addr_del", start, err) }(time.Now())
+	return m.h.AddrDel(link, addr)
+}
+
+func (m *meteredHandle) AddrReplace(link netlink.Link, addr *netlink.Addr) (err error) {
+	defer func(start time.Time) { m.observe("addr_replace", start, err) }(time.Now())
+	return m.h.AddrReplace(link, addr)
+}
+
+func (m *meteredHandle) AddrList(link netlink.Link, family int) (addrs []netlink.Addr, err error) {
+	defer func(start time.Time) { m.observe("addr_list", start, err) }(time.Now())
+	return m.h.AddrList(link, family)
+}
+
+func (m *meteredHandle) NeighAdd(neigh *netlink.Neigh) (err error) {
+	defer func(start time.Time) { m.observe("neigh_add", start, err) }(time.Now())
+	return m.h.NeighAdd(neigh)
+}
+
+func (m *meteredHandle) NeighSet(neigh *netlink.Neigh) (err error) {
+	defer func(start time.Time) { m.observe("neigh_set", start, err) }(time.Now())
+	return m.h.NeighSet(neigh)
+}
+
+func (m *meteredHandle) NeighDel(neigh *netlink.Neigh) (err error) {
+	defer func(start time.Time) { m.observe("neigh_del", start, err) }(time.Now())
+	return m.h.NeighDel(neigh)
+}
+
+func (m *meteredHandle) ConntrackDeleteFilter(table netlink.ConntrackTableType, family netlink.InetFamily, filter netlink.CustomConntrackFilter) (n uint, err error) {
+	defer func(start time.Time) { m.observe("conntrack_delete", start, err) }(time.Now())
+	return m.h.ConntrackDeleteFilter(table, family, filter)
+}
+
+func (m *meteredHandle) BridgeVlanList() (vlans map[int32][]*nl.BridgeVlanInfo, err error) {
+	defer func(start time.Time) { m.observe("bridge_vlan_list", start, err) }(time.Now())
+	return m.h.BridgeVlanList()
+}
+
+func (m *meteredHandle) BridgeVlanAdd(link netlink.Link, vid uint16, pvid, untagged, self, master bool) (err error) {
+	defer func(start time.Time) { m.observe("bridge_vlan_add", start, err) }(time.Now())
+	return m.h.BridgeVlanAdd(link, vid, pvid, untagged, self, master)
+}
+
+func (m *meteredHandle) BridgeVlanDel(link netlink.Link, vid uint16, pvid, untagged, self, master bool) (err error) {
+	defer func(start time.Time) { m.observe("bridge_vlan_del", start, err) }(time.Now())
+	return m.h.BridgeVlanDel(link, vid, pvid, untagged, self, master)
+}
+
+// generateIfaceName returns an interface name with the given prefix not yet used on the host.
+func generateIfaceName(nlh NetlinkHandle, prefix string, len int) (string, error) {
+	for i := 0; i < 3; i++ {
+		name, err := netutils.GenerateRandomName(prefix, len)
+		if err != nil {
+			continue
+		}
+		_, err = nlh.LinkByName(name)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return name, nil
+		}
+		return "", err
+	}
+	return "", types.InternalErrorf("could not generate interface name")
+}
@@ -0,0 +1,60 @@
+package l2bridge
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// failingTestHandle is a dry run handle whose link changes fail.
+type failingTestHandle struct {
+	*dryRunHandle
+}
+
+func (h *failingTestHandle) LinkSetUp(link netlink.Link) error {
+	return errors.New("operation not permitted")
+}
+
+func TestMeteredHandle(t *testing.T) {
+	r := newMetricsRegistry()
+	registerNetlinkMetrics(r)
+	h := newMeteredHandle(&failingTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}, r)
+	br := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0"}}
+
+	tests := []struct {
+		op   string
+		call func() error
+		err  bool
+	}{
+		{op: "link_add", call: func() error { return h.LinkAdd(br) }},
+		{op: "link_get", call: func() error { _, err := h.LinkByName("br0"); return err }},
+		{op: "link_get", call: func() error { _, err := h.LinkByName("missing"); return err }, err: true},
+		{op: "link_list", call: func() error { _, err := h.LinkList(); return err }},
+		{op: "link_set_up", call: func() error { return h.LinkSetUp(br) }, err: true},
+		{op: "link_set_up", call: func() error { return h.LinkSetUp(br) }, err: true},
+		{op: "link_del", call: func() error { return h.LinkDel(br) }},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.op, tt.err, err)
+		}
+	}
+
+	// Lookups of absent links are not errors.
+	for op, want := range map[string][2]float64{
+		"link_add":    {1, 0},
+		"link_get":    {2, 0},
+		"link_list":   {1, 0},
+		"link_set_up": {2, 2},
+		"link_del":    {1, 0},
+	} {
+		ops, errs := metricSample(r, metricNetlinkOps, "op", op), metricSample(r, metricNetlinkErrors, "op", op)
+		if ops != want[0] || errs != want[1] {
+			t.Errorf("%s: expected %v operations and %v errors, got %v and %v", op, want[0], want[1], ops, errs)
+		}
+		if metricSample(r, metricNetlinkDuration, "op", op) < 0 {
+			t.Errorf("%s: expected a non-negative duration", op)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+)
+
+// requestFingerprint encodes a network configuration as parsed from a CreateNetwork request, before the driver
+// derives anything from it, so that a retried request can be told apart from a conflicting one.
+func requestFingerprint(config *networkConfiguration) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// checkRetry settles a CreateNetwork request for a network which already exists. A retry of the request the
+// network was created with succeeds without doing anything; any other request is rejected, naming the settings it
+// differs in.
+func (n *bridgeNetwork) checkRetry(fingerprint string) error {
+	n.Lock()
+	recorded := n.requested
+	n.Unlock()
+
+	if recorded == "" {
+		return types.ForbiddenErrorf("network %s exists", n.id)
+	}
+	if recorded == fingerprint {
+		return nil
+	}
+
+	var was, now map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(recorded), &was); err != nil {
+		return internalErrorf("failed to decode the configuration of network %s: %v", n.id, err)
+	}
+	if err := json.Unmarshal([]byte(fingerprint), &now); err != nil {
+		return internalErrorf("failed to decode the configuration requested for network %s: %v", n.id, err)
+	}
+	var differs []string
+	for field, value := range now {
+		if string(was[field]) != string(value) {
+			differs = append(differs, field)
+		}
+	}
+	sort.Strings(differs)
+	return types.BadRequestErrorf("network %s exists with a different configuration: %s differ", n.id, strings.Join(differs, ", "))
+}
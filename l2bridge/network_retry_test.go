@@ -0,0 +1,61 @@
+package l2bridge
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestCreateNetworkRetry(t *testing.T) {
+	stp := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.STP: "true"}}
+	tests := []struct {
+		name       string
+		opts       map[string]interface{}
+		pool       string
+		unrecorded bool
+		badRequest string // A setting the error must name
+		forbidden  bool
+	}{
+		{name: "same request", pool: "10.1.0.0/16"},
+		{name: "different option", opts: stp, pool: "10.1.0.0/16", badRequest: "STP"},
+		{name: "different pool", pool: "10.2.0.0/16", badRequest: "PoolIPv4"},
+		{name: "created before requests were recorded", pool: "10.1.0.0/16", unrecorded: true, forbidden: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			n, _ := d.getNetwork(testID(1))
+			if tt.unrecorded {
+				n.requested = ""
+			}
+
+			err := d.CreateNetwork(ctx, testID(1), tt.opts, testIPAMData(t, tt.pool), nil)
+			switch {
+			case tt.badRequest != "":
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				if !strings.Contains(err.Error(), tt.badRequest) {
+					t.Errorf("expected the error to name %s, got %v", tt.badRequest, err)
+				}
+			case tt.forbidden:
+				if _, ok := err.(types.ForbiddenError); !ok {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("expected the retry to succeed, got %v", err)
+			}
+			if got, _ := d.getNetwork(testID(1)); got != n || n.config.STP || n.config.PoolIPv4.String() != "10.1.0.0/16" {
+				t.Errorf("expected the network left as created, got %+v", got.config)
+			}
+		})
+	}
+}
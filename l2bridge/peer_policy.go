@@ -0,0 +1,138 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// parsePeers parses a comma separated list of the endpoint ids and addresses an endpoint may talk to.
+func parsePeers(s string) ([]string, error) {
+	var peers []string
+	for _, peer := range strings.Split(s, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer == "" {
+			continue
+		}
+		if strings.ContainsAny(peer, " \t{};") {
+			return nil, fmt.Errorf("%q is neither an endpoint id nor an address", peer)
+		}
+		peers = append(peers, peer)
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no peers given")
+	}
+	return peers, nil
+}
+
+// peerTable is the name of the nftables bridge table restricting the endpoint to its peers.
+func (ep *bridgeEndpoint) peerTable() string {
+	return "l2b-peers-" + ep.hostIfName
+}
+
+// setupPeerPolicy drops bridged traffic between the endpoint and the network's other endpoints, unless they are
+// among its peers. Traffic with the uplink and the host is unaffected. The addresses blocked are filled in by
+// updatePeerPolicies.
+func (ep *bridgeEndpoint) setupPeerPolicy() error {
+	table := ep.peerTable()
+	if err := nft("add", "table", "bridge", table); err != nil {
+		return err
+	}
+	if err := nft("add", "chain", "bridge", table, "forward",
+		"{", "type", "filter", "hook", "forward", "priority", "0", ";", "}"); err != nil {
+		return err
+	}
+	for _, set := range []struct{ name, kind string }{{"blocked4", "ipv4_addr"}, {"blocked6", "ipv6_addr"}} {
+		if err := nft("add", "set", "bridge", table, set.name, "{", "type", set.kind, ";", "}"); err != nil {
+			return err
+		}
+	}
+	for _, rule := range [][]string{
+		{"iifname", ep.hostIfName, "ip", "daddr", "@blocked4", "drop"},
+		{"oifname", ep.hostIfName, "ip", "saddr", "@blocked4", "drop"},
+		{"iifname", ep.hostIfName, "ip6", "daddr", "@blocked6", "drop"},
+		{"oifname", ep.hostIfName, "ip6", "saddr", "@blocked6", "drop"},
+	} {
+		if err := nft(append([]string{"add", "rule", "bridge", table, "forward"}, rule...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePeerPolicy removes the table installed by setupPeerPolicy.
+func (ep *bridgeEndpoint) removePeerPolicy() error {
+	return nft("delete", "table", "bridge", ep.peerTable())
+}
+
+// isPeer reports whether the endpoint lists other, by id or by one of its addresses, among its peers.
+func (ep *bridgeEndpoint) isPeer(other *bridgeEndpoint) bool {
+	for _, peer := range ep.config.Peers {
+		if peer == other.id {
+			return true
+		}
+		if ip := net.ParseIP(peer); ip != nil {
+			for _, addr := range other.addresses() {
+				if ip.Equal(addr) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// updatePeerPolicies refills the blocked addresses of every endpoint with a peer policy installed, as endpoints come
+// and go or change addresses. It is best effort.
+func (n *bridgeNetwork) updatePeerPolicies() {
+	type update struct {
+		ep       *bridgeEndpoint
+		table    string
+		blocked4 []string
+		blocked6 []string
+	}
+	var updates []update
+
+	n.Lock()
+	for _, ep := range n.endpoints {
+		if !ep.peerPolicy {
+			continue
+		}
+		u := update{ep: ep, table: ep.peerTable()}
+		for _, other := range n.endpoints {
+			if other == ep || ep.isPeer(other) {
+				continue
+			}
+			for _, ip := range other.addresses() {
+				if ip.To4() != nil {
+					u.blocked4 = append(u.blocked4, ip.String())
+				} else {
+					u.blocked6 = append(u.blocked6, ip.String())
+				}
+			}
+		}
+		updates = append(updates, u)
+	}
+	n.Unlock()
+
+	for _, u := range updates {
+		for set, elements := range map[string][]string{"blocked4": u.blocked4, "blocked6": u.blocked6} {
+			if err := fillNFTSet(u.table, set, elements); err != nil {
+				logrus.WithError(err).Warnf("Failed to update peer policy of endpoint (%s)", u.ep.id)
+			}
+		}
+	}
+}
+
+// fillNFTSet replaces the elements of a set in a bridge table.
+func fillNFTSet(table, set string, elements []string) error {
+	if err := nft("flush", "set", "bridge", table, set); err != nil {
+		return err
+	}
+	if len(elements) == 0 {
+		return nil
+	}
+	return nft("add", "element", "bridge", table, set, "{", strings.Join(elements, ", "), "}")
+}
@@ -0,0 +1,121 @@
+package l2bridge
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParsePeers(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: "a", want: []string{"a"}},
+		{in: " a , 10.1.0.2,,2001:db8::2 ", want: []string{"a", "10.1.0.2", "2001:db8::2"}},
+		{in: "", err: true},
+		{in: " , ", err: true},
+		{in: "a;b", err: true},
+		{in: "a } drop", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parsePeers(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parsePeers(%q): expected error %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if !equalStrings(got, tt.want) {
+			t.Errorf("parsePeers(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPeerPolicyRules(t *testing.T) {
+	cmds := recordCommands(t)
+	ep := &bridgeEndpoint{hostIfName: "veth1"}
+	if err := ep.setupPeerPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ep.removePeerPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"nft add table bridge l2b-peers-veth1",
+		"nft add chain bridge l2b-peers-veth1 forward { type filter hook forward priority 0 ; }",
+		"nft add set bridge l2b-peers-veth1 blocked4 { type ipv4_addr ; }",
+		"nft add set bridge l2b-peers-veth1 blocked6 { type ipv6_addr ; }",
+		"nft add rule bridge l2b-peers-veth1 forward iifname veth1 ip daddr @blocked4 drop",
+		"nft add rule bridge l2b-peers-veth1 forward oifname veth1 ip saddr @blocked4 drop",
+		"nft add rule bridge l2b-peers-veth1 forward iifname veth1 ip6 daddr @blocked6 drop",
+		"nft add rule bridge l2b-peers-veth1 forward oifname veth1 ip6 saddr @blocked6 drop",
+		"nft delete table bridge l2b-peers-veth1",
+	}
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands\n%v\ngot\n%v", want, *cmds)
+	}
+}
+
+func TestUpdatePeerPolicies(t *testing.T) {
+	// A and B list each other as peers, by id and by address; C has no policy and is listed by neither.
+	a := &bridgeEndpoint{id: "a", hostIfName: "vetha", addr: mustCIDR(t, "10.1.0.2/16"),
+		config: &endpointConfiguration{Peers: []string{"b"}}, peerPolicy: true}
+	b := &bridgeEndpoint{id: "b", hostIfName: "vethb", addr: mustCIDR(t, "10.1.0.3/16"),
+		config: &endpointConfiguration{Peers: []string{"10.1.0.2"}}, peerPolicy: true}
+	c := &bridgeEndpoint{id: "c", hostIfName: "vethc", addr: mustCIDR(t, "10.1.0.4/16"), addrv6: mustCIDR(t, "2001:db8::4/64"),
+		config: &endpointConfiguration{}}
+	n := &bridgeNetwork{endpoints: map[string]*bridgeEndpoint{"a": a, "b": b, "c": c}}
+
+	tests := []struct {
+		name  string
+		setup func()
+		want  []string
+	}{
+		{
+			name: "peers allowed, others dropped",
+			want: []string{
+				"nft add element bridge l2b-peers-vetha blocked4 { 10.1.0.4 }",
+				"nft add element bridge l2b-peers-vetha blocked6 { 2001:db8::4 }",
+				"nft add element bridge l2b-peers-vethb blocked4 { 10.1.0.4 }",
+				"nft add element bridge l2b-peers-vethb blocked6 { 2001:db8::4 }",
+				"nft flush set bridge l2b-peers-vetha blocked4",
+				"nft flush set bridge l2b-peers-vetha blocked6",
+				"nft flush set bridge l2b-peers-vethb blocked4",
+				"nft flush set bridge l2b-peers-vethb blocked6",
+			},
+		},
+		{
+			name:  "peer gone",
+			setup: func() { delete(n.endpoints, "c") },
+			want: []string{
+				"nft flush set bridge l2b-peers-vetha blocked4",
+				"nft flush set bridge l2b-peers-vetha blocked6",
+				"nft flush set bridge l2b-peers-vethb blocked4",
+				"nft flush set bridge l2b-peers-vethb blocked6",
+			},
+		},
+		{
+			name: "peer no longer listed",
+			setup: func() {
+				b.config.Peers = []string{"10.1.0.9"}
+			},
+			want: []string{
+				"nft add element bridge l2b-peers-vethb blocked4 { 10.1.0.2 }",
+				"nft flush set bridge l2b-peers-vetha blocked4",
+				"nft flush set bridge l2b-peers-vetha blocked6",
+				"nft flush set bridge l2b-peers-vethb blocked4",
+				"nft flush set bridge l2b-peers-vethb blocked6",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if tt.setup != nil {
+			tt.setup()
+		}
+		cmds := recordCommands(t)
+		n.updatePeerPolicies()
+		sort.Strings(*cmds)
+		if !equalStrings(*cmds, tt.want) {
+			t.Errorf("%s: expected commands\n%v\ngot\n%v", tt.name, tt.want, *cmds)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package l2bridge
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// portGroup is a named class of bridge ports sharing a guaranteed and a ceiling egress bandwidth, in bits per second.
+type portGroup struct {
+	Rate uint64
+	Ceil uint64
+}
+
+// rateUnits are the bandwidth suffixes understood by parseRate, as in tc.
+var rateUnits = []struct {
+	suffix string
+	scale  uint64
+}{
+	{"gbit", 1000 * 1000 * 1000},
+	{"mbit", 1000 * 1000},
+	{"kbit", 1000},
+	{"bit", 1},
+}
+
+// parseRate parses a bandwidth such as 100mbit into bits per second.
+func parseRate(s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	scale := uint64(1)
+	for _, u := range rateUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, scale = strings.TrimSuffix(s, u.suffix), u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	if n > math.MaxUint64/scale {
+		return 0, fmt.Errorf("rate %q is too large", s)
+	}
+	return n * scale, nil
+}
+
+// parsePortGroups parses a comma separated list of name=rate/ceil port group definitions. The groups share the
+// shaping of the network, capped at the largest of their ceilings, so their guaranteed rates may not sum to more.
+func parsePortGroups(s string) (map[string]portGroup, error) {
+	groups := make(map[string]portGroup)
+	var total, maxCeil uint64
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "=")
+		rates := strings.Split(parts[len(parts)-1], "/")
+		if len(parts) != 2 || parts[0] == "" || len(rates) != 2 {
+			return nil, fmt.Errorf("entry %q is not of the form name=rate/ceil", entry)
+		}
+		name := parts[0]
+		if _, ok := groups[name]; ok {
+			return nil, fmt.Errorf("port group %s is defined more than once", name)
+		}
+
+		rate, err := parseRate(rates[0])
+		if err != nil {
+			return nil, fmt.Errorf("entry %q has %w", entry, err)
+		}
+		ceil, err := parseRate(rates[1])
+		if err != nil {
+			return nil, fmt.Errorf("entry %q has %w", entry, err)
+		}
+		if rate > ceil {
+			return nil, fmt.Errorf("entry %q guarantees more bandwidth than its ceiling", entry)
+		}
+		if total+rate < total {
+			return nil, fmt.Errorf("the guaranteed rates of all port groups overflow")
+		}
+		total += rate
+		if ceil > maxCeil {
+			maxCeil = ceil
+		}
+
+		groups[name] = portGroup{Rate: rate, Ceil: ceil}
+	}
+	if total > maxCeil {
+		return nil, fmt.Errorf("the guaranteed rates of all port groups sum to %dbit, more than the largest ceiling of %dbit", total, maxCeil)
+	}
+	return groups, nil
+}
+
+// The classes of the shared port group shaping. The root class caps the traffic of all groups, each group has a
+// class under it, and each member endpoint a class under that of its group, among which the group's bandwidth is
+// shared fairly.
+const (
+	portGroupRootClass  = 1
+	portGroupFirstGroup = 0x10
+	portGroupFirstPort  = 0x1000
+	// portGroupPortRate is the rate guaranteed to a member, which borrows the rest from its group.
+	portGroupPortRate = "8kbit"
+	// portGroupQuantum is the bytes a member may send in turn when borrowing, a full frame.
+	portGroupQuantum = "1514"
+)
+
+// portGroupDevice is the name of the IFB device shaping the traffic the bridge sends to port group members.
+func portGroupDevice(nid string) string {
+	return "l2pg" + nid[:11]
+}
+
+func bitRate(bps uint64) string {
+	return strconv.FormatUint(bps, 10) + "bit"
+}
+
+func classID(minor int) string {
+	return fmt.Sprintf("1:%x", minor)
+}
+
+// portGroupNames returns the names of the groups in order.
+func portGroupNames(groups map[string]portGroup) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// portGroupClasses assigns each group its class, in the order of their names.
+func portGroupClasses(groups map[string]portGroup) map[string]int {
+	names := portGroupNames(groups)
+	classes := make(map[string]int, len(names))
+	for i, name := range names {
+		classes[name] = portGroupFirstGroup + i
+	}
+	return classes
+}
+
+// portGroupDeviceCmds are the tc commands installing the root and group classes on the device.
+func portGroupDeviceCmds(dev string, groups map[string]portGroup) [][]string {
+	var maxCeil uint64
+	for _, g := range groups {
+		if g.Ceil > maxCeil {
+			maxCeil = g.Ceil
+		}
+	}
+	cmds := [][]string{
+		{"qdisc", "replace", "dev", dev, "root", "handle", "1:", "htb"},
+		{"class", "replace", "dev", dev, "parent", "1:", "classid", classID(portGroupRootClass), "htb",
+			"rate", bitRate(maxCeil), "ceil", bitRate(maxCeil)},
+	}
+	classes := portGroupClasses(groups)
+	for _, name := range portGroupNames(groups) {
+		g := groups[name]
+		cmds = append(cmds, []string{"class", "replace", "dev", dev, "parent", classID(portGroupRootClass),
+			"classid", classID(classes[name]), "htb", "rate", bitRate(g.Rate), "ceil", bitRate(g.Ceil)})
+	}
+	return cmds
+}
+
+// portGroupMemberCmds are the tc commands placing the host interface of a member, with the given class, under the
+// class of its group: the member class is added on the device, and the interface redirects its egress there, marked
+// with the member class.
+func portGroupMemberCmds(ifName, dev string, groupClass, class int, group portGroup) [][]string {
+	return [][]string{
+		{"class", "replace", "dev", dev, "parent", classID(groupClass), "classid", classID(class), "htb",
+			"rate", portGroupPortRate, "ceil", bitRate(group.Ceil), "quantum", portGroupQuantum},
+		{"qdisc", "replace", "dev", ifName, "root", "handle", "1:", "prio"},
+		{"filter", "replace", "dev", ifName, "parent", "1:", "prio", "1", "protocol", "all", "u32", "match", "u32", "0", "0",
+			"action", "skbedit", "priority", classID(class),
+			"action", "mirred", "egress", "redirect", "dev", dev},
+	}
+}
+
+// setupPortGroups creates the device shaping the traffic sent to port group members, with a class for each group.
+func (n *bridgeNetwork) setupPortGroups(config *networkConfiguration, i *bridgeInterface) error {
+	dev := portGroupDevice(config.ID)
+	link, err := i.nlh.LinkByName(dev)
+	if err != nil {
+		if err := i.nlh.LinkAdd(&netlink.Ifb{LinkAttrs: netlink.LinkAttrs{Name: dev, TxQLen: 1000}}); err != nil {
+			return fmt.Errorf("failed to create port group device %s: %w", dev, err)
+		}
+		if link, err = i.nlh.LinkByName(dev); err != nil {
+			return fmt.Errorf("failed to find port group device %s: %w", dev, err)
+		}
+	}
+	if err := i.nlh.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to set port group device %s up: %w", dev, err)
+	}
+	for _, cmd := range portGroupDeviceCmds(dev, config.PortGroups) {
+		if err := tc(cmd...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePortGroups deletes the device created by setupPortGroups, and with it the classes of every group.
+func (n *bridgeNetwork) removePortGroups() {
+	dev := portGroupDevice(n.id)
+	link, err := n.driver.nlh.LinkByName(dev)
+	if err != nil {
+		return
+	}
+	err = n.driver.nlh.LinkDel(link)
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to delete port group device %s of network %s", dev, n.id)
+	}
+	n.driver.countRuleRemoval("tc", err)
+}
+
+// setupPortGroup places the endpoint under the class of its port group, so that the traffic the bridge sends it
+// shares the group's bandwidth with the other members. The endpoint is given a member class of its own.
+func (n *bridgeNetwork) setupPortGroup(ep *bridgeEndpoint, name string) error {
+	n.Lock()
+	group := n.config.PortGroups[name]
+	groupClass := portGroupClasses(n.config.PortGroups)[name]
+	if ep.portGroupClass == 0 {
+		used := make(map[int]bool)
+		for _, other := range n.endpoints {
+			used[other.portGroupClass] = true
+		}
+		for class := portGroupFirstPort; class <= 0xffff; class++ {
+			if !used[class] {
+				ep.portGroupClass = class
+				break
+			}
+		}
+	}
+	class := ep.portGroupClass
+	n.Unlock()
+	if class == 0 {
+		return fmt.Errorf("no class is left for port group members")
+	}
+
+	for _, cmd := range portGroupMemberCmds(ep.hostIfName, portGroupDevice(n.id), groupClass, class, group) {
+		if err := tc(cmd...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePortGroup removes the shaping installed by setupPortGroup, continuing past failures.
+func (n *bridgeNetwork) removePortGroup(ep *bridgeEndpoint) error {
+	n.Lock()
+	class := ep.portGroupClass
+	ep.portGroupClass = 0
+	n.Unlock()
+
+	err := tc("qdisc", "del", "dev", ep.hostIfName, "root", "handle", "1:")
+	if class != 0 {
+		if cerr := tc("class", "del", "dev", portGroupDevice(n.id), "classid", classID(class)); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
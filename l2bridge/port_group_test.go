@@ -0,0 +1,128 @@
+package l2bridge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+		err  bool
+	}{
+		{in: "100", want: 100},
+		{in: "100bit", want: 100},
+		{in: "10kbit", want: 10000},
+		{in: " 5Mbit ", want: 5000000},
+		{in: "1gbit", want: 1000000000},
+		{in: "0mbit", err: true},
+		{in: "fast", err: true},
+		{in: "-1kbit", err: true},
+		{in: "18446744073709551615kbit", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseRate(%q) = %d, %v; expected %d, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestParsePortGroups(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]portGroup
+		err  string
+	}{
+		{
+			in: "gold=600mbit/1gbit, silver=200mbit/500mbit",
+			want: map[string]portGroup{
+				"gold":   {Rate: 600000000, Ceil: 1000000000},
+				"silver": {Rate: 200000000, Ceil: 500000000},
+			},
+		},
+		{in: "", want: map[string]portGroup{}},
+		{in: "gold=1mbit", err: "not of the form"},
+		{in: "=1mbit/2mbit", err: "not of the form"},
+		{in: "gold=1mbit/2mbit,gold=1mbit/2mbit", err: "more than once"},
+		{in: "gold=2mbit/1mbit", err: "more bandwidth than its ceiling"},
+		{in: "gold=x/1mbit", err: "invalid rate"},
+		{in: "gold=600mbit/1gbit,silver=600mbit/1gbit", err: "more than the largest ceiling"},
+	}
+	for _, tt := range tests {
+		got, err := parsePortGroups(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parsePortGroups(%q): expected an error containing %q, got %v", tt.in, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePortGroups(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePortGroups(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPortGroupClassAssignment(t *testing.T) {
+	groups := map[string]portGroup{
+		"silver": {Rate: 200000000, Ceil: 500000000},
+		"gold":   {Rate: 600000000, Ceil: 1000000000},
+	}
+	classes := portGroupClasses(groups)
+	if want := map[string]int{"gold": 0x10, "silver": 0x11}; !reflect.DeepEqual(classes, want) {
+		t.Fatalf("expected group classes %v, got %v", want, classes)
+	}
+
+	dev := portGroupDevice(testID(1))
+	if len(dev) > 15 {
+		t.Errorf("device name %s is longer than an interface name may be", dev)
+	}
+	device := portGroupDeviceCmds(dev, groups)
+	want := [][]string{
+		{"qdisc", "replace", "dev", dev, "root", "handle", "1:", "htb"},
+		{"class", "replace", "dev", dev, "parent", "1:", "classid", "1:1", "htb", "rate", "1000000000bit", "ceil", "1000000000bit"},
+		{"class", "replace", "dev", dev, "parent", "1:1", "classid", "1:10", "htb", "rate", "600000000bit", "ceil", "1000000000bit"},
+		{"class", "replace", "dev", dev, "parent", "1:1", "classid", "1:11", "htb", "rate", "200000000bit", "ceil", "500000000bit"},
+	}
+	if !reflect.DeepEqual(device, want) {
+		t.Errorf("expected device commands\n%v\ngot\n%v", want, device)
+	}
+
+	tests := []struct {
+		ifName string
+		group  string
+		class  int
+		want   [][]string
+	}{
+		{
+			ifName: "veth1", group: "silver", class: 0x1000,
+			want: [][]string{
+				{"class", "replace", "dev", dev, "parent", "1:11", "classid", "1:1000", "htb", "rate", portGroupPortRate, "ceil", "500000000bit", "quantum", portGroupQuantum},
+				{"qdisc", "replace", "dev", "veth1", "root", "handle", "1:", "prio"},
+				{"filter", "replace", "dev", "veth1", "parent", "1:", "prio", "1", "protocol", "all", "u32", "match", "u32", "0", "0",
+					"action", "skbedit", "priority", "1:1000", "action", "mirred", "egress", "redirect", "dev", dev},
+			},
+		},
+		{
+			ifName: "veth2", group: "gold", class: 0x1001,
+			want: [][]string{
+				{"class", "replace", "dev", dev, "parent", "1:10", "classid", "1:1001", "htb", "rate", portGroupPortRate, "ceil", "1000000000bit", "quantum", portGroupQuantum},
+				{"qdisc", "replace", "dev", "veth2", "root", "handle", "1:", "prio"},
+				{"filter", "replace", "dev", "veth2", "parent", "1:", "prio", "1", "protocol", "all", "u32", "match", "u32", "0", "0",
+					"action", "skbedit", "priority", "1:1001", "action", "mirred", "egress", "redirect", "dev", dev},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got := portGroupMemberCmds(tt.ifName, dev, classes[tt.group], tt.class, groups[tt.group])
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("member %s of %s: expected commands\n%v\ngot\n%v", tt.ifName, tt.group, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/portallocator"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// parsePortBindings unpacks the opaque port bindings array passed by libnetwork.
+func parsePortBindings(in interface{}) ([]types.PortBinding, error) {
+	slice, ok := in.([]interface{})
+	if !ok {
+		return nil, &ErrInvalidPortBindingsOption{}
+	}
+
+	var out []types.PortBinding
+	for _, value := range slice {
+		dict, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, &ErrInvalidPortBindingsOption{}
+		}
+
+		proto, ok := dict["Proto"].(float64)
+		if !ok {
+			return nil, &ErrInvalidPortBindingsOption{}
+		}
+		port, ok := dict["Port"].(float64)
+		if !ok {
+			return nil, &ErrInvalidPortBindingsOption{}
+		}
+		pb := types.PortBinding{Proto: types.Protocol(proto), Port: uint16(port)}
+		if x, ok := dict["HostPort"].(float64); ok {
+			pb.HostPort = uint16(x)
+		}
+		if x, ok := dict["HostPortEnd"].(float64); ok {
+			pb.HostPortEnd = uint16(x)
+		}
+		if x, ok := dict["HostIP"].(string); ok && x != "" {
+			if pb.HostIP = net.ParseIP(x); pb.HostIP == nil {
+				return nil, &ErrInvalidPortBindingsOption{}
+			}
+		}
+		out = append(out, pb)
+	}
+	return out, nil
+}
+
+// portMappingRules are the rules forwarding the host port of the binding to the endpoint address it holds, from
+// outside the host and from the host itself, and accepting the forwarded traffic. They match the endpoint's address,
+// so that rules of other endpoints are unaffected.
+func portMappingRules(bridgeName string, pb types.PortBinding) []iptablesRule {
+	proto, hostPort := pb.Proto.String(), strconv.Itoa(int(pb.HostPort))
+	to := net.JoinHostPort(pb.IP.String(), strconv.Itoa(int(pb.Port)))
+	dst, dstLocal := []string{"-m", "addrtype", "--dst-type", "LOCAL"}, []string{"!", "-d", "127.0.0.0/8"}
+	if pb.HostIP != nil && !pb.HostIP.IsUnspecified() {
+		dst, dstLocal = []string{"-d", pb.HostIP.String()}, nil
+	}
+	dnat := func(dst ...string) []string {
+		args := append([]string{"-p", proto}, dst...)
+		return append(args, "--dport", hostPort, "-j", "DNAT", "--to-destination", to)
+	}
+	return []iptablesRule{
+		{iptables.Nat, "PREROUTING", dnat(dst...)},
+		{iptables.Nat, "OUTPUT", dnat(append(dst, dstLocal...)...)},
+		{iptables.Filter, "FORWARD", []string{"-o", bridgeName, "-d", pb.IP.String(), "-p", proto,
+			"--dport", strconv.Itoa(int(pb.Port)), "-j", "ACCEPT"}},
+	}
+}
+
+// reserveHostPort reserves the host port of the binding, picking the first free one if it asks for none or for a
+// range. A port a host process listens on is passed over, as the mapping would take its traffic.
+func reserveHostPort(pb *types.PortBinding) error {
+	start, end := int(pb.HostPort), int(pb.HostPortEnd)
+	if end < start {
+		end = start
+	}
+	proto, allocator := pb.Proto.String(), portallocator.Get()
+
+	var busy []int
+	defer func() {
+		for _, port := range busy {
+			allocator.ReleasePort(pb.HostIP, proto, port)
+		}
+	}()
+	for {
+		port, err := allocator.RequestPortInRange(pb.HostIP, proto, start, end)
+		if err != nil {
+			return err
+		}
+		if err := probeHostPort(pb.HostIP, proto, port); err != nil {
+			busy = append(busy, port)
+			if start != 0 && start == end {
+				return err
+			}
+			continue
+		}
+		pb.HostPort, pb.HostPortEnd = uint16(port), uint16(port)
+		return nil
+	}
+}
+
+// probeHostPort checks that no host process listens on the port, by binding it.
+func probeHostPort(ip net.IP, proto string, port int) error {
+	host := ""
+	if ip != nil {
+		host = ip.String()
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	switch proto {
+	case "tcp":
+		l, err := net.Listen("tcp4", addr)
+		if err != nil {
+			return err
+		}
+		return l.Close()
+	case "udp":
+		c, err := net.ListenPacket("udp4", addr)
+		if err != nil {
+			return err
+		}
+		return c.Close()
+	}
+	return nil
+}
+
+// programPortMapping publishes the bindings of the endpoint on the host's IPv4 addresses, reserving their host ports
+// and forwarding them to the endpoint. Bindings on an IPv6 host address are skipped with a warning, as the driver
+// only programs IPv4 NAT. Nothing is left published if it fails.
+func (n *bridgeNetwork) programPortMapping(ep *bridgeEndpoint, bindings []types.PortBinding) error {
+	n.Lock()
+	bridgeName := n.config.BridgeName
+	addr := ep.addr.IP
+	n.Unlock()
+
+	var mapped []types.PortBinding
+	for _, pb := range bindings {
+		if pb.HostIP != nil && pb.HostIP.To4() == nil {
+			logrus.Warnf("Skipping port binding %s of endpoint %s on an IPv6 host address, only IPv4 ports are published", pb.String(), ep.id)
+			continue
+		}
+		pb.IP = addr
+		if err := reserveHostPort(&pb); err != nil {
+			unpublishPorts(bridgeName, mapped)
+			return types.ForbiddenErrorf("failed to reserve host port of binding %s of endpoint %s: %v", pb.String(), ep.id, err)
+		}
+		rules := portMappingRules(bridgeName, pb)
+		for i, r := range rules {
+			if err := programRule(r.table, r.chain, iptables.Insert, r.args); err != nil {
+				for _, done := range rules[:i] {
+					programRule(done.table, done.chain, iptables.Delete, done.args)
+				}
+				portallocator.Get().ReleasePort(pb.HostIP, pb.Proto.String(), int(pb.HostPort))
+				unpublishPorts(bridgeName, mapped)
+				return internalErrorf("failed to publish port binding %s of endpoint %s: %v", pb.String(), ep.id, err)
+			}
+		}
+		mapped = append(mapped, pb)
+	}
+
+	n.Lock()
+	ep.portMapping = mapped
+	n.Unlock()
+	return nil
+}
+
+// unpublishPorts removes the rules of the bindings and releases their host ports.
+func unpublishPorts(bridgeName string, bindings []types.PortBinding) error {
+	var errs []string
+	for _, pb := range bindings {
+		for _, r := range portMappingRules(bridgeName, pb) {
+			if err := programRule(r.table, r.chain, iptables.Delete, r.args); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		portallocator.Get().ReleasePort(pb.HostIP, pb.Proto.String(), int(pb.HostPort))
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// revokePortMapping unpublishes the ports of the endpoint, if any. It is also used when tearing down endpoints of
+// which libnetwork never revoked external connectivity.
+func (n *bridgeNetwork) revokePortMapping(ep *bridgeEndpoint) error {
+	n.Lock()
+	bindings, bridgeName := ep.portMapping, n.config.BridgeName
+	ep.portMapping = nil
+	n.Unlock()
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	err := unpublishPorts(bridgeName, bindings)
+	n.driver.countRuleRemoval("iptables", err)
+	return err
+}
+
+// reservePortMapping reserves again the host ports published for a restored endpoint, which were held by the port
+// allocator of the previous driver process.
+func (ep *bridgeEndpoint) reservePortMapping() {
+	for _, pb := range ep.portMapping {
+		if _, err := portallocator.Get().RequestPort(pb.HostIP, pb.Proto.String(), int(pb.HostPort)); err != nil {
+			logrus.WithError(err).Warnf("Failed to reserve host port of restored binding %s of endpoint %s", pb.String(), ep.id)
+		}
+	}
+}
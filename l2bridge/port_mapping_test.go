@@ -0,0 +1,98 @@
+package l2bridge
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/docker/libnetwork/types"
+)
+
+func TestParsePortBindings(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want []types.PortBinding
+		err  bool
+	}{
+		{name: "empty", in: []interface{}{}},
+		{
+			name: "bindings",
+			in: []interface{}{
+				map[string]interface{}{"Proto": float64(types.TCP), "Port": float64(80), "HostPort": float64(8080)},
+				map[string]interface{}{"Proto": float64(types.UDP), "Port": float64(53), "HostIP": "10.0.0.1",
+					"HostPort": float64(5300), "HostPortEnd": float64(5310)},
+				map[string]interface{}{"Proto": float64(types.TCP), "Port": float64(443), "HostIP": ""},
+			},
+			want: []types.PortBinding{
+				{Proto: types.TCP, Port: 80, HostPort: 8080},
+				{Proto: types.UDP, Port: 53, HostIP: net.ParseIP("10.0.0.1"), HostPort: 5300, HostPortEnd: 5310},
+				{Proto: types.TCP, Port: 443},
+			},
+		},
+		{name: "not a list", in: map[string]interface{}{}, err: true},
+		{name: "not a binding", in: []interface{}{"80/tcp"}, err: true},
+		{name: "no proto", in: []interface{}{map[string]interface{}{"Port": float64(80)}}, err: true},
+		{name: "no port", in: []interface{}{map[string]interface{}{"Proto": float64(types.TCP)}}, err: true},
+		{name: "invalid host ip", in: []interface{}{
+			map[string]interface{}{"Proto": float64(types.TCP), "Port": float64(80), "HostIP": "localhost"}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePortBindings(tt.in)
+			if tt.err {
+				if _, ok := err.(*ErrInvalidPortBindingsOption); !ok {
+					t.Fatalf("expected an ErrInvalidPortBindingsOption, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPortMappingRules(t *testing.T) {
+	tcp := types.PortBinding{Proto: types.TCP, IP: net.ParseIP("10.1.0.2"), Port: 80, HostPort: 8080}
+	udp := types.PortBinding{Proto: types.UDP, IP: net.ParseIP("10.1.0.3"), Port: 53, HostIP: net.ParseIP("192.0.2.1"), HostPort: 5300}
+	tests := []struct {
+		name string
+		pb   types.PortBinding
+		want []iptablesRule
+	}{
+		{
+			name: "any host address",
+			pb:   tcp,
+			want: []iptablesRule{
+				{iptables.Nat, "PREROUTING", []string{"-p", "tcp", "-m", "addrtype", "--dst-type", "LOCAL",
+					"--dport", "8080", "-j", "DNAT", "--to-destination", "10.1.0.2:80"}},
+				{iptables.Nat, "OUTPUT", []string{"-p", "tcp", "-m", "addrtype", "--dst-type", "LOCAL", "!", "-d", "127.0.0.0/8",
+					"--dport", "8080", "-j", "DNAT", "--to-destination", "10.1.0.2:80"}},
+				{iptables.Filter, "FORWARD", []string{"-o", "br0", "-d", "10.1.0.2", "-p", "tcp", "--dport", "80", "-j", "ACCEPT"}},
+			},
+		},
+		{
+			name: "host address",
+			pb:   udp,
+			want: []iptablesRule{
+				{iptables.Nat, "PREROUTING", []string{"-p", "udp", "-d", "192.0.2.1",
+					"--dport", "5300", "-j", "DNAT", "--to-destination", "10.1.0.3:53"}},
+				{iptables.Nat, "OUTPUT", []string{"-p", "udp", "-d", "192.0.2.1",
+					"--dport", "5300", "-j", "DNAT", "--to-destination", "10.1.0.3:53"}},
+				{iptables.Filter, "FORWARD", []string{"-o", "br0", "-d", "10.1.0.3", "-p", "udp", "--dport", "53", "-j", "ACCEPT"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := portMappingRules("br0", tt.pb); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected rules\n%v\ngot\n%v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package l2bridge
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// setupPromisc puts the bridge, and the network's uplink, in promiscuous mode. The kernel counts promiscuity, so the
+// uplink is only switched once and switched back when it is released.
+func (n *bridgeNetwork) setupPromisc(config *networkConfiguration, i *bridgeInterface) error {
+	if err := i.nlh.SetPromiscOn(i.Link); err != nil {
+		return fmt.Errorf("failed to set bridge %s promiscuous: %w", config.BridgeName, err)
+	}
+	if n.uplinkPort == "" || n.uplinkPromisc {
+		return nil
+	}
+	link, err := i.nlh.LinkByName(n.uplinkPort)
+	if err != nil {
+		return fmt.Errorf("could not find uplink %s: %w", n.uplinkPort, err)
+	}
+	if err := i.nlh.SetPromiscOn(link); err != nil {
+		return fmt.Errorf("failed to set uplink %s promiscuous: %w", n.uplinkPort, err)
+	}
+	n.uplinkPromisc = true
+	return nil
+}
+
+// releasePromisc undoes setupPromisc on the given uplink.
+func (n *bridgeNetwork) releasePromisc(nlh NetlinkHandle, link netlink.Link) {
+	if !n.uplinkPromisc {
+		return
+	}
+	if err := nlh.SetPromiscOff(link); err != nil {
+		logrus.WithError(err).Warnf("Failed to clear promiscuous mode of uplink %s", link.Attrs().Name)
+		return
+	}
+	n.uplinkPromisc = false
+}
+
+// portLearning returns whether the endpoint's bridge port learns source MACs, as set on the endpoint or else on the
+// network, or nil to leave the kernel default.
+func (n *bridgeNetwork) portLearning(ep *bridgeEndpoint) *bool {
+	if ep.config != nil && ep.config.Learning != nil {
+		return ep.config.Learning
+	}
+	return n.config.Learning
+}
+
+// reportLinkFlags adds the effective promiscuous mode of the bridge and MAC learning of the endpoint's port to the
+// endpoint info.
+func (n *bridgeNetwork) reportLinkFlags(nlh NetlinkHandle, ep *bridgeEndpoint, m map[string]string) {
+	if nlh == nil {
+		return
+	}
+	if br, err := nlh.LinkByName(n.config.BridgeName); err == nil {
+		m[label.Promisc] = strconv.FormatBool(br.Attrs().Promisc != 0)
+	}
+	if host, err := nlh.LinkByName(ep.hostIfName); err == nil {
+		if pi, err := nlh.LinkGetProtinfo(host); err == nil {
+			m[label.Learning] = strconv.FormatBool(pi.Learning)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package l2bridge
+
+import (
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// maxReapInterval bounds how long the reaper waits between scans for vanished endpoints.
+const maxReapInterval = 30 * time.Second
+
+// Metrics describing endpoints reclaimed by the reaper.
+const (
+	metricReapedEndpoints = "l2bridge_reaped_endpoints_total"
+	metricReapedAddresses = "l2bridge_reaped_addresses_total"
+)
+
+func registerReaperMetrics(r *metricsRegistry) {
+	r.register(metricReapedEndpoints, metricCounter, "Endpoints deleted by the reaper after their interface and sandbox vanished.")
+	r.register(metricReapedAddresses, metricCounter, "Addresses freed by the reaper, by family.", "family")
+}
+
+// startReaper periodically deletes endpoints whose host interface and sandbox have both been gone for the grace
+// period, as when a container is killed without libnetwork ever deleting its endpoint. It does nothing unless a
+// grace period is configured.
+func (d *bridgeDriver) startReaper() {
+	d.Lock()
+	grace := d.config.ReapGracePeriod
+	d.Unlock()
+	// The endpoints of a dry run never have a sandbox, and would all be reaped.
+	if grace <= 0 || d.dryRun() {
+		return
+	}
+
+	interval := grace / 2
+	if interval > maxReapInterval {
+		interval = maxReapInterval
+	}
+	go func() {
+		vanished := make(map[string]time.Time) // key: endpoint id, first seen vanished
+		for range time.Tick(interval) {
+			vanished = d.reap(vanished, grace, time.Now())
+		}
+	}()
+}
+
+// reap deletes the endpoints vanished for longer than the grace period, returning those still within it.
+func (d *bridgeDriver) reap(vanished map[string]time.Time, grace time.Duration, now time.Time) map[string]time.Time {
+	d.Lock()
+	nlh := d.nlh
+	d.Unlock()
+	if nlh == nil {
+		return vanished
+	}
+
+	type candidate struct {
+		n  *bridgeNetwork
+		ep *bridgeEndpoint
+	}
+	var candidates []candidate
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		for _, ep := range n.endpoints {
+			if !ep.adopted {
+				candidates = append(candidates, candidate{n, ep})
+			}
+		}
+		n.Unlock()
+	}
+
+	still := make(map[string]time.Time)
+	for _, c := range candidates {
+		if !d.endpointVanished(nlh, c.n, c.ep) {
+			continue
+		}
+		since, ok := vanished[c.ep.id]
+		if !ok {
+			since = now
+			logrus.Infof("Endpoint (%s) of network %s vanished, reclaiming it after %v", c.ep.id, c.n.id, grace)
+		}
+		if now.Sub(since) < grace {
+			still[c.ep.id] = since
+			continue
+		}
+		d.reapEndpoint(c.n, c.ep)
+	}
+	return still
+}
+
+// endpointVanished reports whether both the endpoint's host interface and its sandbox are gone.
+func (d *bridgeDriver) endpointVanished(nlh NetlinkHandle, n *bridgeNetwork, ep *bridgeEndpoint) bool {
+	n.Lock()
+	hostIfName, sandboxKey := ep.hostIfName, ep.sandboxKey
+	n.Unlock()
+
+	if hostIfName == "" {
+		return false
+	}
+	if _, err := nlh.LinkByName(hostIfName); err == nil {
+		return false
+	} else if _, ok := err.(netlink.LinkNotFoundError); !ok {
+		return false
+	}
+	if sandboxKey != "" {
+		if _, err := os.Stat(sandboxKey); !os.IsNotExist(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// reapEndpoint removes the state left by a vanished endpoint and deletes it, freeing its addresses.
+func (d *bridgeDriver) reapEndpoint(n *bridgeNetwork, ep *bridgeEndpoint) {
+	defer d.lockNetwork(n.id)()
+	n.Lock()
+	joined := ep.sandboxKey != ""
+	n.Unlock()
+	if joined {
+		n.leaveEndpoint(ep)
+	}
+	if err := d.deleteEndpoint(n.id, ep.id); err != nil {
+		logrus.WithError(err).Warnf("Failed to reclaim vanished endpoint (%s) of network %s", ep.id, n.id)
+		return
+	}
+
+	d.metrics.inc(metricReapedEndpoints)
+	for _, ip := range ep.addresses() {
+		family := "ipv6"
+		if ip.To4() != nil {
+			family = "ipv4"
+		}
+		d.metrics.inc(metricReapedAddresses, "family", family)
+		logrus.Infof("Reclaimed address %s of vanished endpoint (%s) on network %s", ip, ep.id, n.id)
+	}
+}
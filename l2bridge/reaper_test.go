@@ -0,0 +1,114 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReap(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	newDualStackNetwork(t, d, testID(1))
+	dir := t.TempDir()
+	liveSandbox := filepath.Join(dir, "live")
+	if err := ioutil.WriteFile(liveSandbox, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+
+	// Endpoints by id: 2 vanished with its sandbox, 3 never joined and vanished, 4 still has its interface, 5 lost
+	// its interface but not its sandbox, and 6 vanished but was adopted and awaits its sandbox.
+	tests := []struct {
+		eid        int
+		sandboxKey string
+		linkGone   bool
+		adopted    bool
+		reaped     bool
+	}{
+		{eid: 2, sandboxKey: filepath.Join(dir, "gone"), linkGone: true, reaped: true},
+		{eid: 3, linkGone: true, reaped: true},
+		{eid: 4, sandboxKey: filepath.Join(dir, "gone")},
+		{eid: 5, sandboxKey: liveSandbox, linkGone: true},
+		{eid: 6, linkGone: true, adopted: true},
+	}
+	for _, tt := range tests {
+		ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.1.0.%d/16", tt.eid)),
+			AddressIPv6: mustCIDR(t, fmt.Sprintf("2001:db8:1::%d/64", tt.eid))}
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(tt.eid), ei, nil); err != nil {
+			t.Fatal(err)
+		}
+		ep := n.endpoints[testID(tt.eid)]
+		ep.sandboxKey, ep.adopted = tt.sandboxKey, tt.adopted
+		if tt.linkGone {
+			link, err := d.nlh.LinkByName(ep.hostIfName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.nlh.LinkDel(link)
+		}
+	}
+	recordCommands(t)
+
+	grace := time.Minute
+	start := time.Now()
+	vanished := d.reap(map[string]time.Time{}, grace, start)
+	if len(vanished) != 2 || !vanished[testID(2)].Equal(start) || !vanished[testID(3)].Equal(start) {
+		t.Fatalf("expected endpoints 2 and 3 seen vanished, got %v", vanished)
+	}
+	vanished = d.reap(vanished, grace, start.Add(grace/2))
+	if len(vanished) != 2 || len(n.endpoints) != len(tests) {
+		t.Fatalf("expected no endpoint reaped within the grace period, got vanished %v", vanished)
+	}
+	if vanished = d.reap(vanished, grace, start.Add(grace)); len(vanished) != 0 {
+		t.Errorf("expected no endpoint left vanished, got %v", vanished)
+	}
+
+	for _, tt := range tests {
+		if _, ok := n.endpoints[testID(tt.eid)]; ok == tt.reaped {
+			t.Errorf("endpoint %d: expected reaped %v", tt.eid, tt.reaped)
+		}
+	}
+	if got := metricSample(d.metrics, metricReapedEndpoints); got != 2 {
+		t.Errorf("expected 2 endpoints reaped, got %v", got)
+	}
+	for _, family := range []string{"ipv4", "ipv6"} {
+		if got := metricSample(d.metrics, metricReapedAddresses, "family", family); got != 2 {
+			t.Errorf("expected 2 %s addresses reclaimed, got %v", family, got)
+		}
+	}
+}
+
+func TestReapForgetsReturningEndpoints(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.2/16")}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	link, err := d.nlh.LinkByName(n.endpoints[testID(2)].hostIfName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grace := time.Minute
+	start := time.Now()
+	d.nlh.LinkDel(link)
+	vanished := d.reap(map[string]time.Time{}, grace, start)
+	d.nlh.LinkAdd(link)
+	if vanished = d.reap(vanished, grace, start.Add(grace/2)); len(vanished) != 0 {
+		t.Fatalf("expected the returned endpoint forgotten, got %v", vanished)
+	}
+	d.nlh.LinkDel(link)
+	vanished = d.reap(vanished, grace, start.Add(grace))
+	if _, ok := n.endpoints[testID(2)]; !ok || !vanished[testID(2)].Equal(start.Add(grace)) {
+		t.Errorf("expected the grace period restarted once the endpoint vanished again, got %v", vanished)
+	}
+}
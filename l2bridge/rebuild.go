@@ -0,0 +1,126 @@
+package l2bridge
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/docker/libnetwork/osl"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// RebuildNetwork tears down and recreates the bridge of a single network from the driver state, then reattaches the
+// ports of the old bridge and the network's endpoints. Endpoint interfaces are left in place, so joined containers
+// only lose connectivity while the bridge is rebuilt.
+func (d *bridgeDriver) RebuildNetwork(nid string) error {
+	defer d.lockNetwork(nid)()
+	return d.rebuildNetwork(nid)
+}
+
+// rebuildNetwork rebuilds the bridge of a network, with the caller holding its network lock.
+func (d *bridgeDriver) rebuildNetwork(nid string) error {
+	defer osl.InitOSContext()()
+
+	d.configNetwork.Lock()
+	defer d.configNetwork.Unlock()
+
+	n, err := d.getNetwork(nid)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	config := n.config
+	log := logrus.WithField("network", nid)
+	if n.foreignBridge && n.bridge.exists() {
+		return types.ForbiddenErrorf("bridge %s of network %s was not created by the driver and is not rebuilt", config.BridgeName, nid)
+	}
+
+	var errs []string
+	fail := func(step string, err error) {
+		log.WithError(err).Warnf("Rebuild step failed: %s", step)
+		errs = append(errs, step+": "+err.Error())
+	}
+
+	// Remember every port of the old bridge, so that uplinks attached to it come back with the endpoints.
+	ports := make(map[string]bool)
+	for _, ep := range n.endpoints {
+		if ep.hostIfName != "" {
+			ports[ep.hostIfName] = true
+		}
+	}
+	if n.uplinkPort != "" {
+		if _, err := d.nlh.LinkByName(n.uplinkPort); err == nil {
+			ports[n.uplinkPort] = true
+		}
+	}
+	if links, err := d.nlh.LinkList(); err != nil {
+		fail("list bridge ports", err)
+	} else if n.bridge.exists() {
+		for _, l := range links {
+			if l.Attrs().MasterIndex == n.bridge.Link.Attrs().Index {
+				ports[l.Attrs().Name] = true
+			}
+		}
+	}
+	portNames := make([]string, 0, len(ports))
+	for port := range ports {
+		portNames = append(portNames, port)
+	}
+	sort.Strings(portNames)
+
+	log.Info("Removing iptables rules")
+	for _, cleanFunc := range n.iptCleanFuncs {
+		if err := cleanFunc(); err != nil {
+			fail("clean iptables rules", err)
+		}
+	}
+	n.iptCleanFuncs = nil
+
+	if n.bridge.exists() {
+		log.Infof("Deleting bridge %s", config.BridgeName)
+		n.removeStaticFDB()
+		if err := d.nlh.LinkDel(n.bridge.Link); err != nil {
+			fail("delete bridge", err)
+		} else {
+			d.markTearingDown(config.BridgeName)
+		}
+	}
+	if err := d.waitTeardown(config.BridgeName); err != nil {
+		return err
+	}
+
+	log.Infof("Recreating bridge %s with ports %s", config.BridgeName, strings.Join(portNames, ","))
+	bridgeIface, err := newInterface(d.nlh, config)
+	if err != nil {
+		return err
+	}
+	n.bridge = bridgeIface
+	if err := d.setupNetworkBridge(n, portNames); err != nil {
+		return internalErrorf("failed to recreate bridge of network %s: %v", nid, err)
+	}
+
+	log.Info("Restoring endpoint state")
+	for _, ep := range n.endpoints {
+		host, err := d.nlh.LinkByName(ep.hostIfName)
+		if err != nil {
+			fail("find interface of endpoint "+ep.id, err)
+			continue
+		}
+		if err := setHairpinMode(d.nlh, host, true); err != nil {
+			fail("set hairpin mode of endpoint "+ep.id, err)
+		}
+		if ep.sandboxKey != "" && config.ProxyNDP && ep.addrv6 != nil && ep.config.wantsIPv6() {
+			if err := n.bridge.addProxyNeighbor(ep.addrv6.IP); err != nil {
+				fail("add proxy neighbor of endpoint "+ep.id, err)
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return types.InternalErrorf("rebuilt network %s with errors: %s", nid, strings.Join(errs, "; "))
+	}
+	log.Info("Rebuilt network")
+	return nil
+}
@@ -0,0 +1,146 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// fakeSysctls replaces the kernel parameters the setup steps change with an in-memory table, for the test.
+func fakeSysctls(t *testing.T) map[string]string {
+	var mu sync.Mutex
+	params := make(map[string]string)
+	read, write := readSysctl, writeSysctl
+	readSysctl = func(path string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if v, ok := params[path]; ok {
+			return []byte(v), nil
+		}
+		return []byte("0\n"), nil
+	}
+	writeSysctl = func(path string, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		params[path] = string(data)
+		return nil
+	}
+	t.Cleanup(func() { readSysctl, writeSysctl = read, write })
+	return params
+}
+
+// masterTestHandle is a dry run handle recording the links deleted and the master each port is set to.
+type masterTestHandle struct {
+	*dryRunHandle
+	deleted  []string
+	enslaved map[string]string // key: port name
+	hairpin  []string
+}
+
+func (h *masterTestHandle) LinkDel(link netlink.Link) error {
+	h.deleted = append(h.deleted, link.Attrs().Name)
+	return h.dryRunHandle.LinkDel(link)
+}
+
+func (h *masterTestHandle) LinkSetMaster(link netlink.Link, master *netlink.Bridge) error {
+	h.enslaved[link.Attrs().Name] = master.Name
+	return nil
+}
+
+func (h *masterTestHandle) LinkSetHairpin(link netlink.Link, mode bool) error {
+	if mode {
+		h.hairpin = append(h.hairpin, link.Attrs().Name)
+	}
+	return nil
+}
+
+func TestRebuildNetwork(t *testing.T) {
+	sysctls := fakeSysctls(t)
+	d := newDryRunDriver()
+	ctx := context.Background()
+	if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, eid := range []int{2, 3} {
+		ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, byte(eid)).To4(), Mask: net.CIDRMask(16, 32)}}
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(eid), ei, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, _ := d.getNetwork(testID(1))
+	bridgeName := n.config.BridgeName
+	veths := []string{n.endpoints[testID(2)].hostIfName, n.endpoints[testID(3)].hostIfName}
+	sort.Strings(veths)
+
+	// The bridge lost one endpoint port, while an uplink the host attached remains enslaved.
+	h := &masterTestHandle{dryRunHandle: d.nlh.(*dryRunHandle), enslaved: make(map[string]string)}
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: bridgeName, Index: 10}}
+	h.LinkAdd(bridge)
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 11, MasterIndex: 10}})
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 12, MasterIndex: 20}})
+	links, _ := h.LinkList()
+	for _, l := range links {
+		if l.Attrs().Name == veths[0] {
+			l.Attrs().MasterIndex = 10
+		}
+	}
+	d.nlh = h
+	n.bridge = &bridgeInterface{Link: bridge, nlh: h}
+	d.config.DryRun = false
+	d.config.EnableIPTables = false
+	d.config.DataRoot = t.TempDir()
+
+	if err := d.RebuildNetwork(testID(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !equalStrings(h.deleted, []string{bridgeName}) {
+		t.Errorf("expected bridge %s deleted, got %v", bridgeName, h.deleted)
+	}
+	if _, err := h.LinkByName(bridgeName); err != nil {
+		t.Errorf("expected bridge %s recreated: %v", bridgeName, err)
+	}
+	want := map[string]string{veths[0]: bridgeName, veths[1]: bridgeName, "eth1": bridgeName}
+	if len(h.enslaved) != len(want) {
+		t.Errorf("expected %v enslaved, got %v", want, h.enslaved)
+	}
+	for port, master := range want {
+		if h.enslaved[port] != master {
+			t.Errorf("expected %s reattached to %s, got %q", port, master, h.enslaved[port])
+		}
+	}
+	sort.Strings(h.hairpin)
+	if !equalStrings(h.hairpin, veths) {
+		t.Errorf("expected hairpin mode restored on %v, got %v", veths, h.hairpin)
+	}
+	if path := "/proc/sys/net/ipv6/conf/" + bridgeName + "/disable_ipv6"; sysctls[path] != "1\n" {
+		t.Errorf("expected IPv6 disabled on the recreated bridge, got %q", sysctls[path])
+	}
+	if n.bridge.Link == bridge {
+		t.Error("expected the network to hold the recreated bridge")
+	}
+}
+
+func TestRebuildNetworkRejected(t *testing.T) {
+	d := newDryRunDriver()
+	if err := d.RebuildNetwork(testID(9)); err == nil {
+		t.Error("expected rebuilding a missing network to fail")
+	}
+
+	if err := d.CreateNetwork(context.Background(), testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	n.foreignBridge = true
+	n.bridge.Link = &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br-host", Index: 10}}
+	if err := d.RebuildNetwork(testID(1)); err == nil {
+		t.Error("expected rebuilding a bridge the driver did not create to fail")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Errorf("expected a ForbiddenError, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package l2bridge
+
+import (
+	"sort"
+
+	"github.com/docker/libnetwork/ns"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// ownedLinkAlias is the alias given to the bridges and veths the driver creates, telling them apart from links
+// created by others which follow the same naming scheme, such as the bridges of the Docker bridge driver.
+const ownedLinkAlias = "l2bridge"
+
+// ReconcileSummary describes the orphaned links and FDB entries removed by Reconcile, or only found with LogOnly.
+type ReconcileSummary struct {
+	Bridges []string `json:"bridges"`
+	Veths   []string `json:"veths"`
+	// FDB are the static FDB entries of endpoints dropped while joined, as mac@port.
+	FDB []string `json:"fdb"`
+	// Errors are the failures to remove an orphaned link, which is retried on the next pass.
+	Errors []string `json:"errors,omitempty"`
+	// LogOnly is set when the orphans listed were only logged and left in place, as with NoCleanup.
+	LogOnly bool `json:"log_only,omitempty"`
+}
+
+// Reconcile deletes the bridges and veths this driver created on the host which no known network or endpoint holds
+// any more, as left behind when the driver was stopped without the networks or endpoints being deleted. It is safe
+// to call periodically: links known to the driver, or created by others, are never touched. It also removes the static
+// FDB entries of endpoints dropped on restore while joined. With NoCleanup, or in a dry run, the orphans are only
+// logged.
+func (d *bridgeDriver) Reconcile() (*ReconcileSummary, error) {
+	return d.reconcile(d.cleanupDisabled())
+}
+
+// cleanupDisabled reports whether Reconcile must leave the orphans it finds in place.
+func (d *bridgeDriver) cleanupDisabled() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.config.NoCleanup || d.config.DryRun
+}
+
+// reconcileOnStart runs a Reconcile pass once the persisted state is restored, removing what an unclean shutdown left
+// behind. It is skipped if the state failed to restore, and only logs if persistence is disabled: in either case links
+// of networks Docker still has would look orphaned.
+func (d *bridgeDriver) reconcileOnStart() {
+	d.Lock()
+	restoreErr := d.restoreErr
+	d.Unlock()
+	if restoreErr != "" {
+		logrus.Warn("Skipping startup reconciliation, the driver state failed to restore")
+		return
+	}
+
+	summary, err := d.reconcile(d.cleanupDisabled() || d.storePath() == "")
+	d.recordReconcile(summary, err)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to reconcile the host on startup")
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"bridges":  len(summary.Bridges),
+		"veths":    len(summary.Veths),
+		"fdb":      len(summary.FDB),
+		"errors":   len(summary.Errors),
+		"log_only": summary.LogOnly,
+	}).Info("Reconciled the host on startup")
+}
+
+// reconcile is Reconcile, only logging the orphans found if logOnly is set.
+func (d *bridgeDriver) reconcile(logOnly bool) (*ReconcileSummary, error) {
+	// Networks are created and deleted holding configNetwork, so none can be half made while links are listed.
+	d.configNetwork.Lock()
+	defer d.configNetwork.Unlock()
+
+	d.Lock()
+	if d.nlh == nil {
+		d.nlh = newMeteredHandle(ns.NlHandle(), d.metrics)
+	}
+	nlh := d.nlh
+	known := make(map[string]bool)
+	for name := range d.tearingDown {
+		known[name] = true
+	}
+	d.Unlock()
+
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		known[n.config.BridgeName] = true
+		for _, ep := range n.endpoints {
+			known[ep.hostIfName] = true
+			known[ep.srcName] = true
+		}
+		n.Unlock()
+	}
+
+	links, err := nlh.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ReconcileSummary{Bridges: []string{}, Veths: []string{}, FDB: []string{}, LogOnly: logOnly}
+	sort.Slice(links, func(i, j int) bool { return links[i].Attrs().Name < links[j].Attrs().Name })
+	for _, link := range links {
+		name := link.Attrs().Name
+		if link.Attrs().Alias != ownedLinkAlias || known[name] {
+			continue
+		}
+		kind := link.Type()
+		if kind != "bridge" && kind != "veth" {
+			continue
+		}
+
+		if logOnly {
+			logrus.Infof("Found orphaned %s %s, leaving it in place", kind, name)
+		} else if err := nlh.LinkDel(link); err != nil {
+			logrus.WithError(err).Warnf("Failed to delete orphaned %s %s", kind, name)
+			summary.Errors = append(summary.Errors, name+": "+err.Error())
+			continue
+		} else {
+			logrus.Infof("Deleted orphaned %s %s", kind, name)
+		}
+		if kind == "bridge" {
+			summary.Bridges = append(summary.Bridges, name)
+		} else {
+			summary.Veths = append(summary.Veths, name)
+			// Deleting one end of a veth pair deletes the other, so the pair is listed once.
+			known[vethPeerName(links, link.Attrs().Index)] = true
+		}
+	}
+
+	removed, failed := d.removeOrphanedFDB(nlh, logOnly)
+	summary.FDB = append(summary.FDB, removed...)
+	summary.Errors = append(summary.Errors, failed...)
+	return summary, nil
+}
+
+// vethPeerName returns the name of the listed link whose parent is the given veth, if any.
+func vethPeerName(links []netlink.Link, index int) string {
+	for _, l := range links {
+		if l.Attrs().ParentIndex == index {
+			return l.Attrs().Name
+		}
+	}
+	return ""
+}
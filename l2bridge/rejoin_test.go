@@ -0,0 +1,63 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestRejoin(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowRejoin bool
+		sandbox     string
+		forbidden   bool
+	}{
+		{name: "same sandbox", sandbox: "/sbox/a"},
+		{name: "other sandbox rejected", sandbox: "/sbox/b", forbidden: true},
+		{name: "other sandbox allowed", allowRejoin: true, sandbox: "/sbox/b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			var opts map[string]interface{}
+			if tt.allowRejoin {
+				opts = map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.AllowRejoin: "true"}}
+			}
+			if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, 2).To4(), Mask: net.CIDRMask(16, 32)}}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := d.Join(ctx, testID(1), testID(2), "/sbox/a", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := d.Join(ctx, testID(1), testID(2), tt.sandbox, nil)
+			n, _ := d.getNetwork(testID(1))
+			key := n.endpoints[testID(2)].sandboxKey
+			if tt.forbidden {
+				if _, ok := err.(types.ForbiddenError); !ok {
+					t.Fatalf("expected a ForbiddenError, got %v", err)
+				}
+				if key != "/sbox/a" {
+					t.Errorf("expected the endpoint to stay in /sbox/a, got %s", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != tt.sandbox {
+				t.Errorf("expected the endpoint in %s, got %s", tt.sandbox, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package l2bridge
+
+// Metrics describing the requests handled by the driver and the objects it tracks.
+const (
+	metricRequests  = "l2bridge_requests_total"
+	metricNetworks  = "l2bridge_networks"
+	metricEndpoints = "l2bridge_endpoints"
+)
+
+func registerRequestMetrics(r *metricsRegistry) {
+	r.register(metricRequests, metricCounter, "Driver requests handled, by method and outcome.", "method", "outcome")
+	r.register(metricNetworks, metricGauge, "Networks tracked by the driver.")
+	r.register(metricEndpoints, metricGauge, "Endpoints tracked by the driver.")
+}
+
+// countRequest counts a handled request as a success, or by the libnetwork class of the error it failed with.
+func (d *bridgeDriver) countRequest(method string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = errorClass(err)
+	}
+	d.metrics.inc(metricRequests, "method", method, "outcome", outcome)
+	d.updateObjectGauges()
+}
+
+// updateObjectGauges sets the gauges of the networks and endpoints tracked by the driver.
+func (d *bridgeDriver) updateObjectGauges() {
+	networks := d.getNetworks()
+	endpoints := 0
+	for _, n := range networks {
+		n.Lock()
+		endpoints += len(n.endpoints)
+		n.Unlock()
+	}
+	d.metrics.set(metricNetworks, float64(len(networks)))
+	d.metrics.set(metricEndpoints, float64(endpoints))
+}
@@ -0,0 +1,83 @@
+package l2bridge
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// addrRange is an inclusive range of addresses.
+type addrRange struct {
+	Start net.IP
+	End   net.IP
+}
+
+// contains reports whether ip falls within the range.
+func (r addrRange) contains(ip net.IP) bool {
+	ip = ip.To16()
+	return bytes.Compare(ip, r.Start.To16()) >= 0 && bytes.Compare(ip, r.End.To16()) <= 0
+}
+
+// within reports whether the whole range lies inside the given subnet.
+func (r addrRange) within(subnet *net.IPNet) bool {
+	return subnet != nil && subnet.Contains(r.Start) && subnet.Contains(r.End)
+}
+
+// withinAny reports whether the range lies entirely within one of the subnets.
+func (r addrRange) withinAny(subnets []*net.IPNet) bool {
+	for _, subnet := range subnets {
+		if r.within(subnet) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r addrRange) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// parseReservedRanges parses a comma separated list of CIDRs and start-end address ranges.
+func parseReservedRanges(s string) ([]addrRange, error) {
+	var ranges []addrRange
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if _, subnet, err := net.ParseCIDR(entry); err == nil {
+			end := make(net.IP, len(subnet.IP))
+			for i := range subnet.IP {
+				end[i] = subnet.IP[i] | ^subnet.Mask[i]
+			}
+			ranges = append(ranges, addrRange{Start: subnet.IP, End: end})
+			continue
+		}
+
+		parts := strings.Split(entry, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("entry %q is neither a CIDR nor a start-end range", entry)
+		}
+		start, end := net.ParseIP(strings.TrimSpace(parts[0])), net.ParseIP(strings.TrimSpace(parts[1]))
+		if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) {
+			return nil, fmt.Errorf("entry %q is not a range of addresses of one family", entry)
+		}
+		if bytes.Compare(start.To16(), end.To16()) > 0 {
+			return nil, fmt.Errorf("entry %q ends before it starts", entry)
+		}
+		ranges = append(ranges, addrRange{Start: start, End: end})
+	}
+	return ranges, nil
+}
+
+// reservedRange returns the reserved range holding ip, if any.
+func (c *networkConfiguration) reservedRange(ip net.IP) (addrRange, bool) {
+	for _, r := range c.Reserved {
+		if r.contains(ip) {
+			return r, true
+		}
+	}
+	return addrRange{}, false
+}
@@ -0,0 +1,134 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestParseReservedRanges(t *testing.T) {
+	r := func(start, end string) addrRange {
+		return addrRange{Start: net.ParseIP(start), End: net.ParseIP(end)}
+	}
+	tests := []struct {
+		in   string
+		want []addrRange
+		err  string
+	}{
+		{in: ""},
+		{in: "10.1.0.0/28", want: []addrRange{r("10.1.0.0", "10.1.0.15")}},
+		{in: "10.1.0.100-10.1.0.120", want: []addrRange{r("10.1.0.100", "10.1.0.120")}},
+		{in: " 10.1.0.0/28 , 10.1.0.100 - 10.1.0.120 ", want: []addrRange{r("10.1.0.0", "10.1.0.15"), r("10.1.0.100", "10.1.0.120")}},
+		{in: "2001:db8:1::/120", want: []addrRange{r("2001:db8:1::", "2001:db8:1::ff")}},
+		{in: "10.1.0.5-10.1.0.5", want: []addrRange{r("10.1.0.5", "10.1.0.5")}},
+		{in: "10.1.0.5", err: "neither a CIDR nor a start-end range"},
+		{in: "10.1.0.5-10.1.0.6-10.1.0.7", err: "neither a CIDR nor a start-end range"},
+		{in: "10.1.0.5-2001:db8::1", err: "one family"},
+		{in: "10.1.0.5-printer", err: "one family"},
+		{in: "10.1.0.20-10.1.0.10", err: "ends before it starts"},
+	}
+	for _, tt := range tests {
+		got, err := parseReservedRanges(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseReservedRanges(%q): expected an error containing %q, got %v", tt.in, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseReservedRanges(%q): %v", tt.in, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseReservedRanges(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// newReservedNetwork creates a dual stack network with the given ranges reserved on a dry run driver.
+func newReservedNetwork(t *testing.T, reserved string) (*bridgeDriver, error) {
+	d := newDryRunDriver()
+	d.ipv6Disabled = func() bool { return false }
+	opts := map[string]interface{}{
+		netlabel.EnableIPv6:  true,
+		netlabel.GenericData: map[string]interface{}{label.Reserved: reserved},
+	}
+	return d, d.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), testIPAMData(t, "2001:db8:1::/64"))
+}
+
+func TestReservedOutsidePools(t *testing.T) {
+	if _, err := newReservedNetwork(t, "10.2.0.0/28"); err == nil {
+		t.Fatal("expected a reserved range outside of the pools to be rejected")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Errorf("expected a BadRequestError, got %v", err)
+	}
+}
+
+func TestReservedAddressRequested(t *testing.T) {
+	d, err := newReservedNetwork(t, "10.1.0.0/28,2001:db8:1::100-2001:db8:1::1ff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		v4, v6    string
+		forbidden bool
+	}{
+		{name: "v4 free", v4: "10.1.0.16", v6: "2001:db8:1::10"},
+		{name: "v4 reserved", v4: "10.1.0.10", forbidden: true},
+		{name: "v6 reserved", v4: "10.1.0.17", v6: "2001:db8:1::180", forbidden: true},
+	}
+	for j, tt := range tests {
+		ei := &EndpointInterface{Address: &net.IPNet{IP: net.ParseIP(tt.v4).To4(), Mask: net.CIDRMask(16, 32)}}
+		if tt.v6 != "" {
+			ei.AddressIPv6 = &net.IPNet{IP: net.ParseIP(tt.v6), Mask: net.CIDRMask(64, 128)}
+		}
+		_, err := d.CreateEndpoint(context.Background(), testID(1), testID(2+j), ei, nil)
+		if !tt.forbidden {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if _, ok := err.(types.ForbiddenError); !ok {
+			t.Errorf("%s: expected a ForbiddenError, got %v", tt.name, err)
+		} else if !strings.Contains(err.Error(), "reserved range") {
+			t.Errorf("%s: expected the error to name the reserved range, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestReservedSkippedOnSelfGeneratedIPv6(t *testing.T) {
+	// Generated MACs start with 02:42, so half of the addresses derived from them fall in the range reserved here.
+	reserved := "2001:db8:1::242:0:0-2001:db8:1::242:7fff:ffff"
+	d, err := newReservedNetwork(t, reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, _ := parseReservedRanges(reserved)
+	for j := 0; j < 8; j++ {
+		ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 1, byte(j+1)).To4(), Mask: net.CIDRMask(16, 32)}}
+		out, err := d.CreateEndpoint(context.Background(), testID(1), testID(2+j), ei, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.AddressIPv6 == nil || ranges[0].contains(out.AddressIPv6.IP) {
+			t.Errorf("expected an IPv6 address outside of %s, got %v", reserved, out.AddressIPv6)
+		}
+	}
+
+	// A requested MAC cannot be changed to avoid the reserved range.
+	mac, _ := net.ParseMAC("02:42:00:00:00:01")
+	ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 2, 1).To4(), Mask: net.CIDRMask(16, 32)}, MacAddress: mac}
+	if _, err := d.CreateEndpoint(context.Background(), testID(1), testID(20), ei, nil); err == nil {
+		t.Error("expected an address derived from the requested MAC within the reserved range to be rejected")
+	} else if _, ok := err.(types.ForbiddenError); !ok {
+		t.Errorf("expected a ForbiddenError, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package l2bridge
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+)
+
+// setupBridgeIPv4 assigns the network's IPv4 gateway address to the bridge.
+func setupBridgeIPv4(config *networkConfiguration, i *bridgeInterface) error {
+	if err := i.nlh.AddrReplace(i.Link, &netlink.Addr{IPNet: config.BridgeIPv4}); err != nil {
+		return fmt.Errorf("failed to add IPv4 address %s to bridge: %w", config.BridgeIPv4, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package l2bridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+)
+
+func TestAssignGatewayToBridge(t *testing.T) {
+	tests := []struct {
+		name       string
+		labels     map[string]interface{}
+		v4, v6     string
+		badRequest bool
+	}{
+		{name: "default", v4: "10.1.0.1/16", v6: "2001:db8:1::1/64"},
+		{name: "true", labels: map[string]interface{}{label.AssignGatewayToBridge: "true"}, v4: "10.1.0.1/16", v6: "2001:db8:1::1/64"},
+		{name: "false", labels: map[string]interface{}{label.AssignGatewayToBridge: "false"}},
+		{name: "isolated host", labels: map[string]interface{}{label.IsolateHost: "true"}},
+		{name: "isolated host with gateway", labels: map[string]interface{}{label.IsolateHost: "true", label.AssignGatewayToBridge: "true"}, badRequest: true},
+		{name: "invalid", labels: map[string]interface{}{label.AssignGatewayToBridge: "maybe"}, badRequest: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			d.ipv6Disabled = func() bool { return false }
+			opts := map[string]interface{}{netlabel.EnableIPv6: true, netlabel.GenericData: tt.labels}
+			err := d.CreateNetwork(context.Background(), testID(1), opts, testIPAMData(t, "10.1.0.0/16"), testIPAMData(t, "2001:db8:1::/64"))
+			if tt.badRequest {
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, _ := d.getNetwork(testID(1))
+			if got := n.config.BridgeIPv4; (got == nil) != (tt.v4 == "") || got != nil && got.String() != tt.v4 {
+				t.Errorf("expected bridge IPv4 %q, got %v", tt.v4, got)
+			}
+			if got := n.config.BridgeIPv6; (got == nil) != (tt.v6 == "") || got != nil && got.String() != tt.v6 {
+				t.Errorf("expected bridge IPv6 %q, got %v", tt.v6, got)
+			}
+		})
+	}
+}
+
+func TestBridgeGatewayOverlap(t *testing.T) {
+	tests := []struct {
+		name      string
+		assign    string
+		forbidden bool
+	}{
+		{name: "both assign", assign: "true", forbidden: true},
+		{name: "second does not assign", assign: "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.AllowOverlap: "true"}}
+			if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			opts = map[string]interface{}{netlabel.GenericData: map[string]interface{}{
+				label.AllowOverlap: "true", label.AssignGatewayToBridge: tt.assign,
+			}}
+			err := d.CreateNetwork(ctx, testID(2), opts, testIPAMData(t, "10.1.0.0/16"), nil)
+			if !tt.forbidden {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if _, ok := err.(types.ForbiddenError); !ok {
+				t.Fatalf("expected a ForbiddenError, got %v", err)
+			}
+		})
+	}
+}
+
+// addrTestHandle is a dry run handle recording the addresses set on links, as address@link.
+type addrTestHandle struct {
+	*dryRunHandle
+	replaced []string
+}
+
+func (h *addrTestHandle) AddrReplace(link netlink.Link, addr *netlink.Addr) error {
+	h.replaced = append(h.replaced, addr.IPNet.String()+"@"+link.Attrs().Name)
+	return nil
+}
+
+func TestSetupBridgeIPv4(t *testing.T) {
+	h := &addrTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+	config := &networkConfiguration{BridgeIPv4: mustCIDR(t, "10.1.0.1/16")}
+	i := &bridgeInterface{Link: &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0"}}, nlh: h}
+	if err := setupBridgeIPv4(config, i); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.1.0.1/16@br0"}; !equalStrings(h.replaced, want) {
+		t.Errorf("expected %v, got %v", want, h.replaced)
+	}
+}
@@ -45,7 +45,7 @@ func setupBridgeNetFiltering(config *networkConfiguration, i *bridgeInterface) e
 			}
 		}
 		if err != nil {
-			return fmt.Errorf("cannot restrict inter-container communication: %v", err)
+			return fmt.Errorf("cannot restrict inter-container communication: %w", err)
 		}
 	}
 	return nil
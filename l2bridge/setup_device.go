@@ -2,6 +2,7 @@ package l2bridge
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/docker/docker/pkg/parsers/kernel"
 	"github.com/docker/libnetwork/netutils"
@@ -17,6 +18,7 @@ func setupDevice(config *networkConfiguration, i *bridgeInterface) error {
 	i.Link = &netlink.Bridge{
 		LinkAttrs: netlink.LinkAttrs{
 			Name: config.BridgeName,
+			MTU:  config.Mtu,
 		},
 	}
 
@@ -33,8 +35,16 @@ func setupDevice(config *networkConfiguration, i *bridgeInterface) error {
 		return err
 	}
 
+	// Mark the bridge as made by the driver, so that Reconcile may delete it once orphaned.
+	if err := i.nlh.LinkSetAlias(i.Link, ownedLinkAlias); err != nil {
+		logrus.WithError(err).Warnf("Failed to set alias of bridge %s", config.BridgeName)
+	}
+
 	if setMac {
 		hwAddr := netutils.GenerateRandomMAC()
+		if config.StableGatewayMAC {
+			hwAddr = gatewayMAC(config)
+		}
 		if err = i.nlh.LinkSetHardwareAddr(i.Link, hwAddr); err != nil {
 			return fmt.Errorf("failed to set bridge mac-address %s : %s", hwAddr, err.Error())
 		}
@@ -43,11 +53,23 @@ func setupDevice(config *networkConfiguration, i *bridgeInterface) error {
 	return err
 }
 
+// gatewayMAC derives a MAC address from the network's default gateway, so that the bridge keeps the same address
+// across recreations and ARP caches for the gateway remain valid.
+func gatewayMAC(config *networkConfiguration) net.HardwareAddr {
+	if gw := config.DefaultGatewayIPv4; gw != nil {
+		return netutils.GenerateMACFromIP(gw)
+	}
+	if gw := config.DefaultGatewayIPv6; gw != nil {
+		return netutils.GenerateMACFromIP(gw[len(gw)-net.IPv4len:])
+	}
+	return netutils.GenerateRandomMAC()
+}
+
 // SetupDeviceUp ups the given bridge interface.
 func setupDeviceUp(config *networkConfiguration, i *bridgeInterface) error {
 	err := i.nlh.LinkSetUp(i.Link)
 	if err != nil {
-		return fmt.Errorf("failed to set link up for %s: %v", config.BridgeName, err)
+		return fmt.Errorf("failed to set link up for %s: %w", config.BridgeName, err)
 	}
 
 	// Attempt to update the bridge interface to refresh the flags status,
@@ -65,10 +87,10 @@ func setupDisableIPv6(config *networkConfiguration, i *bridgeInterface) error {
 	path := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/disable_ipv6", config.BridgeName)
 	enabled, err := getSysBoolParam(path)
 	if enabled || err != nil {
-		return fmt.Errorf("failed to read ipv6 autoconf value: %v", err)
+		return fmt.Errorf("failed to read ipv6 autoconf value: %w", err)
 	}
 	if err := setSysBoolParam(path, true); err != nil {
-		return fmt.Errorf("failed to disable ipv6 autoconf: %v", err)
+		return fmt.Errorf("failed to disable ipv6 autoconf: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,113 @@
+package l2bridge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/libnetwork/iptables"
+)
+
+const (
+	hostIsolationAllowDHCP = "dhcp"
+	hostIsolationAllowND   = "nd"
+)
+
+// parseHostIsolationAllow parses a comma separated list of protocols permitted through host isolation.
+func parseHostIsolationAllow(s string) ([]string, error) {
+	var allow []string
+	for _, proto := range strings.Split(s, ",") {
+		switch proto = strings.TrimSpace(proto); proto {
+		case "":
+		case hostIsolationAllowDHCP, hostIsolationAllowND:
+			allow = append(allow, proto)
+		default:
+			return nil, fmt.Errorf("unknown protocol %q, expected %s or %s", proto, hostIsolationAllowDHCP, hostIsolationAllowND)
+		}
+	}
+	return allow, nil
+}
+
+func (n *bridgeNetwork) setupHostIsolation(config *networkConfiguration, i *bridgeInterface) error {
+	if err := setHostIsolation(config, true); err != nil {
+		return fmt.Errorf("failed to setup host isolation: %w", err)
+	}
+	n.registerIptCleanFunc(func() error {
+		return setHostIsolation(config, false)
+	})
+	return nil
+}
+
+// setHostIsolation adds or removes rules dropping traffic arriving from the bridge and destined to the host itself,
+// depending on whether enable is true or false respectively. Bridged traffic between endpoints is not affected.
+func setHostIsolation(config *networkConfiguration, enable bool) error {
+	v4rules, v6rules := hostIsolationRules(config)
+	if !enable {
+		// Remove the exceptions before the drop rule, the reverse of installation.
+		reverseRules(v4rules)
+		reverseRules(v6rules)
+	}
+
+	action := iptables.Insert
+	if !enable {
+		action = iptables.Delete
+	}
+	for _, rule := range v4rules {
+		if err := iptables.ProgramRule(iptables.Filter, "INPUT", action, rule); err != nil {
+			return err
+		}
+	}
+	if config.EnableIPv6 {
+		for _, rule := range v6rules {
+			if err := programIP6Rule("INPUT", action, rule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hostIsolationRules gives the IPv4 and IPv6 INPUT chain rules isolating the host from the bridge, in the order
+// they are inserted.
+func hostIsolationRules(config *networkConfiguration) (v4rules, v6rules [][]string) {
+	var (
+		br      = config.BridgeName
+		allowed = map[string]bool{}
+	)
+	for _, proto := range config.IsolateHostAllow {
+		allowed[proto] = true
+	}
+
+	// Rules are inserted at the top of the chain, so the drop rule comes first and the exceptions go above it.
+	v4rules = [][]string{{"-i", br, "-j", "DROP"}}
+	if allowed[hostIsolationAllowDHCP] {
+		v4rules = append(v4rules, []string{"-i", br, "-p", "udp", "--dport", "67", "-j", "ACCEPT"})
+	}
+	v6rules = [][]string{{"-i", br, "-j", "DROP"}}
+	if allowed[hostIsolationAllowND] {
+		for _, icmpType := range []string{"router-solicitation", "neighbour-solicitation", "neighbour-advertisement"} {
+			v6rules = append(v6rules, []string{"-i", br, "-p", "ipv6-icmp", "--icmpv6-type", icmpType, "-j", "ACCEPT"})
+		}
+	}
+	return v4rules, v6rules
+}
+
+func reverseRules(rules [][]string) {
+	for i, j := 0, len(rules)-1; i < j; i, j = i+1, j-1 {
+		rules[i], rules[j] = rules[j], rules[i]
+	}
+}
+
+// programIP6Rule adds the rule to the ip6tables filter table if not already present, or removes it if present.
+// The iptables package only manages IPv4 rules.
+func programIP6Rule(chain string, action iptables.Action, rule []string) error {
+	_, err := runCommand("ip6tables", append([]string{"-t", "filter", "-C", chain}, rule...)...)
+	exists := err == nil
+	if exists != (action == iptables.Delete) {
+		return nil
+	}
+	args := append([]string{"-t", "filter", string(action), chain}, rule...)
+	if out, err := runCommand("ip6tables", args...); err != nil {
+		return fmt.Errorf("ip6tables %s failed: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package l2bridge
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/iptables"
+)
+
+func TestParseHostIsolationAllow(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: ""},
+		{in: "dhcp", want: []string{"dhcp"}},
+		{in: " dhcp , nd ", want: []string{"dhcp", "nd"}},
+		{in: "dhcp,ssh", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHostIsolationAllow(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseHostIsolationAllow(%q): expected error %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHostIsolationAllow(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHostIsolationRules(t *testing.T) {
+	drop := []string{"-i", "br0", "-j", "DROP"}
+	dhcp := []string{"-i", "br0", "-p", "udp", "--dport", "67", "-j", "ACCEPT"}
+	nd := func(icmpType string) []string {
+		return []string{"-i", "br0", "-p", "ipv6-icmp", "--icmpv6-type", icmpType, "-j", "ACCEPT"}
+	}
+	tests := []struct {
+		name   string
+		allow  []string
+		v4, v6 [][]string
+	}{
+		{name: "drop all", v4: [][]string{drop}, v6: [][]string{drop}},
+		{name: "allow dhcp", allow: []string{"dhcp"}, v4: [][]string{drop, dhcp}, v6: [][]string{drop}},
+		{name: "allow nd", allow: []string{"nd"}, v4: [][]string{drop}, v6: [][]string{
+			drop, nd("router-solicitation"), nd("neighbour-solicitation"), nd("neighbour-advertisement"),
+		}},
+	}
+	for _, tt := range tests {
+		v4, v6 := hostIsolationRules(&networkConfiguration{BridgeName: "br0", IsolateHostAllow: tt.allow})
+		if !reflect.DeepEqual(v4, tt.v4) || !reflect.DeepEqual(v6, tt.v6) {
+			t.Errorf("%s: expected rules %v and %v, got %v and %v", tt.name, tt.v4, tt.v6, v4, v6)
+		}
+		// Only traffic the host receives from the bridge is matched: the rules sit in the INPUT chain, which bridged
+		// traffic between endpoints never traverses, and none may match another interface.
+		for _, rule := range append(v4, v6...) {
+			if rule[0] != "-i" || rule[1] != "br0" {
+				t.Errorf("%s: rule %v does not match only traffic arriving from the bridge", tt.name, rule)
+			}
+		}
+	}
+}
+
+func TestProgramIP6Rule(t *testing.T) {
+	rule := []string{"-i", "br0", "-j", "DROP"}
+	tests := []struct {
+		name   string
+		action iptables.Action
+		exists bool
+		want   []string
+	}{
+		{name: "insert", action: iptables.Insert, want: []string{
+			"ip6tables -t filter -C INPUT -i br0 -j DROP",
+			"ip6tables -t filter -I INPUT -i br0 -j DROP",
+		}},
+		{name: "insert present", action: iptables.Insert, exists: true, want: []string{
+			"ip6tables -t filter -C INPUT -i br0 -j DROP",
+		}},
+		{name: "delete", action: iptables.Delete, exists: true, want: []string{
+			"ip6tables -t filter -C INPUT -i br0 -j DROP",
+			"ip6tables -t filter -D INPUT -i br0 -j DROP",
+		}},
+		{name: "delete absent", action: iptables.Delete, want: []string{
+			"ip6tables -t filter -C INPUT -i br0 -j DROP",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cmds []string
+			orig := runCommand
+			runCommand = func(name string, args ...string) ([]byte, error) {
+				cmds = append(cmds, name+" "+strings.Join(args, " "))
+				if args[2] == "-C" && !tt.exists {
+					return nil, errors.New("exit status 1")
+				}
+				return nil, nil
+			}
+			defer func() { runCommand = orig }()
+
+			if err := programIP6Rule("INPUT", tt.action, rule); err != nil {
+				t.Fatal(err)
+			}
+			if !equalStrings(cmds, tt.want) {
+				t.Errorf("expected commands %v, got %v", tt.want, cmds)
+			}
+		})
+	}
+}
+
+func TestIsolateHostValidation(t *testing.T) {
+	yes := true
+	tests := []struct {
+		name   string
+		config networkConfiguration
+		err    bool
+		gw     bool
+	}{
+		{name: "isolated", config: networkConfiguration{BridgeName: "br0", IsolateHost: true}},
+		{name: "isolated holding the gateway", config: networkConfiguration{BridgeName: "br0", IsolateHost: true, AssignGatewayToBridge: &yes}, err: true},
+		{name: "not isolated", config: networkConfiguration{BridgeName: "br0"}, gw: true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+		}
+		if !tt.err && tt.config.assignsGateway() != tt.gw {
+			t.Errorf("%s: expected the bridge to hold the gateway %v", tt.name, tt.gw)
+		}
+	}
+}
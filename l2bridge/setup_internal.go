@@ -0,0 +1,47 @@
+package l2bridge
+
+import (
+	"fmt"
+
+	"github.com/docker/libnetwork/iptables"
+)
+
+// setupInternal enforces the isolation of an internal network, dropping traffic routed between its bridge and any
+// other interface. Traffic bridged between endpoints, and with the host itself, is not affected.
+func (n *bridgeNetwork) setupInternal(config *networkConfiguration, i *bridgeInterface) error {
+	if err := setInternal(config, true); err != nil {
+		return fmt.Errorf("failed to setup internal network isolation: %w", err)
+	}
+	n.registerIptCleanFunc(func() error {
+		return setInternal(config, false)
+	})
+	return nil
+}
+
+// setInternal adds or removes the rules dropping traffic forwarded into or out of the network's bridge, depending on
+// whether enable is true or false respectively.
+func setInternal(config *networkConfiguration, enable bool) error {
+	br := config.BridgeName
+	rules := [][]string{
+		{"-i", br, "!", "-o", br, "-j", "DROP"},
+		{"-o", br, "!", "-i", br, "-j", "DROP"},
+	}
+
+	action := iptables.Insert
+	if !enable {
+		action = iptables.Delete
+	}
+	for _, rule := range rules {
+		if err := iptables.ProgramRule(iptables.Filter, "FORWARD", action, rule); err != nil {
+			return err
+		}
+	}
+	if config.EnableIPv6 {
+		for _, rule := range rules {
+			if err := programIP6Rule("FORWARD", action, rule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -18,7 +18,7 @@ func (n *bridgeNetwork) setupIPTables(config *networkConfiguration, i *bridgeInt
 	}
 
 	if err := setLocalForwarding(config.BridgeName, true); err != nil {
-		return fmt.Errorf("failed to setup IP tables: %v", err)
+		return fmt.Errorf("failed to setup IP tables: %w", err)
 	}
 	n.registerIptCleanFunc(func() error {
 		return setLocalForwarding(config.BridgeName, false)
@@ -38,11 +38,11 @@ func setLocalForwarding(bridgeIface string, enable bool) error {
 
 	if enable {
 		if err := iptables.ProgramRule(table, chain, iptables.Append, rule); err != nil {
-			return fmt.Errorf("unable to setup bridge forwarding rule: %v", err)
+			return fmt.Errorf("unable to setup bridge forwarding rule: %w", err)
 		}
 	} else {
 		if err := iptables.ProgramRule(table, chain, iptables.Delete, rule); err != nil {
-			return fmt.Errorf("unable to cleanup bridge forwarding rule: %v", err)
+			return fmt.Errorf("unable to cleanup bridge forwarding rule: %w", err)
 		}
 	}
 	return nil
@@ -0,0 +1,24 @@
+package l2bridge
+
+import (
+	"fmt"
+)
+
+// setupIPv6Forwarding sets whether the bridge acts as an IPv6 router. Unless the network forwards IPv6, the bridge
+// neither forwards nor accepts router advertisements, so that the host does not route or autoconfigure on a segment
+// it only switches.
+func setupIPv6Forwarding(config *networkConfiguration, i *bridgeInterface) error {
+	forwarding, acceptRA := "0", "0"
+	if config.IPv6Forward {
+		// A forwarding interface ignores router advertisements unless accept_ra is 2.
+		forwarding, acceptRA = "1", "2"
+	}
+	for _, p := range []struct{ param, value string }{{"forwarding", forwarding}, {"accept_ra", acceptRA}} {
+		param, value := p.param, p.value
+		path := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/%s", config.BridgeName, param)
+		if err := writeSysctl(path, []byte(value+"\n")); err != nil {
+			return fmt.Errorf("failed to set ipv6 %s to %s: %w", param, value, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package l2bridge
+
+import (
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestSetupIPv6Forwarding(t *testing.T) {
+	tests := []struct {
+		forward              bool
+		forwarding, acceptRA string
+	}{
+		{forwarding: "0\n", acceptRA: "0\n"},
+		{forward: true, forwarding: "1\n", acceptRA: "2\n"},
+	}
+	for _, tt := range tests {
+		sysctls := fakeSysctls(t)
+		config := &networkConfiguration{BridgeName: "br0", EnableIPv6: true, IPv6Forward: tt.forward}
+		if err := setupIPv6Forwarding(config, &bridgeInterface{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := sysctls["/proc/sys/net/ipv6/conf/br0/forwarding"]; got != tt.forwarding {
+			t.Errorf("forward %v: expected forwarding %q, got %q", tt.forward, tt.forwarding, got)
+		}
+		if got := sysctls["/proc/sys/net/ipv6/conf/br0/accept_ra"]; got != tt.acceptRA {
+			t.Errorf("forward %v: expected accept_ra %q, got %q", tt.forward, tt.acceptRA, got)
+		}
+	}
+}
+
+func TestIPv6ForwardRequiresIPv6(t *testing.T) {
+	tests := []struct {
+		enableIPv6 bool
+		badRequest bool
+	}{
+		{enableIPv6: true},
+		{badRequest: true},
+	}
+	for _, tt := range tests {
+		c := &networkConfiguration{IPv6Forward: true, EnableIPv6: tt.enableIPv6}
+		err := c.Validate()
+		if _, ok := err.(types.BadRequestError); ok != tt.badRequest {
+			t.Errorf("IPv6 %v: expected bad request %v, got %v", tt.enableIPv6, tt.badRequest, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package l2bridge
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMTU is the MTU given to endpoint interfaces when the network sets none.
+const defaultMTU = 1500
+
+// setupNestedMTU clamps the network MTU to the MTU of the device the bridge is enslaved to, such as a VRF or
+// another bridge, so that endpoints never send frames larger than the parent can carry.
+func setupNestedMTU(config *networkConfiguration, i *bridgeInterface) error {
+	master := i.Link.Attrs().MasterIndex
+	if master == 0 {
+		return nil
+	}
+
+	parent, err := i.nlh.LinkByIndex(master)
+	if err != nil {
+		return fmt.Errorf("failed to look up parent device of bridge %s: %w", config.BridgeName, err)
+	}
+
+	mtu := config.Mtu
+	if mtu == 0 {
+		mtu = defaultMTU
+	}
+	if parentMTU := parent.Attrs().MTU; parentMTU > 0 && mtu > parentMTU {
+		logrus.Warnf("Clamping MTU of network %s from %d to %d, the MTU of %s which bridge %s is enslaved to",
+			config.ID, mtu, parentMTU, parent.Attrs().Name, config.BridgeName)
+		config.Mtu = parentMTU
+	}
+	return nil
+}
+
+// setupMTU applies the network MTU to a bridge which existed before the network, as only a bridge the driver creates is
+// given it by setupDevice. A foreign bridge is left as the host configured it. It also warns when the uplink has a
+// smaller MTU than the network, as the larger frames are dropped on their way out.
+func (n *bridgeNetwork) setupMTU(config *networkConfiguration, i *bridgeInterface) error {
+	if config.Mtu == 0 {
+		return nil
+	}
+
+	if mtu := i.Link.Attrs().MTU; mtu != config.Mtu {
+		if n.foreignBridge {
+			logrus.Warnf("Bridge %s of network %s has MTU %d rather than %d, it is left as the host configured it",
+				config.BridgeName, config.ID, mtu, config.Mtu)
+		} else if err := i.nlh.LinkSetMTU(i.Link, config.Mtu); err != nil {
+			return fmt.Errorf("failed to set MTU of bridge %s to %d: %w", config.BridgeName, config.Mtu, err)
+		}
+	}
+
+	if n.uplinkPort == "" {
+		return nil
+	}
+	if link, err := i.nlh.LinkByName(n.uplinkPort); err == nil && link.Attrs().MTU < config.Mtu {
+		logrus.Warnf("Uplink %s of network %s has MTU %d, smaller than the network MTU %d, so larger frames are dropped",
+			n.uplinkPort, config.ID, link.Attrs().MTU, config.Mtu)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package l2bridge
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestSetupNestedMTU(t *testing.T) {
+	tests := []struct {
+		name      string
+		master    int
+		parentMTU int
+		mtu       int
+		want      int
+		err       bool
+	}{
+		{name: "not nested", parentMTU: 1400, want: 0},
+		{name: "default above parent", master: 7, parentMTU: 1400, want: 1400},
+		{name: "configured above parent", master: 7, parentMTU: 1400, mtu: 9000, want: 1400},
+		{name: "configured below parent", master: 7, parentMTU: 9000, mtu: 1450, want: 1450},
+		{name: "default below parent", master: 7, parentMTU: 9000, want: 0},
+		{name: "parent without MTU", master: 7, mtu: 9000, want: 9000},
+		{name: "missing parent", master: 8, parentMTU: 1400, mtu: 9000, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &uplinkTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+			h.LinkAdd(&netlink.Vrf{LinkAttrs: netlink.LinkAttrs{Name: "vrf0", Index: 7, MTU: tt.parentMTU}})
+			bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0", Index: 1, MasterIndex: tt.master}}
+			h.LinkAdd(bridge)
+
+			config := &networkConfiguration{ID: testID(1), BridgeName: "br0", Mtu: tt.mtu}
+			err := setupNestedMTU(config, &bridgeInterface{Link: bridge, nlh: h})
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error for a parent device which cannot be found")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Mtu != tt.want {
+				t.Errorf("expected MTU %d, got %d", tt.want, config.Mtu)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// setupProxyNDP enables IPv6 neighbor discovery proxying on the bridge.
+func setupProxyNDP(config *networkConfiguration, i *bridgeInterface) error {
+	path := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/proxy_ndp", config.BridgeName)
+	if err := setSysBoolParam(path, true); err != nil {
+		return fmt.Errorf("failed to enable ipv6 ndp proxy: %w", err)
+	}
+	return nil
+}
+
+// proxyNeighbor returns the proxy neighbor entry on the bridge for the given address.
+func (i *bridgeInterface) proxyNeighbor(ip net.IP) *netlink.Neigh {
+	return &netlink.Neigh{
+		LinkIndex: i.Link.Attrs().Index,
+		Family:    netlink.FAMILY_V6,
+		Flags:     netlink.NTF_PROXY,
+		IP:        ip,
+	}
+}
+
+// addProxyNeighbor makes the bridge answer neighbor solicitations for the given address.
+func (i *bridgeInterface) addProxyNeighbor(ip net.IP) error {
+	return i.nlh.NeighAdd(i.proxyNeighbor(ip))
+}
+
+// delProxyNeighbor removes a proxy neighbor entry added by addProxyNeighbor.
+func (i *bridgeInterface) delProxyNeighbor(ip net.IP) error {
+	return i.nlh.NeighDel(i.proxyNeighbor(ip))
+}
@@ -0,0 +1,67 @@
+package l2bridge
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// neighTestHandle is a dry run handle recording the neighbor entries added and deleted.
+type neighTestHandle struct {
+	*dryRunHandle
+	added, deleted []*netlink.Neigh
+}
+
+func (h *neighTestHandle) NeighAdd(neigh *netlink.Neigh) error {
+	h.added = append(h.added, neigh)
+	return nil
+}
+
+func (h *neighTestHandle) NeighDel(neigh *netlink.Neigh) error {
+	h.deleted = append(h.deleted, neigh)
+	return nil
+}
+
+func TestProxyNeighbor(t *testing.T) {
+	h := &neighTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+	i := &bridgeInterface{Link: &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0", Index: 5}}, nlh: h}
+
+	addrs := []string{"2001:db8:1::2", "2001:db8:1::3"}
+	for _, addr := range addrs {
+		if err := i.addProxyNeighbor(net.ParseIP(addr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, addr := range addrs {
+		if err := i.delProxyNeighbor(net.ParseIP(addr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, entries := range map[string][]*netlink.Neigh{"added": h.added, "deleted": h.deleted} {
+		if len(entries) != len(addrs) {
+			t.Fatalf("expected %d entries %s, got %d", len(addrs), name, len(entries))
+		}
+		for j, neigh := range entries {
+			if neigh.LinkIndex != 5 || neigh.Family != netlink.FAMILY_V6 || neigh.Flags != netlink.NTF_PROXY {
+				t.Errorf("entry %s for %s is not a proxy entry on the bridge: %+v", name, addrs[j], neigh)
+			}
+			if !neigh.IP.Equal(net.ParseIP(addrs[j])) {
+				t.Errorf("expected entry %s for %s, got %s", name, addrs[j], neigh.IP)
+			}
+		}
+	}
+}
+
+func TestSetupProxyNDPSysctl(t *testing.T) {
+	// The bridge does not exist, so the write fails, naming the sysctl of the bridge it was meant for.
+	err := setupProxyNDP(&networkConfiguration{BridgeName: "l2b-test-none"}, nil)
+	if err == nil {
+		t.Fatal("expected enabling proxy NDP on a missing bridge to fail")
+	}
+	if want := "/proc/sys/net/ipv6/conf/l2b-test-none/proxy_ndp"; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the write to %s, got %v", want, err)
+	}
+}
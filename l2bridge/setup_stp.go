@@ -0,0 +1,29 @@
+package l2bridge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// stpStatePath is the sysfs attribute holding the STP state of the named bridge.
+func stpStatePath(bridgeName string) string {
+	return fmt.Sprintf("/sys/class/net/%s/bridge/stp_state", bridgeName)
+}
+
+// setupSTP enables the spanning tree protocol on the bridge.
+func setupSTP(config *networkConfiguration, i *bridgeInterface) error {
+	if err := setSysBoolParam(stpStatePath(config.BridgeName), true); err != nil {
+		return fmt.Errorf("failed to enable stp on bridge %s: %w", config.BridgeName, err)
+	}
+	return nil
+}
+
+// bridgeSTPState reports whether STP runs on the named bridge, either in the kernel or in a user space daemon.
+func bridgeSTPState(bridgeName string) (bool, error) {
+	state, err := ioutil.ReadFile(stpStatePath(bridgeName))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(state)) != "0", nil
+}
@@ -2,23 +2,64 @@ package l2bridge
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/docker/libnetwork/ns"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
 )
 
-func bridgeInterfaceExists(name string) (bool, error) {
-	nlh := ns.NlHandle()
-	link, err := nlh.LinkByName(name)
-	if err != nil {
-		if strings.Contains(err.Error(), "Link not found") {
-			return false, nil
+// validateBridgeName checks that a bridge name requested with l2bridge.name is one the kernel accepts. Beyond the
+// kernel's rules, only letters, digits and "-_." are allowed, keeping the name usable in iptables rules and paths.
+func validateBridgeName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("%q is not an interface name", name)
+	}
+	if len(name) > maxIfaceNameLen {
+		return fmt.Errorf("interface names are limited to %d characters", maxIfaceNameLen)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return fmt.Errorf("interface names may only contain letters, digits, '-', '_' and '.'")
+		}
+	}
+	return nil
+}
+
+// checkBridgeName rejects creating a network whose bridge name is taken, whether by another network or by a device
+// the driver did not create. A bridge the driver created and left behind, or is still tearing down, is taken over.
+// The caller must hold configNetwork.
+func (d *bridgeDriver) checkBridgeName(config *networkConfiguration) error {
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		other := n.config.BridgeName
+		n.Unlock()
+		if other == config.BridgeName {
+			return types.ForbiddenErrorf("bridge name %s is used by network %s", config.BridgeName, n.id)
 		}
-		return false, fmt.Errorf("failed to check bridge interface existence: %v", err)
 	}
 
-	if link.Type() == "bridge" {
-		return true, nil
+	d.Lock()
+	nlh, tearingDown := d.nlh, d.tearingDown[config.BridgeName]
+	d.Unlock()
+	if tearingDown {
+		return nil
+	}
+	if nlh == nil {
+		nlh = ns.NlHandle()
+	}
+
+	link, err := nlh.LinkByName(config.BridgeName)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("failed to check bridge interface existence: %w", err)
+	}
+	if link.Type() != "bridge" {
+		return types.BadRequestErrorf("bridge name %s is taken by an existing non-bridge device of type %s", config.BridgeName, link.Type())
+	}
+	if link.Attrs().Alias != ownedLinkAlias {
+		return types.ForbiddenErrorf("bridge name %s is taken by a bridge not created by this driver", config.BridgeName)
 	}
-	return false, fmt.Errorf("existing interface %s is not a bridge", name)
+	return nil
 }
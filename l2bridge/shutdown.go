@@ -0,0 +1,102 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ShutdownMode selects what Shutdown does with the networks of the driver.
+type ShutdownMode string
+
+const (
+	// ShutdownLeave persists the driver state and leaves bridges and endpoints in place, so that containers keep
+	// their connectivity while the driver is down, as across an upgrade. It is the default.
+	ShutdownLeave ShutdownMode = "leave"
+	// ShutdownPurge deletes every network and endpoint of the driver, and everything it created for them.
+	ShutdownPurge ShutdownMode = "purge"
+)
+
+func (m ShutdownMode) valid() bool {
+	return m == "" || m == ShutdownLeave || m == ShutdownPurge
+}
+
+// Close shuts the driver down in its configured mode, without a deadline.
+func (d *Driver) Close() error {
+	return d.Shutdown(context.Background())
+}
+
+// Shutdown prepares the driver for the process to exit, in its configured mode. Each network and endpoint removal
+// of a purge gives up once ctx is done.
+func (d *Driver) Shutdown(ctx context.Context) error {
+	d.bridge.Lock()
+	mode := d.bridge.config.ShutdownMode
+	d.bridge.Unlock()
+
+	switch mode {
+	case ShutdownPurge:
+		return d.bridge.purge(ctx)
+	case ShutdownLeave, "":
+		if err := d.bridge.storeUpdate(); err != nil {
+			return internalErrorf("failed to save driver state on shutdown: %v", err)
+		}
+		logrus.Infof("Shut down leaving %d networks in place", len(d.bridge.getNetworks()))
+		return nil
+	default:
+		return types.BadRequestErrorf("unknown shutdown mode %q", mode)
+	}
+}
+
+// purge deletes every network with its endpoints, leaving them first if joined. Networks are drained first, so that
+// no endpoint is added behind the purge's back. It is best effort, and reports how many networks were left behind.
+func (d *bridgeDriver) purge(ctx context.Context) error {
+	networks := d.getNetworks()
+	sort.Slice(networks, func(i, j int) bool { return networks[i].id < networks[j].id })
+	for _, n := range networks {
+		n.Lock()
+		n.draining = true
+		n.Unlock()
+	}
+
+	var failed int
+	for _, n := range networks {
+		n.Lock()
+		type endpoint struct {
+			id     string
+			joined bool
+		}
+		eps := make([]endpoint, 0, len(n.endpoints))
+		for _, ep := range n.endpoints {
+			eps = append(eps, endpoint{id: ep.id, joined: ep.sandboxKey != ""})
+		}
+		n.Unlock()
+		sort.Slice(eps, func(i, j int) bool { return eps[i].id < eps[j].id })
+
+		for _, ep := range eps {
+			if ep.joined {
+				if err := d.RevokeExternalConnectivity(n.id, ep.id); err != nil {
+					logrus.WithError(err).Warnf("Failed to revoke external connectivity of endpoint (%s) on purge", ep.id)
+				}
+				if err := d.Leave(ctx, n.id, ep.id); err != nil {
+					logrus.WithError(err).Warnf("Failed to leave endpoint (%s) on purge", ep.id)
+				}
+			}
+			if err := d.DeleteEndpoint(ctx, n.id, ep.id); err != nil {
+				logrus.WithError(err).Warnf("Failed to delete endpoint (%s) on purge", ep.id)
+			}
+		}
+		if err := d.DeleteNetwork(ctx, n.id); err != nil {
+			logrus.WithError(err).Warnf("Failed to delete network %s on purge", n.id)
+			failed++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("purge left %d of %d networks behind", failed, len(networks))
+	}
+	logrus.Infof("Shut down purging %d networks", len(networks))
+	return nil
+}
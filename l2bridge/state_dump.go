@@ -0,0 +1,148 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// stateDump is a snapshot of the in-memory state of the driver.
+type stateDump struct {
+	Time           time.Time       `json:"time"`
+	Version        string          `json:"version"`
+	Config         Configuration   `json:"config"`
+	KernelFeatures map[string]bool `json:"kernel_features"`
+	Networks       []networkDump   `json:"networks"`
+}
+
+type networkDump struct {
+	ID        string               `json:"id"`
+	Bridge    string               `json:"bridge"`
+	PoolIPv4  string               `json:"pool_ipv4,omitempty"`
+	PoolIPv6  string               `json:"pool_ipv6,omitempty"`
+	Draining  bool                 `json:"draining,omitempty"`
+	LastError *lastError           `json:"last_error,omitempty"`
+	Config    networkConfiguration `json:"config"`
+	Endpoints []endpointDump       `json:"endpoints"`
+}
+
+type endpointDump struct {
+	ID               string                 `json:"id"`
+	HostIfName       string                 `json:"host_ifname"`
+	SrcName          string                 `json:"src_name"`
+	SandboxKey       string                 `json:"sandbox_key,omitempty"`
+	MacAddress       string                 `json:"mac_address,omitempty"`
+	Address          string                 `json:"address,omitempty"`
+	AddressIPv6      string                 `json:"address_ipv6,omitempty"`
+	GatewayIPv4      net.IP                 `json:"gateway_ipv4,omitempty"`
+	GatewayIPv6      net.IP                 `json:"gateway_ipv6,omitempty"`
+	Adopted          bool                   `json:"adopted,omitempty"`
+	GatewayReachable string                 `json:"gateway_reachable,omitempty"`
+	Meta             map[string]string      `json:"meta,omitempty"`
+	LastError        *lastError             `json:"last_error,omitempty"`
+	Config           *endpointConfiguration `json:"config,omitempty"`
+}
+
+func ipNetString(n *net.IPNet) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// stateDump snapshots the driver state, holding the lock of each network while it is copied.
+func (d *bridgeDriver) stateDump() *stateDump {
+	d.Lock()
+	config := *d.config
+	d.Unlock()
+
+	s := &stateDump{
+		Time:           time.Now().UTC(),
+		Version:        Version,
+		Config:         config,
+		KernelFeatures: d.kernelFeatures(),
+		Networks:       []networkDump{},
+	}
+
+	networks := d.getNetworks()
+	sort.Slice(networks, func(i, j int) bool { return networks[i].id < networks[j].id })
+	for _, n := range networks {
+		n.Lock()
+		nd := networkDump{
+			ID:        n.id,
+			Bridge:    n.config.BridgeName,
+			PoolIPv4:  ipNetString(n.config.PoolIPv4),
+			PoolIPv6:  ipNetString(n.config.PoolIPv6),
+			Draining:  n.draining,
+			LastError: n.lastErr,
+			Config:    *n.config,
+			Endpoints: []endpointDump{},
+		}
+		for _, ep := range n.endpoints {
+			ed := endpointDump{
+				ID:               ep.id,
+				HostIfName:       ep.hostIfName,
+				SrcName:          ep.srcName,
+				SandboxKey:       ep.sandboxKey,
+				Address:          ipNetString(ep.addr),
+				AddressIPv6:      ipNetString(ep.addrv6),
+				GatewayIPv4:      ep.gatewayv4,
+				GatewayIPv6:      ep.gatewayv6,
+				Adopted:          ep.adopted,
+				GatewayReachable: ep.gwReachable,
+				Meta:             ep.meta,
+				LastError:        ep.lastErr,
+				Config:           ep.config,
+			}
+			if ep.macAddress != nil {
+				ed.MacAddress = ep.macAddress.String()
+			}
+			nd.Endpoints = append(nd.Endpoints, ed)
+		}
+		n.Unlock()
+		sort.Slice(nd.Endpoints, func(i, j int) bool { return nd.Endpoints[i].ID < nd.Endpoints[j].ID })
+		s.Networks = append(s.Networks, nd)
+	}
+	return s
+}
+
+// dumpState writes a snapshot of the driver state as JSON to the configured file, or to the log if none is set.
+func (d *bridgeDriver) dumpState() error {
+	d.Lock()
+	path := d.config.StateDumpPath
+	d.Unlock()
+
+	data, err := json.Marshal(d.stateDump())
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		logrus.WithField("state", string(data)).Info("Driver state dump")
+		return nil
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	logrus.Infof("Dumped driver state to %s", path)
+	return nil
+}
+
+// handleStateDumps dumps the driver state each time the process receives SIGUSR2.
+func (d *bridgeDriver) handleStateDumps() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+	go func() {
+		for range sigs {
+			if err := d.dumpState(); err != nil {
+				logrus.WithError(err).Warn("Failed to dump driver state")
+			}
+		}
+	}()
+}
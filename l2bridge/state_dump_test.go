@@ -0,0 +1,95 @@
+package l2bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+// newStateDumpDriver returns a dry run driver with two networks, the first draining and holding two endpoints.
+func newStateDumpDriver(t *testing.T) *bridgeDriver {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	for n, pool := range map[int]string{1: "10.1.0.0/16", 2: "10.2.0.0/16"} {
+		if err := d.CreateNetwork(ctx, testID(n), nil, testIPAMData(t, pool), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, eid := range []int{3, 2} {
+		ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.1.0.%d/16", eid))}
+		opts := map[string]interface{}{label.MetaPrefix + "owner": "test"}
+		if _, err := d.CreateEndpoint(ctx, testID(1), testID(eid), ei, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.Join(ctx, testID(1), testID(2), "/var/run/docker/netns/test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetNetworkDraining(testID(1), true); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func checkStateDump(t *testing.T, data []byte) {
+	t.Helper()
+	var s stateDump
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("invalid state dump %s: %v", data, err)
+	}
+	if s.Version != Version || !s.Config.DryRun || s.Time.IsZero() {
+		t.Errorf("expected the version, configuration and time in the dump, got %+v", s)
+	}
+	if len(s.Networks) != 2 || s.Networks[0].ID != testID(1) || s.Networks[1].ID != testID(2) {
+		t.Fatalf("expected networks 1 and 2 in order, got %+v", s.Networks)
+	}
+	n := s.Networks[0]
+	if !n.Draining || n.PoolIPv4 != "10.1.0.0/16" || n.Bridge == "" || n.Config.ID != testID(1) {
+		t.Errorf("expected network 1 draining with its pool, bridge and configuration, got %+v", n)
+	}
+	if len(n.Endpoints) != 2 || n.Endpoints[0].ID != testID(2) || n.Endpoints[1].ID != testID(3) {
+		t.Fatalf("expected endpoints 2 and 3 in order, got %+v", n.Endpoints)
+	}
+	ep := n.Endpoints[0]
+	if ep.Address != "10.1.0.2/16" || ep.MacAddress == "" || ep.HostIfName == "" || ep.SrcName == "" ||
+		ep.SandboxKey != "/var/run/docker/netns/test" || ep.Meta["owner"] != "test" || ep.Config == nil ||
+		ep.GatewayIPv4.String() != "10.1.0.1" {
+		t.Errorf("expected endpoint 2 complete, got %+v", ep)
+	}
+	if len(s.Networks[1].Endpoints) != 0 {
+		t.Errorf("expected no endpoints on network 2, got %+v", s.Networks[1].Endpoints)
+	}
+}
+
+func TestDumpStateToFile(t *testing.T) {
+	d := newStateDumpDriver(t)
+	d.config.StateDumpPath = filepath.Join(t.TempDir(), "state.json")
+	if err := d.dumpState(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(d.config.StateDumpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStateDump(t, data)
+}
+
+func TestDumpStateToLog(t *testing.T) {
+	d := newStateDumpDriver(t)
+	hook := captureLogs(t)
+	if err := d.dumpState(); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Driver state dump" {
+			checkStateDump(t, []byte(entry.Data["state"].(string)))
+			return
+		}
+	}
+	t.Fatal("expected the state dumped to the log")
+}
@@ -0,0 +1,217 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// staticFDBEntry pins a MAC address to a bridge port.
+type staticFDBEntry struct {
+	MAC  net.HardwareAddr
+	Port string
+}
+
+// parseStaticFDB parses a comma separated list of mac=port entries.
+func parseStaticFDB(s string) ([]staticFDBEntry, error) {
+	return parseFDBEntries(s, "=")
+}
+
+// parseEndpointFDB parses a comma separated list of mac@port entries.
+func parseEndpointFDB(s string) ([]staticFDBEntry, error) {
+	return parseFDBEntries(s, "@")
+}
+
+func parseFDBEntries(s, sep string) ([]staticFDBEntry, error) {
+	var entries []staticFDBEntry
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, sep)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("entry %q is not of the form mac%sport", entry, sep)
+		}
+		mac, err := net.ParseMAC(parts[0])
+		if err != nil || len(mac) != 6 {
+			return nil, fmt.Errorf("entry %q has an invalid MAC address", entry)
+		}
+		if seen[mac.String()] {
+			return nil, fmt.Errorf("MAC address %s is pinned more than once", mac)
+		}
+		seen[mac.String()] = true
+		entries = append(entries, staticFDBEntry{MAC: mac, Port: parts[1]})
+	}
+	return entries, nil
+}
+
+// fdbNeighbor returns the static forwarding database entry of the MAC on the port with the given index.
+func fdbNeighbor(portIndex int, mac net.HardwareAddr) *netlink.Neigh {
+	return &netlink.Neigh{
+		LinkIndex:    portIndex,
+		Family:       syscall.AF_BRIDGE,
+		State:        netlink.NUD_NOARP,
+		Flags:        netlink.NTF_MASTER,
+		HardwareAddr: mac,
+	}
+}
+
+// checkStaticFDBPorts checks, before the bridge is touched, that each static FDB entry names a port the network can
+// pin it to: its uplink, or an interface already on the host. The ports of endpoints are created, with generated
+// names, only after the network, so entries for them are rejected; they are pinned with l2bridge.fdb on the endpoint.
+func (d *bridgeDriver) checkStaticFDBPorts(config *networkConfiguration) error {
+	uplink := config.Uplink
+	if config.VLAN != 0 {
+		uplink = fmt.Sprintf("%s.%d", config.Uplink, config.VLAN)
+	}
+	for _, e := range config.StaticFDB {
+		if e.Port == uplink {
+			continue
+		}
+		if _, err := d.nlh.LinkByName(e.Port); err != nil {
+			return types.BadRequestErrorf("static FDB port %s for %s does not exist: %s may only name the uplink or "+
+				"interfaces existing before the network, endpoint ports are pinned with %s", e.Port, e.MAC, label.StaticFDB, label.EndpointFDB)
+		}
+	}
+	return nil
+}
+
+// setupStaticFDB installs the configured static forwarding database entries on the bridge. Each port must already
+// be attached to the bridge.
+func setupStaticFDB(config *networkConfiguration, i *bridgeInterface) error {
+	for _, e := range config.StaticFDB {
+		if err := i.addFDBEntry(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFDBEntry pins the entry's MAC to its port, which must be attached to the bridge.
+func (i *bridgeInterface) addFDBEntry(e staticFDBEntry) error {
+	port, err := i.nlh.LinkByName(e.Port)
+	if err != nil {
+		return types.BadRequestErrorf("static FDB port %s for %s does not exist", e.Port, e.MAC)
+	}
+	if port.Attrs().MasterIndex != i.Link.Attrs().Index {
+		return types.BadRequestErrorf("static FDB port %s for %s is not attached to bridge %s", e.Port, e.MAC, i.Link.Attrs().Name)
+	}
+	if err := i.nlh.NeighSet(fdbNeighbor(port.Attrs().Index, e.MAC)); err != nil {
+		return fmt.Errorf("failed to add static FDB entry %s on port %s: %w", e.MAC, e.Port, err)
+	}
+	return nil
+}
+
+// removeStaticFDB removes the entries installed by setupStaticFDB. It is best effort.
+func (n *bridgeNetwork) removeStaticFDB() {
+	for _, e := range n.config.StaticFDB {
+		port, err := n.bridge.nlh.LinkByName(e.Port)
+		if err != nil {
+			continue
+		}
+		if err := n.bridge.nlh.NeighDel(fdbNeighbor(port.Attrs().Index, e.MAC)); err != nil {
+			logrus.WithError(err).Warnf("Failed to remove static FDB entry %s on port %s on network %s delete", e.MAC, e.Port, n.id)
+		}
+	}
+}
+
+// setupEndpointFDB pins the MAC addresses the endpoint asked for to their ports while it is joined.
+func (n *bridgeNetwork) setupEndpointFDB(ep *bridgeEndpoint) error {
+	n.Lock()
+	ep.fdbInstalled = true
+	n.Unlock()
+	for _, e := range ep.config.FDB {
+		if err := n.bridge.addFDBEntry(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeEndpointFDB removes the entries installed by setupEndpointFDB, if any. It is best effort.
+func (n *bridgeNetwork) removeEndpointFDB(ep *bridgeEndpoint) {
+	n.Lock()
+	installed := ep.fdbInstalled
+	ep.fdbInstalled = false
+	n.Unlock()
+	if !installed {
+		return
+	}
+	for _, e := range ep.config.FDB {
+		port, err := n.bridge.nlh.LinkByName(e.Port)
+		if err != nil {
+			continue
+		}
+		err = n.bridge.nlh.NeighDel(fdbNeighbor(port.Attrs().Index, e.MAC))
+		if err != nil && err != syscall.ENOENT {
+			logrus.WithError(err).Warnf("Failed to remove static FDB entry %s on port %s of endpoint (%s)", e.MAC, e.Port, ep.id)
+		}
+		n.driver.countRuleRemoval("fdb", err)
+	}
+}
+
+// orphanedFDB are the static FDB entries of an endpoint dropped while they were installed, as when its interface
+// vanished while the driver was down. They are removed by the next Reconcile.
+type orphanedFDB struct {
+	Endpoint string           `json:"endpoint"`
+	Bridge   string           `json:"bridge"`
+	Entries  []staticFDBEntry `json:"entries"`
+}
+
+// removeOrphanedFDB removes the orphaned static FDB entries, returning those removed as mac@port and the failures.
+// Entries whose bridge or port is gone went with it. If logOnly is set, the entries are listed and kept instead. The
+// caller must hold configNetwork.
+func (d *bridgeDriver) removeOrphanedFDB(nlh NetlinkHandle, logOnly bool) (removed, failed []string) {
+	d.Lock()
+	orphans := d.orphanedFDB
+	d.Unlock()
+
+	var kept []orphanedFDB
+	for _, o := range orphans {
+		bridge, err := nlh.LinkByName(o.Bridge)
+		if err != nil {
+			continue
+		}
+		var left []staticFDBEntry
+		for _, e := range o.Entries {
+			port, err := nlh.LinkByName(e.Port)
+			if err != nil || port.Attrs().MasterIndex != bridge.Attrs().Index {
+				continue
+			}
+			name := e.MAC.String() + "@" + e.Port
+			if logOnly {
+				logrus.Infof("Found orphaned static FDB entry %s of endpoint (%s), leaving it in place", name, o.Endpoint)
+				removed = append(removed, name)
+				left = append(left, e)
+				continue
+			}
+			if err := nlh.NeighDel(fdbNeighbor(port.Attrs().Index, e.MAC)); err != nil && err != syscall.ENOENT {
+				logrus.WithError(err).Warnf("Failed to remove orphaned static FDB entry %s of endpoint (%s)", name, o.Endpoint)
+				failed = append(failed, name+": "+err.Error())
+				left = append(left, e)
+				continue
+			}
+			logrus.Infof("Removed orphaned static FDB entry %s of endpoint (%s)", name, o.Endpoint)
+			removed = append(removed, name)
+		}
+		if len(left) != 0 {
+			kept = append(kept, orphanedFDB{Endpoint: o.Endpoint, Bridge: o.Bridge, Entries: left})
+		}
+	}
+
+	d.Lock()
+	d.orphanedFDB = kept
+	d.Unlock()
+	if len(orphans) != 0 && !logOnly {
+		d.storeSync("orphaned fdb removal")
+	}
+	return removed, failed
+}
@@ -0,0 +1,143 @@
+package l2bridge
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+)
+
+func TestParseStaticFDB(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+	mac2, _ := net.ParseMAC("02:42:ac:11:00:03")
+	tests := []struct {
+		in   string
+		want []staticFDBEntry
+		err  string
+	}{
+		{in: "02:42:ac:11:00:02=eth1", want: []staticFDBEntry{{MAC: mac, Port: "eth1"}}},
+		{in: " 02:42:ac:11:00:02=eth1 , 02:42:ac:11:00:03=eth2 ", want: []staticFDBEntry{{MAC: mac, Port: "eth1"}, {MAC: mac2, Port: "eth2"}}},
+		{in: ""},
+		{in: "02:42:ac:11:00:02", err: "not of the form"},
+		{in: "02:42:ac:11:00:02=", err: "not of the form"},
+		{in: "02:42:ac:11:00:02@eth1", err: "not of the form"},
+		{in: "zz:42:ac:11:00:02=eth1", err: "invalid MAC"},
+		{in: "02:00:5e:10:00:00:00:01=eth1", err: "invalid MAC"},
+		{in: "02:42:ac:11:00:02=eth1,02:42:AC:11:00:02=eth2", err: "more than once"},
+	}
+	for _, tt := range tests {
+		got, err := parseStaticFDB(tt.in)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseStaticFDB(%q): expected an error containing %q, got %v", tt.in, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStaticFDB(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseStaticFDB(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckStaticFDBPorts(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+	tests := []struct {
+		name       string
+		uplink     string
+		vlan       int
+		port       string
+		badRequest bool
+	}{
+		{name: "uplink", uplink: "eth1", port: "eth1"},
+		{name: "vlan uplink", uplink: "eth1", vlan: 100, port: "eth1.100"},
+		{name: "existing interface", port: "eth2"},
+		{name: "later endpoint port", port: "veth1a2b3c4", badRequest: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			d.nlh.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2"}})
+			config := &networkConfiguration{Uplink: tt.uplink, VLAN: tt.vlan, StaticFDB: []staticFDBEntry{{MAC: mac, Port: tt.port}}}
+			err := d.checkStaticFDBPorts(config)
+			if !tt.badRequest {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if _, ok := err.(types.BadRequestError); !ok {
+				t.Fatalf("expected a BadRequestError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), label.EndpointFDB) {
+				t.Errorf("expected the error to point at %s, got %v", label.EndpointFDB, err)
+			}
+		})
+	}
+}
+
+// fdbTestHandle is a dry run handle recording the FDB entries set and deleted, as mac@port index.
+type fdbTestHandle struct {
+	*dryRunHandle
+	set, deleted []string
+}
+
+func (h *fdbTestHandle) NeighSet(neigh *netlink.Neigh) error {
+	h.set = append(h.set, fdbTestEntry(neigh))
+	return nil
+}
+
+func (h *fdbTestHandle) NeighDel(neigh *netlink.Neigh) error {
+	h.deleted = append(h.deleted, fdbTestEntry(neigh))
+	return nil
+}
+
+func fdbTestEntry(neigh *netlink.Neigh) string {
+	if neigh.State != netlink.NUD_NOARP || neigh.Flags != netlink.NTF_MASTER {
+		return "not static: " + neigh.String()
+	}
+	return neigh.HardwareAddr.String() + "@" + strconv.Itoa(neigh.LinkIndex)
+}
+
+func TestStaticFDBInstallAndCleanup(t *testing.T) {
+	mac, _ := net.ParseMAC("02:42:ac:11:00:02")
+	mac2, _ := net.ParseMAC("02:42:ac:11:00:03")
+	h := &fdbTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0", Index: 1}}
+	h.LinkAdd(bridge)
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 2, MasterIndex: 1}})
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 3, MasterIndex: 1}})
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth3", Index: 4}})
+
+	config := &networkConfiguration{StaticFDB: []staticFDBEntry{{MAC: mac, Port: "eth1"}, {MAC: mac2, Port: "eth2"}}}
+	i := &bridgeInterface{Link: bridge, nlh: h}
+	if err := setupStaticFDB(config, i); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"02:42:ac:11:00:02@2", "02:42:ac:11:00:03@3"}
+	if !equalStrings(h.set, want) {
+		t.Errorf("expected %v installed, got %v", want, h.set)
+	}
+
+	n := &bridgeNetwork{id: testID(1), config: config, bridge: i}
+	n.removeStaticFDB()
+	if !equalStrings(h.deleted, want) {
+		t.Errorf("expected %v removed, got %v", want, h.deleted)
+	}
+
+	// A port off the bridge is rejected rather than pinned.
+	config.StaticFDB = []staticFDBEntry{{MAC: mac, Port: "eth3"}}
+	if err := setupStaticFDB(config, i); err == nil {
+		t.Error("expected an error pinning a MAC to a port off the bridge")
+	} else if _, ok := err.(types.BadRequestError); !ok {
+		t.Errorf("expected a BadRequestError, got %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/libnetwork/ns"
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultDataRoot is the directory the driver state is persisted under.
+	defaultDataRoot = "/var/lib/l2bridge"
+	stateFileName   = "state.json"
+)
+
+// storedState is the driver state persisted across restarts.
+type storedState struct {
+	Networks    []storedNetwork `json:"networks"`
+	OrphanedFDB []orphanedFDB   `json:"orphaned_fdb,omitempty"`
+	// Allocated are the configurations of the swarm networks allocated on this manager, by network id.
+	Allocated map[string]*networkConfiguration `json:"allocated,omitempty"`
+}
+
+type storedNetwork struct {
+	Config      *networkConfiguration `json:"config"`
+	Draining    bool                  `json:"draining,omitempty"`
+	Quiet       bool                  `json:"quiet,omitempty"`
+	UplinkPort  string                `json:"uplink_port,omitempty"`
+	UplinkWasUp bool                  `json:"uplink_was_up,omitempty"`
+	VLANCreated bool                  `json:"vlan_created,omitempty"`
+	// UplinkPromisc is set while the uplink is in promiscuous mode on behalf of the network.
+	UplinkPromisc bool   `json:"uplink_promisc,omitempty"`
+	MSSClampMTU   int    `json:"mss_clamp_mtu,omitempty"`
+	Requested     string `json:"requested,omitempty"`
+	// ForeignBridge is set for a network on a bridge the driver did not create, with the addresses it added to it.
+	ForeignBridge bool         `json:"foreign_bridge,omitempty"`
+	BridgeAddrs   []*net.IPNet `json:"bridge_addrs,omitempty"`
+	// Declared is set for a network whose bridge is not realized, as a lazy network with no joined endpoints.
+	Declared  bool             `json:"declared,omitempty"`
+	Endpoints []storedEndpoint `json:"endpoints"`
+}
+
+type storedEndpoint struct {
+	ID              string                 `json:"id"`
+	SrcName         string                 `json:"src_name"`
+	HostIfName      string                 `json:"host_ifname"`
+	SandboxKey      string                 `json:"sandbox_key,omitempty"`
+	Addr            *net.IPNet             `json:"addr,omitempty"`
+	AddrIPv6        *net.IPNet             `json:"addr_ipv6,omitempty"`
+	GatewayIPv4     net.IP                 `json:"gateway_ipv4,omitempty"`
+	GatewayIPv6     net.IP                 `json:"gateway_ipv6,omitempty"`
+	MacAddress      net.HardwareAddr       `json:"mac_address,omitempty"`
+	Config          *endpointConfiguration `json:"config,omitempty"`
+	ExposedPorts    []types.TransportPort  `json:"exposed_ports,omitempty"`
+	Meta            map[string]string      `json:"meta,omitempty"`
+	MTU             int                    `json:"mtu,omitempty"`
+	VLAN            *endpointVLAN          `json:"vlan,omitempty"`
+	Adopted         bool                   `json:"adopted,omitempty"`
+	PeerPolicy      bool                   `json:"peer_policy,omitempty"`
+	MasqueradeIface string                 `json:"masquerade_iface,omitempty"`
+	MasqueradeAddr  net.IP                 `json:"masquerade_addr,omitempty"`
+	DHCP            *dhcpLease             `json:"dhcp,omitempty"`
+	FDBInstalled    bool                   `json:"fdb_installed,omitempty"`
+	PortMapping     []types.PortBinding    `json:"port_mapping,omitempty"`
+	ReplacedSysctls map[string]string      `json:"replaced_sysctls,omitempty"`
+	PortGroupClass  int                    `json:"port_group_class,omitempty"`
+}
+
+// storePath returns the file the driver state is persisted to, or the empty string if persistence is disabled.
+func (d *bridgeDriver) storePath() string {
+	d.Lock()
+	defer d.Unlock()
+	// A dry run leaves no state behind, nor picks up that of a live driver.
+	if d.config.DataRoot == "" || d.config.DryRun {
+		return ""
+	}
+	return filepath.Join(d.config.DataRoot, stateFileName)
+}
+
+// storeUpdate persists the state of every network and endpoint. The file is replaced atomically, so that a crash
+// while writing leaves the previous state in place.
+func (d *bridgeDriver) storeUpdate() error {
+	path := d.storePath()
+	if path == "" {
+		return nil
+	}
+
+	d.storeMu.Lock()
+	defer d.storeMu.Unlock()
+
+	state := storedState{Networks: []storedNetwork{}}
+	d.Lock()
+	state.OrphanedFDB = d.orphanedFDB
+	state.Allocated = make(map[string]*networkConfiguration, len(d.allocated))
+	for id, config := range d.allocated {
+		state.Allocated[id] = config
+	}
+	d.Unlock()
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		sn := storedNetwork{
+			Config:        n.config,
+			Draining:      n.draining,
+			Quiet:         n.quiet,
+			UplinkPort:    n.uplinkPort,
+			UplinkWasUp:   n.uplinkWasUp,
+			VLANCreated:   n.vlanCreated,
+			UplinkPromisc: n.uplinkPromisc,
+			MSSClampMTU:   n.mssClampMTU,
+			Requested:     n.requested,
+			Declared:      n.pendingRebuild,
+			ForeignBridge: n.foreignBridge,
+			BridgeAddrs:   n.bridgeAddrs,
+			Endpoints:     []storedEndpoint{},
+		}
+		for _, ep := range n.endpoints {
+			sn.Endpoints = append(sn.Endpoints, storedEndpoint{
+				ID:              ep.id,
+				SrcName:         ep.srcName,
+				HostIfName:      ep.hostIfName,
+				SandboxKey:      ep.sandboxKey,
+				Addr:            ep.addr,
+				AddrIPv6:        ep.addrv6,
+				GatewayIPv4:     ep.gatewayv4,
+				GatewayIPv6:     ep.gatewayv6,
+				MacAddress:      ep.macAddress,
+				Config:          ep.config,
+				ExposedPorts:    ep.exposedPorts,
+				Meta:            ep.meta,
+				MTU:             ep.mtu,
+				VLAN:            ep.vlan,
+				Adopted:         ep.adopted,
+				PeerPolicy:      ep.peerPolicy,
+				MasqueradeIface: ep.masqueradeIface,
+				MasqueradeAddr:  ep.masqueradeAddr,
+				DHCP:            ep.dhcp,
+				FDBInstalled:    ep.fdbInstalled,
+				PortMapping:     ep.portMapping,
+				ReplacedSysctls: ep.replacedSysctls,
+				PortGroupClass:  ep.portGroupClass,
+			})
+		}
+		n.Unlock()
+		// Fields referenced here are replaced rather than modified in place, so they may be encoded after unlocking.
+		state.Networks = append(state.Networks, sn)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// storeSync persists the driver state after a change, logging rather than failing the request if it cannot.
+func (d *bridgeDriver) storeSync(change string) {
+	if err := d.storeUpdate(); err != nil {
+		logrus.WithError(err).Warnf("Failed to save driver state after %s", change)
+	}
+}
+
+// restoreState reloads the persisted driver state and reconciles it with the host. Endpoints whose veth pair is gone
+// are dropped. Networks whose bridge is gone are kept, and their bridge is recreated when next used. Networks whose
+// bridge survived are warm restarted, if enabled; otherwise their iptables rules are left in place, but are not
+// removed when the network is deleted.
+func (d *bridgeDriver) restoreState() error {
+	path := d.storePath()
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state storedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	d.Lock()
+	d.orphanedFDB = state.OrphanedFDB
+	if state.Allocated != nil {
+		d.allocated = state.Allocated
+	}
+	d.Unlock()
+	if len(state.Networks) == 0 {
+		return nil
+	}
+
+	d.Lock()
+	if d.nlh == nil {
+		d.nlh = newMeteredHandle(ns.NlHandle(), d.metrics)
+	}
+	nlh := d.nlh
+	d.Unlock()
+
+	for _, sn := range state.Networks {
+		config := sn.Config
+		if config == nil || config.ID == "" {
+			continue
+		}
+		bridgeIface, err := newInterface(nlh, config)
+		if err != nil {
+			logrus.WithError(err).Warnf("Failed to restore network %s", config.ID)
+			continue
+		}
+		n := &bridgeNetwork{
+			id:             config.ID,
+			endpoints:      make(map[string]*bridgeEndpoint),
+			config:         config,
+			bridge:         bridgeIface,
+			driver:         d,
+			draining:       sn.Draining,
+			quiet:          sn.Quiet,
+			uplinkPort:     sn.UplinkPort,
+			uplinkWasUp:    sn.UplinkWasUp,
+			vlanCreated:    sn.VLANCreated,
+			uplinkPromisc:  sn.UplinkPromisc,
+			mssClampMTU:    sn.MSSClampMTU,
+			requested:      sn.Requested,
+			pendingRebuild: !bridgeIface.exists(),
+			foreignBridge:  sn.ForeignBridge,
+			bridgeAddrs:    sn.BridgeAddrs,
+		}
+		if n.pendingRebuild && sn.Declared {
+			logrus.Infof("Restored network %s is declared, its bridge %s is created when first used", config.ID, config.BridgeName)
+		} else if n.pendingRebuild {
+			logrus.Warnf("Bridge %s of restored network %s is gone, it will be recreated when next used", config.BridgeName, config.ID)
+		}
+
+		for _, se := range sn.Endpoints {
+			if _, err := nlh.LinkByName(se.HostIfName); err != nil {
+				logrus.Warnf("Dropping restored endpoint %s of network %s, its interface %s is gone", se.ID, config.ID, se.HostIfName)
+				if se.FDBInstalled && se.Config != nil && len(se.Config.FDB) != 0 {
+					d.Lock()
+					d.orphanedFDB = append(d.orphanedFDB, orphanedFDB{Endpoint: se.ID, Bridge: config.BridgeName, Entries: se.Config.FDB})
+					d.Unlock()
+				}
+				continue
+			}
+			n.endpoints[se.ID] = &bridgeEndpoint{
+				id:              se.ID,
+				nid:             config.ID,
+				srcName:         se.SrcName,
+				hostIfName:      se.HostIfName,
+				sandboxKey:      se.SandboxKey,
+				addr:            se.Addr,
+				addrv6:          se.AddrIPv6,
+				gatewayv4:       se.GatewayIPv4,
+				gatewayv6:       se.GatewayIPv6,
+				macAddress:      se.MacAddress,
+				config:          se.Config,
+				exposedPorts:    se.ExposedPorts,
+				meta:            se.Meta,
+				mtu:             se.MTU,
+				vlan:            se.VLAN,
+				adopted:         se.Adopted,
+				peerPolicy:      se.PeerPolicy,
+				masqueradeIface: se.MasqueradeIface,
+				masqueradeAddr:  se.MasqueradeAddr,
+				dhcp:            se.DHCP,
+				fdbInstalled:    se.FDBInstalled,
+				portMapping:     se.PortMapping,
+				replacedSysctls: se.ReplacedSysctls,
+				portGroupClass:  se.PortGroupClass,
+			}
+			n.endpoints[se.ID].reservePortMapping()
+			// State saved before the masqueraded address was recorded masqueraded the endpoint's own.
+			if se.MasqueradeIface != "" && se.MasqueradeAddr == nil && se.Addr != nil {
+				n.endpoints[se.ID].masqueradeAddr = se.Addr.IP
+			}
+			if n.endpoints[se.ID].config == nil {
+				n.endpoints[se.ID].config = &endpointConfiguration{}
+			}
+		}
+
+		d.Lock()
+		d.networks[config.ID] = n
+		warm := d.config.WarmRestart
+		d.Unlock()
+		logrus.Infof("Restored network %s with %d endpoints", config.ID, len(n.endpoints))
+		for _, ep := range n.endpoints {
+			if ep.sandboxKey != "" && ep.dhcp != nil && !ep.dhcp.Released {
+				n.keepDHCPLease(ep, ep.sandboxKey)
+			}
+		}
+		if warm && !n.pendingRebuild {
+			d.warmRestart(n)
+		}
+	}
+	return nil
+}
+
+// ensureBridge realizes the bridge of a network which has none: a restored network whose bridge was gone on restart,
+// or a lazy network without joined endpoints. The caller holds the network lock.
+func (d *bridgeDriver) ensureBridge(n *bridgeNetwork) error {
+	n.Lock()
+	pending := n.pendingRebuild
+	n.Unlock()
+	if !pending {
+		return nil
+	}
+
+	err := d.rebuildNetwork(n.id)
+	n.Lock()
+	if n.bridge.exists() {
+		n.pendingRebuild = false
+	}
+	n.Unlock()
+	if err != nil {
+		logrus.WithError(err).Warnf("Recreated bridge of network %s with errors", n.id)
+	}
+	if !n.bridge.exists() {
+		return internalErrorf("failed to recreate bridge %s of network %s: %v", n.config.BridgeName, n.id, err)
+	}
+	return nil
+}
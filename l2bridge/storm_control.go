@@ -0,0 +1,37 @@
+package l2bridge
+
+import (
+	"strconv"
+)
+
+const (
+	// bumFilterPrio places the BUM policer ahead of any other ingress filter on the port.
+	bumFilterPrio = "1"
+	// minBUMBurst is the smallest burst, in bytes, given to the BUM policer so that a full frame always fits.
+	minBUMBurst = 1600
+)
+
+// setupBUMPolicer drops broadcast and multicast frames received from the named interface in excess of rate, in bits
+// per second. Unknown unicast cannot be told apart from known unicast at the port, so it is not policed.
+func setupBUMPolicer(ifName string, rate uint64) error {
+	if err := setupIngressQdisc(ifName); err != nil {
+		return err
+	}
+
+	// Allow bursts of a tenth of a second of traffic.
+	burst := rate / 8 / 10
+	if burst < minBUMBurst {
+		burst = minBUMBurst
+	}
+
+	// The group bit is the low bit of the first byte of the destination MAC, which sits 14 bytes before the network
+	// header that u32 offsets are relative to.
+	return tc("filter", "add", "dev", ifName, "parent", "ffff:", "prio", bumFilterPrio, "protocol", "all", "u32",
+		"match", "u8", "0x01", "0x01", "at", "-14",
+		"police", "rate", strconv.FormatUint(rate, 10)+"bit", "burst", strconv.FormatUint(burst, 10), "drop")
+}
+
+// removeBUMPolicer removes the policer installed by setupBUMPolicer.
+func removeBUMPolicer(ifName string) error {
+	return tc("filter", "del", "dev", ifName, "parent", "ffff:", "prio", bumFilterPrio)
+}
@@ -0,0 +1,62 @@
+package l2bridge
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestBUMRateLimitLabel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+		err  bool
+	}{
+		{in: "10mbit", want: 10000000},
+		{in: "64kbit", want: 64000},
+		{in: "storm", err: true},
+		{in: "0mbit", err: true},
+	}
+	for _, tt := range tests {
+		c := &networkConfiguration{}
+		err := c.fromLabels(map[string]interface{}{label.BUMRateLimit: tt.in})
+		if (err != nil) != tt.err {
+			t.Errorf("%s=%s: expected error %v, got %v", label.BUMRateLimit, tt.in, tt.err, err)
+			continue
+		}
+		if c.BUMRateLimit != tt.want {
+			t.Errorf("%s=%s: expected rate %d, got %d", label.BUMRateLimit, tt.in, tt.want, c.BUMRateLimit)
+		}
+	}
+}
+
+func TestBUMPolicer(t *testing.T) {
+	tests := []struct {
+		rate  uint64
+		burst string
+	}{
+		{rate: 10000000, burst: "125000"},
+		// Low rates get a burst fitting a full frame.
+		{rate: 64000, burst: "1600"},
+	}
+	for _, tt := range tests {
+		cmds := recordCommands(t)
+		if err := setupBUMPolicer("veth1", tt.rate); err != nil {
+			t.Fatal(err)
+		}
+		if err := removeBUMPolicer("veth1"); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			"tc qdisc replace dev veth1 handle ffff: ingress",
+			"tc filter add dev veth1 parent ffff: prio 1 protocol all u32 match u8 0x01 0x01 at -14 police rate " +
+				strconv.FormatUint(tt.rate, 10) + "bit burst " + tt.burst + " drop",
+			"tc filter del dev veth1 parent ffff: prio 1",
+		}
+		if !equalStrings(*cmds, want) {
+			t.Errorf("rate %d: expected commands\n%s\ngot\n%s", tt.rate, strings.Join(want, "\n"), strings.Join(*cmds, "\n"))
+		}
+	}
+}
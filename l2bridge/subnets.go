@@ -0,0 +1,169 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// secondarySubnet is a subnet of a network beyond the first of its address family.
+type secondarySubnet struct {
+	Pool    *net.IPNet
+	Gateway net.IP
+}
+
+// parseSecondarySubnets returns the subnets following the first in the IPAM data, taking the gateway of each from the
+// given auxiliary address key, as for the first.
+func parseSecondarySubnets(id string, data []*IPAMData, gwKey string) ([]secondarySubnet, error) {
+	var subnets []secondarySubnet
+	for i := 1; i < len(data); i++ {
+		if data[i].Pool == nil {
+			return nil, types.BadRequestErrorf("subnet %d of l2bridge network %s has no pool", i, id)
+		}
+		s := secondarySubnet{Pool: types.GetIPNetCopy(data[i].Pool)}
+		if gw, ok := data[i].AuxAddresses[gwKey]; ok {
+			s.Gateway = gw.IP
+			if err := checkGatewayAddress(s.Gateway, s.Pool); err != nil {
+				return nil, err
+			}
+		}
+		subnets = append(subnets, s)
+	}
+	return subnets, nil
+}
+
+// checkGatewayAddress rejects a gateway that is the network or broadcast address of its IPv4 pool.
+func checkGatewayAddress(gw net.IP, pool *net.IPNet) error {
+	if gw.To4() == nil {
+		return nil
+	}
+	if ones, bits := pool.Mask.Size(); ones < bits-1 {
+		first, last := netutils.NetworkRange(pool)
+		if gw.Equal(first) {
+			return types.BadRequestErrorf("gateway %s is the network address of %s", gw, pool)
+		}
+		if gw.Equal(last) {
+			return types.BadRequestErrorf("gateway %s is the broadcast address of %s", gw, pool)
+		}
+	}
+	return nil
+}
+
+// poolsIPv4 returns every IPv4 pool of the network, the first one first.
+func (c *networkConfiguration) poolsIPv4() []*net.IPNet {
+	return appendPools(c.PoolIPv4, c.SecondaryIPv4)
+}
+
+// poolsIPv6 returns every IPv6 pool of the network, the first one first.
+func (c *networkConfiguration) poolsIPv6() []*net.IPNet {
+	return appendPools(c.PoolIPv6, c.SecondaryIPv6)
+}
+
+func appendPools(first *net.IPNet, secondary []secondarySubnet) []*net.IPNet {
+	if first == nil {
+		return nil
+	}
+	pools := []*net.IPNet{first}
+	for _, s := range secondary {
+		pools = append(pools, s.Pool)
+	}
+	return pools
+}
+
+// poolsContain reports whether any of the pools contains ip.
+func poolsContain(pools []*net.IPNet, ip net.IP) bool {
+	for _, pool := range pools {
+		if pool.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// poolOf returns the pool containing ip, or the first pool if none does.
+func poolOf(pools []*net.IPNet, ip net.IP) *net.IPNet {
+	for _, pool := range pools {
+		if pool.Contains(ip) {
+			return pool
+		}
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+	return pools[0]
+}
+
+// gatewayIPv4For returns the gateway of the IPv4 subnet holding addr, the network's default gateway unless addr is in
+// a secondary subnet.
+func (c *networkConfiguration) gatewayIPv4For(addr *net.IPNet) net.IP {
+	return subnetGateway(c.DefaultGatewayIPv4, c.SecondaryIPv4, addr)
+}
+
+// gatewayIPv6For returns the gateway of the IPv6 subnet holding addr, the network's default gateway unless addr is in
+// a secondary subnet.
+func (c *networkConfiguration) gatewayIPv6For(addr *net.IPNet) net.IP {
+	return subnetGateway(c.DefaultGatewayIPv6, c.SecondaryIPv6, addr)
+}
+
+func subnetGateway(gw net.IP, secondary []secondarySubnet, addr *net.IPNet) net.IP {
+	if addr == nil {
+		return gw
+	}
+	for _, s := range secondary {
+		if s.Pool.Contains(addr.IP) {
+			return s.Gateway
+		}
+	}
+	return gw
+}
+
+// formatPools lists the pools for error messages.
+func formatPools(pools []*net.IPNet) string {
+	strs := make([]string, len(pools))
+	for i, pool := range pools {
+		strs[i] = pool.String()
+	}
+	return strings.Join(strs, ", ")
+}
+
+// assignSecondaryGateways gives the bridge an address in each secondary subnet with a gateway, as it holds the first
+// subnet's.
+func (c *networkConfiguration) assignSecondaryGateways() {
+	for _, s := range c.SecondaryIPv4 {
+		if s.Gateway != nil {
+			c.SecondaryBridgeIPs = append(c.SecondaryBridgeIPs, &net.IPNet{IP: s.Gateway, Mask: s.Pool.Mask})
+		}
+	}
+	if !c.EnableIPv6 {
+		return
+	}
+	for _, s := range c.SecondaryIPv6 {
+		if s.Gateway != nil {
+			c.SecondaryBridgeIPs = append(c.SecondaryBridgeIPs, &net.IPNet{IP: s.Gateway, Mask: s.Pool.Mask})
+		}
+	}
+}
+
+// holdsSecondaryIPv6 reports whether the bridge holds an IPv6 address in a secondary subnet.
+func (c *networkConfiguration) holdsSecondaryIPv6() bool {
+	for _, addr := range c.SecondaryBridgeIPs {
+		if addr.IP.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// setupSecondaryBridgeIPs assigns the network's gateway addresses in its secondary subnets to the bridge.
+func setupSecondaryBridgeIPs(config *networkConfiguration, i *bridgeInterface) error {
+	for _, addr := range config.SecondaryBridgeIPs {
+		if err := i.nlh.AddrReplace(i.Link, &netlink.Addr{IPNet: addr}); err != nil {
+			return fmt.Errorf("failed to add address %s to bridge: %w", addr, err)
+		}
+	}
+	return nil
+}
@@ -4,10 +4,16 @@ import (
 	"io/ioutil"
 )
 
+// readSysctl and writeSysctl access the kernel parameters the setup steps change, and are replaced in tests.
+var (
+	readSysctl  = ioutil.ReadFile
+	writeSysctl = func(path string, data []byte) error { return ioutil.WriteFile(path, data, 0644) }
+)
+
 //Gets the value of the kernel parameters located at the given path
 func getSysBoolParam(path string) (bool, error) {
 	enabled := false
-	line, err := ioutil.ReadFile(path)
+	line, err := readSysctl(path)
 	if err != nil {
 		return false, err
 	}
@@ -23,5 +29,11 @@ func setSysBoolParam(path string, on bool) error {
 	if on {
 		value = byte('1')
 	}
-	return ioutil.WriteFile(path, []byte{value, '\n'}, 0644)
+	return writeSysctl(path, []byte{value, '\n'})
+}
+
+// kernelIPv6Disabled reports whether IPv6 is disabled on the host, either by sysctl or by booting without it.
+func kernelIPv6Disabled() bool {
+	enabled, err := getSysBoolParam("/proc/sys/net/ipv6/conf/all/disable_ipv6")
+	return enabled || err != nil
 }
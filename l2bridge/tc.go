@@ -0,0 +1,31 @@
+package l2bridge
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runCommand runs the named host utility with the given arguments, returning its combined output. Tests replace it
+// to record the commands run.
+var runCommand = func(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// tc runs the traffic control utility with the given arguments.
+func tc(args ...string) error {
+	if out, err := runCommand("tc", args...); err != nil {
+		return fmt.Errorf("tc %s failed: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setupIngressQdisc ensures the ingress qdisc is present on the named interface.
+func setupIngressQdisc(ifName string) error {
+	return tc("qdisc", "replace", "dev", ifName, "handle", "ffff:", "ingress")
+}
+
+// removeIngressQdisc removes the ingress qdisc, and with it all ingress filters, from the named interface.
+func removeIngressQdisc(ifName string) error {
+	return tc("qdisc", "del", "dev", ifName, "handle", "ffff:", "ingress")
+}
@@ -0,0 +1,49 @@
+package l2bridge
+
+import (
+	"time"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// defaultTeardownTimeout bounds the wait for the bridge of a deleted network to leave the kernel.
+	defaultTeardownTimeout = 5 * time.Second
+	teardownPollInterval   = 50 * time.Millisecond
+)
+
+// markTearingDown records that the named bridge was deleted and may linger in the kernel for a moment.
+func (d *bridgeDriver) markTearingDown(bridgeName string) {
+	d.Lock()
+	d.tearingDown[bridgeName] = true
+	d.Unlock()
+}
+
+// waitTeardown waits for a bridge deleted along with an earlier network of the same name to disappear, so that a
+// network recreated right after its deletion does not collide with it. Must be called with configNetwork held.
+func (d *bridgeDriver) waitTeardown(bridgeName string) error {
+	d.Lock()
+	pending, timeout := d.tearingDown[bridgeName], d.config.TeardownTimeout
+	d.Unlock()
+	if !pending {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := d.nlh.LinkByName(bridgeName)
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			return types.RetryErrorf("bridge %s of a deleted network is still being torn down", bridgeName)
+		}
+		time.Sleep(teardownPollInterval)
+	}
+
+	d.Lock()
+	delete(d.tearingDown, bridgeName)
+	d.Unlock()
+	return nil
+}
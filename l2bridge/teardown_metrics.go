@@ -0,0 +1,47 @@
+package l2bridge
+
+import (
+	"os/exec"
+)
+
+// Metrics describing endpoint teardown. Objects remaining after teardown indicate a leak.
+const (
+	metricVethsDeleted      = "l2bridge_teardown_veths_deleted_total"
+	metricRulesRemoved      = "l2bridge_teardown_rules_removed_total"
+	metricTeardownMissing   = "l2bridge_teardown_missing_total"
+	metricTeardownLingering = "l2bridge_teardown_lingering_total"
+)
+
+func registerTeardownMetrics(r *metricsRegistry) {
+	r.register(metricVethsDeleted, metricCounter, "Endpoint veth pairs deleted.")
+	r.register(metricRulesRemoved, metricCounter, "Per endpoint rules removed, by kind.", "kind")
+	r.register(metricTeardownMissing, metricCounter, "Objects expected during teardown that were already gone, by kind.", "kind")
+	r.register(metricTeardownLingering, metricCounter, "Objects that remained after teardown, by kind.", "kind")
+}
+
+// verifyLinkGone counts the named interface as lingering if it still exists.
+func (d *bridgeDriver) verifyLinkGone(ifName string) {
+	if !d.config.VerifyTeardown || ifName == "" {
+		return
+	}
+	if _, err := d.nlh.LinkByName(ifName); err == nil {
+		d.metrics.inc(metricTeardownLingering, "kind", "veth")
+	}
+}
+
+// verifyAntispoofGone counts the endpoint's anti-spoofing chain as lingering if it still exists.
+func (d *bridgeDriver) verifyAntispoofGone(ep *bridgeEndpoint) {
+	if !d.config.VerifyTeardown {
+		return
+	}
+	if err := exec.Command("ebtables", "-L", ep.antispoofChain()).Run(); err == nil {
+		d.metrics.inc(metricTeardownLingering, "kind", "ebtables")
+	}
+}
+
+// countRuleRemoval counts the outcome of removing rules of the given kind.
+func (d *bridgeDriver) countRuleRemoval(kind string, err error) {
+	if err == nil {
+		d.metrics.inc(metricRulesRemoved, "kind", kind)
+	}
+}
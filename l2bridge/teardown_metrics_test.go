@@ -0,0 +1,79 @@
+package l2bridge
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// stickyTestHandle is a dry run handle whose deleted links remain.
+type stickyTestHandle struct {
+	*dryRunHandle
+}
+
+func (h *stickyTestHandle) LinkDel(link netlink.Link) error { return nil }
+
+func TestTeardownMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		sticky    bool
+		gone      bool
+		verify    bool
+		deleted   float64
+		missing   float64
+		lingering float64
+	}{
+		{name: "deleted", verify: true, deleted: 1},
+		{name: "already gone", gone: true, verify: true, missing: 1},
+		{name: "lingering", sticky: true, verify: true, deleted: 1, lingering: 1},
+		{name: "lingering unverified", sticky: true, deleted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			ctx := context.Background()
+			if err := d.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+				t.Fatal(err)
+			}
+			ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, 2).To4(), Mask: net.CIDRMask(16, 32)}}
+			if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+				t.Fatal(err)
+			}
+			n, _ := d.getNetwork(testID(1))
+			ep := n.endpoints[testID(2)]
+			h := d.nlh.(*dryRunHandle)
+			if tt.gone {
+				h.LinkDel(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: ep.hostIfName}, PeerName: ep.srcName})
+			}
+			if tt.sticky {
+				d.nlh = &stickyTestHandle{dryRunHandle: h}
+			}
+
+			// Tear the endpoint down as on the host, with the links still faked.
+			d.config.DryRun = false
+			d.config.DataRoot = t.TempDir()
+			d.config.VerifyTeardown = tt.verify
+			if err := d.DeleteEndpoint(ctx, testID(1), testID(2)); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range map[string]float64{
+				metricVethsDeleted:      tt.deleted,
+				metricTeardownMissing:   tt.missing,
+				metricTeardownLingering: tt.lingering,
+			} {
+				var got float64
+				if name == metricVethsDeleted {
+					got = metricSample(d.metrics, name)
+				} else {
+					got = metricSample(d.metrics, name, "kind", "veth")
+				}
+				if got != want {
+					t.Errorf("expected %s %v, got %v", name, want, got)
+				}
+			}
+		})
+	}
+}
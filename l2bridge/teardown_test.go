@@ -0,0 +1,112 @@
+package l2bridge
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/vishvananda/netlink"
+)
+
+// lingerTestHandle is a dry run handle on which a deleted bridge lingers for a number of lookups.
+type lingerTestHandle struct {
+	*dryRunHandle
+	name    string
+	lookups int // -1 lingers forever
+}
+
+func (h *lingerTestHandle) LinkByName(name string) (netlink.Link, error) {
+	h.Lock()
+	linger := name == h.name && h.lookups != 0
+	if linger && h.lookups > 0 {
+		h.lookups--
+	}
+	h.Unlock()
+	if linger {
+		return &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: name}}, nil
+	}
+	return h.dryRunHandle.LinkByName(name)
+}
+
+func TestWaitTeardown(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending bool
+		lookups int
+		retry   bool
+	}{
+		{name: "not deleted", lookups: -1},
+		{name: "gone", pending: true},
+		{name: "lingering", pending: true, lookups: 2},
+		{name: "stuck", pending: true, lookups: -1, retry: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			d.config.TeardownTimeout = 3 * teardownPollInterval
+			d.nlh = &lingerTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle), name: "br0", lookups: tt.lookups}
+			if tt.pending {
+				d.markTearingDown("br0")
+			}
+
+			err := d.waitTeardown("br0")
+			if tt.retry {
+				if _, ok := err.(types.RetryError); !ok {
+					t.Fatalf("expected a RetryError, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if pending := d.tearingDown["br0"]; pending != tt.retry {
+				t.Errorf("expected the bridge still tearing down %v, got %v", tt.retry, pending)
+			}
+		})
+	}
+}
+
+// TestRapidCreateDeleteCreate interleaves creates and deletes of the same network, which must leave the driver
+// holding the network once or not at all, and able to create it again.
+func TestRapidCreateDeleteCreate(t *testing.T) {
+	const workers = 10
+	d := newDryRunDriver()
+	ctx := context.Background()
+	ipam := testIPAMData(t, "10.1.0.0/16")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.CreateNetwork(ctx, testID(1), nil, ipam, nil); err != nil {
+				errs <- err
+			}
+			// The network may already be deleted by another worker.
+			d.DeleteNetwork(ctx, testID(1))
+			if err := d.CreateNetwork(ctx, testID(1), nil, ipam, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("creating the network: %v", err)
+	}
+
+	if n := len(d.getNetworks()); n > 1 {
+		t.Fatalf("expected the network held at most once, got %d networks", n)
+	}
+	if _, err := d.getNetwork(testID(1)); err == nil {
+		if err := d.DeleteNetwork(ctx, testID(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.CreateNetwork(ctx, testID(1), nil, ipam, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.getNetwork(testID(1)); err != nil {
+		t.Error(err)
+	}
+}
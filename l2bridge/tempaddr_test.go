@@ -0,0 +1,115 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netns"
+)
+
+func TestParseUseTempAddr(t *testing.T) {
+	tests := []struct {
+		opt        interface{}
+		want       string
+		badRequest bool
+	}{
+		{opt: "0", want: "0"},
+		{opt: "2", want: "2"},
+		{opt: 1, want: "1"},
+		{opt: "3", badRequest: true},
+		{opt: "yes", badRequest: true},
+		{opt: "", badRequest: true},
+	}
+	for _, tt := range tests {
+		ec, err := parseEndpointOptions(map[string]interface{}{label.UseTempAddr: tt.opt})
+		if tt.badRequest {
+			if _, ok := err.(types.BadRequestError); !ok {
+				t.Errorf("%v: expected a BadRequestError, got %v", tt.opt, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.opt, err)
+			continue
+		}
+		if ec.TempAddr != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.opt, tt.want, ec.TempAddr)
+		}
+	}
+}
+
+func TestTempAddrEndpointInfo(t *testing.T) {
+	d := newDryRunDriver()
+	newDualStackNetwork(t, d, testID(1))
+	ei := &EndpointInterface{AddressIPv6: &net.IPNet{IP: net.ParseIP("2001:db8:1::5"), Mask: net.CIDRMask(64, 128)}}
+	if _, err := d.CreateEndpoint(context.Background(), testID(1), testID(2), ei, map[string]interface{}{label.UseTempAddr: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info[label.UseTempAddr] != "2" {
+		t.Errorf("expected %s 2 in endpoint info, got %q", label.UseTempAddr, info[label.UseTempAddr])
+	}
+}
+
+// newTestSandbox creates a network namespace and returns a path to it usable as a sandbox key, skipping the test
+// where namespaces cannot be created.
+func newTestSandbox(t *testing.T) string {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+	sbox, err := netns.New()
+	if err != nil {
+		t.Skipf("cannot create a network namespace: %v", err)
+	}
+	if err := netns.Set(origin); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sbox.Close() })
+	return fmt.Sprintf("/proc/self/fd/%d", int(sbox))
+}
+
+func TestTempAddrInSandbox(t *testing.T) {
+	const key, path = "net.ipv6.conf.default.use_tempaddr", "/proc/sys/net/ipv6/conf/default/use_tempaddr"
+	host, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	sandboxKey := newTestSandbox(t)
+
+	ep := &bridgeEndpoint{config: &endpointConfiguration{TempAddr: "2"}}
+	replaced, err := applyContainerSysctls(sandboxKey, ep.sandboxSysctls(&JoinResponse{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced[key] != "0" {
+		t.Errorf("expected the sandbox default 0 replaced, got %q", replaced[key])
+	}
+
+	var got []byte
+	if err := inSandbox(sandboxKey, func() (err error) {
+		got, err = ioutil.ReadFile(path)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if v := strings.TrimSpace(string(got)); v != "2" {
+		t.Errorf("expected use_tempaddr 2 in the sandbox, got %s", v)
+	}
+	if now, _ := ioutil.ReadFile(path); string(now) != string(host) {
+		t.Errorf("expected use_tempaddr of the host left at %s, got %s", host, now)
+	}
+}
@@ -0,0 +1,130 @@
+package l2bridge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// topologyNode is a network, bridge, uplink or endpoint in the topology graph.
+type topologyNode struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Name string `json:"name,omitempty"`
+	// Draining is set on networks that accept no new endpoints.
+	Draining bool `json:"draining,omitempty"`
+}
+
+// topologyEdge relates two nodes of the topology graph.
+type topologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// topology is a graph of the layer 2 layout managed by the driver.
+type topology struct {
+	Nodes []topologyNode `json:"nodes"`
+	Edges []topologyEdge `json:"edges"`
+}
+
+// topology builds the graph from the driver state, adding the ports found enslaved to each bridge.
+func (d *bridgeDriver) topology() *topology {
+	t := &topology{Nodes: []topologyNode{}, Edges: []topologyEdge{}}
+
+	d.Lock()
+	networks := make([]*bridgeNetwork, 0, len(d.networks))
+	for _, n := range d.networks {
+		networks = append(networks, n)
+	}
+	nlh := d.nlh
+	d.Unlock()
+	sort.Slice(networks, func(i, j int) bool { return networks[i].id < networks[j].id })
+
+	// Attached ports are looked up by the index of the bridge they are enslaved to.
+	ports := make(map[int][]string)
+	if nlh != nil {
+		links, err := nlh.LinkList()
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to list links for the topology")
+		}
+		for _, l := range links {
+			if master := l.Attrs().MasterIndex; master != 0 {
+				ports[master] = append(ports[master], l.Attrs().Name)
+			}
+		}
+	}
+
+	for _, n := range networks {
+		n.Lock()
+		netID := "network:" + n.id
+		bridgeID := "bridge:" + n.config.BridgeName
+		t.Nodes = append(t.Nodes,
+			topologyNode{ID: netID, Kind: "network", Name: n.id, Draining: n.draining},
+			topologyNode{ID: bridgeID, Kind: "bridge", Name: n.config.BridgeName},
+		)
+		t.Edges = append(t.Edges, topologyEdge{From: netID, To: bridgeID, Kind: "bridge"})
+
+		veths := make(map[string]bool)
+		eids := make([]string, 0, len(n.endpoints))
+		for eid := range n.endpoints {
+			eids = append(eids, eid)
+		}
+		sort.Strings(eids)
+		for _, eid := range eids {
+			ep := n.endpoints[eid]
+			epID := "endpoint:" + eid
+			veths[ep.hostIfName] = true
+			t.Nodes = append(t.Nodes, topologyNode{ID: epID, Kind: "endpoint", Name: ep.hostIfName})
+			t.Edges = append(t.Edges,
+				topologyEdge{From: epID, To: netID, Kind: "member"},
+				topologyEdge{From: epID, To: bridgeID, Kind: "enslaved"},
+			)
+		}
+
+		var attached []string
+		if n.bridge != nil && n.bridge.Link != nil {
+			attached = ports[n.bridge.Link.Attrs().Index]
+		}
+		n.Unlock()
+
+		sort.Strings(attached)
+		for _, name := range attached {
+			if veths[name] {
+				continue
+			}
+			uplinkID := "uplink:" + name
+			t.Nodes = append(t.Nodes, topologyNode{ID: uplinkID, Kind: "uplink", Name: name})
+			t.Edges = append(t.Edges, topologyEdge{From: uplinkID, To: bridgeID, Kind: "enslaved"})
+		}
+	}
+	return t
+}
+
+// writeDOT renders the graph in the Graphviz DOT language.
+func (t *topology) writeDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph l2bridge {"); err != nil {
+		return err
+	}
+	for _, n := range t.Nodes {
+		if _, err := fmt.Fprintf(w, "\t%q [label=%q, shape=%q];\n", n.ID, n.Kind+"\\n"+n.Name, dotShapes[n.Kind]); err != nil {
+			return err
+		}
+	}
+	for _, e := range t.Edges {
+		if _, err := fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", e.From, e.To, e.Kind); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+var dotShapes = map[string]string{
+	"network":  "ellipse",
+	"bridge":   "box",
+	"uplink":   "diamond",
+	"endpoint": "oval",
+}
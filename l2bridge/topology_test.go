@@ -0,0 +1,95 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+// newTopologyDriver returns a driver holding a draining network on br0, with an endpoint on veth1, the uplink eth1
+// enslaved to the bridge and eth2 left out of it.
+func newTopologyDriver() *Driver {
+	d := NewDriver(&Configuration{DryRun: true})
+	h := newDryRunHandle()
+	bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0", Index: 1}}
+	h.LinkAdd(bridge)
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 2, MasterIndex: 1}})
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 3}})
+	h.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "veth1", Index: 4, MasterIndex: 1}})
+	d.bridge.nlh = h
+	d.bridge.networks[testID(1)] = &bridgeNetwork{
+		id:        testID(1),
+		config:    &networkConfiguration{ID: testID(1), BridgeName: "br0"},
+		bridge:    &bridgeInterface{Link: bridge, nlh: h},
+		endpoints: map[string]*bridgeEndpoint{testID(2): {id: testID(2), nid: testID(1), hostIfName: "veth1"}},
+		draining:  true,
+	}
+	return d
+}
+
+func TestTopology(t *testing.T) {
+	d := newTopologyDriver()
+	netID, bridgeID, epID := "network:"+testID(1), "bridge:br0", "endpoint:"+testID(2)
+	want := &topology{
+		Nodes: []topologyNode{
+			{ID: netID, Kind: "network", Name: testID(1), Draining: true},
+			{ID: bridgeID, Kind: "bridge", Name: "br0"},
+			{ID: epID, Kind: "endpoint", Name: "veth1"},
+			{ID: "uplink:eth1", Kind: "uplink", Name: "eth1"},
+		},
+		Edges: []topologyEdge{
+			{From: netID, To: bridgeID, Kind: "bridge"},
+			{From: epID, To: netID, Kind: "member"},
+			{From: epID, To: bridgeID, Kind: "enslaved"},
+			{From: "uplink:eth1", To: bridgeID, Kind: "enslaved"},
+		},
+	}
+	if got := d.bridge.topology(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// An empty driver gives empty lists rather than null.
+	rec := httptest.NewRecorder()
+	NewDriver(&Configuration{DryRun: true}).handleTopology(rec, httptest.NewRequest("GET", "/debug/topology", nil))
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"nodes":[],"edges":[]}` {
+		t.Errorf("expected an empty graph, got %s", got)
+	}
+}
+
+func TestHandleTopology(t *testing.T) {
+	d := newTopologyDriver()
+
+	rec := httptest.NewRecorder()
+	d.handleTopology(rec, httptest.NewRequest("GET", "/debug/topology", nil))
+	var got topology
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(got.Nodes) != 4 || len(got.Edges) != 4 {
+		t.Errorf("expected 4 nodes and 4 edges, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	d.handleTopology(rec, httptest.NewRequest("GET", "/debug/topology?format=dot", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/vnd.graphviz" {
+		t.Errorf("expected a DOT content type, got %s", ct)
+	}
+	dot := rec.Body.String()
+	for _, want := range []string{
+		"digraph l2bridge {\n",
+		`"bridge:br0" [label="bridge\\nbr0", shape="box"];`,
+		`"uplink:eth1" -> "bridge:br0" [label="enslaved"];`,
+		`"endpoint:` + testID(2) + `" -> "network:` + testID(1) + `" [label="member"];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("expected %s in\n%s", want, dot)
+		}
+	}
+	if strings.Contains(dot, "eth2") {
+		t.Errorf("expected eth2, which is off the bridge, left out of\n%s", dot)
+	}
+}
@@ -0,0 +1,107 @@
+package l2bridge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/docker/libnetwork/types"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultTransientErrnos are the host errors a request fails with only momentarily, as on a busy netlink socket or an
+// interface being renamed, so that it fails with a RetryError rather than an InternalError.
+var DefaultTransientErrnos = []syscall.Errno{syscall.EBUSY, syscall.EAGAIN, syscall.ENOBUFS}
+
+// maxErrno bounds the errno values looked up by name.
+const maxErrno = 4096
+
+// ParseErrnos parses a comma separated list of errno names, such as EBUSY,EAGAIN.
+func ParseErrnos(s string) ([]syscall.Errno, error) {
+	byName := make(map[string]syscall.Errno)
+	for e := syscall.Errno(1); e < maxErrno; e++ {
+		if name := unix.ErrnoName(e); name != "" {
+			byName[name] = e
+		}
+	}
+
+	var errnos []syscall.Errno
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		e, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown errno %s", name)
+		}
+		errnos = append(errnos, e)
+	}
+	return errnos, nil
+}
+
+// FormatErrnos lists errnos by name, comma separated, as parsed by ParseErrnos.
+func FormatErrnos(errnos []syscall.Errno) string {
+	names := make([]string, len(errnos))
+	for i, e := range errnos {
+		names[i] = unix.ErrnoName(e)
+	}
+	return strings.Join(names, ",")
+}
+
+// internalError is an InternalError keeping the error it was caused by, so that classifyError can tell a transient
+// cause.
+type internalError struct {
+	msg   string
+	cause error
+}
+
+// internalErrorf is types.InternalErrorf, keeping the last error among the arguments as the cause.
+func internalErrorf(format string, args ...interface{}) error {
+	e := &internalError{msg: fmt.Sprintf(format, args...)}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			e.cause = err
+		}
+	}
+	return e
+}
+
+func (e *internalError) Error() string {
+	return e.msg
+}
+
+func (e *internalError) Unwrap() error {
+	return e.cause
+}
+
+// Internal denotes the type of this error
+func (e *internalError) Internal() {}
+
+// classifyError turns the failure of a request caused by one of the configured transient errnos into a RetryError.
+// Errors already classified otherwise, as a BadRequestError for a misconfiguration, are kept.
+func (d *bridgeDriver) classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch err.(type) {
+	case types.BadRequestError, types.NotFoundError, types.ForbiddenError, types.NoServiceError,
+		types.NotImplementedError, types.TimeoutError, types.RetryError, types.MaskableError:
+		return err
+	}
+
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err
+	}
+	d.Lock()
+	transient := d.config.TransientErrnos
+	d.Unlock()
+	for _, e := range transient {
+		if errno == e {
+			return types.RetryErrorf("%v", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package l2bridge
+
+import (
+	"fmt"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+)
+
+func TestParseErrnos(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []syscall.Errno
+		err  bool
+	}{
+		{in: ""},
+		{in: "EBUSY", want: []syscall.Errno{syscall.EBUSY}},
+		{in: " ebusy, EAGAIN ,,ENOBUFS", want: []syscall.Errno{syscall.EBUSY, syscall.EAGAIN, syscall.ENOBUFS}},
+		{in: "ETIMEDOUT,EINTR", want: []syscall.Errno{syscall.ETIMEDOUT, syscall.EINTR}},
+		{in: "EBUSY,ENOTANERRNO", err: true},
+		{in: "16", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseErrnos(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseErrnos(%q): expected error %v, got %v", tt.in, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseErrnos(%q) = %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+
+	if got := FormatErrnos(DefaultTransientErrnos); got != "EBUSY,EAGAIN,ENOBUFS" {
+		t.Errorf("expected the default transient errnos formatted EBUSY,EAGAIN,ENOBUFS, got %q", got)
+	}
+	if got, _ := ParseErrnos(FormatErrnos(DefaultTransientErrnos)); !reflect.DeepEqual(got, DefaultTransientErrnos) {
+		t.Errorf("expected the formatted errnos parsed back to %v, got %v", DefaultTransientErrnos, got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	d := newDryRunDriver()
+	d.config.TransientErrnos = []syscall.Errno{syscall.EBUSY}
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{name: "transient cause", err: internalErrorf("failed to add link: %v", syscall.EBUSY), retry: true},
+		{name: "wrapped transient cause", err: fmt.Errorf("setup: %w", syscall.EBUSY), retry: true},
+		{name: "other cause", err: internalErrorf("failed to add link: %v", syscall.EEXIST)},
+		{name: "not configured transient", err: internalErrorf("failed to add link: %v", syscall.EAGAIN)},
+		{name: "bad request", err: types.BadRequestErrorf("invalid %v", syscall.EBUSY)},
+		{name: "no cause", err: types.InternalErrorf("failed")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := d.classifyError(tt.err)
+			if _, retry := got.(types.RetryError); retry != tt.retry {
+				t.Errorf("expected a RetryError %v, got %T %v", tt.retry, got, got)
+			}
+			if !tt.retry && got != tt.err {
+				t.Errorf("expected the error kept as is, got %v", got)
+			}
+		})
+	}
+	if err := d.classifyError(nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
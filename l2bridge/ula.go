@@ -0,0 +1,122 @@
+package l2bridge
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/netutils"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+)
+
+const ulaPrefixLen = 64
+
+// deriveULAPrefix derives a unique local /64 prefix (RFC 4193) from the network id. The attempt number is mixed
+// into the derivation so that a colliding prefix can be replaced by another stable one.
+func deriveULAPrefix(id string, attempt uint32) *net.IPNet {
+	var salt [4]byte
+	binary.BigEndian.PutUint32(salt[:], attempt)
+	sum := sha256.Sum256(append([]byte(id), salt[:]...))
+
+	ip := make(net.IP, net.IPv6len)
+	ip[0] = 0xfd
+	// 40-bit global ID followed by a zero subnet ID.
+	copy(ip[1:6], sum[:5])
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ulaPrefixLen, 8*net.IPv6len)}
+}
+
+// maxULAAttempts bounds the prefixes, and the addresses within one, derived before giving up on finding a free one.
+const maxULAAttempts = 16
+
+// assignULA gives the network a derived IPv6 pool not overlapping that of any other network, with the first address
+// of the pool as the gateway, held by the bridge unless asked otherwise. A gateway given with the network must lie in
+// the derived pool. The caller must hold configNetwork.
+func (d *bridgeDriver) assignULA(config *networkConfiguration) error {
+	var pools []*net.IPNet
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		pools = append(pools, n.config.poolsIPv6()...)
+		n.Unlock()
+	}
+
+	var pool *net.IPNet
+	for attempt := uint32(0); pool == nil; attempt++ {
+		if attempt == maxULAAttempts {
+			return types.BadRequestErrorf("no prefix derived for %s on network %s is free of the IPv6 pools of other networks after %d attempts, give an IPv6 pool instead",
+				label.DeriveULA, config.ID, maxULAAttempts)
+		}
+		pool = deriveULAPrefix(config.ID, attempt)
+		for _, other := range pools {
+			if netutils.NetworkOverlaps(pool, other) {
+				pool = nil
+				break
+			}
+		}
+	}
+
+	if config.DefaultGatewayIPv6 != nil && !pool.Contains(config.DefaultGatewayIPv6) {
+		return types.BadRequestErrorf("IPv6 gateway %s is outside of the pool %s derived for %s on network %s",
+			config.DefaultGatewayIPv6, pool, label.DeriveULA, config.ID)
+	}
+
+	gw := make(net.IP, net.IPv6len)
+	copy(gw, pool.IP)
+	gw[net.IPv6len-1] = 1
+
+	config.PoolIPv6 = pool
+	config.ULADerived = true
+	if config.DefaultGatewayIPv6 == nil {
+		config.DefaultGatewayIPv6 = gw
+		if config.assignsGateway() {
+			config.BridgeIPv6 = &net.IPNet{IP: gw, Mask: pool.Mask}
+		}
+	}
+	return nil
+}
+
+// deriveULAAddress derives a stable address of the pool from the endpoint id, with the attempt number mixed in as
+// deriveULAPrefix does.
+func deriveULAAddress(pool *net.IPNet, eid string, attempt uint32) *net.IPNet {
+	var salt [4]byte
+	binary.BigEndian.PutUint32(salt[:], attempt)
+	sum := sha256.Sum256(append([]byte(eid), salt[:]...))
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, pool.IP.To16())
+	copy(ip[ulaPrefixLen/8:], sum[:net.IPv6len-ulaPrefixLen/8])
+	return &net.IPNet{IP: ip, Mask: pool.Mask}
+}
+
+// assignEndpointULA gives the endpoint an address derived from its id in the network's derived pool, passing over
+// the gateway, reserved ranges and addresses of other endpoints.
+func (n *bridgeNetwork) assignEndpointULA(ep *bridgeEndpoint) error {
+	n.Lock()
+	defer n.Unlock()
+	pool, gw := n.config.PoolIPv6, n.config.DefaultGatewayIPv6
+	for attempt := uint32(0); attempt < maxULAAttempts; attempt++ {
+		addr := deriveULAAddress(pool, ep.id, attempt)
+		if addr.IP.Equal(pool.IP) || addr.IP.Equal(gw) {
+			continue
+		}
+		if _, reserved := n.config.reservedRange(addr.IP); reserved {
+			continue
+		}
+		if n.endpointConflict(ep.id, &EndpointInterface{AddressIPv6: addr}) != "" {
+			continue
+		}
+		ep.addrv6 = addr
+		return nil
+	}
+	return types.ForbiddenErrorf("no free address derived for endpoint %s in pool %s of network %s after %d attempts", ep.id, pool, n.id, maxULAAttempts)
+}
+
+// setupBridgeIPv6 assigns the network's IPv6 gateway address to the bridge.
+func setupBridgeIPv6(config *networkConfiguration, i *bridgeInterface) error {
+	if err := i.nlh.AddrAdd(i.Link, &netlink.Addr{IPNet: config.BridgeIPv6}); err != nil {
+		return fmt.Errorf("failed to add IPv6 address %s to bridge: %w", config.BridgeIPv6, err)
+	}
+	return nil
+}
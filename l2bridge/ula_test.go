@@ -0,0 +1,135 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestDeriveULAPrefix(t *testing.T) {
+	ula := &net.IPNet{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(8, 128)}
+	tests := []struct {
+		id      string
+		attempt uint32
+	}{
+		{testID(1), 0},
+		{testID(1), 1},
+		{testID(2), 0},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		pool := deriveULAPrefix(tt.id, tt.attempt)
+		if !pool.IP.Equal(deriveULAPrefix(tt.id, tt.attempt).IP) {
+			t.Errorf("prefix of %s attempt %d is not stable", tt.id, tt.attempt)
+		}
+		if ones, _ := pool.Mask.Size(); ones != ulaPrefixLen || !ula.Contains(pool.IP) {
+			t.Errorf("prefix %s of %s attempt %d is not a unique local /%d", pool, tt.id, tt.attempt, ulaPrefixLen)
+		}
+		if seen[pool.String()] {
+			t.Errorf("prefix %s of %s attempt %d was already derived", pool, tt.id, tt.attempt)
+		}
+		seen[pool.String()] = true
+	}
+}
+
+func TestDeriveULAAddress(t *testing.T) {
+	pool := deriveULAPrefix(testID(1), 0)
+	a, b := deriveULAAddress(pool, testID(2), 0), deriveULAAddress(pool, testID(2), 1)
+	for _, addr := range []*net.IPNet{a, b} {
+		if !pool.Contains(addr.IP) || addr.Mask.String() != pool.Mask.String() {
+			t.Errorf("address %s is not in pool %s", addr, pool)
+		}
+	}
+	if a.IP.Equal(b.IP) {
+		t.Errorf("attempts derived the same address %s", a.IP)
+	}
+	if !a.IP.Equal(deriveULAAddress(pool, testID(2), 0).IP) {
+		t.Errorf("address of attempt 0 is not stable")
+	}
+}
+
+func TestAssignULA(t *testing.T) {
+	id := testID(1)
+	derived := deriveULAPrefix(id, 0)
+	inPool := make(net.IP, net.IPv6len)
+	copy(inPool, derived.IP)
+	inPool[net.IPv6len-1] = 0x20
+
+	tests := []struct {
+		name    string
+		taken   int // Prefixes derived for the network already taken by other networks
+		gateway net.IP
+		pool    *net.IPNet
+		err     bool
+	}{
+		{name: "first prefix", pool: derived},
+		{name: "next free prefix", taken: 3, pool: deriveULAPrefix(id, 3)},
+		{name: "every prefix taken", taken: maxULAAttempts, err: true},
+		{name: "gateway in pool", gateway: inPool, pool: derived},
+		{name: "gateway outside pool", gateway: net.ParseIP("2001:db8::1"), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDryRunDriver()
+			for i := 0; i < tt.taken; i++ {
+				other := fmt.Sprintf("other%d", i)
+				d.networks[other] = &bridgeNetwork{id: other, config: &networkConfiguration{PoolIPv6: deriveULAPrefix(id, uint32(i))}}
+			}
+			config := &networkConfiguration{ID: id, DefaultGatewayIPv6: tt.gateway}
+			err := d.assignULA(config)
+			if tt.err {
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.PoolIPv6.String() != tt.pool.String() || !config.ULADerived {
+				t.Errorf("expected derived pool %s, got %s", tt.pool, config.PoolIPv6)
+			}
+			if tt.gateway != nil && !config.DefaultGatewayIPv6.Equal(tt.gateway) {
+				t.Errorf("expected gateway %s, got %s", tt.gateway, config.DefaultGatewayIPv6)
+			}
+		})
+	}
+}
+
+func TestEndpointULAAddress(t *testing.T) {
+	d := newDryRunDriver()
+	d.ipv6Disabled = func() bool { return false }
+	ctx := context.Background()
+	opts := map[string]interface{}{
+		netlabel.EnableIPv6:  true,
+		netlabel.GenericData: map[string]interface{}{label.DeriveULA: "true"},
+	}
+	if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	n, err := d.getNetwork(testID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := map[string]bool{}
+	for i := 2; i < 6; i++ {
+		v4 := &net.IPNet{IP: net.IPv4(10, 1, 0, byte(i)).To4(), Mask: net.CIDRMask(16, 32)}
+		res, err := d.CreateEndpoint(ctx, testID(1), testID(i), &EndpointInterface{Address: v4}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.AddressIPv6 == nil || !n.config.PoolIPv6.Contains(res.AddressIPv6.IP) {
+			t.Fatalf("endpoint %d was given %v, outside of the derived pool %s", i, res.AddressIPv6, n.config.PoolIPv6)
+		}
+		if addrs[res.AddressIPv6.IP.String()] {
+			t.Errorf("endpoint %d was given the address %s of another", i, res.AddressIPv6.IP)
+		}
+		addrs[res.AddressIPv6.IP.String()] = true
+	}
+}
@@ -0,0 +1,145 @@
+package l2bridge
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// maxIfaceNameLen is the longest interface name the kernel accepts.
+const maxIfaceNameLen = 15
+
+// uplinkPort is the interface attached to a network's bridge for its uplink.
+type uplinkPort struct {
+	name    string
+	wasUp   bool // Whether the interface was up before it was attached
+	created bool // Whether the interface is a VLAN sub-interface created by the driver
+}
+
+// setupUplink finds the interface to attach for the network's uplink. Tagged uplinks are attached through their
+// VLAN sub-interface, which is created unless it already exists.
+func (d *bridgeDriver) setupUplink(config *networkConfiguration) (uplinkPort, error) {
+	if err := d.checkBondUplink(config); err != nil {
+		return uplinkPort{}, err
+	}
+	if config.VLAN == 0 {
+		wasUp, err := d.checkUplink(config.Uplink, config.StealUplink)
+		return uplinkPort{name: config.Uplink, wasUp: wasUp}, err
+	}
+
+	name := fmt.Sprintf("%s.%d", config.Uplink, config.VLAN)
+	if _, err := d.nlh.LinkByName(name); err == nil {
+		wasUp, err := d.checkUplink(name, config.StealUplink)
+		return uplinkPort{name: name, wasUp: wasUp}, err
+	}
+	if len(name) > maxIfaceNameLen {
+		return uplinkPort{}, types.BadRequestErrorf("vlan interface name %s of uplink %s is too long", name, config.Uplink)
+	}
+
+	parent, err := d.nlh.LinkByName(config.Uplink)
+	if err != nil {
+		return uplinkPort{}, types.BadRequestErrorf("uplink %s does not exist: %v", config.Uplink, err)
+	}
+	vlan := &netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{Name: name, ParentIndex: parent.Attrs().Index},
+		VlanId:    config.VLAN,
+	}
+	if err := d.nlh.LinkAdd(vlan); err != nil {
+		return uplinkPort{}, internalErrorf("failed to create vlan interface %s: %v", name, err)
+	}
+	if err := d.nlh.LinkSetUp(vlan); err != nil {
+		if err := d.nlh.LinkDel(vlan); err != nil {
+			logrus.WithError(err).Warnf("Failed to delete vlan interface %s", name)
+		}
+		return uplinkPort{}, internalErrorf("failed to set vlan interface %s up: %v", name, err)
+	}
+	logrus.Infof("Created vlan interface %s for network %s", name, config.ID)
+	return uplinkPort{name: name, wasUp: true, created: true}, nil
+}
+
+// checkUplink checks that the named interface exists and is not a port of any bridge, and reports whether it is up.
+// With steal, an interface enslaved to another device is detached from it instead, cutting that device off.
+func (d *bridgeDriver) checkUplink(name string, steal bool) (bool, error) {
+	link, err := d.nlh.LinkByName(name)
+	if err != nil {
+		return false, types.BadRequestErrorf("uplink %s does not exist: %v", name, err)
+	}
+	if master := link.Attrs().MasterIndex; master != 0 {
+		masterName := "an unknown device"
+		if m, err := d.nlh.LinkByIndex(master); err == nil {
+			masterName = m.Attrs().Name
+		}
+		if !steal {
+			return false, types.BadRequestErrorf("uplink %s is already enslaved to %s, set %s to detach it", name, masterName, label.StealUplink)
+		}
+		logrus.Warnf("STEALING UPLINK: detaching %s from %s as %s is set, traffic of %s through it stops", name, masterName, label.StealUplink, masterName)
+		if err := d.nlh.LinkSetNoMaster(link); err != nil {
+			return false, internalErrorf("failed to detach uplink %s from %s: %v", name, masterName, err)
+		}
+	}
+	return link.Attrs().Flags&net.FlagUp != 0, nil
+}
+
+// setupUplinkUp brings the network's uplink up once attached, as an uplink left down carries no traffic. It is
+// returned to the state it had before by releaseUplink.
+func (n *bridgeNetwork) setupUplinkUp(config *networkConfiguration, i *bridgeInterface) error {
+	link, err := i.nlh.LinkByName(n.uplinkPort)
+	if err != nil {
+		return fmt.Errorf("could not find uplink %s: %w", n.uplinkPort, err)
+	}
+	if link.Attrs().Flags&net.FlagUp != 0 {
+		return nil
+	}
+	if err := i.nlh.LinkSetUp(link); err != nil {
+		return fmt.Errorf("failed to set uplink %s up: %w", n.uplinkPort, err)
+	}
+	return nil
+}
+
+// releaseUplink detaches the network's uplink from the bridge, if it is still attached, and returns it to the up or
+// down state it had before it was attached. A VLAN sub-interface created by the driver is deleted instead. It is best
+// effort.
+func (n *bridgeNetwork) releaseUplink() {
+	name := n.uplinkPort
+	if name == "" || n.bridge == nil {
+		return
+	}
+	nlh := n.bridge.nlh
+
+	link, err := nlh.LinkByName(name)
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to find uplink %s of network %s", name, n.id)
+		return
+	}
+	if n.vlanCreated {
+		if err := nlh.LinkDel(link); err != nil {
+			logrus.WithError(err).Warnf("Failed to delete vlan interface %s of network %s", name, n.id)
+		}
+		return
+	}
+
+	n.releasePromisc(nlh, link)
+
+	// The bridge is looked up by name, as a bridge whose setup failed may not have been refreshed with its index.
+	bridge, err := nlh.LinkByName(n.config.BridgeName)
+	if err != nil || link.Attrs().MasterIndex != bridge.Attrs().Index {
+		return
+	}
+	if err := nlh.LinkSetNoMaster(link); err != nil {
+		logrus.WithError(err).Warnf("Failed to detach uplink %s from bridge %s", name, n.config.BridgeName)
+		return
+	}
+
+	if n.uplinkWasUp {
+		err = nlh.LinkSetUp(link)
+	} else {
+		err = nlh.LinkSetDown(link)
+	}
+	if err != nil {
+		logrus.WithError(err).Warnf("Failed to restore the state of uplink %s", name)
+	}
+}
@@ -0,0 +1,63 @@
+package l2bridge
+
+import (
+	"strings"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// unsafeBondModes are the bonding modes which spread the frames of one source MAC over several slaves, or rewrite
+// their source MACs, confusing the learning of the bridge and of the switches beyond it.
+var unsafeBondModes = map[netlink.BondMode]bool{
+	netlink.BOND_MODE_BALANCE_RR:  true,
+	netlink.BOND_MODE_BALANCE_TLB: true,
+	netlink.BOND_MODE_BALANCE_ALB: true,
+}
+
+// checkBondUplink checks that an uplink which is a bond or team has at least one slave up, so that the network is not
+// created cut off, and warns if the bond's mode is not safe to bridge. Other uplinks pass. The bond is only
+// attached and released as any uplink, and so left intact when the network is deleted.
+func (d *bridgeDriver) checkBondUplink(config *networkConfiguration) error {
+	link, err := d.nlh.LinkByName(config.Uplink)
+	if err != nil {
+		// A missing uplink is reported by setupUplink.
+		return nil
+	}
+	if kind := link.Type(); kind != "bond" && kind != "team" {
+		return nil
+	}
+
+	links, err := d.nlh.LinkList()
+	if err != nil {
+		return internalErrorf("failed to list the slaves of uplink %s: %v", config.Uplink, err)
+	}
+	var slaves, active []string
+	for _, l := range links {
+		if l.Attrs().MasterIndex != link.Attrs().Index {
+			continue
+		}
+		slaves = append(slaves, l.Attrs().Name)
+		if l.Attrs().OperState == netlink.OperUp {
+			active = append(active, l.Attrs().Name)
+		}
+	}
+	if len(slaves) == 0 {
+		return types.BadRequestErrorf("%s uplink %s has no slaves", link.Type(), config.Uplink)
+	}
+	if len(active) == 0 {
+		return types.BadRequestErrorf("%s uplink %s has no active slave, none of %s is up", link.Type(), config.Uplink, strings.Join(slaves, ", "))
+	}
+
+	if bond, ok := link.(*netlink.Bond); ok {
+		if unsafeBondModes[bond.Mode] {
+			logrus.Warnf("Uplink %s of network %s is a bond in %s mode, which is not safe to bridge, prefer active-backup or 802.3ad",
+				config.Uplink, config.ID, bond.Mode)
+		}
+		logrus.Infof("Uplink %s of network %s is a bond in %s mode with active slaves %s", config.Uplink, config.ID, bond.Mode, strings.Join(active, ", "))
+	} else {
+		logrus.Infof("Uplink %s of network %s is a team with active slaves %s", config.Uplink, config.ID, strings.Join(active, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package l2bridge
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/docker/libnetwork/types"
+)
+
+// uplinkGraph associates networks with their uplinks, the ports of a bridge which are not endpoints, through which
+// the MAC addresses of their endpoints reach a physical segment.
+type uplinkGraph struct {
+	// uplinks of each network, by network id.
+	uplinks map[string][]string
+	// networks attached to each uplink, by uplink name.
+	networks map[string][]*bridgeNetwork
+	// ports of each network's bridge which are not endpoints, by network id.
+	ports map[string][]string
+}
+
+// uplinkGraph finds the uplinks of every network from the ports attached to their bridges.
+func (d *bridgeDriver) uplinkGraph() (*uplinkGraph, error) {
+	d.Lock()
+	networks := make([]*bridgeNetwork, 0, len(d.networks))
+	for _, n := range d.networks {
+		networks = append(networks, n)
+	}
+	nlh := d.nlh
+	d.Unlock()
+
+	u := &uplinkGraph{
+		uplinks:  make(map[string][]string),
+		networks: make(map[string][]*bridgeNetwork),
+		ports:    make(map[string][]string),
+	}
+	if nlh == nil {
+		return u, nil
+	}
+	links, err := nlh.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	veths := make(map[string]bool)
+	bridges := make(map[int]*bridgeNetwork)
+	for _, n := range networks {
+		n.Lock()
+		for _, ep := range n.endpoints {
+			veths[ep.hostIfName] = true
+		}
+		if n.bridge != nil && n.bridge.Link != nil {
+			bridges[n.bridge.Link.Attrs().Index] = n
+		}
+		n.Unlock()
+	}
+	names := make(map[int]string)
+	for _, l := range links {
+		names[l.Attrs().Index] = l.Attrs().Name
+	}
+	for _, l := range links {
+		n, ok := bridges[l.Attrs().MasterIndex]
+		if !ok || veths[l.Attrs().Name] {
+			continue
+		}
+		// VLAN sub-interfaces of one device share its segment, so uplinks are named after the parent device.
+		uplink := l.Attrs().Name
+		if parent, ok := names[l.Attrs().ParentIndex]; ok && l.Attrs().ParentIndex != 0 {
+			uplink = parent
+		}
+		u.ports[n.id] = append(u.ports[n.id], l.Attrs().Name)
+		u.uplinks[n.id] = append(u.uplinks[n.id], uplink)
+		u.networks[uplink] = append(u.networks[uplink], n)
+	}
+	return u, nil
+}
+
+// checkUplinkMAC rejects a static MAC address already used by an endpoint of the network, or of any network sharing
+// an uplink with it.
+func (d *bridgeDriver) checkUplinkMAC(n *bridgeNetwork, mac net.HardwareAddr) error {
+	u, err := d.uplinkGraph()
+	if err != nil {
+		return internalErrorf("failed to find the uplinks of network %s: %v", n.id, err)
+	}
+
+	if eid := n.endpointWithMAC(mac); eid != "" {
+		return types.BadRequestErrorf("mac address %s is already used by endpoint %s", mac, eid)
+	}
+	checked := map[string]bool{n.id: true}
+	for _, uplink := range u.uplinks[n.id] {
+		for _, other := range u.networks[uplink] {
+			if checked[other.id] {
+				continue
+			}
+			checked[other.id] = true
+			if eid := other.endpointWithMAC(mac); eid != "" {
+				return types.BadRequestErrorf("mac address %s is already used by endpoint %s of network %s, which shares uplink %s",
+					mac, eid, other.id, uplink)
+			}
+		}
+	}
+	return nil
+}
+
+// endpointWithMAC gives the id of the network's endpoint with the given MAC address, or the empty string if none.
+func (n *bridgeNetwork) endpointWithMAC(mac net.HardwareAddr) string {
+	n.Lock()
+	defer n.Unlock()
+	for eid, ep := range n.endpoints {
+		if bytes.Equal(ep.macAddress, mac) {
+			return eid
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+)
+
+// newUplinkMACDriver returns a driver with networks 1 and 2 attached to VLANs of eth1, network 3 attached to eth2,
+// and an endpoint of network 1 with the MAC address 02:42:0a:01:00:05.
+func newUplinkMACDriver(t *testing.T, unique string) *bridgeDriver {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	h := d.nlh.(*dryRunHandle)
+	h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 2}})
+	ports := []netlink.Link{
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Name: "eth1.10", Index: 3, MasterIndex: 11, ParentIndex: 2}, VlanId: 10},
+		&netlink.Vlan{LinkAttrs: netlink.LinkAttrs{Name: "eth1.20", Index: 4, MasterIndex: 12, ParentIndex: 2}, VlanId: 20},
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth2", Index: 5, MasterIndex: 13}},
+	}
+	for i, port := range ports {
+		n := i + 1
+		opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.UniqueUplinkMAC: unique}}
+		if err := d.CreateNetwork(ctx, testID(n), opts, testIPAMData(t, fmt.Sprintf("10.%d.0.0/16", n)), nil); err != nil {
+			t.Fatal(err)
+		}
+		nw, _ := d.getNetwork(testID(n))
+		bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: fmt.Sprintf("br%d", n), Index: 10 + n}}
+		h.LinkAdd(bridge)
+		h.LinkAdd(port)
+		nw.bridge.Link = bridge
+	}
+	mac, _ := net.ParseMAC("02:42:0a:01:00:05")
+	ei := &EndpointInterface{Address: mustCIDR(t, "10.1.0.5/16"), MacAddress: mac}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(10), ei, nil); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestUniqueUplinkMAC(t *testing.T) {
+	tests := []struct {
+		name       string
+		unique     string
+		network    int
+		mac        string
+		badRequest bool
+	}{
+		{name: "same network", unique: "true", network: 1, mac: "02:42:0a:01:00:05", badRequest: true},
+		{name: "network sharing the uplink", unique: "true", network: 2, mac: "02:42:0a:01:00:05", badRequest: true},
+		{name: "network on another uplink", unique: "true", network: 3, mac: "02:42:0a:01:00:05"},
+		{name: "other MAC", unique: "true", network: 2, mac: "02:42:0a:01:00:06"},
+		{name: "not enforced", unique: "false", network: 2, mac: "02:42:0a:01:00:05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newUplinkMACDriver(t, tt.unique)
+			mac, _ := net.ParseMAC(tt.mac)
+			ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.%d.0.6/16", tt.network)), MacAddress: mac}
+			_, err := d.CreateEndpoint(context.Background(), testID(tt.network), testID(11), ei, nil)
+			if !tt.badRequest {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if _, ok := err.(types.BadRequestError); !ok {
+				t.Fatalf("expected a BadRequestError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUplinkGraph(t *testing.T) {
+	d := newUplinkMACDriver(t, "true")
+	u, err := d.uplinkGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range map[int]string{1: "eth1", 2: "eth1", 3: "eth2"} {
+		if got := u.uplinks[testID(n)]; !equalStrings(got, []string{want}) {
+			t.Errorf("expected network %d on uplink %s, got %v", n, want, got)
+		}
+	}
+	if got := len(u.networks["eth1"]); got != 2 {
+		t.Errorf("expected 2 networks on eth1, got %d", got)
+	}
+	if got := u.ports[testID(2)]; !equalStrings(got, []string{"eth1.20"}) {
+		t.Errorf("expected port eth1.20 on network 2, got %v", got)
+	}
+}
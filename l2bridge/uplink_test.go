@@ -0,0 +1,87 @@
+package l2bridge
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/types"
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/vishvananda/netlink"
+)
+
+// uplinkTestHandle is a dry run handle that finds links by index and records the links detached from their master.
+type uplinkTestHandle struct {
+	*dryRunHandle
+	detached []string
+}
+
+func (h *uplinkTestHandle) LinkByIndex(index int) (netlink.Link, error) {
+	links, _ := h.LinkList()
+	for _, link := range links {
+		if link.Attrs().Index == index {
+			return link, nil
+		}
+	}
+	return nil, netlink.LinkNotFoundError{}
+}
+
+func (h *uplinkTestHandle) LinkSetNoMaster(link netlink.Link) error {
+	h.detached = append(h.detached, link.Attrs().Name)
+	link.Attrs().MasterIndex = 0
+	return nil
+}
+
+func TestSetupUplinkEnslaved(t *testing.T) {
+	tests := []struct {
+		name       string
+		master     int
+		steal      bool
+		badRequest bool
+		detached   []string
+	}{
+		{name: "free uplink"},
+		{name: "enslaved uplink rejected", master: 7, badRequest: true},
+		{name: "enslaved uplink stolen", master: 7, steal: true, detached: []string{"eth1"}},
+		{name: "free uplink with steal", steal: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &uplinkTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle)}
+			h.LinkAdd(&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br-other", Index: 7}})
+			h.LinkAdd(&netlink.Device{LinkAttrs: netlink.LinkAttrs{Name: "eth1", Index: 3, MasterIndex: tt.master, Flags: net.FlagUp}})
+			d := newDryRunDriver()
+			d.nlh = h
+
+			port, err := d.setupUplink(&networkConfiguration{ID: testID(1), Uplink: "eth1", StealUplink: tt.steal})
+			if tt.badRequest {
+				if _, ok := err.(types.BadRequestError); !ok {
+					t.Fatalf("expected a BadRequestError, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "br-other") {
+					t.Errorf("expected the error to name the current master br-other, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if port.name != "eth1" || !port.wasUp {
+				t.Errorf("expected uplink eth1 up, got %+v", port)
+			}
+			if !equalStrings(h.detached, tt.detached) {
+				t.Errorf("expected %v detached, got %v", tt.detached, h.detached)
+			}
+		})
+	}
+}
+
+// TestBondXmitHashPolicyRejected checks the bond hash policy option fails the network rather than being ignored, as
+// the driver leaves the bond of an uplink as the host configured it.
+func TestBondXmitHashPolicyRejected(t *testing.T) {
+	c := &networkConfiguration{}
+	err := c.fromLabels(map[string]interface{}{label.Uplink: "bond0", label.BondXmitHashPolicy: "layer3+4"})
+	if _, ok := err.(types.BadRequestError); !ok {
+		t.Fatalf("expected a BadRequestError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), label.BondXmitHashPolicy) {
+		t.Errorf("expected the error to name %s, got %v", label.BondXmitHashPolicy, err)
+	}
+}
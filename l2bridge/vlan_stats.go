@@ -0,0 +1,124 @@
+package l2bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/nategraf/l2bridge-driver/label"
+	"github.com/sirupsen/logrus"
+)
+
+// Metrics carrying the per-VLAN counters of the ports of networks with VLAN stats.
+const (
+	metricVLANBytes   = "l2bridge_vlan_bytes_total"
+	metricVLANPackets = "l2bridge_vlan_packets_total"
+)
+
+func registerVLANStatsMetrics(r *metricsRegistry) {
+	r.register(metricVLANBytes, metricCounter, "Bytes of each VLAN on endpoint ports of networks with VLAN stats, by direction.", "network", "endpoint", "vlan", "direction")
+	r.register(metricVLANPackets, metricCounter, "Packets of each VLAN on endpoint ports of networks with VLAN stats, by direction.", "network", "endpoint", "vlan", "direction")
+}
+
+// setupVLANStats enables per-VLAN and per-port VLAN accounting on the bridge. Kernels without the feature only
+// produce a warning, so that the network remains usable without accounting.
+func setupVLANStats(config *networkConfiguration, i *bridgeInterface) error {
+	for _, param := range []string{"vlan_stats_enabled", "vlan_stats_per_port"} {
+		path := fmt.Sprintf("/sys/class/net/%s/bridge/%s", config.BridgeName, param)
+		if err := setSysBoolParam(path, true); err != nil {
+			if os.IsNotExist(err) {
+				logrus.Warnf("Kernel does not support %s on bridge %s, VLAN stats will be unavailable", param, config.BridgeName)
+				return nil
+			}
+			return fmt.Errorf("failed to enable %s on bridge %s: %w", param, config.BridgeName, err)
+		}
+	}
+	return nil
+}
+
+// vlanStats holds the traffic counters of one VLAN on a bridge port.
+type vlanStats struct {
+	VLAN      uint16 `json:"vlan"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+}
+
+// report adds the counters to an endpoint info map, keyed by VLAN id.
+func (s vlanStats) report(m map[string]string) {
+	prefix := label.VLANStatsPrefix + strconv.Itoa(int(s.VLAN)) + "."
+	m[prefix+"rx_bytes"] = strconv.FormatUint(s.RxBytes, 10)
+	m[prefix+"rx_packets"] = strconv.FormatUint(s.RxPackets, 10)
+	m[prefix+"tx_bytes"] = strconv.FormatUint(s.TxBytes, 10)
+	m[prefix+"tx_packets"] = strconv.FormatUint(s.TxPackets, 10)
+}
+
+// readVLANStats returns the per-VLAN counters of the named bridge port, as reported by the bridge utility.
+func readVLANStats(ifName string) ([]vlanStats, error) {
+	args := []string{"-s", "-j", "vlan", "show", "dev", ifName}
+	out, err := exec.Command("bridge", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("bridge %s failed: %w", strings.Join(args, " "), err)
+	}
+	return parseVLANStats(out, ifName)
+}
+
+// parseVLANStats extracts the counters of the named port from the JSON output of "bridge -s -j vlan show".
+func parseVLANStats(out []byte, ifName string) ([]vlanStats, error) {
+	var ports []struct {
+		IfName string      `json:"ifname"`
+		VLANs  []vlanStats `json:"vlans"`
+	}
+	if err := json.Unmarshal(out, &ports); err != nil {
+		return nil, fmt.Errorf("failed to parse VLAN stats: %w", err)
+	}
+	for _, p := range ports {
+		if p.IfName == ifName {
+			return p.VLANs, nil
+		}
+	}
+	return nil, nil
+}
+
+// updateVLANStatsMetrics samples the per-VLAN counters of the endpoint ports of every network with VLAN stats.
+func (d *bridgeDriver) updateVLANStatsMetrics() {
+	type port struct{ nid, eid, ifName string }
+	var ports []port
+	for _, n := range d.getNetworks() {
+		n.Lock()
+		if n.config.VLANStats {
+			for _, ep := range n.endpoints {
+				if ep.hostIfName != "" {
+					ports = append(ports, port{n.id, ep.id, ep.hostIfName})
+				}
+			}
+		}
+		n.Unlock()
+	}
+
+	for _, p := range ports {
+		stats, err := d.vlanCounters(p.ifName)
+		if err != nil {
+			logrus.WithError(err).Debugf("Failed to read VLAN stats of endpoint %s", p.eid)
+			continue
+		}
+		for _, s := range stats {
+			vlan := strconv.Itoa(int(s.VLAN))
+			for _, c := range []struct {
+				metric, direction string
+				value             uint64
+			}{
+				{metricVLANBytes, "rx", s.RxBytes},
+				{metricVLANBytes, "tx", s.TxBytes},
+				{metricVLANPackets, "rx", s.RxPackets},
+				{metricVLANPackets, "tx", s.TxPackets},
+			} {
+				d.metrics.set(c.metric, float64(c.value), "network", p.nid, "endpoint", p.eid, "vlan", vlan, "direction", c.direction)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package l2bridge
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/libnetwork/netlabel"
+	"github.com/nategraf/l2bridge-driver/label"
+)
+
+func TestParseVLANStats(t *testing.T) {
+	out := []byte(`[{"ifname":"veth1","vlans":[{"vlan":1,"rx_bytes":100,"rx_packets":2,"tx_bytes":300,"tx_packets":4},` +
+		`{"vlan":10,"rx_bytes":5,"rx_packets":1,"tx_bytes":0,"tx_packets":0}]},{"ifname":"veth2","vlans":[{"vlan":1}]}]`)
+	tests := []struct {
+		ifName string
+		out    []byte
+		want   []vlanStats
+		err    bool
+	}{
+		{ifName: "veth1", out: out, want: []vlanStats{
+			{VLAN: 1, RxBytes: 100, RxPackets: 2, TxBytes: 300, TxPackets: 4},
+			{VLAN: 10, RxBytes: 5, RxPackets: 1},
+		}},
+		{ifName: "veth2", out: out, want: []vlanStats{{VLAN: 1}}},
+		{ifName: "veth3", out: out},
+		{ifName: "veth1", out: []byte("not json"), err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseVLANStats(tt.out, tt.ifName)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.ifName, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.ifName, tt.want, got)
+		}
+	}
+}
+
+func TestVLANStatsReported(t *testing.T) {
+	d := newDryRunDriver()
+	ctx := context.Background()
+	opts := map[string]interface{}{netlabel.GenericData: map[string]interface{}{label.VLANStats: "true"}}
+	if err := d.CreateNetwork(ctx, testID(1), opts, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	ei := &EndpointInterface{Address: &net.IPNet{IP: net.IPv4(10, 1, 0, 2).To4(), Mask: net.CIDRMask(16, 32)}}
+	if _, err := d.CreateEndpoint(ctx, testID(1), testID(2), ei, nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := d.getNetwork(testID(1))
+	hostIfName := n.endpoints[testID(2)].hostIfName
+	d.vlanCounters = func(ifName string) ([]vlanStats, error) {
+		if ifName != hostIfName {
+			t.Errorf("read VLAN stats of %s rather than the endpoint port %s", ifName, hostIfName)
+		}
+		return []vlanStats{{VLAN: 10, RxBytes: 100, RxPackets: 2, TxBytes: 300, TxPackets: 4}}, nil
+	}
+
+	info, err := d.EndpointInfo(testID(1), testID(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"rx_bytes": "100", "rx_packets": "2", "tx_bytes": "300", "tx_packets": "4"} {
+		if got := info[label.VLANStatsPrefix+"10."+key]; got != want {
+			t.Errorf("expected %s %s in endpoint info, got %q", key, want, got)
+		}
+	}
+
+	d.updateVLANStatsMetrics()
+	var buf bytes.Buffer
+	if err := d.metrics.writeText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		metricVLANBytes + `{network="` + testID(1) + `",endpoint="` + testID(2) + `",vlan="10",direction="rx"} 100`,
+		metricVLANBytes + `{network="` + testID(1) + `",endpoint="` + testID(2) + `",vlan="10",direction="tx"} 300`,
+		metricVLANPackets + `{network="` + testID(1) + `",endpoint="` + testID(2) + `",vlan="10",direction="rx"} 2`,
+		metricVLANPackets + `{network="` + testID(1) + `",endpoint="` + testID(2) + `",vlan="10",direction="tx"} 4`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected metric %s, got\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package l2bridge
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/docker/libnetwork/iptables"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// warmRestart brings a restored network, whose bridge survived the restart, and its endpoints back in line with the
+// stored state, as containers may have kept running while the driver was down. A port let go of the bridge is
+// enslaved again, an address lost from a container interface is added again, and the rules of the network and its
+// endpoints are reinstalled. Every step is idempotent: rules which may linger are removed before being installed, so
+// that they are neither missing nor duplicated. It is best effort, and failed steps are only logged.
+func (d *bridgeDriver) warmRestart(n *bridgeNetwork) {
+	config := n.config
+	log := logrus.WithField("network", n.id)
+	var repaired []string
+	fail := func(step string, err error) {
+		log.WithError(err).Warnf("Warm restart step failed: %s", step)
+	}
+
+	// The iptables rules outlive the driver, but must be registered again to be removed with the network.
+	if d.config.EnableIPTables {
+		if err := n.setupIPTables(config, n.bridge); err != nil {
+			fail("reinstall forwarding rules", err)
+		}
+		if config.IsolateHost {
+			if err := n.setupHostIsolation(config, n.bridge); err != nil {
+				fail("reinstall host isolation rules", err)
+			}
+		}
+		if config.Internal {
+			if err := n.setupInternal(config, n.bridge); err != nil {
+				fail("reinstall internal network rules", err)
+			}
+		}
+	}
+
+	if config.UplinkMSSClamp && n.uplinkPort != "" {
+		if err := n.setupUplinkMSSClamp(config, n.bridge); err != nil {
+			fail("reinstall uplink MSS clamping", err)
+		}
+	}
+
+	if len(config.PortGroups) != 0 {
+		if err := n.setupPortGroups(config, n.bridge); err != nil {
+			fail("reinstall port group shaping", err)
+		}
+	}
+
+	for _, ep := range n.endpoints {
+		host, err := d.nlh.LinkByName(ep.hostIfName)
+		if err != nil {
+			fail("find interface of endpoint "+ep.id, err)
+			continue
+		}
+		if host.Attrs().MasterIndex != n.bridge.Link.Attrs().Index {
+			if err := addToBridge(d.nlh, ep.hostIfName, config.BridgeName); err != nil {
+				fail("enslave interface of endpoint "+ep.id, err)
+			} else {
+				repaired = append(repaired, "port "+ep.hostIfName)
+			}
+		}
+		if host.Attrs().Flags&net.FlagUp == 0 {
+			if err := d.nlh.LinkSetUp(host); err != nil {
+				fail("bring up interface of endpoint "+ep.id, err)
+			}
+		}
+
+		// The DSCP map and BUM policer share the ingress qdisc, so both are installed again over a fresh one.
+		if len(config.DSCPMap) != 0 || config.BUMRateLimit != 0 {
+			removeIngressQdisc(ep.hostIfName)
+			if len(config.DSCPMap) != 0 {
+				if err := setupDSCPMap(ep.hostIfName, config.DSCPMap); err != nil {
+					fail("reinstall DSCP map of endpoint "+ep.id, err)
+				}
+			}
+			if config.BUMRateLimit != 0 {
+				if err := setupBUMPolicer(ep.hostIfName, config.BUMRateLimit); err != nil {
+					fail("reinstall BUM policer of endpoint "+ep.id, err)
+				}
+			}
+		}
+
+		// The remaining pieces belong to joined endpoints only.
+		if ep.sandboxKey == "" {
+			continue
+		}
+		if _, err := os.Stat(ep.sandboxKey); err == nil {
+			var addrs []*net.IPNet
+			if ep.config.wantsIPv4() {
+				addrs = append(addrs, ep.addr)
+			}
+			if ep.config.wantsIPv6() {
+				addrs = append(addrs, ep.addrv6)
+			}
+			added, err := ensureSandboxAddresses(ep.sandboxKey, ep.macAddress, addrs...)
+			if err != nil {
+				fail("check addresses of endpoint "+ep.id, err)
+			}
+			for _, addr := range added {
+				repaired = append(repaired, fmt.Sprintf("address %s of endpoint %s", addr, ep.id))
+			}
+		}
+		if config.ProxyNDP && ep.addrv6 != nil && ep.config.wantsIPv6() {
+			if err := n.bridge.nlh.NeighSet(n.bridge.proxyNeighbor(ep.addrv6.IP)); err != nil {
+				fail("add proxy neighbor of endpoint "+ep.id, err)
+			}
+		}
+		if _, ok := config.PortGroups[ep.config.PortGroup]; ok {
+			if err := n.setupPortGroup(ep, ep.config.PortGroup); err != nil {
+				fail("reinstall port group of endpoint "+ep.id, err)
+			}
+		}
+		if rate := ep.config.Bandwidth; rate != 0 {
+			if err := ep.setupBandwidth(rate); err != nil {
+				fail("reinstall bandwidth limit of endpoint "+ep.id, err)
+			}
+		}
+		if ep.config.Antispoof {
+			ep.removeAntispoof()
+			if err := ep.setupAntispoof(); err != nil {
+				fail("reinstall anti-spoofing rules of endpoint "+ep.id, err)
+			}
+		}
+		if limit := ep.config.MaxConns; limit != 0 {
+			ep.removeConnLimit()
+			if err := ep.setupConnLimit(limit); err != nil {
+				fail("reinstall connection limit of endpoint "+ep.id, err)
+			}
+		}
+		if ep.peerPolicy {
+			ep.removePeerPolicy()
+			if err := ep.setupPeerPolicy(); err != nil {
+				fail("reinstall peer policy of endpoint "+ep.id, err)
+			}
+		}
+		if ep.masqueradeIface != "" && ep.masqueradeAddr != nil {
+			for _, r := range masqueradeRules(config.BridgeName, ep.masqueradeIface, ep.masqueradeAddr) {
+				if err := programRule(r.table, r.chain, iptables.Insert, r.args); err != nil {
+					fail("reinstall masquerading of endpoint "+ep.id, err)
+				}
+			}
+		}
+		for _, pb := range ep.portMapping {
+			for _, r := range portMappingRules(config.BridgeName, pb) {
+				if iptables.Exists(r.table, r.chain, r.args...) {
+					continue
+				}
+				if err := programRule(r.table, r.chain, iptables.Insert, r.args); err != nil {
+					fail("reinstall port mapping of endpoint "+ep.id, err)
+				}
+			}
+		}
+	}
+	n.updatePeerPolicies()
+
+	// Replace the MSS clamping table, which may be gone or stale, and is recomputed from the endpoints.
+	n.Lock()
+	if n.mssClampMTU != 0 {
+		nft("delete", "table", "bridge", n.mssClampTable())
+		n.mssClampMTU = 0
+	}
+	n.Unlock()
+	if err := n.updateMSSClamp(); err != nil {
+		fail("reinstall MSS clamping", err)
+	}
+
+	if len(repaired) != 0 {
+		log.Infof("Warm restart repaired %s", strings.Join(repaired, ", "))
+	}
+	log.Infof("Warm restarted network with %d endpoints", len(n.endpoints))
+}
+
+// ensureSandboxAddresses adds any of the given addresses missing from the interface with the given MAC in the
+// sandbox, and returns those it added.
+func ensureSandboxAddresses(sandboxKey string, mac net.HardwareAddr, addrs ...*net.IPNet) ([]*net.IPNet, error) {
+	sbox, err := netns.GetFromPath(sandboxKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sandbox %s: %w", sandboxKey, err)
+	}
+	defer sbox.Close()
+
+	nlh, err := netlink.NewHandleAt(sbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink handle in sandbox %s: %w", sandboxKey, err)
+	}
+	defer nlh.Delete()
+
+	links, err := nlh.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	var link netlink.Link
+	for _, l := range links {
+		if bytes.Equal(l.Attrs().HardwareAddr, mac) {
+			link = l
+			break
+		}
+	}
+	if link == nil {
+		return nil, fmt.Errorf("no interface with MAC %s in sandbox %s", mac, sandboxKey)
+	}
+
+	present, err := nlh.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+	var added []*net.IPNet
+	for _, addr := range addrs {
+		if addr == nil || hasAddr(present, addr) {
+			continue
+		}
+		if err := nlh.AddrAdd(link, &netlink.Addr{IPNet: addr}); err != nil {
+			return added, fmt.Errorf("failed to add %s to %s: %w", addr, link.Attrs().Name, err)
+		}
+		added = append(added, addr)
+	}
+	return added, nil
+}
+
+// hasAddr reports whether addr is among the listed addresses.
+func hasAddr(addrs []netlink.Addr, addr *net.IPNet) bool {
+	for _, a := range addrs {
+		if a.IPNet != nil && a.IPNet.String() == addr.String() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package l2bridge
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// addSandboxInterface adds a veth pair to the sandbox, one end with the given MAC standing in for the container side
+// of an endpoint's veth pair.
+func addSandboxInterface(t *testing.T, sandboxKey string, mac net.HardwareAddr) netlink.Link {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	sbox, err := netns.GetFromPath(sandboxKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sbox.Close()
+	nlh, err := netlink.NewHandleAt(sbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nlh.Delete()
+	link := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "eth0", HardwareAddr: mac}, PeerName: "peer0"}
+	if err := nlh.LinkAdd(link); err != nil {
+		t.Skipf("cannot add an interface to the sandbox: %v", err)
+	}
+	return link
+}
+
+// sandboxAddrs lists the addresses of the sandbox interface.
+func sandboxAddrs(t *testing.T, sandboxKey string, link netlink.Link) []string {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	sbox, err := netns.GetFromPath(sandboxKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sbox.Close()
+	nlh, err := netlink.NewHandleAt(sbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nlh.Delete()
+	addrs, err := nlh.AddrList(link, netlink.FAMILY_V4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strs []string
+	for _, addr := range addrs {
+		strs = append(strs, addr.IPNet.String())
+	}
+	return strs
+}
+
+// TestWarmRestart persists the state of a network with live endpoints, drops the driver, and restores the state in a
+// new driver facing a host where a port left the bridge, a container lost its address, an endpoint's interface is
+// gone and the nftables rules were flushed.
+func TestWarmRestart(t *testing.T) {
+	dataRoot := t.TempDir()
+	sandboxKey := newTestSandbox(t)
+
+	before := newDryRunDriver()
+	ctx := context.Background()
+	if err := before.CreateNetwork(ctx, testID(1), nil, testIPAMData(t, "10.1.0.0/16"), nil); err != nil {
+		t.Fatal(err)
+	}
+	n, _ := before.getNetwork(testID(1))
+	for _, eid := range []int{2, 3, 4} {
+		ei := &EndpointInterface{Address: mustCIDR(t, fmt.Sprintf("10.1.0.%d/16", eid))}
+		if _, err := before.CreateEndpoint(ctx, testID(1), testID(eid), ei, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Endpoint 2 is joined to the sandbox with a connection limit, endpoint 3 is joined to a sandbox gone since with
+	// a peer policy, and the interface of endpoint 4 is gone after the restart.
+	a, b, c := n.endpoints[testID(2)], n.endpoints[testID(3)], n.endpoints[testID(4)]
+	a.sandboxKey, a.config.MaxConns = sandboxKey, 100
+	b.sandboxKey, b.config.Peers, b.peerPolicy = filepath.Join(dataRoot, "gone"), []string{"10.9.9.9"}, true
+	sandboxLink := addSandboxInterface(t, sandboxKey, a.macAddress)
+	before.config.DryRun, before.config.DataRoot = false, dataRoot
+	if err := before.storeUpdate(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &masterTestHandle{dryRunHandle: newDryRunHandle().(*dryRunHandle), enslaved: map[string]string{}}
+	h.LinkAdd(&netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: n.config.BridgeName, Index: 1}})
+	h.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: a.hostIfName, Index: 2, MasterIndex: 1, Flags: net.FlagUp}})
+	h.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: b.hostIfName, Index: 3, Flags: net.FlagUp}})
+	after := newDryRunDriver()
+	after.nlh = h
+	after.config.DryRun, after.config.DataRoot, after.config.WarmRestart = false, dataRoot, true
+	after.config.EnableIPTables = false
+	cmds := recordCommands(t)
+	if err := after.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := after.getNetwork(testID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restored.endpoints[c.id]; ok || len(restored.endpoints) != 2 {
+		t.Errorf("expected only endpoint %s, whose interface is gone, dropped, got %d endpoints", c.id, len(restored.endpoints))
+	}
+	if len(h.enslaved) != 1 || h.enslaved[b.hostIfName] != n.config.BridgeName {
+		t.Errorf("expected only %s enslaved again, got %v", b.hostIfName, h.enslaved)
+	}
+	if got := sandboxAddrs(t, sandboxKey, sandboxLink); !equalStrings(got, []string{"10.1.0.2/16"}) {
+		t.Errorf("expected the address of endpoint 2 added back in its sandbox, got %v", got)
+	}
+	// The rules are removed before being installed, and the peer policy blocks endpoint 2 but not the dropped 4.
+	connTable, peerTable := a.connLimitTable(), b.peerTable()
+	want := []string{
+		"nft delete table bridge " + connTable,
+		"nft add table bridge " + connTable,
+		"nft add chain bridge " + connTable + " forward { type filter hook forward priority 0 ; }",
+		"nft add rule bridge " + connTable + " forward iifname " + a.hostIfName + " ct state new ct count over 100 drop",
+		"nft add chain bridge " + connTable + " input { type filter hook input priority 0 ; }",
+		"nft add rule bridge " + connTable + " input iifname " + a.hostIfName + " ct state new ct count over 100 drop",
+		"nft delete table bridge " + peerTable,
+		"nft add table bridge " + peerTable,
+		"nft add chain bridge " + peerTable + " forward { type filter hook forward priority 0 ; }",
+		"nft add set bridge " + peerTable + " blocked4 { type ipv4_addr ; }",
+		"nft add set bridge " + peerTable + " blocked6 { type ipv6_addr ; }",
+		"nft add rule bridge " + peerTable + " forward iifname " + b.hostIfName + " ip daddr @blocked4 drop",
+		"nft add rule bridge " + peerTable + " forward oifname " + b.hostIfName + " ip saddr @blocked4 drop",
+		"nft add rule bridge " + peerTable + " forward iifname " + b.hostIfName + " ip6 daddr @blocked6 drop",
+		"nft add rule bridge " + peerTable + " forward oifname " + b.hostIfName + " ip6 saddr @blocked6 drop",
+		"nft flush set bridge " + peerTable + " blocked4",
+		"nft add element bridge " + peerTable + " blocked4 { 10.1.0.2 }",
+		"nft flush set bridge " + peerTable + " blocked6",
+	}
+	sort.Strings(want)
+	sort.Strings(*cmds)
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected commands\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(*cmds, "\n"))
+	}
+
+	// A second pass finds nothing left to repair, and replaces the rules rather than duplicating them.
+	*cmds, h.enslaved = nil, map[string]string{}
+	h.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: b.hostIfName, Index: 3, MasterIndex: 1, Flags: net.FlagUp}})
+	after.warmRestart(restored)
+	if len(h.enslaved) != 0 {
+		t.Errorf("expected nothing enslaved again, got %v", h.enslaved)
+	}
+	if got := sandboxAddrs(t, sandboxKey, sandboxLink); !equalStrings(got, []string{"10.1.0.2/16"}) {
+		t.Errorf("expected the sandbox address left alone, got %v", got)
+	}
+	sort.Strings(*cmds)
+	if !equalStrings(*cmds, want) {
+		t.Errorf("expected the same commands on the second pass, got\n%s", strings.Join(*cmds, "\n"))
+	}
+}
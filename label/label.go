@@ -7,9 +7,252 @@ const (
 	// BridgeName label to specify a networks bridge name.
 	BridgeName = "l2bridge.name"
 
-	// GatewayIPv4 label to specify a network's default gateway.
+	// AllocatedBridgeName label passed by a swarm manager to the nodes of a network with the bridge name it allocated,
+	// used unless BridgeName is given.
+	AllocatedBridgeName = "l2bridge.allocated_name"
+
+	// GatewayIPv4 label to specify a network's default gateway. As a join option it gives the container its own
+	// gateway, or none at all with the value none.
 	GatewayIPv4 = "l2bridge.gateway"
 
-	// GatewayIPv6 label to specify a network's IPv6 default gateway.
+	// GatewayIPv6 label to specify a network's IPv6 default gateway, and as a join option the container's own.
 	GatewayIPv6 = "l2bridge.ipv6.gateway"
+
+	// IfName join option to set the prefix of the interface name the container sees, eth by default. Docker names
+	// the interface by appending an index, as in eth0.
+	IfName = "l2bridge.ifname"
+
+	// ProxyNDP label to enable IPv6 neighbor discovery proxying on a network's bridge.
+	ProxyNDP = "l2bridge.proxy_ndp"
+
+	// DSCPMap label to specify a network's DSCP to skb priority mapping, as comma separated dscp:priority pairs.
+	DSCPMap = "l2bridge.dscp_map"
+
+	// AllowRejoin label to let an endpoint join a new sandbox while still joined to another.
+	AllowRejoin = "l2bridge.allow_rejoin"
+
+	// AllowOverlap label to let a network's pools overlap those of other networks, as for networks kept apart on
+	// separate VLANs or uplinks. Without it, on either network, overlapping pools are rejected.
+	AllowOverlap = "l2bridge.allow_overlap"
+
+	// StableGatewayMAC label to derive a network's bridge MAC address from its default gateway.
+	StableGatewayMAC = "l2bridge.stable_gateway_mac"
+
+	// IsolateHost label to drop traffic from a network's endpoints to the host itself.
+	IsolateHost = "l2bridge.isolate_host"
+
+	// IsolateHostAllow label to specify protocols (dhcp, nd) still permitted to the host on an isolated network.
+	IsolateHostAllow = "l2bridge.isolate_host.allow"
+
+	// DeriveULA label to derive an IPv6 unique local prefix from the network id when no IPv6 pool is given.
+	DeriveULA = "l2bridge.ipv6.ula"
+
+	// FlushConntrack label to flush conntrack entries of an endpoint's addresses when the endpoint is deleted.
+	FlushConntrack = "l2bridge.flush_conntrack"
+
+	// VLANStats label to enable per-VLAN, per-port traffic accounting on the bridge.
+	VLANStats = "l2bridge.vlan_stats"
+
+	// VLANStatsPrefix is the prefix of endpoint info keys carrying the per-VLAN counters of the endpoint's port.
+	VLANStatsPrefix = "l2bridge.vlan_stats."
+
+	// DisableGatewayService label to control whether Docker is kept from attaching its own gateway network, and with
+	// it a default route and NAT, to containers on the network. Defaults to true; disable it only when the driver is
+	// not expected to provide egress itself.
+	DisableGatewayService = "l2bridge.disable_gw_service"
+
+	// PortGroups label to define named port groups as a comma separated list of name=rate/ceil bandwidths.
+	PortGroups = "l2bridge.port_groups"
+
+	// PortGroup label to place an endpoint into one of the network's port groups.
+	PortGroup = "l2bridge.port_group"
+
+	// IPv6GatewayOnLink label to control whether the IPv6 gateway is given as an on-link default gateway, the default,
+	// or reached through explicit routes installed in the container.
+	IPv6GatewayOnLink = "l2bridge.v6_gw_onlink"
+
+	// Reserved label to list CIDRs and start-end ranges within the network's pools that are never given to endpoints.
+	Reserved = "l2bridge.reserved"
+
+	// Antispoof label to drop frames from an endpoint whose source MAC or IP address is not the endpoint's own.
+	Antispoof = "l2bridge.antispoof"
+
+	// IPv6GatewayAnycast label to control whether the IPv6 gateway may be the subnet-router anycast address, the
+	// network address of the pool. Defaults to true.
+	IPv6GatewayAnycast = "l2bridge.v6_gw_anycast"
+
+	// StaticFDB label to pin MAC addresses to ports already attached to the bridge, as a comma separated list of
+	// mac=port entries. A port is the uplink or an interface existing before the network; the ports of endpoints,
+	// created later, are pinned with EndpointFDB instead.
+	StaticFDB = "l2bridge.static_fdb"
+
+	// BUMRateLimit label to limit the broadcast and multicast traffic each endpoint may send, e.g. 10mbit.
+	BUMRateLimit = "l2bridge.bum_rate_limit"
+
+	// AssignGatewayToBridge label to control whether the bridge holds the IPAM gateway address. Defaults to true,
+	// unless host isolation is enabled; when false the bridge holds no address and only switches frames.
+	AssignGatewayToBridge = "l2bridge.assign_gateway_to_bridge"
+
+	// UseTempAddr label to set the IPv6 privacy extensions mode (0, 1 or 2) of the container interface.
+	UseTempAddr = "l2bridge.use_tempaddr"
+
+	// IPv6Forward label to let a network's bridge act as an IPv6 router, forwarding packets and accepting router
+	// advertisements. By default the bridge does neither, so that the host does not route on a switched segment.
+	IPv6Forward = "l2bridge.ip6_forward"
+
+	// IgnoreIPv6Disabled label to create the network with IPv4 only, rather than fail, when IPv6 is requested but
+	// disabled in the kernel.
+	IgnoreIPv6Disabled = "l2bridge.ignore_v6_if_disabled"
+
+	// Uplink label to attach an existing host interface, such as eth1 or bond0.100, to a network's bridge. The
+	// interface is detached again, and left in place, when the network is deleted.
+	Uplink = "l2bridge.uplink"
+
+	// Parent label is an alias of Uplink, after the parent option of the macvlan driver.
+	Parent = "l2bridge.parent"
+
+	// BondXmitHashPolicy label is rejected: the bond of an uplink is the host's, attached and released as it is, so
+	// its transmit hash policy is set on the host rather than by a network.
+	BondXmitHashPolicy = "l2bridge.bond_xmit_hash_policy"
+
+	// StealUplink label to detach a network's uplink from the bridge or bond it is already enslaved to before
+	// attaching it, rather than rejecting the network. This cuts the other device off from the uplink.
+	StealUplink = "l2bridge.steal_uplink"
+
+	// LogRequests label to control whether successful requests on the network are logged. Defaults to true; failed
+	// requests are always logged.
+	LogRequests = "l2bridge.log_requests"
+
+	// VLAN label to attach the network's uplink through a sub-interface tagged with this VLAN id, created as
+	// <uplink>.<vlan> unless it already exists.
+	VLAN = "l2bridge.vlan"
+
+	// UniqueUplinkMAC label to reject static endpoint MAC addresses already used on any network sharing an uplink
+	// with the network, rather than only within the network itself.
+	UniqueUplinkMAC = "l2bridge.unique_uplink_mac"
+
+	// MTU label to set the MTU of a network's bridge and endpoints, or on an endpoint to give it its own MTU, such as
+	// a jumbo MTU, rather than the network's.
+	MTU = "l2bridge.mtu"
+
+	// FDBMax label to limit the number of FDB entries a network's bridge learns, protecting host memory on very large
+	// segments. Requires Linux 6.8 or later; older kernels leave the FDB unbounded.
+	FDBMax = "l2bridge.fdb_max"
+
+	// Masquerade label to give a network's endpoints outbound access, masquerading their IPv4 addresses out of the
+	// interface of the host's default route.
+	Masquerade = "l2bridge.masquerade"
+
+	// STP label to enable the spanning tree protocol on a network's bridge, guarding against loops through its
+	// uplinks. Defaults to false, since ports of a bridge running STP only forward after the forwarding delay. As an
+	// endpoint info key it carries the bridge's effective STP state.
+	STP = "l2bridge.stp"
+
+	// Promisc label to put a network's bridge and uplink in promiscuous mode, for monitoring and SDN use. As an
+	// endpoint info key it carries the bridge's effective promiscuous mode.
+	Promisc = "l2bridge.promisc"
+
+	// Learning label to control whether the bridge ports of a network's endpoints, or of a single endpoint, learn
+	// source MAC addresses. Defaults to the kernel's, learning. As an endpoint info key it carries the port's
+	// effective setting.
+	Learning = "l2bridge.learning"
+
+	// LazyBridge label to create a network's bridge only once its first endpoint is created, and delete it again once
+	// its last endpoint leaves, sparing kernel resources on hosts with many networks defined but rarely used.
+	LazyBridge = "l2bridge.lazy_bridge"
+
+	// MSSClamp label to clamp the TCP MSS across the bridge to the smallest endpoint MTU while endpoints with
+	// differing MTUs share it.
+	MSSClamp = "l2bridge.mss_clamp"
+
+	// UplinkMSSClamp label to fit the traffic a network sends out of its uplink to the uplink's MTU, for networks
+	// whose bridge or endpoints use a jumbo MTU the hosts beyond the uplink do not. TCP handshakes have their MSS
+	// clamped, and IPv4 packets too large for the uplink that may not be fragmented are answered with ICMP
+	// fragmentation needed, so that path MTU discovery works for peers with a smaller MTU. Requires an uplink.
+	UplinkMSSClamp = "l2bridge.uplink_mss_clamp"
+
+	// DHCP label to lease the IPv4 address of each endpoint of a network, for which libnetwork provides none, from the
+	// DHCP server on the segment the network bridges, as with the null IPAM driver. The lease is renewed while the
+	// endpoint is joined, and released when it leaves.
+	DHCP = "l2bridge.dhcp"
+
+	// DHCPServer is the endpoint info key carrying the DHCP server the endpoint's address is leased from.
+	DHCPServer = "l2bridge.dhcp.server"
+
+	// DHCPDNS is the endpoint info key carrying the DNS servers offered with the endpoint's lease, comma separated.
+	DHCPDNS = "l2bridge.dhcp.dns"
+
+	// MaxConns label to drop new connections from an endpoint once it has this many connections tracked.
+	MaxConns = "l2bridge.max_conns"
+
+	// Bandwidth label to cap the traffic of an endpoint in each direction, e.g. 100mbit.
+	Bandwidth = "l2bridge.bandwidth"
+
+	// Peers label to restrict an endpoint to a comma separated list of peer endpoint ids and addresses. Bridged traffic
+	// between the endpoint and the network's other endpoints is dropped; traffic with the uplink and host is not.
+	Peers = "l2bridge.peers"
+
+	// EndpointFDB label to pin MAC addresses to ports of the bridge while an endpoint is joined, as a comma separated
+	// list of mac@port entries, for forwarding to known hosts behind an uplink without relying on learning.
+	EndpointFDB = "l2bridge.fdb"
+
+	// VerifyGateway label to check, once an endpoint has joined, that its container can resolve the gateway.
+	VerifyGateway = "l2bridge.verify_gw"
+
+	// GatewayReachable is the endpoint info key reporting the result of the gateway check: pending, reachable or
+	// unreachable.
+	GatewayReachable = "l2bridge.gw_reachable"
+
+	// VLANPVID is the endpoint info key carrying the untagged VLAN of the endpoint's bridge port.
+	VLANPVID = "l2bridge.vlan.pvid"
+
+	// VLANTagged is the endpoint info key carrying the tagged VLANs of the endpoint's bridge port, comma separated.
+	VLANTagged = "l2bridge.vlan.tagged"
+
+	// IPFamily label to select the address families (v4, v6 or dual) an endpoint is given on a dual-stack network.
+	IPFamily = "l2bridge.ip_family"
+
+	// HostIface is the endpoint info key carrying the name of the host side interface of the endpoint's veth pair.
+	HostIface = "l2bridge.host_iface"
+
+	// Bridge is the endpoint info key carrying the name of the bridge the endpoint's host interface is attached to.
+	Bridge = "l2bridge.bridge"
+
+	// SandboxKey is the endpoint info key carrying the sandbox the endpoint is joined to, if any.
+	SandboxKey = "l2bridge.sandbox_key"
+
+	// MACAddress is the endpoint info key carrying the MAC address of the endpoint's container interface.
+	MACAddress = "l2bridge.mac_address"
+
+	// IPv4Address is the endpoint info key carrying the IPv4 address of the endpoint, in CIDR notation.
+	IPv4Address = "l2bridge.ipv4_address"
+
+	// IPv6Address is the endpoint info key carrying the IPv6 address of the endpoint, in CIDR notation.
+	IPv6Address = "l2bridge.ipv6_address"
+
+	// NetworkVLANs is the endpoint info key listing the VLANs configured on the endpoint's bridge, comma separated.
+	NetworkVLANs = "l2bridge.network.vlans"
+
+	// NetworkDraining is the endpoint info key set when the endpoint's network is draining.
+	NetworkDraining = "l2bridge.network.draining"
+
+	// LastErrorPrefix is the prefix of endpoint info keys describing the endpoint's last failed operation.
+	LastErrorPrefix = "l2bridge.last_error"
+
+	// NetworkLastErrorPrefix is the prefix of endpoint info keys describing the network's last failed operation.
+	NetworkLastErrorPrefix = "l2bridge.network.last_error"
+
+	// ContainerSysctlPrefix is the prefix of endpoint labels naming network sysctls to set in the container.
+	ContainerSysctlPrefix = "l2bridge.container_sysctl."
+
+	// IPAMGateway IPAM option to give the address of a physical subnet's real gateway, reserved rather than handed
+	// out. Defaults to the first address of the subnet.
+	IPAMGateway = "l2bridge.ipam.gateway"
+
+	// IPAMProbeIface IPAM option to name the interface on a physical subnet through which an address is checked to be
+	// unused on the wire, with ARP, before being handed out. Probing is disabled when unset.
+	IPAMProbeIface = "l2bridge.ipam.probe_iface"
+
+	// MetaPrefix is the prefix of endpoint labels stored as opaque metadata on the endpoint.
+	MetaPrefix = "l2bridge.meta."
 )
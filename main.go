@@ -1,16 +1,93 @@
 package main
 
 import (
-	"github.com/docker/go-plugins-helpers/network"
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nategraf/l2bridge-driver/ipam"
 	"github.com/nategraf/l2bridge-driver/l2bridge"
+	"github.com/sirupsen/logrus"
 )
 
 const (
 	socketAddress = "/run/docker/plugins/l2bridge.sock"
+	// ipamSocketAddress is the socket of the companion IPAM driver. A plugin socket serves a single manifest, so the
+	// IPAM driver cannot share the network driver's, and is selected with --ipam-driver l2bridge-ipam.
+	ipamSocketAddress = "/run/docker/plugins/l2bridge-ipam.sock"
+	// shutdownTimeout bounds the shutdown on SIGTERM or SIGINT, which may have to delete every network.
+	shutdownTimeout = 2 * time.Minute
 )
 
 func main() {
-	d := l2bridge.NewDriver()
-	h := network.NewHandler(d)
-	h.ServeUnix(socketAddress, 0)
+	config := l2bridge.DefaultConfiguration()
+	flag.StringVar(&config.DebugAddress, "debug-addr", "", "TCP address to serve debug endpoints on, disabled if empty")
+	flag.StringVar(&config.MetricsAddress, "metrics-addr", "", "TCP address to serve Prometheus metrics and the /health check on, disabled if empty")
+	flag.StringVar(&config.IPAMURL, "ipam-url", "", "HTTP service to request endpoint addresses from when none is provided")
+	flag.DurationVar(&config.IPAMTimeout, "ipam-timeout", config.IPAMTimeout, "How long to wait for the IPAM service to assign an address")
+	flag.DurationVar(&config.TeardownTimeout, "teardown-timeout", config.TeardownTimeout, "How long to wait for the bridge of a deleted network to disappear before recreating it")
+	flag.BoolVar(&config.VerifyTeardown, "verify-teardown", config.VerifyTeardown, "Check that endpoint objects are gone after teardown and count leftovers as leaks")
+	flag.BoolVar(&config.AutoLoadModules, "auto-load-modules", false, "Load missing kernel modules needed by the driver with modprobe")
+	flag.StringVar(&config.StateDumpPath, "state-dump-path", "", "File to write the driver state to on SIGUSR2, the log if empty")
+	flag.DurationVar(&config.ReapGracePeriod, "reap-grace", 0, "How long an endpoint's interface and sandbox must be gone before it is deleted and its addresses freed, disabled if zero")
+	flag.StringVar(&config.DataRoot, "data-root", config.DataRoot, "Directory to persist networks and endpoints under across restarts, disabled if empty")
+	flag.BoolVar(&config.NoCleanup, "no-cleanup", config.NoCleanup, "Only log the orphaned bridges, veths and FDB entries found on startup and by reconciliation, deleting nothing")
+	flag.BoolVar(&config.WarmRestart, "warm-restart", config.WarmRestart, "Reinstall missing ports, addresses and rules of restored endpoints on startup")
+	flag.BoolVar(&config.GlobalScope, "global-scope", config.GlobalScope, "Advertise the global scope, for swarm managers to allocate networks created with --scope swarm")
+	flag.BoolVar(&config.DryRun, "dry-run", config.DryRun, "Validate and answer requests without changing the host or persisting state")
+	flag.DurationVar(&config.OperationTimeout, "op-timeout", config.OperationTimeout, "How long a network or endpoint request may take before it fails with a timeout, unbounded if zero")
+	flag.StringVar(&config.FlowLogPath, "flow-log", "", "File to append records of the ended flows of NATed endpoints to, - for stdout, disabled if empty")
+	flag.UintVar(&config.FlowLogSampleRate, "flow-log-sample", 1, "Record one in every this many ended flows in the flow log")
+	flag.StringVar(&config.LogFormat, "log-format", envOr("L2BRIDGE_LOG_FORMAT", config.LogFormat), "Log format, text or json, defaulting to $L2BRIDGE_LOG_FORMAT")
+	serveIPAM := flag.Bool("ipam", false, "Also serve the l2bridge-ipam IPAM driver, handing out addresses of physical subnets")
+	shutdownMode := flag.String("shutdown-mode", string(config.ShutdownMode), "What to do with networks on SIGTERM: leave them in place, or purge everything the driver created")
+	transientErrnos := flag.String("transient-errnos", l2bridge.FormatErrnos(config.TransientErrnos), "Host errors, by errno name, failing a request with a retryable error rather than an internal one")
+	flag.Parse()
+	config.ShutdownMode = l2bridge.ShutdownMode(*shutdownMode)
+	errnos, err := l2bridge.ParseErrnos(*transientErrnos)
+	if err != nil {
+		logrus.Fatalf("Invalid -transient-errnos: %v", err)
+	}
+	config.TransientErrnos = errnos
+
+	d := l2bridge.NewDriver(config)
+	if *serveIPAM {
+		dataRoot := config.DataRoot
+		if config.DryRun {
+			dataRoot = ""
+		}
+		ipamDriver := ipam.NewDriver(dataRoot)
+		d.UseIPAM(ipamDriver)
+		go func() {
+			if err := ipamDriver.Serve(ipamSocketAddress); err != nil {
+				logrus.WithError(err).Fatal("IPAM driver failed")
+			}
+		}()
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigs
+		logrus.Infof("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := d.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Fatal("Shutdown failed")
+		}
+		os.Exit(0)
+	}()
+	if err := d.Serve(socketAddress); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// envOr returns the value of the environment variable, or def if it is unset or empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
 }